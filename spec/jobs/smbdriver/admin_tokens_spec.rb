@@ -0,0 +1,42 @@
+require 'rspec'
+require 'json'
+require 'bosh/template/test'
+
+describe 'smbdriver job' do
+  let(:release) {Bosh::Template::Test::ReleaseDir.new(File.join(File.dirname(__FILE__), '../../..'))}
+  let(:job) {release.job('smbdriver')}
+
+  describe 'admin_tokens.json' do
+    let(:template) {job.template('config/admin_tokens.json')}
+
+    context 'when configured with admin tokens' do
+      let(:manifest_properties) do
+        {
+            "admin" => {
+                "tokens" => [
+                    {"name" => "monitoring", "token" => "some-token", "access" => "read"}
+                ]
+            },
+        }
+      end
+
+      it 'renders the tokens' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq([
+            {"name" => "monitoring", "token" => "some-token", "access" => "read"}
+        ])
+      end
+    end
+
+    context 'when not configured with admin tokens' do
+      let(:manifest_properties) {}
+
+      it 'renders no tokens' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq([])
+      end
+    end
+  end
+end
@@ -11,14 +11,139 @@ describe 'smbdriver job' do
     context 'when configured with an admin port' do
       let(:manifest_properties) do
         {
-            "admin_port" => "1111",
+            "adminPort" => 1111,
         }
       end
 
-      it 'renders successfully' do
+      it 'drains through the admin port' do
         tpl_output = template.render(manifest_properties)
 
-        expect(tpl_output).not_to include("ADMIN_PORT=1111")
+        expect(tpl_output).to include("/var/vcap/packages/smbdriver/bin/smbdriverctl")
+        expect(tpl_output).to include("--adminUrl=http://127.0.0.1:1111")
+        expect(tpl_output).to include("--pidFile=/var/vcap/sys/run/smbdriver/smbdriver.pid")
+      end
+    end
+
+    context 'when the admin API is served with mutual TLS' do
+      let(:manifest_properties) do
+        {
+            "admin" => {
+                "tls" => {
+                    "ca_cert" => "some-admin-ca-cert"
+                }
+            },
+        }
+      end
+
+      it 'evacuates with the admin client certificate' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("--adminUrl=https://127.0.0.1:8590")
+        expect(tpl_output).to include("--adminCaFile=$ADMIN_CERTS_DIR/ca.crt")
+        expect(tpl_output).to include("--adminCertFile=$ADMIN_CERTS_DIR/client.crt")
+        expect(tpl_output).to include("--adminKeyFile=$ADMIN_CERTS_DIR/client.key")
+      end
+    end
+
+    context 'when the admin API requires tokens' do
+      let(:manifest_properties) do
+        {
+            "admin" => {
+                "tokens" => [
+                    {"name" => "monitoring", "token" => "some-read-token", "access" => "read"},
+                    {"name" => "drain", "token" => "some-write-token", "access" => "write"}
+                ]
+            },
+        }
+      end
+
+      it 'evacuates with the tokens from the token file' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("--adminTokenFile=/var/vcap/jobs/smbdriver/config/admin_tokens.json")
+        expect(tpl_output).not_to include("some-write-token")
+      end
+    end
+
+    context 'when the admin API is not authenticated' do
+      let(:manifest_properties) {}
+
+      it 'evacuates over http' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("--adminUrl=http://127.0.0.1:8590")
+        expect(tpl_output).not_to include("--adminTokenFile")
+        expect(tpl_output).not_to include("--adminCaFile")
+      end
+    end
+
+    context 'when configured with personalities' do
+      let(:manifest_properties) do
+        {
+            "driver_path" => "/some/driver/path",
+            "personalities" => {
+                "smbdriver-legacy" => {
+                    "listen_port" => 8592
+                }
+            },
+        }
+      end
+
+      it 'removes the spec files of the personalities before evacuating' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("SPEC_FILES=\"/some/driver/path/smbdriver.json,/some/driver/path/smbdriver-legacy.json\"")
+        expect(tpl_output).to include("--specFiles=\"$SPEC_FILES\"")
+      end
+    end
+
+    context 'when configured with the unix transport' do
+      let(:manifest_properties) do
+        {
+            "driver_path" => "/some/driver/path",
+            "transport" => "unix",
+        }
+      end
+
+      it 'removes the socket spec file before evacuating' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("SPEC_FILES=\"/some/driver/path/smbdriver.sock\"")
+      end
+    end
+
+    context 'when configured with the tcp transport' do
+      let(:manifest_properties) do
+        {
+            "driver_path" => "/some/driver/path",
+            "transport" => "tcp",
+            "personalities" => {
+                "smbdriver-legacy" => {
+                    "listen_port" => 8592
+                }
+            },
+        }
+      end
+
+      it 'removes the .spec files before evacuating' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("SPEC_FILES=\"/some/driver/path/smbdriver.spec,/some/driver/path/smbdriver-legacy.spec\"")
+      end
+    end
+
+    context 'when configured with the csi transport' do
+      let(:manifest_properties) do
+        {
+            "driver_path" => "/some/driver/path",
+            "transport" => "csi",
+        }
+      end
+
+      it 'has no spec files to remove' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("SPEC_FILES=\"\"")
       end
     end
   end
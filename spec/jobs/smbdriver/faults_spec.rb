@@ -0,0 +1,45 @@
+require 'rspec'
+require 'json'
+require 'bosh/template/test'
+
+describe 'smbdriver job' do
+  let(:release) {Bosh::Template::Test::ReleaseDir.new(File.join(File.dirname(__FILE__), '../../..'))}
+  let(:job) {release.job('smbdriver')}
+
+  describe 'faults.json' do
+    let(:template) {job.template('config/faults.json')}
+
+    context 'when configured with faults' do
+      let(:manifest_properties) do
+        {
+            "fault_injection" => {
+                "enabled" => true,
+                "faults" => [
+                    {"operation" => "mount", "host" => "fileserver", "errno" => 113},
+                    {"operation" => "unmount", "volume" => "vol1", "hang" => "2m"}
+                ]
+            },
+        }
+      end
+
+      it 'renders the faults' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq([
+            {"operation" => "mount", "host" => "fileserver", "errno" => 113},
+            {"operation" => "unmount", "volume" => "vol1", "hang" => "2m"}
+        ])
+      end
+    end
+
+    context 'when not configured with faults' do
+      let(:manifest_properties) {}
+
+      it 'renders no faults' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq([])
+      end
+    end
+  end
+end
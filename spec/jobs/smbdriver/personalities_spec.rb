@@ -0,0 +1,56 @@
+require 'rspec'
+require 'json'
+require 'bosh/template/test'
+
+describe 'smbdriver job' do
+  let(:release) {Bosh::Template::Test::ReleaseDir.new(File.join(File.dirname(__FILE__), '../../..'))}
+  let(:job) {release.job('smbdriver')}
+
+  describe 'personalities.json' do
+    let(:template) {job.template('config/personalities.json')}
+
+    context 'when configured with personalities' do
+      let(:manifest_properties) do
+        {
+            "personalities" => {
+                "smbdriver-legacy" => {
+                    "listen_port" => 8592,
+                    "force_nodfs" => true,
+                    "allowed_in_mount" => ["mfsymlinks"],
+                    "default_in_mount" => {
+                        "vers" => 2.1,
+                        "nodfs" => true
+                    }
+                },
+            },
+        }
+      end
+
+      it 'renders the default mount option values as strings' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq({
+            "smbdriver-legacy" => {
+                "listen_port" => 8592,
+                "force_nodfs" => true,
+                "allowed_in_mount" => ["mfsymlinks"],
+                "default_in_mount" => {
+                    "vers" => "2.1",
+                    "nodfs" => "true"
+                }
+            }
+        })
+      end
+    end
+
+    context 'when not configured with personalities' do
+      let(:manifest_properties) {}
+
+      it 'renders no personalities' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq({})
+      end
+    end
+  end
+end
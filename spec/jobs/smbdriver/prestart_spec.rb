@@ -19,6 +19,38 @@ describe 'smbdriver job' do
       end
     end
 
+    context 'when configured with SID mappings' do
+      let(:manifest_properties) do
+        {
+            "sid_mappings" => {
+                "users" => {
+                    "S-1-5-21-1-2-3-1001" => 2000
+                }
+            },
+        }
+      end
+
+      it 'installs the cifs.idmap upcall' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("create cifs.idmap * * /var/vcap/packages/smbdriver/bin/smbidmap --sidMappings=/var/vcap/jobs/smbdriver/config/sid_mappings.json %k")
+        expect(tpl_output).not_to include("rm -f /etc/request-key.d/cifs.idmap.conf")
+      end
+    end
+
+    context 'when not configured with SID mappings' do
+      let(:manifest_properties) do
+        {}
+      end
+
+      it 'removes the cifs.idmap upcall' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(tpl_output).to include("rm -f /etc/request-key.d/cifs.idmap.conf")
+        expect(tpl_output).not_to include("create cifs.idmap")
+      end
+    end
+
     context 'when the smbdriver is disabled' do
       let(:manifest_properties) do
         {
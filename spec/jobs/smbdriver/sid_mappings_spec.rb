@@ -0,0 +1,46 @@
+require 'rspec'
+require 'json'
+require 'bosh/template/test'
+
+describe 'smbdriver job' do
+  let(:release) {Bosh::Template::Test::ReleaseDir.new(File.join(File.dirname(__FILE__), '../../..'))}
+  let(:job) {release.job('smbdriver')}
+
+  describe 'sid_mappings.json' do
+    let(:template) {job.template('config/sid_mappings.json')}
+
+    context 'when configured with SID mappings' do
+      let(:manifest_properties) do
+        {
+            "sid_mappings" => {
+                "users" => {
+                    "S-1-5-21-1-2-3-1001" => 2000
+                },
+                "groups" => {
+                    "S-1-5-21-1-2-3-513" => 2000
+                }
+            },
+        }
+      end
+
+      it 'renders the mappings' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq({
+            "users" => {"S-1-5-21-1-2-3-1001" => 2000},
+            "groups" => {"S-1-5-21-1-2-3-513" => 2000}
+        })
+      end
+    end
+
+    context 'when not configured with SID mappings' do
+      let(:manifest_properties) {}
+
+      it 'renders empty mappings' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq({"users" => {}, "groups" => {}})
+      end
+    end
+  end
+end
@@ -29,6 +29,27 @@ describe 'smbdriver job' do
             },
             "force_noserverino" => true,
             "force_nodfs" => true,
+            "resolve_dfs" => true,
+            "mounter" => "fuse",
+            "preflight" => true,
+            "dry_run" => true,
+            "circuit_breaker" => {
+                "failure_threshold" => 5,
+                "cool_down_seconds" => 60
+            },
+            "capacity" => {
+                "check_interval_seconds" => 300,
+                "warning_percent" => 80,
+                "inode_warning_percent" => 95
+            },
+            "cifs_stats" => {
+                "check_interval_seconds" => 30
+            },
+            "security_policy" => {
+                "require_encryption" => true,
+                "minimum_smb_version" => "3.1.1",
+                "servers" => ["*.secure.example.com", "10.0.0.*"]
+            },
         }
       end
 
@@ -50,6 +71,22 @@ describe 'smbdriver job' do
         expect(tpl_output).to include("--insecureSkipVerify")
         expect(tpl_output).to include("--forceNoserverino=true")
         expect(tpl_output).to include("--forceNoDfs=true")
+        expect(tpl_output).to include("--resolveDfs=true")
+        expect(tpl_output).to include("--mounter=\"fuse\"")
+        expect(tpl_output).to include("--preflight=true")
+        expect(tpl_output).to include("--dryRun=true")
+        expect(tpl_output).to include("--circuitBreakerThreshold=5")
+        expect(tpl_output).to include("--circuitBreakerCoolDown=60s")
+        expect(tpl_output).to include("--capacityCheckInterval=300s")
+        expect(tpl_output).to include("--capacityWarningPercent=80")
+        expect(tpl_output).to include("--capacityInodeWarningPercent=95")
+        expect(tpl_output).to include("--cifsStatsInterval=30s")
+        expect(tpl_output).to include("--requireEncryption=true")
+        expect(tpl_output).to include("--minimumSmbVersion=\"3.1.1\"")
+        expect(tpl_output).to include("--securityPolicyServers=\"*.secure.example.com,10.0.0.*\"")
+        expect(tpl_output).to include("--tuningProfiles=\"/var/vcap/jobs/smbdriver/config/tuning_profiles.json\"")
+        expect(tpl_output).to include("--sidMappings=\"/var/vcap/jobs/smbdriver/config/sid_mappings.json\"")
+        expect(tpl_output).to include("--personalities=\"/var/vcap/jobs/smbdriver/config/personalities.json\"")
       end
     end
 
@@ -125,5 +162,224 @@ describe 'smbdriver job' do
         expect(tpl_output).to include("--forceNoDfs=false")
       end
     end
+
+    context 'when not configured with resolve_dfs' do
+      let(:manifest_properties) {}
+
+      it 'defaults resolve_dfs to false' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--resolveDfs=false")
+      end
+    end
+
+    context 'when not configured with a mounter' do
+      let(:manifest_properties) {}
+
+      it 'picks the mounter automatically' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--mounter=\"auto\"")
+      end
+    end
+
+    context 'when not configured with preflight' do
+      let(:manifest_properties) {}
+
+      it 'defaults preflight to false' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--preflight=false")
+      end
+    end
+
+    context 'when not configured with dry_run' do
+      let(:manifest_properties) {}
+
+      it 'mounts the shares' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--dryRun=false")
+      end
+    end
+
+    context 'when not configured with a circuit breaker' do
+      let(:manifest_properties) {}
+
+      it 'disables the circuit breaker' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--circuitBreakerThreshold=0")
+        expect(tpl_output).to include("--circuitBreakerCoolDown=30s")
+      end
+    end
+
+    context 'when not configured with capacity checks' do
+      let(:manifest_properties) {}
+
+      it 'checks every minute and warns at 90 percent' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--capacityCheckInterval=60s")
+        expect(tpl_output).to include("--capacityWarningPercent=90")
+        expect(tpl_output).to include("--capacityInodeWarningPercent=90")
+      end
+    end
+
+    context 'when not configured with a CIFS statistics interval' do
+      let(:manifest_properties) {}
+
+      it 'reads the statistics every minute' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--cifsStatsInterval=60s")
+      end
+    end
+
+    context 'when not configured with a transport' do
+      let(:manifest_properties) {}
+
+      it 'serves json over tcp' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--transport=\"tcp-json\"")
+        expect(tpl_output).not_to include("--socketPath")
+      end
+    end
+
+    context 'when configured with the unix transport' do
+      let(:manifest_properties) do
+        {
+            "driver_path" => "/some/driver/path",
+            "transport" => "unix",
+            "unix_socket" => {
+                "path" => "/some/run/smbdriver.sock",
+                "owner" => "vcap",
+                "group" => "docker",
+                "mode" => "0600"
+            },
+        }
+      end
+
+      it 'serves on the configured socket' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--transport=\"unix\"")
+        expect(tpl_output).to include("--socketPath=\"/some/run/smbdriver.sock\"")
+        expect(tpl_output).to include("--socketOwner=\"vcap\"")
+        expect(tpl_output).to include("--socketGroup=\"docker\"")
+        expect(tpl_output).to include("--socketMode=\"0600\"")
+        expect(tpl_output).to include("rm -f \"/some/driver/path\"/smbdriver.sock")
+      end
+    end
+
+    context 'when configured with an authenticated admin API' do
+      let(:manifest_properties) do
+        {
+            "admin" => {
+                "tls" => {
+                    "ca_cert" => "some-admin-ca-cert",
+                    "write_common_names" => ["smbdriver-drain", "operator"]
+                },
+                "tokens" => [
+                    {"name" => "monitoring", "token" => "some-token", "access" => "read"}
+                ]
+            },
+        }
+      end
+
+      it 'serves the admin API with mutual TLS and tokens' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--adminCaFile=\"/var/vcap/jobs/smbdriver/config/certs/admin/ca.crt\"")
+        expect(tpl_output).to include("--adminCertFile=\"/var/vcap/jobs/smbdriver/config/certs/admin/server.crt\"")
+        expect(tpl_output).to include("--adminKeyFile=\"/var/vcap/jobs/smbdriver/config/certs/admin/server.key\"")
+        expect(tpl_output).to include("--adminWriteCommonNames=\"smbdriver-drain,operator\"")
+        expect(tpl_output).to include("--adminTokenFile=\"/var/vcap/jobs/smbdriver/config/admin_tokens.json\"")
+      end
+    end
+
+    context 'when not configured with an authenticated admin API' do
+      let(:manifest_properties) {}
+
+      it 'serves the admin API without authentication' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).not_to include("--adminCaFile")
+        expect(tpl_output).not_to include("--adminTokenFile")
+      end
+    end
+
+    context 'when configured with personalities' do
+      let(:manifest_properties) do
+        {
+            "driver_path" => "/some/driver/path",
+            "personalities" => {
+                "smbdriver-legacy" => {
+                    "listen_port" => 8592
+                }
+            },
+        }
+      end
+
+      it 'removes the spec files of the personalities when stopping' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("rm -f \"/some/driver/path\"/smbdriver-legacy.json")
+        expect(tpl_output).to include("\"/some/driver/path\"/smbdriver-legacy.spec")
+        expect(tpl_output).to include("rm -f \"/some/driver/path\"/smbdriver.spec")
+      end
+    end
+
+    context 'when configured with tracing' do
+      let(:manifest_properties) do
+        {
+            "tracing" => {
+                "exporter" => "zipkin",
+                "endpoint" => "http://zipkin.example.com:9411/api/v2/spans",
+                "sample_rate" => 0.1
+            },
+        }
+      end
+
+      it 'exports the spans to the endpoint' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--traceExporter=\"zipkin\"")
+        expect(tpl_output).to include("--traceEndpoint=\"http://zipkin.example.com:9411/api/v2/spans\"")
+        expect(tpl_output).to include("--traceSampleRate=0.1")
+      end
+    end
+
+    context 'when not configured with tracing' do
+      let(:manifest_properties) {}
+
+      it 'records no spans' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).not_to include("--traceExporter")
+      end
+    end
+
+    context 'when configured with fault injection' do
+      let(:manifest_properties) do
+        {
+            "fault_injection" => {
+                "enabled" => true
+            },
+        }
+      end
+
+      it 'injects the faults in faults.json' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--faultInjectionFile=\"/var/vcap/jobs/smbdriver/config/faults.json\"")
+      end
+    end
+
+    context 'when not configured with fault injection' do
+      let(:manifest_properties) {}
+
+      it 'injects no faults' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).not_to include("--faultInjectionFile")
+      end
+    end
+
+    context 'when not configured with a security policy' do
+      let(:manifest_properties) {}
+
+      it 'does not enforce encryption or a minimum SMB version' do
+        tpl_output = template.render(manifest_properties)
+        expect(tpl_output).to include("--requireEncryption=false")
+        expect(tpl_output).to include("--minimumSmbVersion=\"\"")
+        expect(tpl_output).to include("--securityPolicyServers=\"\"")
+      end
+    end
   end
 end
@@ -0,0 +1,48 @@
+require 'rspec'
+require 'json'
+require 'bosh/template/test'
+
+describe 'smbdriver job' do
+  let(:release) {Bosh::Template::Test::ReleaseDir.new(File.join(File.dirname(__FILE__), '../../..'))}
+  let(:job) {release.job('smbdriver')}
+
+  describe 'tuning_profiles.json' do
+    let(:template) {job.template('config/tuning_profiles.json')}
+
+    context 'when configured with tuning profiles' do
+      let(:manifest_properties) do
+        {
+            "tuning_profiles" => {
+                "bulk-read" => {
+                    "cache" => "loose",
+                    "rsize" => 4194304,
+                    "nobrl" => true
+                },
+            },
+        }
+      end
+
+      it 'renders every option value as a string' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq({
+            "bulk-read" => {
+                "cache" => "loose",
+                "rsize" => "4194304",
+                "nobrl" => "true"
+            }
+        })
+      end
+    end
+
+    context 'when not configured with tuning profiles' do
+      let(:manifest_properties) {}
+
+      it 'renders an empty object' do
+        tpl_output = template.render(manifest_properties)
+
+        expect(JSON.parse(tpl_output)).to eq({})
+      end
+    end
+  end
+end
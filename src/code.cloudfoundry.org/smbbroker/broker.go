@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"code.cloudfoundry.org/smbdriver/smbsnapshot"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	"github.com/pivotal-cf/brokerapi/v11/domain"
+	"github.com/pivotal-cf/brokerapi/v11/domain/apiresponses"
+)
+
+const (
+	shareKey    = "share"
+	readonlyKey = "readonly"
+	versionKey  = "version"
+	posixKey    = "posix"
+)
+
+// InstanceStore looks up the parameters that service instances were
+// provisioned with.
+type InstanceStore interface {
+	RetrieveInstanceDetails(id string) (brokerstore.ServiceInstance, error)
+}
+
+// smbBroker adds the SMB specific handling of provision and bind parameters
+// on top of the generic existing volume broker, and mounts the bindings of
+// plans with the driver that planDrivers maps them to.
+type smbBroker struct {
+	domain.ServiceBroker
+	logger      lager.Logger
+	store       InstanceStore
+	planDrivers map[string]string
+}
+
+func NewSmbBroker(logger lager.Logger, broker domain.ServiceBroker, store InstanceStore, planDrivers map[string]string) domain.ServiceBroker {
+	return &smbBroker{ServiceBroker: broker, logger: logger, store: store, planDrivers: planDrivers}
+}
+
+func (b *smbBroker) Provision(ctx context.Context, instanceID string, details domain.ProvisionDetails, asyncAllowed bool) (domain.ProvisionedServiceSpec, error) {
+	logger := b.logger.Session("smb-provision").WithData(lager.Data{"instanceID": instanceID})
+
+	var parameters map[string]json.RawMessage
+	if err := json.Unmarshal(details.RawParameters, &parameters); err != nil {
+		return b.ServiceBroker.Provision(ctx, instanceID, details, asyncAllowed)
+	}
+
+	if _, ok := parameters[smbsnapshot.Key]; ok {
+		err := errors.New("snapshot can only be given when binding the service")
+		logger.Info("invalid-snapshot", lager.Data{"error": err.Error()})
+		return domain.ProvisionedServiceSpec{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-snapshot")
+	}
+
+	// The version may still be given when binding.
+	if err := checkPosixVersion(decodeParameters(parameters), false); err != nil {
+		logger.Info("invalid-posix", lager.Data{"error": err.Error()})
+		return domain.ProvisionedServiceSpec{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-posix")
+	}
+
+	if raw, ok := parameters[smbsource.AlternatesKey]; ok {
+		var err error
+		if parameters[smbsource.AlternatesKey], err = normalizeAlternates(raw); err != nil {
+			logger.Info("invalid-alternate-shares", lager.Data{"error": err.Error()})
+			return domain.ProvisionedServiceSpec{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-alternate-shares")
+		}
+
+		if details.RawParameters, err = json.Marshal(parameters); err != nil {
+			return domain.ProvisionedServiceSpec{}, err
+		}
+	}
+
+	var share string
+	if err := json.Unmarshal(parameters[shareKey], &share); err != nil || share == "" {
+		return b.ServiceBroker.Provision(ctx, instanceID, details, asyncAllowed)
+	}
+
+	source, err := smbsource.Parse(share)
+	if err != nil {
+		logger.Info("invalid-share", lager.Data{"share": share, "error": err.Error()})
+		return domain.ProvisionedServiceSpec{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-share")
+	}
+
+	if source.String() != share {
+		logger.Info("normalized-share", lager.Data{"share": share, "normalized": source.String()})
+	}
+
+	if parameters[shareKey], err = json.Marshal(source.String()); err != nil {
+		return domain.ProvisionedServiceSpec{}, err
+	}
+
+	if details.RawParameters, err = json.Marshal(parameters); err != nil {
+		return domain.ProvisionedServiceSpec{}, err
+	}
+
+	return b.ServiceBroker.Provision(ctx, instanceID, details, asyncAllowed)
+}
+
+// Bind mounts snapshots read-only, both in the container and on the cell, and
+// normalizes alternate shares like Provision does.
+func (b *smbBroker) Bind(ctx context.Context, instanceID, bindingID string, details domain.BindDetails, asyncAllowed bool) (domain.Binding, error) {
+	binding, err := b.bind(ctx, instanceID, bindingID, details, asyncAllowed)
+	if err != nil {
+		return binding, err
+	}
+
+	if driver, ok := b.planDrivers[details.PlanID]; ok {
+		b.logger.Session("smb-bind").Debug("plan-driver", lager.Data{"instanceID": instanceID, "bindingID": bindingID, "driver": driver})
+		for i := range binding.VolumeMounts {
+			binding.VolumeMounts[i].Driver = driver
+		}
+	}
+
+	return binding, nil
+}
+
+func (b *smbBroker) bind(ctx context.Context, instanceID, bindingID string, details domain.BindDetails, asyncAllowed bool) (domain.Binding, error) {
+	var parameters map[string]json.RawMessage
+	if err := json.Unmarshal(details.RawParameters, &parameters); err != nil {
+		return b.ServiceBroker.Bind(ctx, instanceID, bindingID, details, asyncAllowed)
+	}
+
+	if err := checkPosixVersion(b.bindOptions(instanceID, parameters), true); err != nil {
+		b.logger.Session("smb-bind").Info("invalid-posix", lager.Data{"instanceID": instanceID, "bindingID": bindingID, "error": err.Error()})
+		return domain.Binding{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-posix")
+	}
+
+	if raw, ok := parameters[smbsource.AlternatesKey]; ok {
+		var err error
+		if parameters[smbsource.AlternatesKey], err = normalizeAlternates(raw); err != nil {
+			b.logger.Session("smb-bind").Info("invalid-alternate-shares", lager.Data{"instanceID": instanceID, "bindingID": bindingID, "error": err.Error()})
+			return domain.Binding{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-alternate-shares")
+		}
+
+		if details.RawParameters, err = json.Marshal(parameters); err != nil {
+			return domain.Binding{}, err
+		}
+	}
+
+	if _, ok := parameters[smbsnapshot.Key]; !ok {
+		return b.ServiceBroker.Bind(ctx, instanceID, bindingID, details, asyncAllowed)
+	}
+
+	if raw, ok := parameters[readonlyKey]; ok {
+		var readonly interface{}
+		_ = json.Unmarshal(raw, &readonly)
+		if fmt.Sprintf("%v", readonly) != "true" {
+			err := errors.New("snapshot can only be bound read-only")
+			b.logger.Session("smb-bind").Info("invalid-snapshot", lager.Data{"instanceID": instanceID, "bindingID": bindingID, "error": err.Error()})
+			return domain.Binding{}, apiresponses.NewFailureResponse(err, http.StatusBadRequest, "invalid-snapshot")
+		}
+	}
+
+	b.logger.Session("smb-bind").Info("forcing-readonly-snapshot", lager.Data{"instanceID": instanceID, "bindingID": bindingID})
+	parameters[readonlyKey] = json.RawMessage("true")
+
+	var err error
+	if details.RawParameters, err = json.Marshal(parameters); err != nil {
+		return domain.Binding{}, err
+	}
+
+	return b.ServiceBroker.Bind(ctx, instanceID, bindingID, details, asyncAllowed)
+}
+
+// bindOptions returns the options that a binding is mounted with: the
+// parameters its instance was provisioned with, overridden by its own.
+func (b *smbBroker) bindOptions(instanceID string, parameters map[string]json.RawMessage) map[string]interface{} {
+	options := map[string]interface{}{}
+	if instance, err := b.store.RetrieveInstanceDetails(instanceID); err == nil {
+		if fingerprint, ok := instance.ServiceFingerPrint.(map[string]interface{}); ok {
+			for key, value := range fingerprint {
+				options[key] = value
+			}
+		}
+	}
+
+	for key, value := range decodeParameters(parameters) {
+		options[key] = value
+	}
+	return options
+}
+
+// checkPosixVersion checks that options which ask for posix give version
+// 3.1.1. A missing version is only an error when versionRequired is set.
+func checkPosixVersion(options map[string]interface{}, versionRequired bool) error {
+	posix := options[posixKey]
+	if posix == nil {
+		return nil
+	}
+
+	version := options[versionKey]
+	if version == nil {
+		if !versionRequired {
+			return nil
+		}
+		version = ""
+	}
+
+	return validatePosixVersion(fmt.Sprintf("%v", posix), fmt.Sprintf("%v", version))
+}
+
+// decodeParameters decodes raw parameters, keeping numbers as they were
+// given so that a version such as 3.0 is not read as 3.
+func decodeParameters(parameters map[string]json.RawMessage) map[string]interface{} {
+	decoded := map[string]interface{}{}
+	for key, raw := range parameters {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+
+		var value interface{}
+		if err := decoder.Decode(&value); err == nil {
+			decoded[key] = value
+		}
+	}
+	return decoded
+}
+
+// normalizeAlternates accepts alternate shares either as a list or as a comma
+// separated string, and stores them as a comma separated string of canonical
+// shares, the form mount options are passed to the driver in.
+func normalizeAlternates(raw json.RawMessage) (json.RawMessage, error) {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var joined string
+		if err := json.Unmarshal(raw, &joined); err != nil {
+			return nil, errors.New("alternate_shares must be a list of shares or a comma separated string")
+		}
+		list = []string{joined}
+	}
+
+	sources := []smbsource.Source{}
+	for _, item := range list {
+		parsed, err := smbsource.ParseList(item)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, parsed...)
+	}
+
+	if len(sources) == 0 {
+		return nil, errors.New("alternate_shares must not be empty")
+	}
+
+	return json.Marshal(smbsource.JoinList(sources))
+}
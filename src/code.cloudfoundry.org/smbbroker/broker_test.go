@@ -0,0 +1,430 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	. "code.cloudfoundry.org/smbbroker"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/brokerapi/v11/domain"
+	"github.com/pivotal-cf/brokerapi/v11/domain/apiresponses"
+)
+
+type fakeServiceBroker struct {
+	domain.ServiceBroker
+
+	provisionCallCount int
+	provisionDetails   domain.ProvisionDetails
+
+	bindCallCount int
+	bindDetails   domain.BindDetails
+	bindResponse  domain.Binding
+}
+
+func (f *fakeServiceBroker) Provision(_ context.Context, _ string, details domain.ProvisionDetails, _ bool) (domain.ProvisionedServiceSpec, error) {
+	f.provisionCallCount++
+	f.provisionDetails = details
+	return domain.ProvisionedServiceSpec{}, nil
+}
+
+func (f *fakeServiceBroker) Bind(_ context.Context, _, _ string, details domain.BindDetails, _ bool) (domain.Binding, error) {
+	f.bindCallCount++
+	f.bindDetails = details
+	return f.bindResponse, nil
+}
+
+type fakeInstanceStore struct {
+	instances map[string]brokerstore.ServiceInstance
+}
+
+func (f *fakeInstanceStore) RetrieveInstanceDetails(id string) (brokerstore.ServiceInstance, error) {
+	instance, ok := f.instances[id]
+	if !ok {
+		return brokerstore.ServiceInstance{}, errors.New("instance not found")
+	}
+	return instance, nil
+}
+
+var _ = Describe("SmbBroker", func() {
+	var (
+		inner   *fakeServiceBroker
+		subject domain.ServiceBroker
+	)
+
+	BeforeEach(func() {
+		inner = &fakeServiceBroker{}
+		subject = NewSmbBroker(lagertest.NewTestLogger("smb-broker"), inner, &fakeInstanceStore{}, nil)
+	})
+
+	Describe("#Provision", func() {
+		var (
+			rawParameters string
+			err           error
+		)
+
+		JustBeforeEach(func() {
+			_, err = subject.Provision(context.TODO(), "instance-id", domain.ProvisionDetails{
+				RawParameters: json.RawMessage(rawParameters),
+			}, false)
+		})
+
+		providedParameters := func() map[string]interface{} {
+			parameters := map[string]interface{}{}
+			Expect(json.Unmarshal(inner.provisionDetails.RawParameters, &parameters)).To(Succeed())
+			return parameters
+		}
+
+		DescribeTable("normalizes the share",
+			func(share, expected string) {
+				rawParameters = `{"share": ` + string(mustMarshal(share)) + `, "version": 1.0}`
+				_, err := subject.Provision(context.TODO(), "instance-id", domain.ProvisionDetails{
+					RawParameters: json.RawMessage(rawParameters),
+				}, false)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(providedParameters()).To(HaveKeyWithValue("share", expected))
+				Expect(string(inner.provisionDetails.RawParameters)).To(ContainSubstring(`"version":1.0`))
+			},
+			Entry("a canonical share", "//server/share", "//server/share"),
+			Entry("a UNC path", `\\server\share\dir\`, "//server/share/dir"),
+			Entry("an smb URL", "smb://server/share/dir", "//server/share/dir"),
+			Entry("an smb URL with a port", "smb://[2001:db8::1]:1445/share", "//[2001:db8::1]:1445/share"),
+		)
+
+		Context("when the share is malformed", func() {
+			BeforeEach(func() {
+				rawParameters = `{"share": "server/share"}`
+			})
+
+			It("rejects the request with a precise message", func() {
+				Expect(err).To(MatchError(ContainSubstring(`"server/share" is not a valid share`)))
+				failure, ok := err.(*apiresponses.FailureResponse)
+				Expect(ok).To(BeTrue())
+				Expect(failure.ValidatedStatusCode(nil)).To(Equal(http.StatusBadRequest))
+				Expect(inner.provisionCallCount).To(BeZero())
+			})
+		})
+
+		Context("when a snapshot is given", func() {
+			BeforeEach(func() {
+				rawParameters = `{"share": "//server/share", "snapshot": "@GMT-2024.03.27-20.52.19"}`
+			})
+
+			It("rejects the request", func() {
+				Expect(err).To(MatchError("snapshot can only be given when binding the service"))
+				Expect(inner.provisionCallCount).To(BeZero())
+			})
+		})
+
+		Context("when posix is given with a version other than 3.1.1", func() {
+			BeforeEach(func() {
+				rawParameters = `{"share": "//server/share", "posix": true, "version": "3.0"}`
+			})
+
+			It("rejects the request", func() {
+				Expect(err).To(MatchError("posix requires version 3.1.1, but version 3.0 was given"))
+				failure, ok := err.(*apiresponses.FailureResponse)
+				Expect(ok).To(BeTrue())
+				Expect(failure.ValidatedStatusCode(nil)).To(Equal(http.StatusBadRequest))
+				Expect(inner.provisionCallCount).To(BeZero())
+			})
+		})
+
+		Context("when posix is given without a version", func() {
+			BeforeEach(func() {
+				rawParameters = `{"share": "//server/share", "posix": true}`
+			})
+
+			It("leaves the version to the binding", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inner.provisionCallCount).To(Equal(1))
+			})
+		})
+
+		Context("when alternate shares are given as a list", func() {
+			BeforeEach(func() {
+				rawParameters = `{"share": "//server/share", "alternate_shares": ["smb://replica/share", "\\\\backup\\share"]}`
+			})
+
+			It("stores them as a comma separated string of canonical shares", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(inner.provisionDetails.RawParameters)).To(MatchJSON(`{"share": "//server/share", "alternate_shares": "//replica/share,//backup/share"}`))
+			})
+		})
+
+		Context("when an alternate share is malformed", func() {
+			BeforeEach(func() {
+				rawParameters = `{"share": "//server/share", "alternate_shares": "//replica/share,backup"}`
+			})
+
+			It("rejects the request", func() {
+				Expect(err).To(MatchError(ContainSubstring("is not a valid share")))
+				failure, ok := err.(*apiresponses.FailureResponse)
+				Expect(ok).To(BeTrue())
+				Expect(failure.ValidatedStatusCode(nil)).To(Equal(http.StatusBadRequest))
+				Expect(inner.provisionCallCount).To(BeZero())
+			})
+		})
+
+		Context("when no share is given", func() {
+			BeforeEach(func() {
+				rawParameters = `{"version": "3.0"}`
+			})
+
+			It("leaves validation to the wrapped broker", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inner.provisionCallCount).To(Equal(1))
+				Expect(string(inner.provisionDetails.RawParameters)).To(Equal(rawParameters))
+			})
+		})
+
+		Context("when the parameters are not valid JSON", func() {
+			BeforeEach(func() {
+				rawParameters = `{"share": `
+			})
+
+			It("leaves validation to the wrapped broker", func() {
+				Expect(inner.provisionCallCount).To(Equal(1))
+				Expect(string(inner.provisionDetails.RawParameters)).To(Equal(rawParameters))
+			})
+		})
+	})
+})
+
+var _ = Describe("SmbBroker#Bind", func() {
+	var (
+		inner         *fakeServiceBroker
+		store         *fakeInstanceStore
+		subject       domain.ServiceBroker
+		rawParameters string
+		planID        string
+		binding       domain.Binding
+		err           error
+	)
+
+	BeforeEach(func() {
+		inner = &fakeServiceBroker{
+			bindResponse: domain.Binding{
+				VolumeMounts: []domain.VolumeMount{{Driver: "smbdriver", ContainerDir: "/var/vcap/data/instance-id"}},
+			},
+		}
+		store = &fakeInstanceStore{instances: map[string]brokerstore.ServiceInstance{
+			"instance-id": {ServiceFingerPrint: map[string]interface{}{"share": "//server/share"}},
+		}}
+		subject = NewSmbBroker(lagertest.NewTestLogger("smb-broker"), inner, store, map[string]string{"legacy-plan-id": "smbdriver-legacy"})
+		planID = "plan-id"
+	})
+
+	JustBeforeEach(func() {
+		binding, err = subject.Bind(context.TODO(), "instance-id", "binding-id", domain.BindDetails{
+			PlanID:        planID,
+			RawParameters: json.RawMessage(rawParameters),
+		}, false)
+	})
+
+	Context("when the plan names a driver", func() {
+		BeforeEach(func() {
+			rawParameters = `{"version": "3.0"}`
+			planID = "legacy-plan-id"
+		})
+
+		It("mounts the binding with that driver", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.VolumeMounts).To(HaveLen(1))
+			Expect(binding.VolumeMounts[0].Driver).To(Equal("smbdriver-legacy"))
+			Expect(binding.VolumeMounts[0].ContainerDir).To(Equal("/var/vcap/data/instance-id"))
+		})
+	})
+
+	Context("when the plan does not name a driver", func() {
+		BeforeEach(func() {
+			rawParameters = `{"version": "3.0"}`
+		})
+
+		It("mounts the binding with smbdriver", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(binding.VolumeMounts[0].Driver).To(Equal("smbdriver"))
+		})
+	})
+
+	Context("when a snapshot is given", func() {
+		BeforeEach(func() {
+			rawParameters = `{"snapshot": "@GMT-2024.03.27-20.52.19", "version": "3.0"}`
+		})
+
+		It("binds read-only", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(inner.bindDetails.RawParameters)).To(MatchJSON(`{"snapshot": "@GMT-2024.03.27-20.52.19", "version": "3.0", "readonly": true}`))
+		})
+	})
+
+	Context("when a snapshot is given with readonly", func() {
+		BeforeEach(func() {
+			rawParameters = `{"snapshot": "@GMT-2024.03.27-20.52.19", "readonly": "true"}`
+		})
+
+		It("binds read-only", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(inner.bindDetails.RawParameters)).To(MatchJSON(`{"snapshot": "@GMT-2024.03.27-20.52.19", "readonly": true}`))
+		})
+	})
+
+	Context("when a snapshot is given with readonly false", func() {
+		BeforeEach(func() {
+			rawParameters = `{"snapshot": "@GMT-2024.03.27-20.52.19", "readonly": false}`
+		})
+
+		It("rejects the request", func() {
+			Expect(err).To(MatchError("snapshot can only be bound read-only"))
+			failure, ok := err.(*apiresponses.FailureResponse)
+			Expect(ok).To(BeTrue())
+			Expect(failure.ValidatedStatusCode(nil)).To(Equal(http.StatusBadRequest))
+			Expect(inner.bindCallCount).To(BeZero())
+		})
+	})
+
+	Context("when posix is given with a version other than 3.1.1", func() {
+		BeforeEach(func() {
+			rawParameters = `{"posix": true, "version": "2.1"}`
+		})
+
+		It("rejects the request", func() {
+			Expect(err).To(MatchError("posix requires version 3.1.1, but version 2.1 was given"))
+			Expect(inner.bindCallCount).To(BeZero())
+		})
+	})
+
+	Context("when posix is given with version 3.1.1", func() {
+		BeforeEach(func() {
+			rawParameters = `{"posix": true, "version": "3.1.1"}`
+		})
+
+		It("binds", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inner.bindCallCount).To(Equal(1))
+		})
+	})
+
+	Context("when posix is given with version 3.11", func() {
+		BeforeEach(func() {
+			rawParameters = `{"posix": true, "version": "3.11"}`
+		})
+
+		It("binds, since it is another spelling of 3.1.1", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inner.bindCallCount).To(Equal(1))
+		})
+	})
+
+	Context("when posix is given without a version", func() {
+		BeforeEach(func() {
+			rawParameters = `{"posix": true}`
+		})
+
+		It("rejects the request", func() {
+			Expect(err).To(MatchError("posix requires version 3.1.1, but no version was given"))
+			Expect(inner.bindCallCount).To(BeZero())
+		})
+
+		Context("and the instance was provisioned with version 3.1.1", func() {
+			BeforeEach(func() {
+				store.instances["instance-id"] = brokerstore.ServiceInstance{
+					ServiceFingerPrint: map[string]interface{}{"share": "//server/share", "version": "3.1.1"},
+				}
+			})
+
+			It("binds", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inner.bindCallCount).To(Equal(1))
+			})
+		})
+
+		Context("and the instance was provisioned with another version", func() {
+			BeforeEach(func() {
+				store.instances["instance-id"] = brokerstore.ServiceInstance{
+					ServiceFingerPrint: map[string]interface{}{"share": "//server/share", "version": "3.0"},
+				}
+			})
+
+			It("rejects the request", func() {
+				Expect(err).To(MatchError("posix requires version 3.1.1, but version 3.0 was given"))
+				Expect(inner.bindCallCount).To(BeZero())
+			})
+		})
+	})
+
+	Context("when the instance was provisioned with posix", func() {
+		BeforeEach(func() {
+			store.instances["instance-id"] = brokerstore.ServiceInstance{
+				ServiceFingerPrint: map[string]interface{}{"share": "//server/share", "posix": true},
+			}
+		})
+
+		Context("and the binding gives version 3.1.1", func() {
+			BeforeEach(func() {
+				rawParameters = `{"version": "3.1.1"}`
+			})
+
+			It("binds", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(inner.bindCallCount).To(Equal(1))
+			})
+		})
+
+		Context("and the binding gives another version", func() {
+			BeforeEach(func() {
+				rawParameters = `{"version": 3.0}`
+			})
+
+			It("rejects the request", func() {
+				Expect(err).To(MatchError("posix requires version 3.1.1, but version 3.0 was given"))
+				Expect(inner.bindCallCount).To(BeZero())
+			})
+		})
+	})
+
+	Context("when alternate shares are given", func() {
+		BeforeEach(func() {
+			rawParameters = `{"alternate_shares": "smb://replica/share, //backup/share"}`
+		})
+
+		It("normalizes them", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(inner.bindDetails.RawParameters)).To(MatchJSON(`{"alternate_shares": "//replica/share,//backup/share"}`))
+		})
+	})
+
+	Context("when alternate shares are not a string or list", func() {
+		BeforeEach(func() {
+			rawParameters = `{"alternate_shares": 3}`
+		})
+
+		It("rejects the request", func() {
+			Expect(err).To(MatchError("alternate_shares must be a list of shares or a comma separated string"))
+			Expect(inner.bindCallCount).To(BeZero())
+		})
+	})
+
+	Context("when no snapshot is given", func() {
+		BeforeEach(func() {
+			rawParameters = `{"version": "3.0"}`
+		})
+
+		It("does not change the parameters", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(inner.bindCallCount).To(Equal(1))
+			Expect(string(inner.bindDetails.RawParameters)).To(Equal(rawParameters))
+		})
+	})
+})
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	Expect(err).NotTo(HaveOccurred())
+	return b
+}
@@ -1,5 +1,5 @@
 package main
 
 func AllowedOptions() string {
-	return "source,mount,ro,username,password,domain,version,mfsymlinks,noserverino,forceuid,noforceuid,forcegid,noforcegid,nodfs"
+	return "source,mount,ro,username,password,domain,version,mfsymlinks,noserverino,forceuid,noforceuid,forcegid,noforcegid,nodfs,subpath,seal,sign,cache,actimeo,rsize,wsize,nobrl,hard,soft,echo_interval,multichannel,max_channels,profile,snapshot,multiuser,uid,cifsacl,idsfromsid,modefromsid,posix,alternate_shares"
 }
@@ -8,6 +8,6 @@ import (
 
 var _ = Describe("Config", func() {
 	It("should return the correct allowed options", func() {
-		Expect(AllowedOptions()).To(Equal("source,mount,ro,username,password,domain,version,mfsymlinks,noserverino,forceuid,noforceuid,forcegid,noforcegid,nodfs"))
+		Expect(AllowedOptions()).To(Equal("source,mount,ro,username,password,domain,version,mfsymlinks,noserverino,forceuid,noforceuid,forcegid,noforcegid,nodfs,subpath,seal,sign,cache,actimeo,rsize,wsize,nobrl,hard,soft,echo_interval,multichannel,max_channels,profile,snapshot,multiuser,uid,cifsacl,idsfromsid,modefromsid,posix,alternate_shares"))
 	})
 })
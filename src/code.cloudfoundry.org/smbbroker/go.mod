@@ -11,6 +11,7 @@ require (
 	code.cloudfoundry.org/goshims v0.45.0
 	code.cloudfoundry.org/lager/v3 v3.10.0
 	code.cloudfoundry.org/service-broker-store v0.93.0
+	code.cloudfoundry.org/smbdriver v0.0.0-00010101000000-000000000000
 	code.cloudfoundry.org/volume-mount-options v0.100.0
 	github.com/google/gofuzz v1.2.0
 	github.com/onsi/ginkgo/v2 v2.20.2
@@ -33,9 +34,11 @@ require (
 	github.com/openzipkin/zipkin-go v0.4.3 // indirect
 	golang.org/x/crypto v0.28.0 // indirect
 	golang.org/x/net v0.30.0 // indirect
-	golang.org/x/sys v0.26.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.19.0 // indirect
 	golang.org/x/tools v0.26.0 // indirect
 	google.golang.org/protobuf v1.35.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace code.cloudfoundry.org/smbdriver => ../smbdriver
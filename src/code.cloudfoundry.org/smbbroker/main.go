@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -19,6 +20,9 @@ import (
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagerflags"
 	"code.cloudfoundry.org/service-broker-store/brokerstore"
+	"code.cloudfoundry.org/smbdriver/smbsnapshot"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	"code.cloudfoundry.org/smbdriver/smbtuning"
 	vmo "code.cloudfoundry.org/volume-mount-options"
 	vmou "code.cloudfoundry.org/volume-mount-options/utils"
 	"github.com/pivotal-cf/brokerapi/v11"
@@ -221,6 +225,10 @@ func createServer(logger lager.Logger) ifrit.Runner {
 
 	versionValidator := vmo.UserOptsValidationFunc(validateVersion)
 	symlinksValidator := vmo.UserOptsValidationFunc(validateMfsymlinks)
+	subpathValidator := vmo.UserOptsValidationFunc(validateSubpath)
+	flagValidator := vmo.UserOptsValidationFunc(validateFlag)
+	tuningValidator := vmo.UserOptsValidationFunc(smbtuning.Validate)
+	snapshotValidator := vmo.UserOptsValidationFunc(smbsnapshot.Validate)
 
 	configMask, err := vmo.NewMountOptsMask(
 		strings.Split(AllowedOptions(), ","),
@@ -231,7 +239,7 @@ func createServer(logger lager.Logger) ifrit.Runner {
 		},
 		[]string{},
 		[]string{"source"},
-		versionValidator, symlinksValidator,
+		versionValidator, symlinksValidator, subpathValidator, flagValidator, tuningValidator, snapshotValidator,
 	)
 	if err != nil {
 		logger.Fatal("creating-config-mask-error", err)
@@ -244,7 +252,12 @@ func createServer(logger lager.Logger) ifrit.Runner {
 		logger.Fatal("loading-services-config-error", err)
 	}
 
-	serviceBroker := existingvolumebroker.New(
+	planDrivers, err := PlanDrivers(services)
+	if err != nil {
+		logger.Fatal("loading-services-config-error", err)
+	}
+
+	serviceBroker := NewSmbBroker(logger, existingvolumebroker.New(
 		existingvolumebroker.BrokerTypeSMB,
 		logger,
 		services,
@@ -252,7 +265,7 @@ func createServer(logger lager.Logger) ifrit.Runner {
 		clock.NewClock(),
 		store,
 		configMask,
-	)
+	), store, planDrivers)
 
 	credentials := brokerapi.BrokerCredentials{Username: username, Password: password}
 	handler := brokerapi.New(serviceBroker, slog.New(lager.NewHandler(lager.NewLogger("broker-api"))), credentials)
@@ -273,8 +286,32 @@ func validateMfsymlinks(key string, val string) error {
 	return fmt.Errorf("%s is not a valid value for mfsymlinks", val)
 }
 
+func validateFlag(key string, val string) error {
+	flags := []string{"seal", "sign", "multiuser", "cifsacl", "idsfromsid", "modefromsid", "posix"}
+
+	for _, flag := range flags {
+		if key == flag && val != "true" {
+			return fmt.Errorf("%s is not a valid value for %s", val, key)
+		}
+	}
+
+	return nil
+}
+
+func validateSubpath(key string, val string) error {
+	if key != "subpath" {
+		return nil
+	}
+
+	if _, err := smbsource.CleanPath(val); err != nil {
+		return fmt.Errorf("%s is not a valid subpath: %s", val, err.Error())
+	}
+
+	return nil
+}
+
 func validateVersion(key string, val string) error {
-	validVersions := []string{"1.0", "2.0", "2.1", "3.0", "3.1.1"}
+	validVersions := []string{"1.0", "2.0", "2.1", "3.0", "3.1.1", "3.11"}
 
 	if key != "version" {
 		return nil
@@ -288,3 +325,18 @@ func validateVersion(key string, val string) error {
 
 	return fmt.Errorf("%s is not a valid version", val)
 }
+
+// validatePosixVersion checks that the POSIX extensions are only asked for
+// together with SMB 3.1.1, the only version that offers them. mount.cifs
+// also accepts 3.11 for it.
+func validatePosixVersion(posix, version string) error {
+	if posix != "true" || version == "3.1.1" || version == "3.11" {
+		return nil
+	}
+
+	if version == "" {
+		return errors.New("posix requires version 3.1.1, but no version was given")
+	}
+
+	return fmt.Errorf("posix requires version 3.1.1, but version %s was given", version)
+}
@@ -265,7 +265,7 @@ var _ = Describe("smbbroker Main", func() {
 				provisionDetailsJsons, err := json.Marshal(domain.ProvisionDetails{
 					ServiceID:     serviceOfferingID,
 					PlanID:        planID,
-					RawParameters: json.RawMessage(`{"share": "sharevalue", "version": "1.0"}`),
+					RawParameters: json.RawMessage(`{"share": "\\\\server\\sharevalue", "version": "1.0"}`),
 				})
 
 				Expect(err).NotTo(HaveOccurred())
@@ -275,6 +275,23 @@ var _ = Describe("smbbroker Main", func() {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(resp.StatusCode).To(Equal(201))
 			})
+			It("should respond with 400 when the share is malformed", func() {
+				provisionDetailsJsons, err := json.Marshal(domain.ProvisionDetails{
+					ServiceID:     serviceOfferingID,
+					PlanID:        planID,
+					RawParameters: json.RawMessage(`{"share": "server/sharevalue"}`),
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				reader := strings.NewReader(string(provisionDetailsJsons))
+				resp, err := httpDoWithAuth("PUT", fmt.Sprintf("/v2/service_instances/%s", serviceInstanceID), reader)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(400))
+
+				responseBody, err := io.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(responseBody)).To(ContainSubstring(`is not a valid share`))
+			})
 		})
 
 		Context("#bind", func() {
@@ -323,12 +340,25 @@ var _ = Describe("smbbroker Main", func() {
 			Context("allowed parameters", func() {
 				It("should accept the parameter", func() {
 					rawParametersMap := map[string]string{
-						"username":   "user",
-						"password":   "foo",
-						"mount":      "somemount",
-						"readonly":   "true",
-						"domain":     "foo",
-						"mfsymlinks": "true",
+						"username":         "user",
+						"password":         "foo",
+						"mount":            "somemount",
+						"readonly":         "true",
+						"domain":           "foo",
+						"mfsymlinks":       "true",
+						"subpath":          "apps/app1",
+						"seal":             "true",
+						"sign":             "true",
+						"cache":            "loose",
+						"rsize":            "1048576",
+						"nobrl":            "true",
+						"profile":          "bulk-read",
+						"multiuser":        "true",
+						"cifsacl":          "true",
+						"idsfromsid":       "true",
+						"posix":            "true",
+						"version":          "3.1.1",
+						"alternate_shares": "//replica/sharevalue",
 					}
 
 					rawParameters, err := json.Marshal(rawParametersMap)
@@ -396,6 +426,133 @@ var _ = Describe("smbbroker Main", func() {
 				})
 			})
 
+			Context("invalid subpath", func() {
+				It("should respond with 400", func() {
+					rawParameters, err := json.Marshal(map[string]string{
+						"subpath": "apps/../../other",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					bindDetailJson, err := json.Marshal(domain.BindDetails{
+						ServiceID:     serviceOfferingID,
+						PlanID:        planID,
+						AppGUID:       "222",
+						RawParameters: rawParameters,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					reader := strings.NewReader(string(bindDetailJson))
+					endpoint := fmt.Sprintf("/v2/service_instances/%s/service_bindings/%s", serviceInstanceID, bindingID)
+					resp, err := httpDoWithAuth("PUT", endpoint, reader)
+
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(400))
+
+					responseBody, err := io.ReadAll(resp.Body)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(responseBody)).To(ContainSubstring("apps/../../other is not a valid subpath"))
+				})
+			})
+
+			Context("invalid seal", func() {
+				It("should respond with 400", func() {
+					rawParameters, err := json.Marshal(map[string]string{
+						"seal": "yes",
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					bindDetailJson, err := json.Marshal(domain.BindDetails{
+						ServiceID:     serviceOfferingID,
+						PlanID:        planID,
+						AppGUID:       "222",
+						RawParameters: rawParameters,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					reader := strings.NewReader(string(bindDetailJson))
+					endpoint := fmt.Sprintf("/v2/service_instances/%s/service_bindings/%s", serviceInstanceID, bindingID)
+					resp, err := httpDoWithAuth("PUT", endpoint, reader)
+
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(400))
+
+					responseBody, err := io.ReadAll(resp.Body)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(responseBody)).To(ContainSubstring("yes is not a valid value for seal"))
+				})
+			})
+
+			Context("invalid tuning option", func() {
+				It("should respond with 400", func() {
+					rawParameters, err := json.Marshal(map[string]interface{}{
+						"rsize": 5000,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					bindDetailJson, err := json.Marshal(domain.BindDetails{
+						ServiceID:     serviceOfferingID,
+						PlanID:        planID,
+						AppGUID:       "222",
+						RawParameters: rawParameters,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					reader := strings.NewReader(string(bindDetailJson))
+					endpoint := fmt.Sprintf("/v2/service_instances/%s/service_bindings/%s", serviceInstanceID, bindingID)
+					resp, err := httpDoWithAuth("PUT", endpoint, reader)
+
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(400))
+
+					responseBody, err := io.ReadAll(resp.Body)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(responseBody)).To(ContainSubstring("5000 is not a valid value for rsize, expected a multiple of 4096"))
+				})
+			})
+
+			Context("snapshot", func() {
+				bind := func(snapshot string) *http.Response {
+					rawParameters, err := json.Marshal(map[string]string{
+						"snapshot": snapshot,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					bindDetailJson, err := json.Marshal(domain.BindDetails{
+						ServiceID:     serviceOfferingID,
+						PlanID:        planID,
+						AppGUID:       "222",
+						RawParameters: rawParameters,
+					})
+					Expect(err).NotTo(HaveOccurred())
+
+					reader := strings.NewReader(string(bindDetailJson))
+					endpoint := fmt.Sprintf("/v2/service_instances/%s/service_bindings/%s", serviceInstanceID, bindingID)
+					resp, err := httpDoWithAuth("PUT", endpoint, reader)
+					Expect(err).NotTo(HaveOccurred())
+
+					return resp
+				}
+
+				It("should bind read-only", func() {
+					resp := bind("@GMT-2024.03.27-20.52.19")
+					Expect(resp.StatusCode).To(Equal(201))
+
+					var binding domain.Binding
+					Expect(json.NewDecoder(resp.Body).Decode(&binding)).To(Succeed())
+					Expect(binding.VolumeMounts).To(HaveLen(1))
+					Expect(binding.VolumeMounts[0].Mode).To(Equal("r"))
+				})
+
+				It("should respond with 400 when the snapshot is invalid", func() {
+					resp := bind("yesterday")
+					Expect(resp.StatusCode).To(Equal(400))
+
+					responseBody, err := io.ReadAll(resp.Body)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(responseBody)).To(ContainSubstring("yesterday is not a valid snapshot"))
+				})
+			})
+
 			Context("versions", func() {
 				DescribeTable("valid versions", func(version string) {
 					rawParametersMap := map[string]string{
@@ -2,11 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/pivotal-cf/brokerapi/v11/domain"
 )
 
+// driverMetadataKey is the key in the metadata of a plan that names the
+// smbdriver personality that the bindings of the plan are mounted with.
+const driverMetadataKey = "driver"
+
 type Services interface {
 	List() []domain.Service
 }
@@ -34,3 +39,28 @@ func NewServicesFromConfig(pathToServicesConfig string) (Services, error) {
 func (s *services) List() []domain.Service {
 	return s.services
 }
+
+// PlanDrivers maps the IDs of the plans that name a driver in their metadata
+// to that driver. Bindings of other plans are mounted with smbdriver.
+func PlanDrivers(services Services) (map[string]string, error) {
+	drivers := map[string]string{}
+	for _, service := range services.List() {
+		for _, plan := range service.Plans {
+			if plan.Metadata == nil {
+				continue
+			}
+
+			value, ok := plan.Metadata.AdditionalMetadata[driverMetadataKey]
+			if !ok {
+				continue
+			}
+
+			driver, ok := value.(string)
+			if !ok || driver == "" {
+				return nil, fmt.Errorf("the driver of plan %s must be a name", plan.Name)
+			}
+			drivers[plan.ID] = driver
+		}
+	}
+	return drivers, nil
+}
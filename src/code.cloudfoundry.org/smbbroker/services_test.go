@@ -1,6 +1,9 @@
 package main_test
 
 import (
+	"os"
+	"path/filepath"
+
 	. "code.cloudfoundry.org/smbbroker"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -41,4 +44,52 @@ var _ = Describe("Services", func() {
 			}))
 		})
 	})
+
+	Describe("PlanDrivers", func() {
+		It("has no drivers for the default services", func() {
+			drivers, err := PlanDrivers(services)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(drivers).To(BeEmpty())
+		})
+
+		Context("when plans name a driver in their metadata", func() {
+			BeforeEach(func() {
+				path := filepath.Join(GinkgoT().TempDir(), "services.json")
+				Expect(os.WriteFile(path, []byte(`[{
+					"id": "service-id",
+					"name": "smb",
+					"plans": [
+						{"id": "existing-plan-id", "name": "Existing"},
+						{"id": "legacy-plan-id", "name": "Legacy", "metadata": {"driver": "smbdriver-legacy", "bullets": ["nodfs"]}}
+					]
+				}]`), 0600)).To(Succeed())
+
+				var err error
+				services, err = NewServicesFromConfig(path)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("maps the plans to their drivers", func() {
+				drivers, err := PlanDrivers(services)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(drivers).To(Equal(map[string]string{"legacy-plan-id": "smbdriver-legacy"}))
+			})
+		})
+
+		Context("when the driver of a plan is not a name", func() {
+			BeforeEach(func() {
+				path := filepath.Join(GinkgoT().TempDir(), "services.json")
+				Expect(os.WriteFile(path, []byte(`[{"id": "service-id", "name": "smb", "plans": [{"id": "legacy-plan-id", "name": "Legacy", "metadata": {"driver": 3}}]}]`), 0600)).To(Succeed())
+
+				var err error
+				services, err = NewServicesFromConfig(path)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("fails", func() {
+				_, err := PlanDrivers(services)
+				Expect(err).To(MatchError("the driver of plan Legacy must be a name"))
+			})
+		})
+	})
 })
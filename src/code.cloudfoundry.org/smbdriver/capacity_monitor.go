@@ -0,0 +1,230 @@
+package smbdriver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+const (
+	// DefaultCapacityCheckInterval is how often mounted volumes are checked.
+	DefaultCapacityCheckInterval = time.Minute
+
+	// DefaultStatfsTimeout bounds how long checking a volume may take, since
+	// statfs blocks while the server of a hard mount does not answer.
+	DefaultStatfsTimeout = 10 * time.Second
+)
+
+// DiskUsage is the result of statfs on a mounted volume.
+type DiskUsage struct {
+	TotalBytes  uint64
+	FreeBytes   uint64
+	UsedBytes   uint64
+	TotalInodes uint64
+	FreeInodes  uint64
+}
+
+// StatfsFunc returns the disk usage of the file system mounted at path.
+type StatfsFunc func(path string) (DiskUsage, error)
+
+// CapacityThresholds are the percentages of bytes and inodes in use above
+// which a volume is logged as nearly full. A threshold of 0 is not checked.
+type CapacityThresholds struct {
+	BytesPercent  int
+	InodesPercent int
+}
+
+type capacityWarnings struct {
+	bytes  bool
+	inodes bool
+}
+
+type statfsResult struct {
+	usage DiskUsage
+	err   error
+}
+
+// CapacityMonitor periodically checks the capacity and usage of the mounted
+// volumes, and logs when they cross the warning thresholds.
+type CapacityMonitor struct {
+	logger     lager.Logger
+	mounts     driveradmin.MountLister
+	statfs     StatfsFunc
+	interval   time.Duration
+	timeout    time.Duration
+	thresholds CapacityThresholds
+	clock      clock.Clock
+
+	mutex   sync.Mutex
+	volumes map[string]driveradmin.VolumeCapacity
+	warned  map[string]capacityWarnings
+	pending map[string]bool
+}
+
+func NewCapacityMonitor(logger lager.Logger, mounts driveradmin.MountLister, statfs StatfsFunc, interval, timeout time.Duration, thresholds CapacityThresholds, clock clock.Clock) *CapacityMonitor {
+	return &CapacityMonitor{
+		logger:     logger.Session("capacity-monitor"),
+		mounts:     mounts,
+		statfs:     statfs,
+		interval:   interval,
+		timeout:    timeout,
+		thresholds: thresholds,
+		clock:      clock,
+		volumes:    map[string]driveradmin.VolumeCapacity{},
+		warned:     map[string]capacityWarnings{},
+		pending:    map[string]bool{},
+	}
+}
+
+// Run checks the volumes every interval until signalled.
+func (c *CapacityMonitor) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env := driverhttp.NewHttpDriverEnv(c.logger, ctx)
+
+	ticker := c.clock.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			c.Check(env)
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// Check checks each mounted volume once.
+func (c *CapacityMonitor) Check(env dockerdriver.Env) {
+	mounts := c.mounts.Mounts(env)
+
+	volumes := map[string]driveradmin.VolumeCapacity{}
+	for _, mount := range mounts {
+		volumes[mount.Target] = c.checkVolume(mount)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.volumes = volumes
+	for target := range c.warned {
+		if _, ok := volumes[target]; !ok {
+			delete(c.warned, target)
+		}
+	}
+}
+
+// Capacity lists the volumes as of their last check, ordered by target.
+func (c *CapacityMonitor) Capacity(env dockerdriver.Env) []driveradmin.VolumeCapacity {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	volumes := []driveradmin.VolumeCapacity{}
+	for _, volume := range c.volumes {
+		volumes = append(volumes, volume)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Target < volumes[j].Target })
+
+	return volumes
+}
+
+func (c *CapacityMonitor) checkVolume(mount driveradmin.Mount) driveradmin.VolumeCapacity {
+	volume := driveradmin.VolumeCapacity{Target: mount.Target, Source: mount.Source, CheckedAt: c.clock.Now()}
+
+	// A statfs that is still blocked from an earlier check is not repeated,
+	// so that a hung mount does not pile up goroutines.
+	c.mutex.Lock()
+	pending := c.pending[mount.Target]
+	if !pending {
+		c.pending[mount.Target] = true
+	}
+	c.mutex.Unlock()
+
+	if pending {
+		volume.Err = fmt.Sprintf("statfs has not returned for more than %s", c.timeout)
+		return volume
+	}
+
+	result := make(chan statfsResult, 1)
+	go func() {
+		usage, err := c.statfs(mount.Target)
+
+		c.mutex.Lock()
+		delete(c.pending, mount.Target)
+		c.mutex.Unlock()
+
+		result <- statfsResult{usage: usage, err: err}
+	}()
+
+	select {
+	case r := <-result:
+		if r.err != nil {
+			volume.Err = r.err.Error()
+			c.logger.Info("statfs-failed", lager.Data{"target": mount.Target, "error": r.err.Error()})
+			return volume
+		}
+
+		volume.TotalBytes = r.usage.TotalBytes
+		volume.FreeBytes = r.usage.FreeBytes
+		volume.UsedBytes = r.usage.UsedBytes
+		volume.TotalInodes = r.usage.TotalInodes
+		volume.FreeInodes = r.usage.FreeInodes
+		if r.usage.TotalInodes > r.usage.FreeInodes {
+			volume.UsedInodes = r.usage.TotalInodes - r.usage.FreeInodes
+		}
+	case <-c.clock.After(c.timeout):
+		volume.Err = fmt.Sprintf("statfs timed out after %s", c.timeout)
+		c.logger.Info("statfs-timed-out", lager.Data{"target": mount.Target})
+		return volume
+	}
+
+	c.warn(volume)
+	return volume
+}
+
+// warn logs when a volume crosses a threshold, in either direction.
+func (c *CapacityMonitor) warn(volume driveradmin.VolumeCapacity) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	warnings := c.warned[volume.Target]
+	warnings.bytes = c.crossed("bytes", volume, volume.UsedBytes, volume.UsedBytes+volume.FreeBytes, c.thresholds.BytesPercent, warnings.bytes)
+	warnings.inodes = c.crossed("inodes", volume, volume.UsedInodes, volume.TotalInodes, c.thresholds.InodesPercent, warnings.inodes)
+	c.warned[volume.Target] = warnings
+}
+
+func (c *CapacityMonitor) crossed(kind string, volume driveradmin.VolumeCapacity, used, total uint64, threshold int, warned bool) bool {
+	if threshold <= 0 || total == 0 {
+		return false
+	}
+
+	percent := float64(used) * 100 / float64(total)
+	data := lager.Data{
+		"target":       volume.Target,
+		"source":       volume.Source,
+		"kind":         kind,
+		"used-percent": fmt.Sprintf("%.1f", percent),
+		"threshold":    threshold,
+	}
+
+	over := percent >= float64(threshold)
+	switch {
+	case over && !warned:
+		c.logger.Info("volume-capacity-warning", data)
+	case !over && warned:
+		c.logger.Info("volume-capacity-recovered", data)
+	}
+	return over
+}
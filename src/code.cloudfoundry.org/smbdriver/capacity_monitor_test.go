@@ -0,0 +1,191 @@
+package smbdriver_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("CapacityMonitor", func() {
+	var (
+		logger     *lagertest.TestLogger
+		env        dockerdriver.Env
+		fakeClock  *fakeclock.FakeClock
+		mounts     *smbdriverfakes.FakeMountLister
+		mutex      sync.Mutex
+		usages     map[string]smbdriver.DiskUsage
+		statfsErr  error
+		statfsHang chan struct{}
+		thresholds smbdriver.CapacityThresholds
+		subject    *smbdriver.CapacityMonitor
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("capacity-monitor")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		fakeClock = fakeclock.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+
+		mounts = &smbdriverfakes.FakeMountLister{}
+		mounts.MountsReturns([]driveradmin.Mount{
+			{Target: "/mnt/b", Source: "//server/b"},
+			{Target: "/mnt/a", Source: "//server/a"},
+		})
+
+		usages = map[string]smbdriver.DiskUsage{
+			"/mnt/a": {TotalBytes: 1000, FreeBytes: 600, UsedBytes: 400, TotalInodes: 100, FreeInodes: 90},
+			"/mnt/b": {TotalBytes: 2000, FreeBytes: 100, UsedBytes: 1900, TotalInodes: 100, FreeInodes: 5},
+		}
+		statfsErr = nil
+		statfsHang = nil
+		thresholds = smbdriver.CapacityThresholds{BytesPercent: 90, InodesPercent: 90}
+	})
+
+	JustBeforeEach(func() {
+		statfs := func(path string) (smbdriver.DiskUsage, error) {
+			mutex.Lock()
+			hang := statfsHang
+			mutex.Unlock()
+			if hang != nil {
+				<-hang
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			return usages[path], statfsErr
+		}
+
+		subject = smbdriver.NewCapacityMonitor(logger, mounts, statfs, time.Minute, 10*time.Second, thresholds, fakeClock)
+	})
+
+	It("reports nothing before the first check", func() {
+		Expect(subject.Capacity(env)).To(BeEmpty())
+	})
+
+	It("reports the capacity and usage of each mounted volume", func() {
+		subject.Check(env)
+
+		Expect(subject.Capacity(env)).To(Equal([]driveradmin.VolumeCapacity{
+			{Target: "/mnt/a", Source: "//server/a", TotalBytes: 1000, FreeBytes: 600, UsedBytes: 400, TotalInodes: 100, FreeInodes: 90, UsedInodes: 10, CheckedAt: fakeClock.Now()},
+			{Target: "/mnt/b", Source: "//server/b", TotalBytes: 2000, FreeBytes: 100, UsedBytes: 1900, TotalInodes: 100, FreeInodes: 5, UsedInodes: 95, CheckedAt: fakeClock.Now()},
+		}))
+	})
+
+	It("forgets volumes that are no longer mounted", func() {
+		subject.Check(env)
+
+		mounts.MountsReturns([]driveradmin.Mount{{Target: "/mnt/a", Source: "//server/a"}})
+		subject.Check(env)
+
+		Expect(subject.Capacity(env)).To(HaveLen(1))
+	})
+
+	It("logs the volumes over a threshold once", func() {
+		subject.Check(env)
+		Expect(logger.Buffer()).To(gbytes.Say(`volume-capacity-warning.*"kind":"bytes".*"target":"/mnt/b".*"threshold":90,"used-percent":"95.0"`))
+		Expect(logger.Buffer()).To(gbytes.Say(`volume-capacity-warning.*"kind":"inodes".*"target":"/mnt/b"`))
+
+		subject.Check(env)
+		Expect(logger.Buffer()).NotTo(gbytes.Say("volume-capacity-warning"))
+
+		mutex.Lock()
+		usages["/mnt/b"] = smbdriver.DiskUsage{TotalBytes: 2000, FreeBytes: 1000, UsedBytes: 1000, TotalInodes: 100, FreeInodes: 5}
+		mutex.Unlock()
+
+		subject.Check(env)
+		Expect(logger.Buffer()).To(gbytes.Say(`volume-capacity-recovered.*"kind":"bytes".*"target":"/mnt/b"`))
+		Expect(logger.Buffer()).NotTo(gbytes.Say("volume-capacity"))
+	})
+
+	Context("when the thresholds are not set", func() {
+		BeforeEach(func() {
+			thresholds = smbdriver.CapacityThresholds{}
+		})
+
+		It("does not log warnings", func() {
+			subject.Check(env)
+			Expect(logger.Buffer()).NotTo(gbytes.Say("volume-capacity-warning"))
+		})
+	})
+
+	Context("when statfs fails", func() {
+		BeforeEach(func() {
+			statfsErr = errors.New("stale file handle")
+		})
+
+		It("reports the error", func() {
+			subject.Check(env)
+
+			volumes := subject.Capacity(env)
+			Expect(volumes).To(HaveLen(2))
+			Expect(volumes[0].Err).To(Equal("stale file handle"))
+			Expect(volumes[0].TotalBytes).To(BeZero())
+		})
+	})
+
+	Context("when statfs does not return", func() {
+		BeforeEach(func() {
+			mounts.MountsReturns([]driveradmin.Mount{{Target: "/mnt/a", Source: "//server/a"}})
+			statfsHang = make(chan struct{})
+		})
+
+		It("times out and does not call it again until it returns", func() {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				subject.Check(env)
+			}()
+			fakeClock.WaitForWatcherAndIncrement(10 * time.Second)
+			Eventually(done).Should(BeClosed())
+			Expect(subject.Capacity(env)[0].Err).To(Equal("statfs timed out after 10s"))
+
+			subject.Check(env)
+			Expect(subject.Capacity(env)[0].Err).To(Equal("statfs has not returned for more than 10s"))
+
+			mutex.Lock()
+			hang := statfsHang
+			statfsHang = nil
+			mutex.Unlock()
+			close(hang)
+
+			Eventually(func() string {
+				subject.Check(env)
+				return subject.Capacity(env)[0].Err
+			}).Should(BeEmpty())
+		})
+	})
+
+	Context("when run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(subject)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("checks the volumes every interval", func() {
+			Expect(subject.Capacity(env)).To(BeEmpty())
+
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(func() []driveradmin.VolumeCapacity { return subject.Capacity(env) }).Should(HaveLen(2))
+			Expect(mounts.MountsCallCount()).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,251 @@
+package smbdriver
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/cifsstats"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+)
+
+// DefaultCifsStatsInterval is how often the CIFS client statistics are read.
+const DefaultCifsStatsInterval = time.Minute
+
+// ReadFileFunc reads a file such as /proc/fs/cifs/Stats.
+type ReadFileFunc func(path string) ([]byte, error)
+
+type cifsShareState struct {
+	smbs         uint64
+	checkedAt    time.Time
+	disconnected bool
+}
+
+// CifsStatsMonitor periodically reads the statistics and session state of
+// the kernel CIFS client, maps its shares back to the mounted volumes and
+// logs reconnects and disconnected shares.
+type CifsStatsMonitor struct {
+	logger   lager.Logger
+	mounts   driveradmin.MountLister
+	readFile ReadFileFunc
+	interval time.Duration
+	clock    clock.Clock
+
+	mutex  sync.Mutex
+	stats  driveradmin.CifsStats
+	shares map[string]cifsShareState
+	read   bool
+}
+
+func NewCifsStatsMonitor(logger lager.Logger, mounts driveradmin.MountLister, readFile ReadFileFunc, interval time.Duration, clock clock.Clock) *CifsStatsMonitor {
+	return &CifsStatsMonitor{
+		logger:   logger.Session("cifs-stats-monitor"),
+		mounts:   mounts,
+		readFile: readFile,
+		interval: interval,
+		clock:    clock,
+		stats:    driveradmin.CifsStats{Volumes: []driveradmin.VolumeCifsStats{}},
+		shares:   map[string]cifsShareState{},
+	}
+}
+
+// Run reads the statistics every interval until signalled.
+func (c *CifsStatsMonitor) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env := driverhttp.NewHttpDriverEnv(c.logger, ctx)
+
+	ticker := c.clock.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-ticker.C():
+			c.Check(env)
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// Check reads the statistics once.
+func (c *CifsStatsMonitor) Check(env dockerdriver.Env) {
+	stats, err := c.readStats()
+	if err != nil {
+		c.logger.Info("error-reading-cifs-stats", lager.Data{"error": err.Error()})
+		return
+	}
+
+	debugData, err := c.readDebugData()
+	if err != nil {
+		c.logger.Info("error-reading-cifs-debug-data", lager.Data{"error": err.Error()})
+		return
+	}
+
+	shares := map[string]cifsstats.ShareStats{}
+	for _, share := range stats.Shares {
+		shares[shareKey(share.Name)] = share
+	}
+
+	sessions := map[string]cifsstats.Session{}
+	for _, session := range debugData.Sessions {
+		for _, share := range session.Shares {
+			sessions[shareKey(share.Name)] = session
+		}
+	}
+
+	now := c.clock.Now()
+	volumes := []driveradmin.VolumeCifsStats{}
+	for _, mount := range c.mounts.Mounts(env) {
+		volumes = append(volumes, c.volumeStats(mount, shares, sessions, now))
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Target < volumes[j].Target })
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.read && (stats.SessionReconnects > c.stats.SessionReconnects || stats.ShareReconnects > c.stats.ShareReconnects) {
+		c.logger.Info("cifs-reconnects", lager.Data{
+			"session-reconnects": stats.SessionReconnects - min(stats.SessionReconnects, c.stats.SessionReconnects),
+			"share-reconnects":   stats.ShareReconnects - min(stats.ShareReconnects, c.stats.ShareReconnects),
+		})
+	}
+
+	c.stats = driveradmin.CifsStats{
+		SessionReconnects: stats.SessionReconnects,
+		ShareReconnects:   stats.ShareReconnects,
+		Volumes:           volumes,
+	}
+	c.read = true
+
+	for target := range c.shares {
+		if !hasVolume(volumes, target) {
+			delete(c.shares, target)
+		}
+	}
+}
+
+// CifsStats returns the statistics as of the last check.
+func (c *CifsStatsMonitor) CifsStats(env dockerdriver.Env) driveradmin.CifsStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Volumes = append([]driveradmin.VolumeCifsStats{}, c.stats.Volumes...)
+	return stats
+}
+
+func (c *CifsStatsMonitor) volumeStats(mount driveradmin.Mount, shares map[string]cifsstats.ShareStats, sessions map[string]cifsstats.Session, now time.Time) driveradmin.VolumeCifsStats {
+	volume := driveradmin.VolumeCifsStats{Target: mount.Target, Source: mount.Source, CheckedAt: now}
+
+	// The kernel lists the share that was actually mounted, which differs
+	// from the source when it is a DFS path.
+	mounted := mount.Share
+	if mounted == "" {
+		mounted = mount.Source
+	}
+
+	source, err := smbsource.Parse(mounted)
+	if err != nil {
+		volume.Err = err.Error()
+		return volume
+	}
+	key := strings.ToLower(source.Host) + `\` + strings.ToLower(source.Share)
+
+	share, ok := shares[key]
+	if !ok {
+		volume.Err = "the share is not listed in " + cifsstats.StatsPath
+		return volume
+	}
+
+	volume.Share = share.Name
+	volume.SMBs = share.SMBs
+	volume.BytesRead = share.BytesRead
+	volume.BytesWritten = share.BytesWritten
+	volume.Operations = map[string]driveradmin.CifsOperation{}
+	for name, operation := range share.Operations {
+		volume.Operations[name] = driveradmin.CifsOperation{Sent: operation.Sent, Failed: operation.Failed}
+	}
+
+	volume.SessionStatus = cifsstats.SessionUnknown.String()
+	volume.Disconnected = share.Disconnected
+	if session, ok := sessions[key]; ok {
+		volume.SessionStatus = session.Status.String()
+		if session.Status != cifsstats.SessionUnknown && session.Status != cifsstats.SessionGood {
+			volume.Disconnected = true
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	previous, seen := c.shares[mount.Target]
+	if seen {
+		elapsed := now.Sub(previous.checkedAt).Seconds()
+		if elapsed > 0 && share.SMBs >= previous.smbs {
+			volume.OperationsPerSecond = float64(share.SMBs-previous.smbs) / elapsed
+		}
+	}
+
+	data := lager.Data{"target": mount.Target, "source": mount.Source, "share": share.Name, "session-status": volume.SessionStatus}
+	switch {
+	case volume.Disconnected && !previous.disconnected:
+		c.logger.Info("cifs-share-disconnected", data)
+	case !volume.Disconnected && previous.disconnected:
+		c.logger.Info("cifs-share-reconnected", data)
+	}
+
+	c.shares[mount.Target] = cifsShareState{smbs: share.SMBs, checkedAt: now, disconnected: volume.Disconnected}
+	return volume
+}
+
+// readStats and readDebugData treat a missing file as empty, since the
+// files only exist once the cifs module is loaded.
+func (c *CifsStatsMonitor) readStats() (cifsstats.Stats, error) {
+	b, err := c.readFile(cifsstats.StatsPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cifsstats.Stats{}, nil
+	}
+	if err != nil {
+		return cifsstats.Stats{}, err
+	}
+	return cifsstats.ParseStats(b)
+}
+
+func (c *CifsStatsMonitor) readDebugData() (cifsstats.DebugData, error) {
+	b, err := c.readFile(cifsstats.DebugDataPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cifsstats.DebugData{}, nil
+	}
+	if err != nil {
+		return cifsstats.DebugData{}, err
+	}
+	return cifsstats.ParseDebugData(b)
+}
+
+// shareKey turns a kernel share name, \\server\share, into the key used to
+// match it with the source of a volume. Names are case insensitive.
+func shareKey(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, `\\`))
+}
+
+func hasVolume(volumes []driveradmin.VolumeCifsStats, target string) bool {
+	for _, volume := range volumes {
+		if volume.Target == target {
+			return true
+		}
+	}
+	return false
+}
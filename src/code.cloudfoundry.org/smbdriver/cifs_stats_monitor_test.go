@@ -0,0 +1,262 @@
+package smbdriver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/cifsstats"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+const cifsStats = `Resources in use
+CIFS Session: 1
+Share (unique mount targets): 2
+
+%d session %d share reconnects
+
+Max requests in flight: 8
+1) \\Server\A
+SMBs: %d
+Bytes read: 4096  Bytes written: 8192
+Creates: 400 total 3 failed
+Writes: 200 total 1 failed
+2) \\server\b%s
+SMBs: 7
+`
+
+const cifsDebugData = `Servers:
+1) ConnectionId: 0x1 Hostname: server
+	Sessions:
+	1) Address: 10.0.0.10 Uses: 1 Capability: 0x300067	Session Status: %d
+	Shares:
+	0) IPC: \\server\IPC$ Mounts: 1 DevInfo: 0x0 Attributes: 0x0
+	1) \\Server\A Mounts: 1 DevInfo: 0x20 Attributes: 0x1006f
+	2) \\server\b Mounts: 1 DevInfo: 0x20 Attributes: 0x1006f
+`
+
+var _ = Describe("CifsStatsMonitor", func() {
+	var (
+		logger    *lagertest.TestLogger
+		env       dockerdriver.Env
+		fakeClock *fakeclock.FakeClock
+		mounts    *smbdriverfakes.FakeMountLister
+		mutex     sync.Mutex
+		files     map[string]string
+		readErr   error
+		subject   *smbdriver.CifsStatsMonitor
+	)
+
+	setFiles := func(sessionReconnects, shareReconnects, smbs int, disconnected string, sessionStatus int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		files = map[string]string{
+			cifsstats.StatsPath:     fmt.Sprintf(cifsStats, sessionReconnects, shareReconnects, smbs, disconnected),
+			cifsstats.DebugDataPath: fmt.Sprintf(cifsDebugData, sessionStatus),
+		}
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("cifs-stats-monitor")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		fakeClock = fakeclock.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+
+		mounts = &smbdriverfakes.FakeMountLister{}
+		mounts.MountsReturns([]driveradmin.Mount{
+			{Target: "/mnt/b", Source: "//server/b"},
+			{Target: "/mnt/a", Source: "//server/a/folder"},
+			{Target: "/mnt/c", Source: "//other/c"},
+		})
+
+		setFiles(1, 2, 1200, "", 1)
+		readErr = nil
+	})
+
+	JustBeforeEach(func() {
+		readFile := func(path string) ([]byte, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if readErr != nil {
+				return nil, readErr
+			}
+			content, ok := files[path]
+			if !ok {
+				return nil, fs.ErrNotExist
+			}
+			return []byte(content), nil
+		}
+
+		subject = smbdriver.NewCifsStatsMonitor(logger, mounts, readFile, time.Minute, fakeClock)
+	})
+
+	It("reports nothing before the first check", func() {
+		Expect(subject.CifsStats(env)).To(Equal(driveradmin.CifsStats{Volumes: []driveradmin.VolumeCifsStats{}}))
+	})
+
+	It("maps the shares of the kernel to the mounted volumes", func() {
+		subject.Check(env)
+
+		stats := subject.CifsStats(env)
+		Expect(stats.SessionReconnects).To(Equal(uint64(1)))
+		Expect(stats.ShareReconnects).To(Equal(uint64(2)))
+		Expect(stats.Volumes).To(Equal([]driveradmin.VolumeCifsStats{
+			{
+				Target:        "/mnt/a",
+				Source:        "//server/a/folder",
+				Share:         `\\Server\A`,
+				SessionStatus: "good",
+				SMBs:          1200,
+				BytesRead:     4096,
+				BytesWritten:  8192,
+				Operations: map[string]driveradmin.CifsOperation{
+					"Creates": {Sent: 400, Failed: 3},
+					"Writes":  {Sent: 200, Failed: 1},
+				},
+				CheckedAt: fakeClock.Now(),
+			},
+			{
+				Target:        "/mnt/b",
+				Source:        "//server/b",
+				Share:         `\\server\b`,
+				SessionStatus: "good",
+				SMBs:          7,
+				Operations:    map[string]driveradmin.CifsOperation{},
+				CheckedAt:     fakeClock.Now(),
+			},
+			{
+				Target:    "/mnt/c",
+				Source:    "//other/c",
+				CheckedAt: fakeClock.Now(),
+				Err:       "the share is not listed in /proc/fs/cifs/Stats",
+			},
+		}))
+	})
+
+	Context("when a volume mounted a DFS target", func() {
+		BeforeEach(func() {
+			mounts.MountsReturns([]driveradmin.Mount{
+				{Target: "/mnt/dfs", Source: "//corp/namespace/b", Share: "//server/b"},
+			})
+		})
+
+		It("maps the share that was mounted to the volume", func() {
+			subject.Check(env)
+
+			volumes := subject.CifsStats(env).Volumes
+			Expect(volumes).To(HaveLen(1))
+			Expect(volumes[0].Source).To(Equal("//corp/namespace/b"))
+			Expect(volumes[0].Share).To(Equal(`\\server\b`))
+			Expect(volumes[0].SMBs).To(Equal(uint64(7)))
+			Expect(volumes[0].Err).To(BeEmpty())
+		})
+	})
+
+	It("reports the rate of operations since the last check", func() {
+		subject.Check(env)
+
+		fakeClock.Increment(time.Minute)
+		setFiles(1, 2, 1800, "", 1)
+		subject.Check(env)
+
+		Expect(subject.CifsStats(env).Volumes[0].OperationsPerSecond).To(Equal(10.0))
+		Expect(subject.CifsStats(env).Volumes[1].OperationsPerSecond).To(Equal(0.0))
+	})
+
+	It("logs reconnects", func() {
+		subject.Check(env)
+		Expect(logger.Buffer()).NotTo(gbytes.Say("cifs-reconnects"))
+
+		setFiles(3, 2, 1200, "", 1)
+		subject.Check(env)
+		Expect(logger.Buffer()).To(gbytes.Say(`cifs-reconnects.*"session-reconnects":2,"share-reconnects":0`))
+	})
+
+	It("logs when a share is disconnected and reconnected", func() {
+		subject.Check(env)
+
+		setFiles(1, 2, 1200, "\tDISCONNECTED", 1)
+		subject.Check(env)
+		Expect(logger.Buffer()).To(gbytes.Say(`cifs-share-disconnected.*"share":"\\\\\\\\server\\\\b".*"target":"/mnt/b"`))
+		Expect(subject.CifsStats(env).Volumes[1].Disconnected).To(BeTrue())
+
+		subject.Check(env)
+		Expect(logger.Buffer()).NotTo(gbytes.Say("cifs-share-disconnected"))
+
+		setFiles(1, 3, 1200, "", 1)
+		subject.Check(env)
+		Expect(logger.Buffer()).To(gbytes.Say(`cifs-share-reconnected.*"target":"/mnt/b"`))
+	})
+
+	It("reports the shares of a session that needs to reconnect as disconnected", func() {
+		setFiles(1, 2, 1200, "", 3)
+		subject.Check(env)
+
+		volumes := subject.CifsStats(env).Volumes
+		Expect(volumes[0].Disconnected).To(BeTrue())
+		Expect(volumes[0].SessionStatus).To(Equal("need-reconnect"))
+		Expect(volumes[1].Disconnected).To(BeTrue())
+		Expect(logger.Buffer()).To(gbytes.Say(`cifs-share-disconnected.*"target":"/mnt/a"`))
+	})
+
+	Context("when the cifs module is not loaded", func() {
+		BeforeEach(func() {
+			files = map[string]string{}
+		})
+
+		It("reports no shares", func() {
+			subject.Check(env)
+
+			stats := subject.CifsStats(env)
+			Expect(stats.SessionReconnects).To(BeZero())
+			Expect(stats.Volumes).To(HaveLen(3))
+			Expect(stats.Volumes[0].Err).To(Equal("the share is not listed in /proc/fs/cifs/Stats"))
+		})
+	})
+
+	Context("when the statistics cannot be read", func() {
+		BeforeEach(func() {
+			readErr = errors.New("permission denied")
+		})
+
+		It("logs the error and keeps the last statistics", func() {
+			subject.Check(env)
+
+			Expect(logger.Buffer()).To(gbytes.Say(`error-reading-cifs-stats.*permission denied`))
+			Expect(subject.CifsStats(env).Volumes).To(BeEmpty())
+		})
+	})
+
+	Context("when run", func() {
+		var process ifrit.Process
+
+		JustBeforeEach(func() {
+			process = ifrit.Invoke(subject)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+		})
+
+		It("reads the statistics every interval", func() {
+			Expect(subject.CifsStats(env).Volumes).To(BeEmpty())
+
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(func() []driveradmin.VolumeCifsStats { return subject.CifsStats(env).Volumes }).Should(HaveLen(3))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package cifsstats_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCifsstats(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cifsstats Suite")
+}
@@ -0,0 +1,107 @@
+package cifsstats
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SessionStatus is the state of an SMB session as printed by the kernel.
+type SessionStatus int
+
+// The values shared by the kernel's session status enums.
+const (
+	SessionUnknown       SessionStatus = -1
+	SessionNew           SessionStatus = 0
+	SessionGood          SessionStatus = 1
+	SessionExiting       SessionStatus = 2
+	SessionNeedReconnect SessionStatus = 3
+)
+
+func (s SessionStatus) String() string {
+	switch s {
+	case SessionUnknown:
+		return "unknown"
+	case SessionNew:
+		return "new"
+	case SessionGood:
+		return "good"
+	case SessionExiting:
+		return "exiting"
+	case SessionNeedReconnect:
+		return "need-reconnect"
+	default:
+		return "in-setup"
+	}
+}
+
+// DebugShare is a share listed under a session in DebugData.
+type DebugShare struct {
+	Name         string // \\server\share as mounted
+	Mounts       int
+	Disconnected bool
+}
+
+// Session is an SMB session listed in DebugData.
+type Session struct {
+	Server  string
+	Address string
+	Status  SessionStatus
+	Shares  []DebugShare
+}
+
+// DebugData is the session state in /proc/fs/cifs/DebugData.
+type DebugData struct {
+	Sessions []Session
+}
+
+var (
+	hostnameField      = regexp.MustCompile(`Hostname: (\S+)`)
+	sessionStartLine   = regexp.MustCompile(`^\d+\) (?:Address|Name): (\S+)`)
+	sessionStatusField = regexp.MustCompile(`(?i)session status: (\d+)`)
+	debugShareLine     = regexp.MustCompile(`^\d+\) (IPC: )?(\\\\.*?) Mounts: (\d+)`)
+)
+
+// ParseDebugData parses the servers, sessions and shares of
+// /proc/fs/cifs/DebugData. IPC$ connections are left out.
+func ParseDebugData(b []byte) (DebugData, error) {
+	var data DebugData
+	var server string
+	var session *Session
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if m := debugShareLine.FindStringSubmatch(line); m != nil {
+			if session == nil || m[1] != "" {
+				continue
+			}
+			mounts, _ := strconv.Atoi(m[3])
+			session.Shares = append(session.Shares, DebugShare{
+				Name:         m[2],
+				Mounts:       mounts,
+				Disconnected: strings.Contains(line, "DISCONNECTED"),
+			})
+			continue
+		}
+
+		if m := hostnameField.FindStringSubmatch(line); m != nil {
+			server = m[1]
+		}
+
+		if m := sessionStartLine.FindStringSubmatch(line); m != nil {
+			data.Sessions = append(data.Sessions, Session{Server: server, Address: m[1], Status: SessionUnknown})
+			session = &data.Sessions[len(data.Sessions)-1]
+		}
+
+		if m := sessionStatusField.FindStringSubmatch(line); m != nil && session != nil {
+			status, _ := strconv.Atoi(m[1])
+			session.Status = SessionStatus(status)
+		}
+	}
+
+	return data, scanner.Err()
+}
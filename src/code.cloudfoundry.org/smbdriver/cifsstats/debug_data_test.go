@@ -0,0 +1,92 @@
+package cifsstats_test
+
+import (
+	"code.cloudfoundry.org/smbdriver/cifsstats"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const debugData = `Display Internal CIFS Data Structures for Debugging
+---------------------------------------------------
+CIFS Version 2.40
+Features: DFS,FSCACHE,STATS2,DEBUG,ALLOW_INSECURE_LEGACY,CIFS_POSIX,UPCALL(SPNEGO),XATTR,ACL,WITNESS
+CIFSMaxBufSize: 16384
+Active VFS Requests: 0
+
+Servers:
+1) ConnectionId: 0x1 Hostname: fs1
+Number of credits: 512,1,1 Dialect 0x311
+Server capabilities: 0x300067
+TCP status: 1 Instance: 1
+Local Users To Server: 1 SecMode: 0x1 Req On Wire: 0 Net namespace: 4026531840
+In Send: 0 In MaxReq Wait: 0
+
+	Sessions: 
+	1) Address: 10.0.0.10 Uses: 1 Capability: 0x300067	Session Status: 1 
+	Security type: RawNTLMSSP  SessionId: 0x3c0a4800000035
+	User: 0 Cred User: 0
+
+	Shares: 
+	0) IPC: \\fs1\IPC$ Mounts: 1 DevInfo: 0x0 Attributes: 0x0
+	PathComponentMax: 0 Status: 1 type: 0 Serial Number: 0x0
+	Share Capabilities: None	Share Flags: 0x0
+	tid: 0x1	Maximal Access: 0x1f00a9
+
+	1) \\fs1\data Mounts: 2 DevInfo: 0x20 Attributes: 0x1006f
+	PathComponentMax: 255 Status: 1 type: DISK Serial Number: 0x6a1cc4e5
+	Share Capabilities: None Aligned, Partition Aligned,	Share Flags: 0x0
+	tid: 0x5	Optimal sector size: 0x200	Maximal Access: 0x1f01ff
+
+	MIDs: 
+
+2) ConnectionId: 0x2 Hostname: fs2
+Number of credits: 0,0,0 Dialect 0x300
+TCP status: 3 Instance: 4
+
+	Sessions: 
+	1) Address: 10.0.0.20 Uses: 1 Capability: 0x300047	Session Status: 3 
+	Security type: RawNTLMSSP  SessionId: 0x9100000000001
+
+	Shares: 
+	1) \\fs2\my share Mounts: 1 DevInfo: 0x20 Attributes: 0x1006f	DISCONNECTED 
+	PathComponentMax: 255 Status: 3 type: DISK Serial Number: 0x0
+`
+
+var _ = Describe("ParseDebugData", func() {
+	It("parses the sessions and their shares", func() {
+		data, err := cifsstats.ParseDebugData([]byte(debugData))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(data.Sessions).To(Equal([]cifsstats.Session{
+			{
+				Server:  "fs1",
+				Address: "10.0.0.10",
+				Status:  cifsstats.SessionGood,
+				Shares:  []cifsstats.DebugShare{{Name: `\\fs1\data`, Mounts: 2}},
+			},
+			{
+				Server:  "fs2",
+				Address: "10.0.0.20",
+				Status:  cifsstats.SessionNeedReconnect,
+				Shares:  []cifsstats.DebugShare{{Name: `\\fs2\my share`, Mounts: 1, Disconnected: true}},
+			},
+		}))
+	})
+
+	It("parses the session status of older kernels", func() {
+		data, err := cifsstats.ParseDebugData([]byte("Servers:\n1) Name: 10.0.0.10 Uses: 1 Capability: 0x300067\tSession Status: 1\tTCP status: 1\n\tShares:\n\t1) \\\\fs1\\data Mounts: 1 DevInfo: 0x20 Attributes: 0x1006f\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data.Sessions).To(Equal([]cifsstats.Session{{
+			Address: "10.0.0.10",
+			Status:  cifsstats.SessionGood,
+			Shares:  []cifsstats.DebugShare{{Name: `\\fs1\data`, Mounts: 1}},
+		}}))
+	})
+
+	It("names the session states", func() {
+		Expect(cifsstats.SessionGood.String()).To(Equal("good"))
+		Expect(cifsstats.SessionNeedReconnect.String()).To(Equal("need-reconnect"))
+		Expect(cifsstats.SessionStatus(4).String()).To(Equal("in-setup"))
+		Expect(cifsstats.SessionUnknown.String()).To(Equal("unknown"))
+	})
+})
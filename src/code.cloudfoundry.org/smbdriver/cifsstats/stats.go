@@ -0,0 +1,97 @@
+// Package cifsstats parses the statistics and session state that the kernel
+// CIFS client publishes in /proc/fs/cifs/Stats and /proc/fs/cifs/DebugData.
+// The formats differ between kernel versions, so lines that are not
+// recognised are skipped rather than rejected.
+package cifsstats
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	StatsPath     = "/proc/fs/cifs/Stats"
+	DebugDataPath = "/proc/fs/cifs/DebugData"
+)
+
+// Operation counts the requests of one kind sent for a share.
+type Operation struct {
+	Sent   uint64
+	Failed uint64
+}
+
+// ShareStats are the counters of a share (a tree connection).
+type ShareStats struct {
+	Name         string // \\server\share as mounted
+	Disconnected bool
+	SMBs         uint64
+	BytesRead    uint64
+	BytesWritten uint64
+	Operations   map[string]Operation
+}
+
+// Stats is the content of /proc/fs/cifs/Stats.
+type Stats struct {
+	SessionReconnects uint64
+	ShareReconnects   uint64
+	Shares            []ShareStats
+}
+
+var (
+	reconnectsLine = regexp.MustCompile(`^(\d+) session (\d+) share reconnects$`)
+	shareLine      = regexp.MustCompile(`^\d+\) (\\\\.*)$`)
+	smbsLine       = regexp.MustCompile(`^SMBs: (\d+)`)
+	bytesLine      = regexp.MustCompile(`^Bytes read: (\d+)\s+Bytes written: (\d+)`)
+	operationLine  = regexp.MustCompile(`^(\w+): (\d+) (?:sent|total) (\d+) failed`)
+)
+
+// ParseStats parses /proc/fs/cifs/Stats.
+func ParseStats(b []byte) (Stats, error) {
+	var stats Stats
+	var share *ShareStats
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if m := reconnectsLine.FindStringSubmatch(line); m != nil {
+			stats.SessionReconnects = parseUint(m[1])
+			stats.ShareReconnects = parseUint(m[2])
+			continue
+		}
+
+		if m := shareLine.FindStringSubmatch(line); m != nil {
+			name, disconnected := strings.CutSuffix(m[1], "DISCONNECTED")
+			stats.Shares = append(stats.Shares, ShareStats{
+				Name:         strings.TrimSpace(name),
+				Disconnected: disconnected,
+				Operations:   map[string]Operation{},
+			})
+			share = &stats.Shares[len(stats.Shares)-1]
+			continue
+		}
+
+		if share == nil {
+			continue
+		}
+
+		if m := smbsLine.FindStringSubmatch(line); m != nil {
+			share.SMBs = parseUint(m[1])
+		} else if m := bytesLine.FindStringSubmatch(line); m != nil {
+			share.BytesRead = parseUint(m[1])
+			share.BytesWritten = parseUint(m[2])
+		} else if m := operationLine.FindStringSubmatch(line); m != nil {
+			share.Operations[m[1]] = Operation{Sent: parseUint(m[2]), Failed: parseUint(m[3])}
+		}
+	}
+
+	return stats, scanner.Err()
+}
+
+func parseUint(s string) uint64 {
+	n, _ := strconv.ParseUint(s, 10, 64)
+	return n
+}
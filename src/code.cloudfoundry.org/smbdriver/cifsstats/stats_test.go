@@ -0,0 +1,75 @@
+package cifsstats_test
+
+import (
+	"code.cloudfoundry.org/smbdriver/cifsstats"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const smb2Stats = `Resources in use
+CIFS Session: 2
+Share (unique mount targets): 3
+SMB Request/Response Buffer: 2 Pool size: 6
+SMB Small Req/Resp Buffer: 2 Pool size: 30
+Total Large 12 Small 1290 Allocations
+Operations (MIDs): 0
+
+3 session 5 share reconnects
+Total vfs operations: 1024 maximum at one time: 4
+
+Max requests in flight: 8
+1) \\fs1\data
+SMBs: 1200
+Bytes read: 4096  Bytes written: 8192
+Open files: 2 total (local), 2 open on server
+TreeConnects: 1 total 0 failed
+TreeDisconnects: 0 total 0 failed
+Creates: 400 total 3 failed
+Closes: 398 total 0 failed
+Flushes: 10 total 0 failed
+Reads: 150 total 0 failed
+Writes: 200 total 1 failed
+Locks: 0 total 0 failed
+IOCTLs: 2 total 0 failed
+QueryDirectories: 20 total 0 failed
+ChangeNotifies: 0 total 0 failed
+QueryInfos: 15 total 0 failed
+SetInfos: 4 total 0 failed
+OplockBreaks: 0 sent 0 failed
+2) \\fs2\my share	DISCONNECTED 
+SMBs: 7
+Creates: 3 total 3 failed
+`
+
+var _ = Describe("ParseStats", func() {
+	It("parses the reconnects and the counters of each share", func() {
+		stats, err := cifsstats.ParseStats([]byte(smb2Stats))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(stats.SessionReconnects).To(Equal(uint64(3)))
+		Expect(stats.ShareReconnects).To(Equal(uint64(5)))
+		Expect(stats.Shares).To(HaveLen(2))
+
+		Expect(stats.Shares[0].Name).To(Equal(`\\fs1\data`))
+		Expect(stats.Shares[0].Disconnected).To(BeFalse())
+		Expect(stats.Shares[0].SMBs).To(Equal(uint64(1200)))
+		Expect(stats.Shares[0].BytesRead).To(Equal(uint64(4096)))
+		Expect(stats.Shares[0].BytesWritten).To(Equal(uint64(8192)))
+		Expect(stats.Shares[0].Operations).To(HaveLen(14))
+		Expect(stats.Shares[0].Operations["Creates"]).To(Equal(cifsstats.Operation{Sent: 400, Failed: 3}))
+		Expect(stats.Shares[0].Operations["OplockBreaks"]).To(Equal(cifsstats.Operation{}))
+
+		Expect(stats.Shares[1]).To(Equal(cifsstats.ShareStats{
+			Name:         `\\fs2\my share`,
+			Disconnected: true,
+			SMBs:         7,
+			Operations:   map[string]cifsstats.Operation{"Creates": {Sent: 3, Failed: 3}},
+		}))
+	})
+
+	It("parses the statistics when nothing is mounted", func() {
+		stats, err := cifsstats.ParseStats([]byte("Resources in use\nCIFS Session: 0\n\n0 session 0 share reconnects\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats).To(Equal(cifsstats.Stats{}))
+	})
+})
@@ -0,0 +1,137 @@
+package smbdriver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+// DefaultCircuitBreakerCoolDown is how long mounts from a server fail
+// immediately once its circuit has opened.
+const DefaultCircuitBreakerCoolDown = 30 * time.Second
+
+type serverCircuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// CircuitBreaker fails the mounts from a server immediately once connecting
+// to it has failed a number of times in a row, so that container starts do
+// not each wait out a mount attempt while the server is down. After a
+// cool-down one probe mount is let through, which closes the circuit when it
+// reaches the server and opens it again when it does not.
+type CircuitBreaker struct {
+	threshold int
+	coolDown  time.Duration
+	clock     clock.Clock
+
+	mutex   sync.Mutex
+	servers map[string]*serverCircuit
+}
+
+// NewCircuitBreaker opens the circuit of a server after threshold
+// consecutive connection failures. A threshold of 0 disables it.
+func NewCircuitBreaker(threshold int, coolDown time.Duration, clock clock.Clock) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		coolDown:  coolDown,
+		clock:     clock,
+		servers:   map[string]*serverCircuit{},
+	}
+}
+
+// CircuitBreakers lists the servers that connections have failed to,
+// ordered by server.
+func (b *CircuitBreaker) CircuitBreakers(env dockerdriver.Env) []driveradmin.CircuitBreaker {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	breakers := []driveradmin.CircuitBreaker{}
+	for server, circuit := range b.servers {
+		breaker := driveradmin.CircuitBreaker{
+			Server:              server,
+			State:               "closed",
+			ConsecutiveFailures: circuit.failures,
+		}
+		if circuit.failures >= b.threshold {
+			breaker.OpenUntil = circuit.openUntil
+			breaker.State = "open"
+			if !b.clock.Now().Before(circuit.openUntil) {
+				breaker.State = "half-open"
+			}
+		}
+		breakers = append(breakers, breaker)
+	}
+	sort.Slice(breakers, func(i, j int) bool { return breakers[i].Server < breakers[j].Server })
+
+	return breakers
+}
+
+// allow returns an error when mounts from host must fail immediately. Once
+// the cool-down has passed, it lets a single probe mount through.
+func (b *CircuitBreaker) allow(host string) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	circuit, ok := b.servers[strings.ToLower(host)]
+	if !ok || circuit.failures < b.threshold {
+		return nil
+	}
+
+	if b.clock.Now().Before(circuit.openUntil) {
+		return dockerdriver.SafeError{SafeDescription: fmt.Sprintf("the SMB server %s is unavailable after %d consecutive connection failures, mounts will be retried after %s",
+			host, circuit.failures, circuit.openUntil.UTC().Format(time.RFC3339))}
+	}
+
+	if circuit.probing {
+		return dockerdriver.SafeError{SafeDescription: fmt.Sprintf("the SMB server %s is unavailable after %d consecutive connection failures, a probe mount is in progress",
+			host, circuit.failures)}
+	}
+
+	circuit.probing = true
+	return nil
+}
+
+// record records the outcome of a mount from host, and returns true when it
+// opened the circuit. Only failures to reach the server count; any answer
+// from the server closes the circuit.
+func (b *CircuitBreaker) record(host string, err error, unreachable bool) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	key := strings.ToLower(host)
+	if err == nil || !unreachable {
+		delete(b.servers, key)
+		return false
+	}
+
+	circuit, ok := b.servers[key]
+	if !ok {
+		circuit = &serverCircuit{}
+		b.servers[key] = circuit
+	}
+
+	circuit.failures++
+	circuit.probing = false
+	if circuit.failures < b.threshold {
+		return false
+	}
+
+	circuit.openUntil = b.clock.Now().Add(b.coolDown)
+	return true
+}
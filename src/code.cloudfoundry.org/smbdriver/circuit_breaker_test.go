@@ -0,0 +1,136 @@
+package smbdriver_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CircuitBreaker", func() {
+	var (
+		clock   *fakeclock.FakeClock
+		env     dockerdriver.Env
+		breaker *smbdriver.CircuitBreaker
+
+		unreachable = errors.New("mount error(113): No route to host")
+	)
+
+	BeforeEach(func() {
+		clock = fakeclock.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("circuit-breaker"), context.TODO())
+		breaker = smbdriver.NewCircuitBreaker(2, 30*time.Second, clock)
+	})
+
+	It("allows mounts from servers it has not seen", func() {
+		Expect(breaker.Allow("nas")).To(Succeed())
+		Expect(breaker.CircuitBreakers(env)).To(BeEmpty())
+	})
+
+	Context("when connecting to a server fails fewer times than the threshold", func() {
+		BeforeEach(func() {
+			Expect(breaker.Record("nas", unreachable, true)).To(BeFalse())
+		})
+
+		It("keeps the circuit closed", func() {
+			Expect(breaker.Allow("nas")).To(Succeed())
+			Expect(breaker.CircuitBreakers(env)).To(Equal([]driveradmin.CircuitBreaker{
+				{Server: "nas", State: "closed", ConsecutiveFailures: 1},
+			}))
+		})
+
+		It("forgets the failures once a mount succeeds", func() {
+			Expect(breaker.Record("nas", nil, false)).To(BeFalse())
+			Expect(breaker.CircuitBreakers(env)).To(BeEmpty())
+		})
+
+		It("forgets the failures once the server answers", func() {
+			Expect(breaker.Record("nas", errors.New("mount error(13): Permission denied"), false)).To(BeFalse())
+			Expect(breaker.CircuitBreakers(env)).To(BeEmpty())
+		})
+	})
+
+	Context("when connecting to a server fails as many times as the threshold", func() {
+		var opened bool
+
+		BeforeEach(func() {
+			breaker.Record("NAS", unreachable, true)
+			opened = breaker.Record("nas", unreachable, true)
+		})
+
+		It("opens the circuit of the server regardless of case", func() {
+			Expect(opened).To(BeTrue())
+			Expect(breaker.CircuitBreakers(env)).To(Equal([]driveradmin.CircuitBreaker{
+				{Server: "nas", State: "open", ConsecutiveFailures: 2, OpenUntil: clock.Now().Add(30 * time.Second)},
+			}))
+		})
+
+		It("fails mounts from the server with a safe error", func() {
+			err := breaker.Allow("Nas")
+			Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+			Expect(err).To(MatchError("the SMB server Nas is unavailable after 2 consecutive connection failures, mounts will be retried after 2024-03-01T12:00:30Z"))
+		})
+
+		It("allows mounts from other servers", func() {
+			Expect(breaker.Allow("other-nas")).To(Succeed())
+		})
+
+		Context("and the cool-down has passed", func() {
+			BeforeEach(func() {
+				clock.Increment(30 * time.Second)
+			})
+
+			It("is half-open", func() {
+				Expect(breaker.CircuitBreakers(env)[0].State).To(Equal("half-open"))
+			})
+
+			It("lets a single probe mount through", func() {
+				Expect(breaker.Allow("nas")).To(Succeed())
+
+				err := breaker.Allow("nas")
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				Expect(err).To(MatchError("the SMB server nas is unavailable after 2 consecutive connection failures, a probe mount is in progress"))
+			})
+
+			It("closes the circuit when the probe reaches the server", func() {
+				Expect(breaker.Allow("nas")).To(Succeed())
+				Expect(breaker.Record("nas", nil, false)).To(BeFalse())
+
+				Expect(breaker.CircuitBreakers(env)).To(BeEmpty())
+				Expect(breaker.Allow("nas")).To(Succeed())
+			})
+
+			It("opens the circuit again when the probe fails", func() {
+				Expect(breaker.Allow("nas")).To(Succeed())
+				Expect(breaker.Record("nas", unreachable, true)).To(BeTrue())
+
+				Expect(breaker.CircuitBreakers(env)).To(Equal([]driveradmin.CircuitBreaker{
+					{Server: "nas", State: "open", ConsecutiveFailures: 3, OpenUntil: clock.Now().Add(30 * time.Second)},
+				}))
+				Expect(breaker.Allow("nas")).To(MatchError(ContainSubstring("mounts will be retried after 2024-03-01T12:01:00Z")))
+			})
+		})
+	})
+
+	Context("when the threshold is 0", func() {
+		BeforeEach(func() {
+			breaker = smbdriver.NewCircuitBreaker(0, 30*time.Second, clock)
+		})
+
+		It("never opens the circuit", func() {
+			for i := 0; i < 5; i++ {
+				Expect(breaker.Record("nas", unreachable, true)).To(BeFalse())
+			}
+			Expect(breaker.Allow("nas")).To(Succeed())
+			Expect(breaker.CircuitBreakers(env)).To(BeEmpty())
+		})
+	})
+})
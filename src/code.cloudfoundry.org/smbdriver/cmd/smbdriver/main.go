@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime/debug"
 	"strconv"
+	"strings"
 
+	"code.cloudfoundry.org/clock"
 	cf_debug_server "code.cloudfoundry.org/debugserver"
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
@@ -17,13 +23,24 @@ import (
 	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/lager/v3/lagerflags"
 	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/csinode"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
 	"code.cloudfoundry.org/smbdriver/driveradmin/driveradminhttp"
 	"code.cloudfoundry.org/smbdriver/driveradmin/driveradminlocal"
+	"code.cloudfoundry.org/smbdriver/idmap"
+	"code.cloudfoundry.org/smbdriver/kmsg"
+	"code.cloudfoundry.org/smbdriver/smbdfs"
+	"code.cloudfoundry.org/smbdriver/smbfault"
+	"code.cloudfoundry.org/smbdriver/smbfuse"
+	"code.cloudfoundry.org/smbdriver/smbpreflight"
+	"code.cloudfoundry.org/smbdriver/smbtrace"
+	"code.cloudfoundry.org/smbdriver/smbtuning"
 	"code.cloudfoundry.org/tlsconfig"
 	"code.cloudfoundry.org/volumedriver"
 	"code.cloudfoundry.org/volumedriver/invoker"
 	"code.cloudfoundry.org/volumedriver/mountchecker"
 	"code.cloudfoundry.org/volumedriver/oshelper"
+	"github.com/openzipkin/zipkin-go"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
 	"github.com/tedsuo/ifrit/http_server"
@@ -42,6 +59,36 @@ var adminPort = flag.Int(
 	"Port to serve process admin functions",
 )
 
+var adminCaFile = flag.String(
+	"adminCaFile",
+	"",
+	"(optional) - The certificate authority public key file that admin clients must present a certificate from. Serves the admin functions with mutual TLS when set",
+)
+
+var adminCertFile = flag.String(
+	"adminCertFile",
+	"",
+	"(optional) - The public key file to serve the admin functions with mutual TLS",
+)
+
+var adminKeyFile = flag.String(
+	"adminKeyFile",
+	"",
+	"(optional) - The private key file to serve the admin functions with mutual TLS",
+)
+
+var adminWriteCommonNames = flag.String(
+	"adminWriteCommonNames",
+	"",
+	"(optional) - Comma separated list of client certificate common names that may evacuate the driver. When empty every admin client certificate may",
+)
+
+var adminTokenFile = flag.String(
+	"adminTokenFile",
+	"",
+	"(optional) - Path to a JSON file of bearer tokens that grant read or write access to the admin functions",
+)
+
 var driversPath = flag.String(
 	"driversPath",
 	"",
@@ -51,7 +98,49 @@ var driversPath = flag.String(
 var transport = flag.String(
 	"transport",
 	"tcp",
-	"Transport protocol to transmit HTTP over",
+	"Transport protocol to transmit HTTP over: tcp, tcp-json or unix, or csi to serve the CSI Identity and Node services on csiSocket instead",
+)
+
+var socketPath = flag.String(
+	"socketPath",
+	"",
+	"Path of the unix socket to serve volume management functions on when the transport is unix. Defaults to smbdriver.sock in driversPath",
+)
+
+var socketOwner = flag.String(
+	"socketOwner",
+	"",
+	"User name or uid that owns the unix socket. Defaults to the user of the smbdriver",
+)
+
+var socketGroup = flag.String(
+	"socketGroup",
+	"",
+	"Group name or gid of the unix socket. Defaults to the group of the smbdriver",
+)
+
+var socketMode = flag.String(
+	"socketMode",
+	"0660",
+	"Octal file mode of the unix socket",
+)
+
+var csiSocket = flag.String(
+	"csiSocket",
+	"/var/lib/kubelet/plugins/smb.csi.cloudfoundry.org/csi.sock",
+	"Path of the unix socket to serve the CSI services on when the transport is csi",
+)
+
+var csiDriverName = flag.String(
+	"csiDriverName",
+	csinode.DefaultDriverName,
+	"Name of the CSI plugin",
+)
+
+var csiNodeID = flag.String(
+	"csiNodeID",
+	"",
+	"ID of the node reported to the CSI container orchestrator. Defaults to the hostname",
 )
 
 var mountDir = flag.String(
@@ -136,13 +225,131 @@ var forceNoDfs = flag.Bool(
 	"Force all smb mounts to use the 'nodfs' mount flag, regardless of what the service binding asks for",
 )
 
+var resolveDfs = flag.Bool(
+	"resolveDfs",
+	false,
+	"Resolve DFS referrals in the driver and mount the target shares directly with the 'nodfs' mount flag",
+)
+
+var circuitBreakerThreshold = flag.Int(
+	"circuitBreakerThreshold",
+	0,
+	"Number of consecutive connection failures after which mounts from an SMB server fail immediately for circuitBreakerCoolDown. Disabled when 0",
+)
+
+var circuitBreakerCoolDown = flag.Duration(
+	"circuitBreakerCoolDown",
+	smbdriver.DefaultCircuitBreakerCoolDown,
+	"How long mounts from an SMB server fail immediately once its circuit breaker has opened, before a probe mount is let through",
+)
+
+var capacityCheckInterval = flag.Duration(
+	"capacityCheckInterval",
+	smbdriver.DefaultCapacityCheckInterval,
+	"How often the capacity and usage of the mounted volumes is checked with statfs. Disabled when 0",
+)
+
+var capacityWarningPercent = flag.Int(
+	"capacityWarningPercent",
+	90,
+	"Percentage of the bytes of a volume in use above which a warning is logged. Disabled when 0",
+)
+
+var capacityInodeWarningPercent = flag.Int(
+	"capacityInodeWarningPercent",
+	90,
+	"Percentage of the inodes of a volume in use above which a warning is logged. Disabled when 0",
+)
+
+var cifsStatsInterval = flag.Duration(
+	"cifsStatsInterval",
+	smbdriver.DefaultCifsStatsInterval,
+	"How often the statistics of the kernel CIFS client are read from /proc/fs/cifs. Disabled when 0",
+)
+
+var requireEncryption = flag.Bool(
+	"requireEncryption",
+	false,
+	"Reject SMB mounts that do not use the 'seal' mount option",
+)
+
+var minimumSmbVersion = flag.String(
+	"minimumSmbVersion",
+	"",
+	"(optional) - Reject SMB mounts that do not use at least this SMB version (3.0, 3.02 or 3.1.1)",
+)
+
+var securityPolicyServers = flag.String(
+	"securityPolicyServers",
+	"",
+	"(optional) - Comma separated list of server host patterns that requireEncryption and minimumSmbVersion apply to. Applies to all servers when empty",
+)
+
+var tuningProfiles = flag.String(
+	"tuningProfiles",
+	"",
+	"(optional) - Path to a JSON file of named tuning profiles that service bindings can refer to with the 'profile' option",
+)
+
+var personalitiesFile = flag.String(
+	"personalities",
+	"",
+	"(optional) - Path to a JSON file of named driver personalities to serve in addition to smbdriver, each with its own mount options",
+)
+
+var sidMappings = flag.String(
+	"sidMappings",
+	"",
+	"(optional) - Path to the JSON file mapping Windows SIDs to uids and gids for cifsacl and idsfromsid mounts. It is read by smbidmap and validated on start",
+)
+
+var traceExporter = flag.String(
+	"traceExporter",
+	"",
+	"(optional) - Exporter of the spans recorded for driver requests and mounts: zipkin or log. Nothing is recorded when empty",
+)
+
+var traceEndpoint = flag.String(
+	"traceEndpoint",
+	smbtrace.DefaultEndpoint,
+	"(optional) - URL of the zipkin collector that the zipkin exporter sends spans to",
+)
+
+var traceSampleRate = flag.Float64(
+	"traceSampleRate",
+	1,
+	"(optional) - Fraction of the requests without a trace context from volman that start a trace",
+)
+
+var faultInjectionFile = flag.String(
+	"faultInjectionFile",
+	"",
+	"(optional) - Path to the JSON list of faults to inject into mounts, unmounts and checks. Fault injection, including the faults admin route, is disabled when empty. Never set in production",
+)
+
+var mounterKind = flag.String(
+	"mounter",
+	smbdriver.AutoMounter,
+	"(optional) - How shares are mounted: kernel for kernel CIFS mounts, fuse for a userspace SMB client served through FUSE, or auto for kernel CIFS when the cifs module can be loaded and FUSE otherwise",
+)
+
+var preflight = flag.Bool(
+	"preflight",
+	false,
+	"Connect to each share with the credentials of the mount before the kernel mounts it, and fail the mount with the step that failed",
+)
+
+var dryRun = flag.Bool(
+	"dryRun",
+	false,
+	"Validate and translate the options of each mount and log the mount command, but create the mountpoint as a plain directory instead of mounting the share. Never set in production",
+)
+
 const listenAddress = "127.0.0.1"
 
 func main() {
 	parseCommandLine()
 
-	var smbDriverServer ifrit.Runner
-
 	logger, logSink := newLogger()
 	logger.Info("start")
 	defer logger.Info("end")
@@ -150,35 +357,155 @@ func main() {
 	configMask, err := smbdriver.NewSmbVolumeMountMask()
 	exitOnFailure(logger, err)
 
-	mounter := smbdriver.NewSmbMounter(
-		invoker.NewProcessGroupInvoker(),
-		&osshim.OsShim{},
-		configMask,
-		*forceNoserverino,
-		*forceNoDfs,
-	)
+	securityPolicy, err := smbdriver.NewSecurityPolicy(*requireEncryption, *minimumSmbVersion, strings.Split(*securityPolicyServers, ","))
+	exitOnFailure(logger, err)
+
+	profiles, err := smbtuning.LoadProfiles(*tuningProfiles)
+	exitOnFailure(logger, err)
+
+	// The mappings are used by the kernel's idmap upcall rather than the
+	// driver, so they are only loaded to report mistakes early.
+	_, err = idmap.LoadMappings(*sidMappings)
+	exitOnFailure(logger, err)
+
+	personalities, err := smbdriver.LoadPersonalities(*personalitiesFile)
+	exitOnFailure(logger, err)
+
+	tracer, traceReporter, err := smbtrace.NewTracer(smbtrace.Config{
+		Exporter:   *traceExporter,
+		Endpoint:   *traceEndpoint,
+		SampleRate: *traceSampleRate,
+	})
+	exitOnFailure(logger, err)
+	defer traceReporter.Close()
+
+	mountTargets := smbdriver.RestoreMountTargets(logger, filepath.Join(*mountDir, "mount-targets.json"))
+	circuitBreaker := smbdriver.NewCircuitBreaker(*circuitBreakerThreshold, *circuitBreakerCoolDown, clock.NewClock())
+
+	mounterOptions := []smbdriver.MounterOption{
+		smbdriver.WithSecurityPolicy(securityPolicy),
+		smbdriver.WithTuningProfiles(profiles),
+		smbdriver.WithMountTargets(mountTargets),
+		smbdriver.WithKeyringStateFile(filepath.Join(*mountDir, "multiuser-keys.json")),
+		smbdriver.WithCircuitBreaker(circuitBreaker),
+		smbdriver.WithKernelLog(openKernelLog),
+		smbdriver.WithPersonalities(personalities...),
+		smbdriver.WithTracer(tracer),
+	}
+	if *resolveDfs {
+		mounterOptions = append(mounterOptions, smbdriver.WithDfsResolver(smbdfs.NewResolver(smbdfs.GetReferral, smbdfs.DefaultTimeout, clock.NewClock())))
+	}
+	if *preflight {
+		mounterOptions = append(mounterOptions, smbdriver.WithPreflight(smbpreflight.NewChecker(smbpreflight.Probe, smbpreflight.DefaultTimeout)))
+	}
+	if *dryRun {
+		mounterOptions = append(mounterOptions, smbdriver.WithDryRun())
+		logger.Info("dry-run-enabled")
+	}
+
+	var mountInvoker invoker.Invoker = invoker.NewProcessGroupInvoker()
+	var faultInvoker *smbfault.Invoker
+	if *faultInjectionFile != "" {
+		faults, err := smbfault.LoadFaults(*faultInjectionFile)
+		exitOnFailure(logger, err)
+
+		faultInvoker, err = smbfault.NewInvoker(mountInvoker, mountTargets, clock.NewClock(), faults)
+		exitOnFailure(logger, err)
+		mountInvoker = faultInvoker
+		logger.Info("fault-injection-enabled", lager.Data{"faults": faults})
+	}
+
+	smbdriver.ForgetFuseMounts(driverhttp.NewHttpDriverEnv(logger, context.TODO()), mountInvoker, mountTargets)
+
+	var mounter volumedriver.Mounter
+	if chooseMounter(logger) == smbdriver.FuseMounter {
+		mounter = smbdriver.NewFuseMounter(
+			mountInvoker,
+			&osshim.OsShim{},
+			configMask,
+			*forceNoserverino,
+			*forceNoDfs,
+			smbfuse.Mount,
+			mounterOptions...,
+		)
+	} else {
+		mounter = smbdriver.NewSmbMounter(
+			mountInvoker,
+			&osshim.OsShim{},
+			configMask,
+			*forceNoserverino,
+			*forceNoDfs,
+			mounterOptions...,
+		)
+	}
+
+	var mountChecker mountchecker.MountChecker = mountchecker.NewChecker(&bufioshim.BufioShim{}, &osshim.OsShim{})
+	if *dryRun {
+		mountChecker = smbdriver.NewDryRunMountChecker(mountChecker, mountTargets)
+	}
 
 	client := volumedriver.NewVolumeDriver(
 		logger,
 		&osshim.OsShim{},
 		&filepathshim.FilepathShim{},
 		&timeshim.TimeShim{},
-		mountchecker.NewChecker(&bufioshim.BufioShim{}, &osshim.OsShim{}),
+		mountChecker,
 		*mountDir,
 		mounter,
 		oshelper.NewOsHelper(),
 	)
+	tracedClient := smbtrace.NewDriver(tracer, client)
 
-	if *transport == "tcp" {
-		smbDriverServer = createSmbDriverServer(logger, client, *atPort, *driversPath, false)
-	} else if *transport == "tcp-json" {
-		smbDriverServer = createSmbDriverServer(logger, client, *atPort, *driversPath, true)
+	var servers grouper.Members
+	if *transport == "csi" {
+		if len(personalities) > 0 {
+			exitOnFailure(logger, errors.New("personalities cannot be served with the csi transport"))
+		}
+		servers = grouper.Members{
+			{Name: "smbdriver-server", Runner: createCsiServer(logger, mounter)},
+		}
 	} else {
-		smbDriverServer = createSmbDriverUnixServer(logger, client, *atPort)
+		servers = grouper.Members{
+			{Name: "smbdriver-server", Runner: createSmbDriverTransportServer(logger, tracedClient, tracer, smbdriver.DefaultPersonality, *atPort, *socketPath)},
+		}
+
+		// Each personality is served separately, so that its requests are
+		// mounted with its options.
+		ports := map[int]string{*atPort: smbdriver.DefaultPersonality, *adminPort: "driveradmin"}
+		for _, personality := range personalities {
+			if *transport != "unix" {
+				if personality.ListenPort == 0 {
+					exitOnFailure(logger, fmt.Errorf("personality %s has no listen_port", personality.Name))
+				}
+				if other, ok := ports[personality.ListenPort]; ok {
+					exitOnFailure(logger, fmt.Errorf("personality %s listens on port %d of %s", personality.Name, personality.ListenPort, other))
+				}
+				ports[personality.ListenPort] = personality.Name
+			}
+
+			servers = append(servers, grouper.Member{
+				Name:   "smbdriver-server-" + personality.Name,
+				Runner: createSmbDriverTransportServer(logger, tracedClient, tracer, personality.Name, personality.ListenPort, ""),
+			})
+		}
 	}
 
-	servers := grouper.Members{
-		{Name: "smbdriver-server", Runner: smbDriverServer},
+	capacityMonitor := smbdriver.NewCapacityMonitor(
+		logger,
+		mountTargets,
+		smbdriver.Statfs,
+		*capacityCheckInterval,
+		smbdriver.DefaultStatfsTimeout,
+		smbdriver.CapacityThresholds{BytesPercent: *capacityWarningPercent, InodesPercent: *capacityInodeWarningPercent},
+		clock.NewClock(),
+	)
+	if *capacityCheckInterval > 0 {
+		servers = append(servers, grouper.Member{Name: "capacity-monitor", Runner: capacityMonitor})
+	}
+
+	cifsStatsMonitor := smbdriver.NewCifsStatsMonitor(logger, mountTargets, os.ReadFile, *cifsStatsInterval, clock.NewClock())
+	if *cifsStatsInterval > 0 {
+		servers = append(servers, grouper.Member{Name: "cifs-stats-monitor", Runner: cifsStatsMonitor})
 	}
 
 	if dbgAddr := cf_debug_server.DebugAddress(flag.CommandLine); dbgAddr != "" {
@@ -188,9 +515,7 @@ func main() {
 	}
 
 	adminClient := driveradminlocal.NewDriverAdminLocal()
-	adminHandler, _ := driveradminhttp.NewHandler(logger, adminClient)
-	adminAddress := listenAddress + ":" + strconv.Itoa(*adminPort)
-	adminServer := http_server.New(adminAddress, adminHandler)
+	adminServer := createAdminServer(logger, adminClient)
 
 	servers = append(grouper.Members{
 		{Name: "driveradmin", Runner: adminServer},
@@ -201,10 +526,54 @@ func main() {
 
 	adminClient.SetServerProc(process)
 	adminClient.RegisterDrainable(client)
+	if guard, ok := mounter.(driveradmin.EvacuationGuard); ok {
+		adminClient.RegisterEvacuationGuard(guard)
+	}
+	adminClient.RegisterMountLister(mountTargets)
+	adminClient.RegisterCircuitBreakerLister(circuitBreaker)
+	adminClient.RegisterCapacityReporter(capacityMonitor)
+	adminClient.RegisterCifsStatsReporter(cifsStatsMonitor)
+	if faultInvoker != nil {
+		adminClient.RegisterFaultInjector(faultInvoker)
+	}
 
 	untilTerminated(logger, process)
 }
 
+func openKernelLog() (smbdriver.KernelLog, error) {
+	reader, err := kmsg.Open(kmsg.Path)
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// chooseMounter returns the mounter selected by the mounter flag, which for
+// auto is the kernel unless the cifs module cannot be loaded.
+func chooseMounter(logger lager.Logger) string {
+	kind := *mounterKind
+	switch kind {
+	case smbdriver.KernelMounter:
+	case smbdriver.FuseMounter:
+		if *dryRun {
+			exitOnFailure(logger, fmt.Errorf("dryRun is not supported with the fuse mounter"))
+		}
+	case smbdriver.AutoMounter:
+		env := driverhttp.NewHttpDriverEnv(logger, context.Background())
+		kind = smbdriver.KernelMounter
+		// A dry run never mounts, so it does not load the cifs module either.
+		if !*dryRun && !smbdriver.KernelCifsAvailable(env, os.ReadFile, invoker.NewProcessGroupInvoker()) {
+			logger.Info("kernel-cifs-unavailable")
+			kind = smbdriver.FuseMounter
+		}
+	default:
+		exitOnFailure(logger, fmt.Errorf("%q is not a valid mounter, expected kernel, fuse or auto", kind))
+	}
+
+	logger.Info("mounter-selected", lager.Data{"mounter": kind})
+	return kind
+}
+
 func exitOnFailure(logger lager.Logger, err error) {
 	if err != nil {
 		logger.Fatal("fatal-err-aborting", err)
@@ -220,12 +589,25 @@ func processRunnerFor(servers grouper.Members) ifrit.Runner {
 	return sigmon.New(grouper.NewOrdered(os.Interrupt, servers))
 }
 
-func createSmbDriverServer(logger lager.Logger, client dockerdriver.Driver, atPort int, driversPath string, jsonSpec bool) ifrit.Runner {
+// createSmbDriverTransportServer serves the driver API of the named
+// personality on the port or unix socket of the transport.
+func createSmbDriverTransportServer(logger lager.Logger, client dockerdriver.Driver, tracer *zipkin.Tracer, name string, atPort int, socketPath string) ifrit.Runner {
+	switch *transport {
+	case "tcp":
+		return createSmbDriverServer(logger, client, tracer, name, atPort, *driversPath, false)
+	case "tcp-json":
+		return createSmbDriverServer(logger, client, tracer, name, atPort, *driversPath, true)
+	default:
+		return createSmbDriverUnixServer(logger, client, tracer, name, socketPath, *driversPath)
+	}
+}
+
+func createSmbDriverServer(logger lager.Logger, client dockerdriver.Driver, tracer *zipkin.Tracer, name string, atPort int, driversPath string, jsonSpec bool) ifrit.Runner {
 	atAddress := listenAddress + ":" + strconv.Itoa(atPort)
 	advertisedUrl := "http://" + atAddress
-	logger.Info("writing-spec-file", lager.Data{"location": driversPath, "name": "smbdriver", "address": advertisedUrl, "unique-volume-ids": true})
+	logger.Info("writing-spec-file", lager.Data{"location": driversPath, "name": name, "address": advertisedUrl, "unique-volume-ids": true})
 	if jsonSpec {
-		driverJsonSpec := dockerdriver.DriverSpec{Name: "smbdriver", Address: advertisedUrl, UniqueVolumeIds: true}
+		driverJsonSpec := dockerdriver.DriverSpec{Name: name, Address: advertisedUrl, UniqueVolumeIds: true}
 
 		if *requireSSL {
 			absCaFile, err := filepath.Abs(*caFile)
@@ -241,15 +623,16 @@ func createSmbDriverServer(logger lager.Logger, client dockerdriver.Driver, atPo
 		jsonBytes, err := json.Marshal(driverJsonSpec)
 
 		exitOnFailure(logger, err)
-		err = dockerdriver.WriteDriverSpec(logger, driversPath, "smbdriver", "json", jsonBytes)
+		err = dockerdriver.WriteDriverSpec(logger, driversPath, name, "json", jsonBytes)
 		exitOnFailure(logger, err)
 	} else {
-		err := dockerdriver.WriteDriverSpec(logger, driversPath, "smbdriver", "spec", []byte(advertisedUrl))
+		err := dockerdriver.WriteDriverSpec(logger, driversPath, name, "spec", []byte(advertisedUrl))
 		exitOnFailure(logger, err)
 	}
 
 	handler, err := driverhttp.NewHandler(logger, client)
 	exitOnFailure(logger, err)
+	handler = smbtrace.NewHandler(tracer, smbdriver.NewPersonalityHandler(name, handler))
 
 	var server ifrit.Runner
 	if *requireSSL {
@@ -270,11 +653,95 @@ func createSmbDriverServer(logger lager.Logger, client dockerdriver.Driver, atPo
 	return server
 }
 
-func createSmbDriverUnixServer(logger lager.Logger, client dockerdriver.Driver, atPort int) ifrit.Runner {
-	atAddress := listenAddress + ":" + strconv.Itoa(atPort)
+func createAdminServer(logger lager.Logger, client driveradmin.DriverAdmin) ifrit.Runner {
+	adminAddress := listenAddress + ":" + strconv.Itoa(*adminPort)
+
+	if *adminCaFile == "" && *adminTokenFile == "" {
+		adminHandler, err := driveradminhttp.NewHandler(logger, client)
+		exitOnFailure(logger, err)
+		return http_server.New(adminAddress, adminHandler)
+	}
+
+	var tokens []driveradminhttp.Token
+	if *adminTokenFile != "" {
+		var err error
+		tokens, err = driveradminhttp.LoadTokens(*adminTokenFile)
+		exitOnFailure(logger, err)
+	}
+
+	var writeCommonNames []string
+	for _, commonName := range strings.Split(*adminWriteCommonNames, ",") {
+		if commonName = strings.TrimSpace(commonName); commonName != "" {
+			writeCommonNames = append(writeCommonNames, commonName)
+		}
+	}
+
+	authenticator := driveradminhttp.NewAuthenticator(tokens, writeCommonNames)
+	adminHandler, err := driveradminhttp.NewAuthenticatedHandler(logger, client, authenticator)
+	exitOnFailure(logger, err)
+
+	if *adminCaFile == "" {
+		return http_server.New(adminAddress, adminHandler)
+	}
+
+	tlsConfig, err := tlsconfig.
+		Build(
+			tlsconfig.WithIdentityFromFile(*adminCertFile, *adminKeyFile),
+			tlsconfig.WithInternalServiceDefaults(),
+		).
+		Server(tlsconfig.WithClientAuthenticationFromFile(*adminCaFile))
+	if err != nil {
+		logger.Fatal("admin-tls-configuration-failed", err)
+	}
+	return http_server.NewTLSServer(adminAddress, adminHandler, tlsConfig)
+}
+
+func createCsiServer(logger lager.Logger, mounter volumedriver.Mounter) ifrit.Runner {
+	nodeID := *csiNodeID
+	if nodeID == "" {
+		hostname, err := os.Hostname()
+		exitOnFailure(logger, err)
+		nodeID = hostname
+	}
+
+	server := csinode.NewServer(logger, mounter, &osshim.OsShim{}, *csiDriverName, buildVersion(), nodeID)
+	return csinode.NewRunner(logger, *csiSocket, server)
+}
+
+// buildVersion is the version of the smbdriver module the binary was built
+// from, or "(devel)" when it was built from a checkout.
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+func createSmbDriverUnixServer(logger lager.Logger, client dockerdriver.Driver, tracer *zipkin.Tracer, name, socketPath, driversPath string) ifrit.Runner {
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		logger.Fatal("invalid-socket-mode", err, lager.Data{"socket-mode": *socketMode})
+	}
+
+	// volman discovers drivers that listen on a unix socket by a .sock file
+	// in the drivers path.
+	discoveryPath := filepath.Join(driversPath, name+".sock")
+	path := socketPath
+	if path == "" {
+		path = discoveryPath
+	}
+
 	handler, err := driverhttp.NewHandler(logger, client)
 	exitOnFailure(logger, err)
-	return http_server.NewUnixServer(atAddress, handler)
+	handler = smbtrace.NewHandler(tracer, smbdriver.NewPersonalityHandler(name, handler))
+
+	return smbdriver.NewUnixSocketServer(logger, smbdriver.UnixSocket{
+		Path:          path,
+		Owner:         *socketOwner,
+		Group:         *socketGroup,
+		Mode:          os.FileMode(mode),
+		DiscoveryPath: discoveryPath,
+	}, handler)
 }
 
 func newLogger() (lager.Logger, *lager.ReconfigurableSink) {
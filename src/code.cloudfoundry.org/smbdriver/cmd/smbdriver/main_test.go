@@ -1,7 +1,9 @@
 package main_test
 
 import (
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -40,6 +42,68 @@ var _ = Describe("Main", func() {
 			session.Kill().Wait()
 		})
 
+		Context("with the unix transport", func() {
+			BeforeEach(func() {
+				var err error
+				dir, err = os.MkdirTemp("", "driversPath")
+				Expect(err).ToNot(HaveOccurred())
+
+				command.Args = append(command.Args, "-driversPath="+dir, "-transport=unix", "-socketMode=0600")
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("serves on smbdriver.sock in the drivers path", func() {
+				socketPath := filepath.Join(dir, "smbdriver.sock")
+				EventuallyWithOffset(1, func() error {
+					conn, err := net.Dial("unix", socketPath)
+					if err == nil {
+						conn.Close()
+					}
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+
+				info, err := os.Stat(socketPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+				_, err = net.Dial("tcp", "127.0.0.1:8589")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Context("with the csi transport", func() {
+			var socketPath string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = os.MkdirTemp("", "csi")
+				Expect(err).ToNot(HaveOccurred())
+				socketPath = filepath.Join(dir, "csi.sock")
+
+				command.Args = append(command.Args, "-transport=csi", "-csiSocket="+socketPath, "-adminPort=8591")
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("serves the CSI services on the socket instead of tcp/8589", func() {
+				EventuallyWithOffset(1, func() error {
+					conn, err := net.Dial("unix", socketPath)
+					if err == nil {
+						conn.Close()
+					}
+					return err
+				}, 5).ShouldNot(HaveOccurred())
+
+				_, err := net.Dial("tcp", "127.0.0.1:8589")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
 		Context("with a driver path", func() {
 			BeforeEach(func() {
 				var err error
@@ -68,6 +132,259 @@ var _ = Describe("Main", func() {
 			}`))
 			})
 
+			Context("when an invalid minimum SMB version is supplied", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "-minimumSmbVersion=2.1")
+					expectedStartOutput = "fatal-err-aborting"
+				})
+
+				It("should error", func() {
+					Eventually(session).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(BeZero())
+				})
+			})
+
+			Context("when the tuning profiles file is invalid", func() {
+				BeforeEach(func() {
+					profilesFile := filepath.Join(dir, "tuning_profiles.json")
+					Expect(os.WriteFile(profilesFile, []byte(`{"bulk-read": {"cache": "fast"}}`), 0600)).To(Succeed())
+
+					command.Args = append(command.Args, "-tuningProfiles="+profilesFile)
+					expectedStartOutput = "fatal-err-aborting"
+				})
+
+				It("should error", func() {
+					Eventually(session).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(BeZero())
+				})
+			})
+
+			Context("when the SID mappings file is invalid", func() {
+				BeforeEach(func() {
+					mappingsFile := filepath.Join(dir, "sid_mappings.json")
+					Expect(os.WriteFile(mappingsFile, []byte(`{"users": {"alice": 2000}}`), 0600)).To(Succeed())
+
+					command.Args = append(command.Args, "-sidMappings="+mappingsFile)
+					expectedStartOutput = "fatal-err-aborting"
+				})
+
+				It("should error", func() {
+					Eventually(session).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(BeZero())
+				})
+			})
+
+			Context("with personalities", func() {
+				BeforeEach(func() {
+					personalitiesFile := filepath.Join(dir, "personalities.json")
+					Expect(os.WriteFile(personalitiesFile, []byte(`{"smbdriver-legacy": {"listen_port": 8592, "force_nodfs": true}}`), 0600)).To(Succeed())
+
+					command.Args = append(command.Args, "-personalities="+personalitiesFile)
+				})
+
+				It("registers and serves each personality", func() {
+					EventuallyWithOffset(1, func() error {
+						_, err := net.Dial("tcp", "127.0.0.1:8592")
+						return err
+					}, 5).ShouldNot(HaveOccurred())
+
+					specFileContents, err := os.ReadFile(filepath.Join(dir, "smbdriver-legacy.json"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(specFileContents)).To(MatchJSON(`{
+					"Name": "smbdriver-legacy",
+					"Addr": "http://127.0.0.1:8592",
+					"TLSConfig": null,
+					"UniqueVolumeIds": true
+				}`))
+
+					Expect(filepath.Join(dir, "smbdriver.json")).To(BeAnExistingFile())
+				})
+			})
+
+			Context("when a personality has no listen port", func() {
+				BeforeEach(func() {
+					personalitiesFile := filepath.Join(dir, "personalities.json")
+					Expect(os.WriteFile(personalitiesFile, []byte(`{"smbdriver-legacy": {"force_nodfs": true}}`), 0600)).To(Succeed())
+
+					command.Args = append(command.Args, "-personalities="+personalitiesFile)
+					expectedStartOutput = "fatal-err-aborting"
+				})
+
+				It("should error", func() {
+					Eventually(session).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(BeZero())
+				})
+			})
+
+			Context("with an admin token file", func() {
+				BeforeEach(func() {
+					tokenFile := filepath.Join(dir, "admin_tokens.json")
+					Expect(os.WriteFile(tokenFile, []byte(`[{"name": "monitoring", "token": "read-token", "access": "read"}]`), 0600)).To(Succeed())
+
+					command.Args = append(command.Args, "-adminTokenFile="+tokenFile)
+				})
+
+				adminGet := func(path, token string) int {
+					req, err := http.NewRequest("GET", "http://127.0.0.1:8590"+path, nil)
+					Expect(err).NotTo(HaveOccurred())
+					if token != "" {
+						req.Header.Set("Authorization", "Bearer "+token)
+					}
+					resp, err := http.DefaultClient.Do(req)
+					Expect(err).NotTo(HaveOccurred())
+					resp.Body.Close()
+					return resp.StatusCode
+				}
+
+				It("authenticates admin requests", func() {
+					EventuallyWithOffset(1, func() error {
+						_, err := net.Dial("tcp", "127.0.0.1:8590")
+						return err
+					}, 5).ShouldNot(HaveOccurred())
+
+					Expect(adminGet("/ping", "")).To(Equal(http.StatusUnauthorized))
+					Expect(adminGet("/ping", "read-token")).To(Equal(http.StatusOK))
+					Expect(adminGet("/evacuate", "read-token")).To(Equal(http.StatusForbidden))
+				})
+			})
+
+			Context("when the admin token file is invalid", func() {
+				BeforeEach(func() {
+					tokenFile := filepath.Join(dir, "admin_tokens.json")
+					Expect(os.WriteFile(tokenFile, []byte(`[{"name": "monitoring", "token": "read-token", "access": "admin"}]`), 0600)).To(Succeed())
+
+					command.Args = append(command.Args, "-adminTokenFile="+tokenFile)
+					expectedStartOutput = "fatal-err-aborting"
+				})
+
+				It("should error", func() {
+					Eventually(session).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(BeZero())
+				})
+			})
+
+			Context("with the log trace exporter", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "-traceExporter=log")
+				})
+
+				It("records the requests in the trace of the caller", func() {
+					EventuallyWithOffset(1, func() error {
+						_, err := net.Dial("tcp", "127.0.0.1:8589")
+						return err
+					}, 5).ShouldNot(HaveOccurred())
+
+					req, err := http.NewRequest("POST", "http://127.0.0.1:8589/VolumeDriver.Capabilities", nil)
+					Expect(err).NotTo(HaveOccurred())
+					req.Header.Set("X-B3-TraceId", "463ac35c9f6413ad48485a3953bb6124")
+					req.Header.Set("X-B3-SpanId", "a2fb4a1d1a96d312")
+					req.Header.Set("X-B3-Sampled", "1")
+					resp, err := http.DefaultClient.Do(req)
+					Expect(err).NotTo(HaveOccurred())
+					resp.Body.Close()
+
+					Eventually(session.Err).Should(gbytes.Say(`"traceId":"463ac35c9f6413ad48485a3953bb6124","id":"[0-9a-f]+","parentId":"a2fb4a1d1a96d312","name":"volumedriver.capabilities"`))
+				})
+			})
+
+			Context("when the trace exporter is unknown", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "-traceExporter=jaeger")
+					expectedStartOutput = "fatal-err-aborting"
+				})
+
+				It("should error", func() {
+					Eventually(session).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(BeZero())
+				})
+			})
+
+			Context("with a fault injection file", func() {
+				BeforeEach(func() {
+					faultsFile := filepath.Join(dir, "faults.json")
+					Expect(os.WriteFile(faultsFile, []byte(`[{"operation": "mount", "host": "server", "errno": 13}]`), 0600)).To(Succeed())
+
+					command.Args = append(command.Args, "-faultInjectionFile="+faultsFile)
+				})
+
+				It("serves the faults on the admin API", func() {
+					EventuallyWithOffset(1, func() error {
+						_, err := net.Dial("tcp", "127.0.0.1:8590")
+						return err
+					}, 5).ShouldNot(HaveOccurred())
+
+					resp, err := http.Get("http://127.0.0.1:8590/faults")
+					Expect(err).NotTo(HaveOccurred())
+					defer resp.Body.Close()
+					Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+					body, err := io.ReadAll(resp.Body)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(body)).To(MatchJSON(`{"Faults": [{"operation": "mount", "host": "server", "errno": 13}], "Err": ""}`))
+				})
+			})
+
+			Context("when the fault injection file is invalid", func() {
+				BeforeEach(func() {
+					faultsFile := filepath.Join(dir, "faults.json")
+					Expect(os.WriteFile(faultsFile, []byte(`[{"operation": "format", "errno": 13}]`), 0600)).To(Succeed())
+
+					command.Args = append(command.Args, "-faultInjectionFile="+faultsFile)
+					expectedStartOutput = "fatal-err-aborting"
+				})
+
+				It("should error", func() {
+					Eventually(session).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(BeZero())
+				})
+			})
+
+			Context("with the fuse mounter", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "-mounter=fuse")
+					expectedStartOutput = `"mounter":"fuse"`
+				})
+
+				It("serves the shares through FUSE", func() {
+					Eventually(session.Out).Should(gbytes.Say("smb-driver-server.started"))
+				})
+			})
+
+			Context("with a dry run", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "-dryRun")
+					expectedStartOutput = "dry-run-enabled"
+				})
+
+				It("mounts with the kernel mounter", func() {
+					Eventually(session.Out).Should(gbytes.Say(`"mounter":"kernel"`))
+				})
+
+				Context("and the fuse mounter", func() {
+					BeforeEach(func() {
+						command.Args = append(command.Args, "-mounter=fuse")
+						expectedStartOutput = "fatal-err-aborting"
+					})
+
+					It("should error", func() {
+						Eventually(session).Should(gexec.Exit())
+						Expect(session.ExitCode()).NotTo(BeZero())
+					})
+				})
+			})
+
+			Context("when the mounter is unknown", func() {
+				BeforeEach(func() {
+					command.Args = append(command.Args, "-mounter=nfs")
+					expectedStartOutput = "fatal-err-aborting"
+				})
+
+				It("should error", func() {
+					Eventually(session).Should(gexec.Exit())
+					Expect(session.ExitCode()).NotTo(BeZero())
+				})
+			})
+
 			Context("when invalid args are supplied", func() {
 
 				BeforeEach(func() {
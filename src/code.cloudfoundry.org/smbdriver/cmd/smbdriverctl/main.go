@@ -0,0 +1,287 @@
+// smbdriverctl queries and drains the smbdriver through its admin API, e.g.
+//
+//	smbdriverctl --adminTokenFile=/var/vcap/jobs/smbdriver/config/admin_tokens.json mounts
+//
+// It runs one of the commands:
+//
+//	ping              checks that the smbdriver answers
+//	mounts            lists the mounted volumes
+//	circuit-breakers  lists the servers whose mounts recently failed
+//	capacity          reports the capacity and usage of the volumes
+//	cifs-stats        reports the kernel CIFS client statistics
+//	faults            lists the faults injected into mounts, unmounts and checks
+//	set-faults        replaces the injected faults with the JSON list on stdin
+//	evacuate          drains the smbdriver and makes it exit
+//	drain             waits for the rep, evacuates the smbdriver and waits for it to exit
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagerflags"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/driveradmin/driveradminhttp"
+	"code.cloudfoundry.org/smbdriver/smbdrain"
+	"code.cloudfoundry.org/tlsconfig"
+)
+
+var adminUrl = flag.String(
+	"adminUrl",
+	"http://127.0.0.1:8590",
+	"URL of the admin API of the smbdriver",
+)
+
+var adminCaFile = flag.String(
+	"adminCaFile",
+	"",
+	"(optional) - The certificate authority public key file of the admin API, when it is served with mutual TLS",
+)
+
+var adminCertFile = flag.String(
+	"adminCertFile",
+	"",
+	"(optional) - The public key file of the client certificate to present to the admin API",
+)
+
+var adminKeyFile = flag.String(
+	"adminKeyFile",
+	"",
+	"(optional) - The private key file of the client certificate to present to the admin API",
+)
+
+var adminTokenFile = flag.String(
+	"adminTokenFile",
+	"",
+	"(optional) - Path to the JSON file of admin API bearer tokens. The first token with the access that the command requires is used",
+)
+
+var adminTokenName = flag.String(
+	"adminTokenName",
+	"",
+	"(optional) - Name of the token in adminTokenFile to use instead",
+)
+
+var requestTimeout = flag.Duration(
+	"timeout",
+	30*time.Second,
+	"How long to wait for the smbdriver to answer a query",
+)
+
+var pidFile = flag.String(
+	"pidFile",
+	"/var/vcap/sys/run/smbdriver/smbdriver.pid",
+	"Path to the pid file of the smbdriver, for drain",
+)
+
+var specFiles = flag.String(
+	"specFiles",
+	"",
+	"(optional) - Comma separated list of the driver spec files that drain removes before evacuating the smbdriver",
+)
+
+var repTimeout = flag.Duration(
+	"repTimeout",
+	smbdrain.DefaultConfig().RepTimeout,
+	"How long drain waits for the rep to evacuate the apps of the cell",
+)
+
+var evacuateTimeout = flag.Duration(
+	"evacuateTimeout",
+	smbdrain.DefaultConfig().EvacuateTimeout,
+	"How long evacuate and drain wait for the smbdriver to evacuate, after which drain kills it",
+)
+
+var exitTimeout = flag.Duration(
+	"exitTimeout",
+	smbdrain.DefaultConfig().ExitTimeout,
+	"How long drain waits for the smbdriver to exit once it has evacuated, after which it kills it",
+)
+
+const usage = "usage: smbdriverctl [flags] ping|mounts|circuit-breakers|capacity|cifs-stats|faults|set-faults|evacuate|drain"
+
+func main() {
+	lagerflags.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fail(usage)
+	}
+	command := flag.Arg(0)
+
+	logger, _ := lagerflags.NewFromConfig("smbdriverctl", lagerflags.ConfigFromFlags())
+
+	switch command {
+	case "ping":
+		query(logger, driveradmin.PingRoute, func(client driveradmin.DriverAdmin, env dockerdriver.Env) (any, string) {
+			response := client.Ping(env)
+			return nil, response.Err
+		})
+	case "mounts":
+		query(logger, driveradmin.MountsRoute, func(client driveradmin.DriverAdmin, env dockerdriver.Env) (any, string) {
+			response := client.Mounts(env)
+			return response.Mounts, response.Err
+		})
+	case "circuit-breakers":
+		query(logger, driveradmin.CircuitBreakersRoute, func(client driveradmin.DriverAdmin, env dockerdriver.Env) (any, string) {
+			response := client.CircuitBreakers(env)
+			return response.CircuitBreakers, response.Err
+		})
+	case "capacity":
+		query(logger, driveradmin.CapacityRoute, func(client driveradmin.DriverAdmin, env dockerdriver.Env) (any, string) {
+			response := client.Capacity(env)
+			return response.Volumes, response.Err
+		})
+	case "cifs-stats":
+		query(logger, driveradmin.CifsStatsRoute, func(client driveradmin.DriverAdmin, env dockerdriver.Env) (any, string) {
+			response := client.CifsStats(env)
+			return driveradmin.CifsStats{
+				SessionReconnects: response.SessionReconnects,
+				ShareReconnects:   response.ShareReconnects,
+				Volumes:           response.Volumes,
+			}, response.Err
+		})
+	case "faults":
+		query(logger, driveradmin.FaultsRoute, func(client driveradmin.DriverAdmin, env dockerdriver.Env) (any, string) {
+			response := client.Faults(env)
+			return response.Faults, response.Err
+		})
+	case "set-faults":
+		var faults []driveradmin.Fault
+		if err := json.NewDecoder(os.Stdin).Decode(&faults); err != nil {
+			fail(fmt.Sprintf("invalid faults on stdin: %s", err.Error()))
+		}
+		query(logger, driveradmin.SetFaultsRoute, func(client driveradmin.DriverAdmin, env dockerdriver.Env) (any, string) {
+			response := client.SetFaults(env, faults)
+			return nil, response.Err
+		})
+	case "evacuate":
+		*requestTimeout = *evacuateTimeout
+		query(logger, driveradmin.EvacuateRoute, func(client driveradmin.DriverAdmin, env dockerdriver.Env) (any, string) {
+			response := client.Evacuate(env)
+			return nil, response.Err
+		})
+	case "drain":
+		drain(logger)
+	default:
+		fail(fmt.Sprintf("unknown command %q\n%s", command, usage))
+	}
+}
+
+// query makes the request of a command and prints its result as JSON.
+func query(logger lager.Logger, route string, request func(driveradmin.DriverAdmin, dockerdriver.Env) (any, string)) {
+	client, err := newClient(driveradmin.RouteAccess[route])
+	if err != nil {
+		fail(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *requestTimeout)
+	defer cancel()
+
+	result, responseErr := request(client, driverhttp.NewHttpDriverEnv(logger, ctx))
+	if responseErr != "" {
+		fail(responseErr)
+	}
+	if result == nil {
+		return
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		fail(err.Error())
+	}
+	fmt.Println(string(output))
+}
+
+func drain(logger lager.Logger) {
+	client, err := newClient(driveradmin.RouteAccess[driveradmin.EvacuateRoute])
+	if err != nil {
+		fail(err.Error())
+	}
+
+	config := smbdrain.DefaultConfig()
+	config.PidFile = *pidFile
+	config.RepTimeout = *repTimeout
+	config.EvacuateTimeout = *evacuateTimeout
+	config.ExitTimeout = *exitTimeout
+	for _, specFile := range strings.Split(*specFiles, ",") {
+		if specFile = strings.TrimSpace(specFile); specFile != "" {
+			config.SpecFiles = append(config.SpecFiles, specFile)
+		}
+	}
+
+	drainer := smbdrain.NewDrainer(logger, client, smbdrain.NewProcProcesses("/proc"), clock.NewClock(), config)
+	if err := drainer.Drain(); err != nil {
+		fail(err.Error())
+	}
+}
+
+// newClient returns a client that presents the client certificate, if any,
+// and the token with the access that the command requires.
+func newClient(access driveradmin.Access) (driveradmin.DriverAdmin, error) {
+	httpClient := &http.Client{}
+	if *adminCaFile != "" {
+		tlsConfig, err := tlsconfig.
+			Build(
+				tlsconfig.WithInternalServiceDefaults(),
+				tlsconfig.WithIdentityFromFile(*adminCertFile, *adminKeyFile),
+			).
+			Client(tlsconfig.WithAuthorityFromFile(*adminCaFile))
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin TLS configuration: %s", err.Error())
+		}
+		httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	token, err := adminToken(access)
+	if err != nil {
+		return nil, err
+	}
+
+	return driveradminhttp.NewRemoteClient(*adminUrl, httpClient, token), nil
+}
+
+func adminToken(access driveradmin.Access) (string, error) {
+	if *adminTokenFile == "" {
+		return "", nil
+	}
+
+	tokens, err := driveradminhttp.LoadTokens(*adminTokenFile)
+	if err != nil {
+		return "", err
+	}
+
+	for _, token := range tokens {
+		if *adminTokenName != "" {
+			if token.Name == *adminTokenName {
+				return token.Token, nil
+			}
+			continue
+		}
+
+		if tokenAccess, _ := driveradmin.ParseAccess(token.Access); tokenAccess >= access {
+			return token.Token, nil
+		}
+	}
+
+	if *adminTokenName != "" {
+		return "", fmt.Errorf("there is no admin token %s in %s", *adminTokenName, *adminTokenFile)
+	}
+	// Without a token, a client certificate may still grant the access.
+	return "", nil
+}
+
+func fail(message string) {
+	fmt.Fprintf(os.Stderr, "smbdriverctl: %s\n", message)
+	os.Exit(1)
+}
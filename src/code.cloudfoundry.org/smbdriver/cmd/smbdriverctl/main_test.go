@@ -0,0 +1,177 @@
+package main_test
+
+import (
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/driveradmin/driveradminhttp"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("smbdriverctl", func() {
+	var (
+		driverAdmin *smbdriverfakes.FakeDriverAdmin
+		server      *httptest.Server
+		dir         string
+		tokenFile   string
+		args        []string
+	)
+
+	run := func(command ...string) *gexec.Session {
+		session, err := gexec.Start(exec.Command(smbdriverctlPath, append(args, command...)...), GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		return session.Wait()
+	}
+
+	BeforeEach(func() {
+		driverAdmin = &smbdriverfakes.FakeDriverAdmin{}
+
+		handler, err := driveradminhttp.NewAuthenticatedHandler(lagertest.NewTestLogger("smbdriverctl"), driverAdmin, driveradminhttp.NewAuthenticator([]driveradminhttp.Token{
+			{Name: "monitoring", Token: "read-token", Access: "read"},
+			{Name: "drain", Token: "write-token", Access: "write"},
+		}, nil))
+		Expect(err).NotTo(HaveOccurred())
+		server = httptest.NewServer(handler)
+		DeferCleanup(server.Close)
+
+		dir, err = os.MkdirTemp("", "smbdriverctl")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+
+		tokenFile = filepath.Join(dir, "admin_tokens.json")
+		Expect(os.WriteFile(tokenFile, []byte(`[
+			{"name": "monitoring", "token": "read-token", "access": "read"},
+			{"name": "drain", "token": "write-token", "access": "write"}
+		]`), 0600)).To(Succeed())
+
+		args = []string{"-adminUrl=" + server.URL, "-adminTokenFile=" + tokenFile}
+	})
+
+	It("prints the mounts as JSON", func() {
+		driverAdmin.MountsReturns(driveradmin.MountsResponse{Mounts: []driveradmin.Mount{
+			{Target: "/var/vcap/data/volumes/smb/vol1", Source: "//server/share", Sources: []string{"//server/share"}, Share: "//server/share", Personality: "smbdriver", Mounter: "kernel"},
+		}})
+
+		session := run("mounts")
+		Expect(session).To(gexec.Exit(0))
+		Expect(session.Out.Contents()).To(MatchJSON(`[{
+			"Target": "/var/vcap/data/volumes/smb/vol1",
+			"Source": "//server/share",
+			"Sources": ["//server/share"],
+			"Share": "//server/share",
+			"Personality": "smbdriver",
+			"Mounter": "kernel"
+		}]`))
+	})
+
+	It("evacuates the smbdriver with a token that has write access", func() {
+		Expect(run("evacuate")).To(gexec.Exit(0))
+		Expect(driverAdmin.EvacuateCallCount()).To(Equal(1))
+	})
+
+	It("uses the named token", func() {
+		args = append(args, "-adminTokenName=monitoring")
+
+		session := run("evacuate")
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("smbdriverctl: evacuate: 403 write access required"))
+		Expect(driverAdmin.EvacuateCallCount()).To(Equal(0))
+	})
+
+	It("sets the faults from stdin", func() {
+		command := exec.Command(smbdriverctlPath, append(args, "set-faults")...)
+		command.Stdin = strings.NewReader(`[{"operation": "mount", "host": "server", "hang": "2m"}]`)
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(session.Wait()).To(gexec.Exit(0))
+		Expect(driverAdmin.SetFaultsCallCount()).To(Equal(1))
+		_, faults := driverAdmin.SetFaultsArgsForCall(0)
+		Expect(faults).To(Equal([]driveradmin.Fault{{Operation: "mount", Host: "server", Hang: "2m"}}))
+	})
+
+	It("fails to list the faults when fault injection is disabled", func() {
+		driverAdmin.FaultsReturns(driveradmin.FaultsResponse{Err: "fault injection is disabled"})
+
+		session := run("faults")
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("smbdriverctl: faults: 500 fault injection is disabled"))
+	})
+
+	It("fails when the smbdriver does not answer", func() {
+		server.Close()
+
+		session := run("ping")
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("connection refused"))
+	})
+
+	It("fails on an unknown command", func() {
+		session := run("restart")
+		Expect(session).To(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say(`unknown command "restart"`))
+	})
+
+	Describe("drain", func() {
+		var (
+			pidFile  string
+			specFile string
+			sleeper  *gexec.Session
+		)
+
+		BeforeEach(func() {
+			var err error
+			sleeper, err = gexec.Start(exec.Command("sleep", "60"), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(func() { sleeper.Kill().Wait() })
+
+			pidFile = filepath.Join(dir, "smbdriver.pid")
+			Expect(os.WriteFile(pidFile, []byte(strconv.Itoa(sleeper.Command.Process.Pid)), 0644)).To(Succeed())
+			specFile = filepath.Join(dir, "smbdriver.json")
+			Expect(os.WriteFile(specFile, []byte("{}"), 0644)).To(Succeed())
+
+			// The smbdriver fails to answer once it has evacuated.
+			evacuated := false
+			driverAdmin.EvacuateStub = func(dockerdriver.Env) driveradmin.ErrorResponse {
+				evacuated = true
+				return driveradmin.ErrorResponse{}
+			}
+			driverAdmin.PingStub = func(dockerdriver.Env) driveradmin.ErrorResponse {
+				if evacuated {
+					return driveradmin.ErrorResponse{Err: "exiting"}
+				}
+				return driveradmin.ErrorResponse{}
+			}
+
+			args = append(args, "-pidFile="+pidFile, "-specFiles="+specFile)
+		})
+
+		It("evacuates the smbdriver and kills it once it has exited", func() {
+			Expect(run("drain")).To(gexec.Exit(0))
+
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(1))
+			Expect(specFile).NotTo(BeAnExistingFile())
+			Expect(pidFile).NotTo(BeAnExistingFile())
+			Eventually(sleeper).Should(gexec.Exit())
+		})
+
+		It("does nothing when the smbdriver is not running", func() {
+			sleeper.Kill().Wait()
+
+			Expect(run("drain")).To(gexec.Exit(0))
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(0))
+			Expect(specFile).To(BeAnExistingFile())
+		})
+	})
+})
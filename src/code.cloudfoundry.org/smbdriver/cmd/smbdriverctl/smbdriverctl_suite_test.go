@@ -0,0 +1,26 @@
+package main_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gexec"
+)
+
+func TestSmbDriverCtl(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "smbdriverctl Suite")
+}
+
+var smbdriverctlPath string
+
+var _ = BeforeSuite(func() {
+	var err error
+	smbdriverctlPath, err = Build("code.cloudfoundry.org/smbdriver/cmd/smbdriverctl", "-mod=vendor")
+	Expect(err).ToNot(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	CleanupBuildArtifacts()
+})
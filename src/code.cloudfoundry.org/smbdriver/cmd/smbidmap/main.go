@@ -0,0 +1,127 @@
+//go:build linux
+// +build linux
+
+// smbidmap is run by request-key to answer the kernel's cifs.idmap upcalls
+// from the SID mapping file configured for the smbdriver, e.g.
+//
+//	create cifs.idmap * * /var/vcap/packages/smbdriver/bin/smbidmap --sidMappings=/path/to/sid_mappings.json %k
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/smbdriver/idmap"
+	"golang.org/x/sys/unix"
+)
+
+// Keyctl is the part of the kernel's key management that answers an upcall.
+type Keyctl interface {
+	AssumeAuthority(key int) error
+	Describe(key int) (string, error)
+	Instantiate(key int, payload []byte) error
+	SetTimeout(key int, seconds int) error
+	Negate(key int, seconds int) error
+}
+
+type unixKeyctl struct{}
+
+func (unixKeyctl) AssumeAuthority(key int) error {
+	_, err := unix.KeyctlInt(unix.KEYCTL_ASSUME_AUTHORITY, key, 0, 0, 0)
+	return err
+}
+
+func (unixKeyctl) Describe(key int) (string, error) {
+	return unix.KeyctlString(unix.KEYCTL_DESCRIBE, key)
+}
+
+func (unixKeyctl) Instantiate(key int, payload []byte) error {
+	_, err := unix.KeyctlBuffer(unix.KEYCTL_INSTANTIATE, key, payload, 0)
+	return err
+}
+
+func (unixKeyctl) SetTimeout(key int, seconds int) error {
+	_, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, key, seconds, 0, 0)
+	return err
+}
+
+func (unixKeyctl) Negate(key int, seconds int) error {
+	_, err := unix.KeyctlInt(unix.KEYCTL_NEGATE, key, seconds, 0, 0)
+	return err
+}
+
+func main() {
+	os.Exit(Run(os.Args[1:], unixKeyctl{}, os.Stderr))
+}
+
+// Run answers the upcall for the key serial in args, and returns the exit
+// code of smbidmap.
+func Run(args []string, keyctl Keyctl, stderr io.Writer) int {
+	fail := func(message string) int {
+		fmt.Fprintf(stderr, "smbidmap: %s\n", message)
+		return 1
+	}
+
+	flags := flag.NewFlagSet("smbidmap", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	sidMappings := flags.String(
+		"sidMappings",
+		"",
+		"[REQUIRED] - Path to the JSON file mapping SIDs to uids and gids",
+	)
+	keyTimeout := flags.Int(
+		"keyTimeout",
+		600,
+		"Seconds the kernel caches an answer for, so that changes to the mappings are picked up",
+	)
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		return fail("usage: smbidmap --sidMappings=<path> <key serial>")
+	}
+
+	key, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fail(fmt.Sprintf("%s is not a valid key serial", flags.Arg(0)))
+	}
+
+	if err := keyctl.AssumeAuthority(key); err != nil {
+		return fail(fmt.Sprintf("cannot assume authority over key %d: %s", key, err.Error()))
+	}
+
+	// The description has the form "type;uid;gid;perm;description".
+	description, err := keyctl.Describe(key)
+	if err != nil {
+		return fail(fmt.Sprintf("cannot describe key %d: %s", key, err.Error()))
+	}
+	description = description[strings.LastIndex(description, ";")+1:]
+
+	mappings, err := idmap.LoadMappings(*sidMappings)
+	if err != nil {
+		_ = keyctl.Negate(key, *keyTimeout)
+		return fail(err.Error())
+	}
+
+	payload, err := mappings.Resolve(description)
+	if err != nil {
+		_ = keyctl.Negate(key, *keyTimeout)
+		return fail(err.Error())
+	}
+
+	if err := keyctl.Instantiate(key, payload); err != nil {
+		return fail(fmt.Sprintf("cannot instantiate key %d: %s", key, err.Error()))
+	}
+
+	if err := keyctl.SetTimeout(key, *keyTimeout); err != nil {
+		return fail(fmt.Sprintf("cannot set the timeout of key %d: %s", key, err.Error()))
+	}
+
+	return 0
+}
@@ -0,0 +1,255 @@
+//go:build linux
+// +build linux
+
+package main_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/smbdriver/cmd/smbidmap"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+type fakeKeyctl struct {
+	description string
+
+	assumeAuthorityErr error
+	describeErr        error
+	instantiateErr     error
+
+	authority    []int
+	instantiated map[int][]byte
+	timeouts     map[int]int
+	negated      map[int]int
+}
+
+func newFakeKeyctl(description string) *fakeKeyctl {
+	return &fakeKeyctl{
+		description:  description,
+		instantiated: map[int][]byte{},
+		timeouts:     map[int]int{},
+		negated:      map[int]int{},
+	}
+}
+
+func (f *fakeKeyctl) AssumeAuthority(key int) error {
+	f.authority = append(f.authority, key)
+	return f.assumeAuthorityErr
+}
+
+func (f *fakeKeyctl) Describe(int) (string, error) {
+	return f.description, f.describeErr
+}
+
+func (f *fakeKeyctl) Instantiate(key int, payload []byte) error {
+	if f.instantiateErr != nil {
+		return f.instantiateErr
+	}
+	f.instantiated[key] = payload
+	return nil
+}
+
+func (f *fakeKeyctl) SetTimeout(key int, seconds int) error {
+	f.timeouts[key] = seconds
+	return nil
+}
+
+func (f *fakeKeyctl) Negate(key int, seconds int) error {
+	f.negated[key] = seconds
+	return nil
+}
+
+var _ = Describe("Run", func() {
+	var (
+		keyctl       *fakeKeyctl
+		mappingsPath string
+		args         []string
+		stderr       *gbytes.Buffer
+		exitCode     int
+	)
+
+	BeforeEach(func() {
+		keyctl = newFakeKeyctl("cifs.idmap;0;0;3f010000;os:S-1-5-21-1-2-3-1001")
+
+		mappingsPath = filepath.Join(GinkgoT().TempDir(), "sid_mappings.json")
+		Expect(os.WriteFile(mappingsPath, []byte(`{"users": {"S-1-5-21-1-2-3-1001": 2000}}`), 0600)).To(Succeed())
+
+		args = []string{"--sidMappings=" + mappingsPath, "42"}
+		stderr = gbytes.NewBuffer()
+	})
+
+	JustBeforeEach(func() {
+		exitCode = Run(args, keyctl, stderr)
+	})
+
+	It("instantiates the key with the mapped id", func() {
+		Expect(exitCode).To(Equal(0))
+		Expect(keyctl.authority).To(Equal([]int{42}))
+
+		payload := make([]byte, 4)
+		binary.NativeEndian.PutUint32(payload, 2000)
+		Expect(keyctl.instantiated).To(HaveKeyWithValue(42, payload))
+		Expect(keyctl.negated).To(BeEmpty())
+	})
+
+	It("caches the answer for the default timeout", func() {
+		Expect(keyctl.timeouts).To(HaveKeyWithValue(42, 600))
+	})
+
+	Context("when a key timeout is given", func() {
+		BeforeEach(func() {
+			args = append([]string{"--keyTimeout=30"}, args...)
+		})
+
+		It("caches the answer for that timeout", func() {
+			Expect(exitCode).To(Equal(0))
+			Expect(keyctl.timeouts).To(HaveKeyWithValue(42, 30))
+		})
+	})
+
+	Context("when no key serial is given", func() {
+		BeforeEach(func() {
+			args = []string{"--sidMappings=" + mappingsPath}
+		})
+
+		It("prints the usage and fails", func() {
+			Expect(exitCode).To(Equal(1))
+			Expect(stderr).To(gbytes.Say("usage: smbidmap --sidMappings=<path> <key serial>"))
+			Expect(keyctl.authority).To(BeEmpty())
+		})
+	})
+
+	Context("when the key serial is not a number", func() {
+		BeforeEach(func() {
+			args = []string{"--sidMappings=" + mappingsPath, "key"}
+		})
+
+		It("fails", func() {
+			Expect(exitCode).To(Equal(1))
+			Expect(stderr).To(gbytes.Say("smbidmap: key is not a valid key serial"))
+		})
+	})
+
+	Context("when a flag is not known", func() {
+		BeforeEach(func() {
+			args = []string{"--unknown", "42"}
+		})
+
+		It("fails like a flag parse error", func() {
+			Expect(exitCode).To(Equal(2))
+			Expect(stderr).To(gbytes.Say("flag provided but not defined: -unknown"))
+		})
+	})
+
+	Context("when authority over the key cannot be assumed", func() {
+		BeforeEach(func() {
+			keyctl.assumeAuthorityErr = errors.New("operation not permitted")
+		})
+
+		It("fails without answering", func() {
+			Expect(exitCode).To(Equal(1))
+			Expect(stderr).To(gbytes.Say("cannot assume authority over key 42: operation not permitted"))
+			Expect(keyctl.instantiated).To(BeEmpty())
+			Expect(keyctl.negated).To(BeEmpty())
+		})
+	})
+
+	Context("when the key cannot be described", func() {
+		BeforeEach(func() {
+			keyctl.describeErr = errors.New("key has been revoked")
+		})
+
+		It("fails", func() {
+			Expect(exitCode).To(Equal(1))
+			Expect(stderr).To(gbytes.Say("cannot describe key 42: key has been revoked"))
+		})
+	})
+
+	Context("when the mapping file cannot be read", func() {
+		BeforeEach(func() {
+			Expect(os.Remove(mappingsPath)).To(Succeed())
+		})
+
+		It("negates the key and fails", func() {
+			Expect(exitCode).To(Equal(1))
+			Expect(keyctl.negated).To(HaveKeyWithValue(42, 600))
+			Expect(keyctl.instantiated).To(BeEmpty())
+		})
+	})
+
+	Context("when the SID is not mapped", func() {
+		BeforeEach(func() {
+			keyctl.description = "cifs.idmap;0;0;3f010000;os:S-1-5-21-1-2-3-1002"
+		})
+
+		It("negates the key and fails", func() {
+			Expect(exitCode).To(Equal(1))
+			Expect(keyctl.negated).To(HaveKeyWithValue(42, 600))
+			Expect(keyctl.instantiated).To(BeEmpty())
+		})
+	})
+
+	Context("when the key cannot be instantiated", func() {
+		BeforeEach(func() {
+			keyctl.instantiateErr = errors.New("key has expired")
+		})
+
+		It("fails", func() {
+			Expect(exitCode).To(Equal(1))
+			Expect(stderr).To(gbytes.Say("cannot instantiate key 42: key has expired"))
+			Expect(keyctl.timeouts).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("Main", func() {
+	var (
+		session *gexec.Session
+		command *exec.Cmd
+	)
+
+	JustBeforeEach(func() {
+		var err error
+		session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("without a key serial", func() {
+		BeforeEach(func() {
+			command = exec.Command(idmapPath)
+		})
+
+		It("exits with 1", func() {
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(session.Err).To(gbytes.Say("usage: smbidmap"))
+		})
+	})
+
+	Context("when not run by request-key", func() {
+		BeforeEach(func() {
+			command = exec.Command(idmapPath, "--sidMappings=/does/not/exist", "2147483647")
+		})
+
+		It("cannot assume authority over the key and exits with 1", func() {
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(session.Err).To(gbytes.Say("cannot assume authority over key 2147483647"))
+		})
+	})
+
+	Context("with an unknown flag", func() {
+		BeforeEach(func() {
+			command = exec.Command(idmapPath, "--unknown")
+		})
+
+		It("exits with 2", func() {
+			Eventually(session).Should(gexec.Exit(2))
+		})
+	})
+})
@@ -0,0 +1,31 @@
+//go:build linux
+// +build linux
+
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gexec"
+)
+
+func TestSmbIdmap(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SMB Idmap Main Suite")
+}
+
+var idmapPath string
+
+var _ = BeforeSuite(func() {
+	SetDefaultEventuallyTimeout(1 * time.Minute)
+	var err error
+	idmapPath, err = Build("code.cloudfoundry.org/smbdriver/cmd/smbidmap", "-mod=vendor")
+	Expect(err).ToNot(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	CleanupBuildArtifacts()
+})
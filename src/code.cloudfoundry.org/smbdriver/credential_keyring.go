@@ -0,0 +1,233 @@
+package smbdriver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/volumedriver/invoker"
+)
+
+const multiuserKey = "multiuser"
+
+// uidKey lets a multiuser binding name the uid that its app processes run
+// as, so that its credentials are loaded into the keyring of that uid.
+const uidKey = "uid"
+
+// containerUid is the uid that app processes run as, and that SMB mounts are
+// presented as.
+const containerUid = "2000"
+
+// The keys are written and removed by a shell running as the container uid,
+// so that they land in that user's keyring. Credentials are passed in
+// environment variables to keep them off the process list.
+const (
+	addKeyScript    = `printf '%s:%s' "$CIFS_USERNAME" "$CIFS_PASSWORD" | keyctl padd logon "$CIFS_KEY" @u > /dev/null`
+	removeKeyScript = `keyctl unlink "$(keyctl search @u logon "$CIFS_KEY")" @u`
+)
+
+// checkMultiuserUid checks the uid that a binding asks its credentials to be
+// loaded for.
+func checkMultiuserUid(multiuser bool, uid string) error {
+	if !multiuser {
+		return errors.New("uid can only be given with multiuser")
+	}
+	if value, err := strconv.ParseUint(uid, 10, 32); err != nil || value == 0 {
+		return fmt.Errorf("uid %s is not a valid user id", uid)
+	}
+	return nil
+}
+
+// multiuserUid returns the uid whose keyring holds the credentials of a
+// multiuser mount.
+func multiuserUid(mountOpts map[string]interface{}) string {
+	if uid, ok := mountOpts[uidKey]; ok {
+		return fmt.Sprintf("%v", uid)
+	}
+	return containerUid
+}
+
+type keyringCredential struct {
+	uid         string
+	description string
+}
+
+type keyringEntry struct {
+	username   string
+	references int
+}
+
+// keyringRecord is how the key of a target is saved in the state file.
+type keyringRecord struct {
+	Uid      string `json:"uid"`
+	Key      string `json:"key"`
+	Username string `json:"username"`
+}
+
+// credentialKeyring loads the credentials of multiuser mounts into the kernel
+// keyring, the way cifscreds does, and removes them again once the last mount
+// using them is unmounted.
+type credentialKeyring struct {
+	invoker   invoker.Invoker
+	stateFile string
+
+	mutex       sync.Mutex
+	restored    bool
+	credentials map[string]keyringCredential
+	entries     map[keyringCredential]*keyringEntry
+}
+
+func newCredentialKeyring(invoker invoker.Invoker) *credentialKeyring {
+	return &credentialKeyring{
+		invoker:     invoker,
+		credentials: map[string]keyringCredential{},
+		entries:     map[keyringCredential]*keyringEntry{},
+	}
+}
+
+// Add loads the credentials for the server at address into the keyring of
+// uid on behalf of the mount at target. The kernel looks keys up by server
+// address, so a uid can only hold one set of credentials per server. Adding
+// the credentials of a target again replaces the ones it added before.
+func (k *credentialKeyring) Add(env dockerdriver.Env, target, uid, address, username, password string) error {
+	logger := env.Logger().Session("keyring-add", lager.Data{"target": target, "uid": uid, "address": address})
+
+	credential := keyringCredential{uid: uid, description: "cifs:a:" + address}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.restore(logger)
+
+	previous, added := k.credentials[target]
+	readded := added && previous == credential
+
+	entry, ok := k.entries[credential]
+	if ok && entry.username != username && !(readded && entry.references == 1) {
+		return fmt.Errorf("credentials of another user are already loaded for %s and uid %s by a multiuser mount", address, uid)
+	}
+
+	err := k.invoke(env, credential, addKeyScript,
+		"CIFS_USERNAME="+username,
+		"CIFS_PASSWORD="+password,
+	)
+	if err != nil {
+		logger.Error("add-key-failed", err)
+		return fmt.Errorf("cannot load multiuser credentials into the keyring: %s", err.Error())
+	}
+
+	if !ok {
+		entry = &keyringEntry{}
+		k.entries[credential] = entry
+	}
+	entry.username = username
+	if !readded {
+		entry.references++
+		k.credentials[target] = credential
+	}
+
+	logger.Info("key-added", lager.Data{"key": credential.description, "references": entry.references})
+
+	if added && !readded {
+		if err := k.release(env, target, previous); err != nil {
+			logger.Error("release-previous-key-failed", err)
+		}
+	}
+	k.save(logger)
+	return nil
+}
+
+// Remove drops the reference of the mount at target and removes the key once
+// no other mount uses it. Targets without multiuser credentials are ignored.
+func (k *credentialKeyring) Remove(env dockerdriver.Env, target string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.restore(env.Logger())
+
+	credential, ok := k.credentials[target]
+	if !ok {
+		return nil
+	}
+	delete(k.credentials, target)
+
+	err := k.release(env, target, credential)
+	k.save(env.Logger())
+	return err
+}
+
+// restore loads the keys saved by a previous run the first time the keyring
+// is used.
+func (k *credentialKeyring) restore(logger lager.Logger) {
+	if k.restored || k.stateFile == "" {
+		return
+	}
+	k.restored = true
+
+	records := map[string]keyringRecord{}
+	if err := readStateFile(k.stateFile, &records); err != nil {
+		logger.Error("restore-keyring-state-failed", err, lager.Data{"state-file": k.stateFile})
+		return
+	}
+
+	for target, record := range records {
+		credential := keyringCredential{uid: record.Uid, description: record.Key}
+		entry, ok := k.entries[credential]
+		if !ok {
+			entry = &keyringEntry{username: record.Username}
+			k.entries[credential] = entry
+		}
+		entry.references++
+		k.credentials[target] = credential
+	}
+	logger.Info("keyring-state-restored", lager.Data{"state-file": k.stateFile, "targets": len(records)})
+}
+
+// save writes the keys of the targets to the state file. Keys that are not
+// saved are still removed on unmount, unless the smbdriver restarts first.
+func (k *credentialKeyring) save(logger lager.Logger) {
+	if k.stateFile == "" {
+		return
+	}
+
+	records := map[string]keyringRecord{}
+	for target, credential := range k.credentials {
+		records[target] = keyringRecord{Uid: credential.uid, Key: credential.description, Username: k.entries[credential].username}
+	}
+	if err := writeStateFile(k.stateFile, records); err != nil {
+		logger.Error("save-keyring-state-failed", err, lager.Data{"state-file": k.stateFile})
+	}
+}
+
+func (k *credentialKeyring) release(env dockerdriver.Env, target string, credential keyringCredential) error {
+	logger := env.Logger().Session("keyring-remove", lager.Data{"target": target, "uid": credential.uid, "key": credential.description})
+
+	entry := k.entries[credential]
+	entry.references--
+	if entry.references > 0 {
+		logger.Info("key-still-in-use", lager.Data{"references": entry.references})
+		return nil
+	}
+	delete(k.entries, credential)
+
+	if err := k.invoke(env, credential, removeKeyScript); err != nil {
+		logger.Error("remove-key-failed", err)
+		return err
+	}
+
+	logger.Info("key-removed")
+	return nil
+}
+
+func (k *credentialKeyring) invoke(env dockerdriver.Env, credential keyringCredential, script string, envVars ...string) error {
+	args := []string{
+		"--reuid=" + credential.uid,
+		"--regid=" + credential.uid,
+		"--clear-groups",
+		"sh", "-c", script,
+	}
+
+	envVars = append(envVars, "CIFS_KEY="+credential.description)
+	return k.invoker.Invoke(env, "setpriv", args, envVars...).Wait()
+}
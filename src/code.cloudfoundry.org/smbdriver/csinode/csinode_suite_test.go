@@ -0,0 +1,13 @@
+package csinode_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCsinode(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Csinode Suite")
+}
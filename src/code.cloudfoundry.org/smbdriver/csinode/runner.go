@@ -0,0 +1,66 @@
+package csinode
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/tedsuo/ifrit"
+	"google.golang.org/grpc"
+)
+
+type runner struct {
+	logger     lager.Logger
+	socketPath string
+	server     *Server
+}
+
+// NewRunner serves the CSI services of server on a unix socket at
+// socketPath until signalled. A socket left over from an earlier run is
+// replaced.
+func NewRunner(logger lager.Logger, socketPath string, server *Server) ifrit.Runner {
+	return &runner{logger: logger.Session("csi-server", lager.Data{"socket": socketPath}), socketPath: socketPath, server: server}
+}
+
+func (r *runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	if err := os.Remove(r.socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", r.socketPath)
+	if err != nil {
+		return err
+	}
+
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(r.logErrors))
+	csi.RegisterIdentityServer(grpcServer, r.server)
+	csi.RegisterNodeServer(grpcServer, r.server)
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- grpcServer.Serve(listener)
+	}()
+
+	r.logger.Info("started")
+	close(ready)
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-signals:
+		grpcServer.GracefulStop()
+		r.logger.Info("stopped")
+		return nil
+	}
+}
+
+func (r *runner) logErrors(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		r.logger.Info("request-failed", lager.Data{"method": info.FullMethod, "error": err.Error()})
+	}
+	return resp, err
+}
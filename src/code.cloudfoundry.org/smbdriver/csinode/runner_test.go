@@ -0,0 +1,67 @@
+package csinode_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/csinode"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Runner", func() {
+	var (
+		socketPath string
+		process    ifrit.Process
+		conn       *grpc.ClientConn
+	)
+
+	BeforeEach(func() {
+		// Unix socket paths are limited to about 100 bytes, which the
+		// Ginkgo temporary directories can exceed.
+		dir, err := os.MkdirTemp("", "csi")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		socketPath = filepath.Join(dir, "csi.sock")
+
+		Expect(os.WriteFile(socketPath, []byte("stale"), 0600)).To(Succeed())
+
+		logger := lagertest.NewTestLogger("csi")
+		server := csinode.NewServer(logger, &smbdriverfakes.FakeMounter{}, &os_fake.FakeOs{}, csinode.DefaultDriverName, "1.2.3", "node-1")
+		process = ifrit.Invoke(csinode.NewRunner(logger, socketPath, server))
+
+		conn, err = grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("serves the identity and node services on the socket", func() {
+		info, err := csi.NewIdentityClient(conn).GetPluginInfo(context.TODO(), &csi.GetPluginInfoRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.GetName()).To(Equal(csinode.DefaultDriverName))
+
+		node, err := csi.NewNodeClient(conn).NodeGetInfo(context.TODO(), &csi.NodeGetInfoRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(node.GetNodeId()).To(Equal("node-1"))
+	})
+
+	It("does not implement staging", func() {
+		_, err := csi.NewNodeClient(conn).NodeStageVolume(context.TODO(), &csi.NodeStageVolumeRequest{})
+		Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+	})
+})
@@ -0,0 +1,212 @@
+// Package csinode serves the CSI Identity and Node services, so that the
+// smbdriver can mount SMB shares for Kubernetes pods with the same mounter,
+// options and policies as for Cloud Foundry apps.
+package csinode
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/volumedriver"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
+//counterfeiter:generate -o ../smbdriverfakes/fake_mounter.go code.cloudfoundry.org/volumedriver.Mounter
+
+const (
+	// DefaultDriverName is the name that storage classes and persistent
+	// volumes refer to the plugin by.
+	DefaultDriverName = "smb.csi.cloudfoundry.org"
+
+	// sourceKey is the volume context key of the share, as in the mount
+	// configuration of the SMB broker. shareKey is accepted as well, as it
+	// is the name of the service parameter.
+	sourceKey = "source"
+	shareKey  = "share"
+
+	// kubernetesPrefix marks the volume context keys that Kubernetes adds
+	// about the pod, which are not mount options.
+	kubernetesPrefix = "csi.storage.k8s.io/"
+)
+
+// Server implements the CSI Identity and Node services. Volumes are mounted
+// directly on their target path, so the node does not stage volumes.
+type Server struct {
+	csi.UnimplementedIdentityServer
+	csi.UnimplementedNodeServer
+
+	logger  lager.Logger
+	mounter volumedriver.Mounter
+	os      osshim.Os
+	name    string
+	version string
+	nodeID  string
+}
+
+func NewServer(logger lager.Logger, mounter volumedriver.Mounter, os osshim.Os, name, version, nodeID string) *Server {
+	return &Server{
+		logger:  logger.Session("csi"),
+		mounter: mounter,
+		os:      os,
+		name:    name,
+		version: version,
+		nodeID:  nodeID,
+	}
+}
+
+func (s *Server) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
+	return &csi.GetPluginInfoResponse{Name: s.name, VendorVersion: s.version}, nil
+}
+
+// GetPluginCapabilities reports no capabilities, as the plugin has no
+// controller service: shares exist before they are mounted.
+func (s *Server) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
+	return &csi.GetPluginCapabilitiesResponse{}, nil
+}
+
+func (s *Server) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	return &csi.ProbeResponse{}, nil
+}
+
+func (s *Server) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{}, nil
+}
+
+func (s *Server) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	return &csi.NodeGetInfoResponse{NodeId: s.nodeID}, nil
+}
+
+// NodePublishVolume mounts the share in the volume context on the target
+// path. The other keys of the volume context and the secrets are passed to
+// the mounter as mount options, as are the mount flags of the volume
+// capability.
+func (s *Server) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	logger := s.logger.Session("node-publish-volume", lager.Data{"volume-id": req.GetVolumeId(), "target": req.GetTargetPath()})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is required")
+	}
+	if req.GetTargetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "target path is required")
+	}
+	if err := validateCapability(req.GetVolumeCapability()); err != nil {
+		return nil, err
+	}
+
+	source, opts, err := mountOptions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	env := driverhttp.NewHttpDriverEnv(logger, ctx)
+
+	if s.mounter.Check(env, req.GetVolumeId(), req.GetTargetPath()) {
+		logger.Info("already-mounted")
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	if err := s.os.MkdirAll(req.GetTargetPath(), 0750); err != nil {
+		logger.Error("failed-creating-target", err)
+		return nil, status.Errorf(codes.Internal, "creating the target path failed: %s", err.Error())
+	}
+
+	if err := s.mounter.Mount(env, source, req.GetTargetPath(), opts); err != nil {
+		logger.Error("failed-mounting", err)
+		return nil, status.Errorf(codes.Internal, "mounting %s failed: %s", source, err.Error())
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// NodeUnpublishVolume unmounts the target path, if it is mounted, and
+// removes it.
+func (s *Server) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	logger := s.logger.Session("node-unpublish-volume", lager.Data{"volume-id": req.GetVolumeId(), "target": req.GetTargetPath()})
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume id is required")
+	}
+	if req.GetTargetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "target path is required")
+	}
+
+	env := driverhttp.NewHttpDriverEnv(logger, ctx)
+
+	if s.mounter.Check(env, req.GetVolumeId(), req.GetTargetPath()) {
+		if err := s.mounter.Unmount(env, req.GetTargetPath()); err != nil {
+			logger.Error("failed-unmounting", err)
+			return nil, status.Errorf(codes.Internal, "unmounting failed: %s", err.Error())
+		}
+	}
+
+	if err := s.os.Remove(req.GetTargetPath()); err != nil && !os.IsNotExist(err) {
+		logger.Error("failed-removing-target", err)
+		return nil, status.Errorf(codes.Internal, "removing the target path failed: %s", err.Error())
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+func validateCapability(capability *csi.VolumeCapability) error {
+	if capability == nil {
+		return status.Error(codes.InvalidArgument, "volume capability is required")
+	}
+
+	if capability.GetBlock() != nil {
+		return status.Error(codes.InvalidArgument, "block volumes are not supported")
+	}
+
+	if fsType := capability.GetMount().GetFsType(); fsType != "" && fsType != "cifs" && fsType != "smb" {
+		return status.Errorf(codes.InvalidArgument, "file system type %s is not supported", fsType)
+	}
+
+	return nil
+}
+
+func mountOptions(req *csi.NodePublishVolumeRequest) (string, map[string]interface{}, error) {
+	opts := map[string]interface{}{}
+	for key, value := range req.GetVolumeContext() {
+		if !strings.HasPrefix(key, kubernetesPrefix) {
+			opts[key] = value
+		}
+	}
+
+	source := req.GetVolumeContext()[sourceKey]
+	if source == "" {
+		source = req.GetVolumeContext()[shareKey]
+	}
+	if source == "" {
+		return "", nil, status.Errorf(codes.InvalidArgument, "the volume context has no %s", sourceKey)
+	}
+	delete(opts, shareKey)
+
+	for _, flag := range req.GetVolumeCapability().GetMount().GetMountFlags() {
+		key, value, ok := strings.Cut(flag, "=")
+		if !ok {
+			opts[key] = true
+			continue
+		}
+		opts[key] = value
+	}
+
+	for key, value := range req.GetSecrets() {
+		opts[key] = value
+	}
+
+	if req.GetReadonly() {
+		opts["readonly"] = true
+	}
+
+	return source, opts, nil
+}
@@ -0,0 +1,245 @@
+package csinode_test
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/csinode"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		logger  *lagertest.TestLogger
+		ctx     context.Context
+		mounter *smbdriverfakes.FakeMounter
+		fakeOs  *os_fake.FakeOs
+		subject *csinode.Server
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("csi")
+		ctx = context.TODO()
+		mounter = &smbdriverfakes.FakeMounter{}
+		fakeOs = &os_fake.FakeOs{}
+		subject = csinode.NewServer(logger, mounter, fakeOs, csinode.DefaultDriverName, "1.2.3", "node-1")
+	})
+
+	expectCode := func(err error, code codes.Code) {
+		ExpectWithOffset(1, err).To(HaveOccurred())
+		ExpectWithOffset(1, status.Code(err)).To(Equal(code))
+	}
+
+	Describe("the identity service", func() {
+		It("names the plugin", func() {
+			resp, err := subject.GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetName()).To(Equal("smb.csi.cloudfoundry.org"))
+			Expect(resp.GetVendorVersion()).To(Equal("1.2.3"))
+		})
+
+		It("has no controller service", func() {
+			resp, err := subject.GetPluginCapabilities(ctx, &csi.GetPluginCapabilitiesRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetCapabilities()).To(BeEmpty())
+		})
+
+		It("is ready", func() {
+			_, err := subject.Probe(ctx, &csi.ProbeRequest{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Describe("NodeGetInfo", func() {
+		It("returns the node id", func() {
+			resp, err := subject.NodeGetInfo(ctx, &csi.NodeGetInfoRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetNodeId()).To(Equal("node-1"))
+		})
+	})
+
+	Describe("NodeGetCapabilities", func() {
+		It("does not stage volumes", func() {
+			resp, err := subject.NodeGetCapabilities(ctx, &csi.NodeGetCapabilitiesRequest{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.GetCapabilities()).To(BeEmpty())
+		})
+	})
+
+	Describe("NodePublishVolume", func() {
+		var req *csi.NodePublishVolumeRequest
+
+		BeforeEach(func() {
+			req = &csi.NodePublishVolumeRequest{
+				VolumeId:   "volume-1",
+				TargetPath: "/var/lib/kubelet/pods/pod-1/volumes/kubernetes.io~csi/pv-1/mount",
+				VolumeCapability: &csi.VolumeCapability{
+					AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{MountFlags: []string{"vers=3.0", "mfsymlinks"}}},
+					AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+				},
+				VolumeContext: map[string]string{
+					"source":                      "//server/share",
+					"subpath":                     "apps",
+					"csi.storage.k8s.io/pod.name": "pod-1",
+				},
+				Secrets:  map[string]string{"username": "user", "password": "secret"},
+				Readonly: true,
+			}
+		})
+
+		It("creates the target path and mounts the share with the options of the volume", func() {
+			_, err := subject.NodePublishVolume(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeOs.MkdirAllCallCount()).To(Equal(1))
+			path, perm := fakeOs.MkdirAllArgsForCall(0)
+			Expect(path).To(Equal(req.TargetPath))
+			Expect(perm).To(Equal(os.FileMode(0750)))
+
+			Expect(mounter.MountCallCount()).To(Equal(1))
+			_, source, target, opts := mounter.MountArgsForCall(0)
+			Expect(source).To(Equal("//server/share"))
+			Expect(target).To(Equal(req.TargetPath))
+			Expect(opts).To(Equal(map[string]interface{}{
+				"source":     "//server/share",
+				"subpath":    "apps",
+				"vers":       "3.0",
+				"mfsymlinks": true,
+				"username":   "user",
+				"password":   "secret",
+				"readonly":   true,
+			}))
+		})
+
+		It("does not log the secrets", func() {
+			_, err := subject.NodePublishVolume(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring("secret"))
+		})
+
+		It("accepts the share under the name of the service parameter", func() {
+			req.VolumeContext = map[string]string{"share": "//server/share"}
+
+			_, err := subject.NodePublishVolume(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			_, source, _, opts := mounter.MountArgsForCall(0)
+			Expect(source).To(Equal("//server/share"))
+			Expect(opts).NotTo(HaveKey("share"))
+		})
+
+		Context("when the target is already mounted", func() {
+			BeforeEach(func() {
+				mounter.CheckReturns(true)
+			})
+
+			It("succeeds without mounting again", func() {
+				_, err := subject.NodePublishVolume(ctx, req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mounter.MountCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the mount fails", func() {
+			BeforeEach(func() {
+				mounter.MountReturns(errors.New("exit status 32"))
+			})
+
+			It("returns an internal error", func() {
+				_, err := subject.NodePublishVolume(ctx, req)
+				expectCode(err, codes.Internal)
+				Expect(err.Error()).To(ContainSubstring("mounting //server/share failed: exit status 32"))
+			})
+		})
+
+		Context("when the target path cannot be created", func() {
+			BeforeEach(func() {
+				fakeOs.MkdirAllReturns(errors.New("read-only file system"))
+			})
+
+			It("returns an internal error without mounting", func() {
+				_, err := subject.NodePublishVolume(ctx, req)
+				expectCode(err, codes.Internal)
+				Expect(mounter.MountCallCount()).To(Equal(0))
+			})
+		})
+
+		DescribeTable("rejects invalid requests",
+			func(modify func(*csi.NodePublishVolumeRequest)) {
+				modify(req)
+				_, err := subject.NodePublishVolume(ctx, req)
+				expectCode(err, codes.InvalidArgument)
+				Expect(mounter.MountCallCount()).To(Equal(0))
+			},
+			Entry("without a volume id", func(r *csi.NodePublishVolumeRequest) { r.VolumeId = "" }),
+			Entry("without a target path", func(r *csi.NodePublishVolumeRequest) { r.TargetPath = "" }),
+			Entry("without a volume capability", func(r *csi.NodePublishVolumeRequest) { r.VolumeCapability = nil }),
+			Entry("without a source", func(r *csi.NodePublishVolumeRequest) { r.VolumeContext = map[string]string{} }),
+			Entry("for a block volume", func(r *csi.NodePublishVolumeRequest) {
+				r.VolumeCapability.AccessType = &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}
+			}),
+			Entry("for another file system", func(r *csi.NodePublishVolumeRequest) {
+				r.VolumeCapability.AccessType = &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "nfs"}}
+			}),
+		)
+	})
+
+	Describe("NodeUnpublishVolume", func() {
+		var req *csi.NodeUnpublishVolumeRequest
+
+		BeforeEach(func() {
+			req = &csi.NodeUnpublishVolumeRequest{VolumeId: "volume-1", TargetPath: "/target"}
+			mounter.CheckReturns(true)
+		})
+
+		It("unmounts and removes the target path", func() {
+			_, err := subject.NodeUnpublishVolume(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(mounter.UnmountCallCount()).To(Equal(1))
+			_, target := mounter.UnmountArgsForCall(0)
+			Expect(target).To(Equal("/target"))
+			Expect(fakeOs.RemoveCallCount()).To(Equal(1))
+			Expect(fakeOs.RemoveArgsForCall(0)).To(Equal("/target"))
+		})
+
+		Context("when the target is not mounted", func() {
+			BeforeEach(func() {
+				mounter.CheckReturns(false)
+				fakeOs.RemoveReturns(&os.PathError{Op: "remove", Path: "/target", Err: os.ErrNotExist})
+			})
+
+			It("succeeds without unmounting", func() {
+				_, err := subject.NodeUnpublishVolume(ctx, req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mounter.UnmountCallCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the unmount fails", func() {
+			BeforeEach(func() {
+				mounter.UnmountReturns(errors.New("target is busy"))
+			})
+
+			It("returns an internal error and keeps the target path", func() {
+				_, err := subject.NodeUnpublishVolume(ctx, req)
+				expectCode(err, codes.Internal)
+				Expect(fakeOs.RemoveCallCount()).To(Equal(0))
+			})
+		})
+
+		It("requires a volume id and target path", func() {
+			_, err := subject.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{TargetPath: "/target"})
+			expectCode(err, codes.InvalidArgument)
+			_, err = subject.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: "volume-1"})
+			expectCode(err, codes.InvalidArgument)
+		})
+	})
+})
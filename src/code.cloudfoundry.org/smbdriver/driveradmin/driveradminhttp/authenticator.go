@@ -0,0 +1,131 @@
+package driveradminhttp
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+// Token is a bearer token that grants access to the admin API. Name
+// identifies the client in the logs, so that the token itself is never logged.
+type Token struct {
+	Name   string `json:"name"`
+	Token  string `json:"token"`
+	Access string `json:"access"`
+}
+
+// LoadTokens reads a JSON list of tokens from path.
+func LoadTokens(path string) ([]Token, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(contents, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid admin token file %s: %s", path, err)
+	}
+
+	seen := map[string]bool{}
+	for i, token := range tokens {
+		if token.Name == "" {
+			return nil, fmt.Errorf("admin token %d has no name", i)
+		}
+		if token.Token == "" {
+			return nil, fmt.Errorf("admin token %s is empty", token.Name)
+		}
+		if seen[token.Token] {
+			return nil, fmt.Errorf("admin token %s is used by another client", token.Name)
+		}
+		seen[token.Token] = true
+
+		if _, err := driveradmin.ParseAccess(token.Access); err != nil {
+			return nil, fmt.Errorf("admin token %s: %s", token.Name, err)
+		}
+	}
+
+	return tokens, nil
+}
+
+// Authenticator decides what the client of a request may do, from the bearer
+// token in its Authorization header and from the client certificate it
+// presented when the admin API is served with mutual TLS.
+type Authenticator interface {
+	Authenticate(req *http.Request) (client string, access driveradmin.Access)
+}
+
+type credentialAuthenticator struct {
+	tokens           []Token
+	writeCommonNames []string
+}
+
+// NewAuthenticator grants each token its access. A verified client
+// certificate grants write access when its common name is one of
+// writeCommonNames, or when writeCommonNames is empty, and read access
+// otherwise. A client that presents both gets the higher access.
+func NewAuthenticator(tokens []Token, writeCommonNames []string) Authenticator {
+	return &credentialAuthenticator{tokens: tokens, writeCommonNames: writeCommonNames}
+}
+
+func (a *credentialAuthenticator) Authenticate(req *http.Request) (string, driveradmin.Access) {
+	client, access := "", driveradmin.AccessNone
+
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		commonName := req.TLS.PeerCertificates[0].Subject.CommonName
+		client, access = "cn:"+commonName, driveradmin.AccessRead
+		if len(a.writeCommonNames) == 0 || slices.Contains(a.writeCommonNames, commonName) {
+			access = driveradmin.AccessWrite
+		}
+	}
+
+	bearer, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !found || bearer == "" {
+		return client, access
+	}
+
+	for _, token := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(token.Token)) != 1 {
+			continue
+		}
+		tokenAccess, _ := driveradmin.ParseAccess(token.Access)
+		if tokenAccess > access {
+			client, access = "token:"+token.Name, tokenAccess
+		}
+	}
+
+	return client, access
+}
+
+func requireAccess(logger lager.Logger, authenticator Authenticator, route string, handler http.Handler) http.HandlerFunc {
+	required := driveradmin.RouteAccess[route]
+	if required == driveradmin.AccessNone {
+		required = driveradmin.AccessWrite
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		client, access := authenticator.Authenticate(req)
+
+		if access == driveradmin.AccessNone {
+			logger.Info("unauthenticated-request", lager.Data{"route": route, "remote-addr": req.RemoteAddr})
+			w.Header().Set("WWW-Authenticate", `Bearer realm="smbdriver-admin"`)
+			WriteJSONResponse(w, http.StatusUnauthorized, driveradmin.ErrorResponse{Err: "unauthorized"})
+			return
+		}
+
+		if access < required {
+			logger.Info("forbidden-request", lager.Data{"route": route, "client": client, "access": access.String()})
+			WriteJSONResponse(w, http.StatusForbidden, driveradmin.ErrorResponse{Err: fmt.Sprintf("%s access required", required)})
+			return
+		}
+
+		logger.Debug("authenticated-request", lager.Data{"route": route, "client": client, "access": access.String()})
+		handler.ServeHTTP(w, req)
+	}
+}
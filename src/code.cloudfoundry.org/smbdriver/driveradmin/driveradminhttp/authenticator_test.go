@@ -0,0 +1,217 @@
+package driveradminhttp_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/driveradmin/driveradminhttp"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authenticator", func() {
+	var tokens []driveradminhttp.Token
+
+	BeforeEach(func() {
+		tokens = []driveradminhttp.Token{
+			{Name: "monitoring", Token: "read-token", Access: "read"},
+			{Name: "drain", Token: "write-token", Access: "write"},
+		}
+	})
+
+	withClientCertificate := func(req *http.Request, commonName string) {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+
+	Describe("LoadTokens", func() {
+		var path string
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "admin-tokens")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.RemoveAll, dir)
+			path = filepath.Join(dir, "admin_tokens.json")
+		})
+
+		write := func(tokens any) {
+			contents, err := json.Marshal(tokens)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(path, contents, 0600)).To(Succeed())
+		}
+
+		It("loads the tokens", func() {
+			write(tokens)
+
+			loaded, err := driveradminhttp.LoadTokens(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(Equal(tokens))
+		})
+
+		It("rejects an unknown access", func() {
+			write([]driveradminhttp.Token{{Name: "monitoring", Token: "read-token", Access: "admin"}})
+
+			_, err := driveradminhttp.LoadTokens(path)
+			Expect(err).To(MatchError(ContainSubstring(`admin token monitoring: invalid access "admin"`)))
+		})
+
+		It("rejects an empty token", func() {
+			write([]driveradminhttp.Token{{Name: "monitoring", Access: "read"}})
+
+			_, err := driveradminhttp.LoadTokens(path)
+			Expect(err).To(MatchError("admin token monitoring is empty"))
+		})
+
+		It("rejects a token that is shared by two clients", func() {
+			write([]driveradminhttp.Token{
+				{Name: "monitoring", Token: "token", Access: "read"},
+				{Name: "drain", Token: "token", Access: "write"},
+			})
+
+			_, err := driveradminhttp.LoadTokens(path)
+			Expect(err).To(MatchError("admin token drain is used by another client"))
+		})
+
+		It("rejects a file that is not JSON", func() {
+			Expect(os.WriteFile(path, []byte("read-token"), 0600)).To(Succeed())
+
+			_, err := driveradminhttp.LoadTokens(path)
+			Expect(err).To(MatchError(ContainSubstring("invalid admin token file")))
+		})
+	})
+
+	Describe("Authenticate", func() {
+		var (
+			authenticator    driveradminhttp.Authenticator
+			writeCommonNames []string
+			req              *http.Request
+		)
+
+		BeforeEach(func() {
+			writeCommonNames = nil
+			req = httptest.NewRequest("GET", "http://127.0.0.1/ping", nil)
+		})
+
+		JustBeforeEach(func() {
+			authenticator = driveradminhttp.NewAuthenticator(tokens, writeCommonNames)
+		})
+
+		It("grants the access of a bearer token", func() {
+			req.Header.Set("Authorization", "Bearer read-token")
+			client, access := authenticator.Authenticate(req)
+			Expect(client).To(Equal("token:monitoring"))
+			Expect(access).To(Equal(driveradmin.AccessRead))
+
+			req.Header.Set("Authorization", "Bearer write-token")
+			client, access = authenticator.Authenticate(req)
+			Expect(client).To(Equal("token:drain"))
+			Expect(access).To(Equal(driveradmin.AccessWrite))
+		})
+
+		It("grants no access without credentials or with an unknown token", func() {
+			_, access := authenticator.Authenticate(req)
+			Expect(access).To(Equal(driveradmin.AccessNone))
+
+			req.Header.Set("Authorization", "Bearer some-other-token")
+			_, access = authenticator.Authenticate(req)
+			Expect(access).To(Equal(driveradmin.AccessNone))
+		})
+
+		It("grants write access to any verified client certificate", func() {
+			withClientCertificate(req, "monitoring-agent")
+
+			client, access := authenticator.Authenticate(req)
+			Expect(client).To(Equal("cn:monitoring-agent"))
+			Expect(access).To(Equal(driveradmin.AccessWrite))
+		})
+
+		Context("when write access is limited to some common names", func() {
+			BeforeEach(func() {
+				writeCommonNames = []string{"smbdriver-drain"}
+			})
+
+			It("grants read access to other client certificates", func() {
+				withClientCertificate(req, "monitoring-agent")
+				_, access := authenticator.Authenticate(req)
+				Expect(access).To(Equal(driveradmin.AccessRead))
+
+				withClientCertificate(req, "smbdriver-drain")
+				_, access = authenticator.Authenticate(req)
+				Expect(access).To(Equal(driveradmin.AccessWrite))
+			})
+
+			It("grants the higher access of a certificate and a token", func() {
+				withClientCertificate(req, "monitoring-agent")
+				req.Header.Set("Authorization", "Bearer write-token")
+
+				client, access := authenticator.Authenticate(req)
+				Expect(client).To(Equal("token:drain"))
+				Expect(access).To(Equal(driveradmin.AccessWrite))
+			})
+		})
+	})
+
+	Describe("NewAuthenticatedHandler", func() {
+		var (
+			driverAdmin *smbdriverfakes.FakeDriverAdmin
+			handler     http.Handler
+		)
+
+		BeforeEach(func() {
+			driverAdmin = &smbdriverfakes.FakeDriverAdmin{}
+			var err error
+			handler, err = driveradminhttp.NewAuthenticatedHandler(
+				lagertest.NewTestLogger("authenticated-handler"),
+				driverAdmin,
+				driveradminhttp.NewAuthenticator(tokens, nil),
+			)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		serve := func(path, token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "http://127.0.0.1"+path, nil)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		It("rejects requests without credentials", func() {
+			recorder := serve("/ping", "")
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(recorder.Header().Get("WWW-Authenticate")).To(ContainSubstring("Bearer"))
+			Expect(driverAdmin.PingCallCount()).To(Equal(0))
+		})
+
+		It("lets read access report on the driver", func() {
+			Expect(serve("/ping", "read-token").Code).To(Equal(http.StatusOK))
+			Expect(serve("/mounts", "read-token").Code).To(Equal(http.StatusOK))
+			Expect(driverAdmin.PingCallCount()).To(Equal(1))
+			Expect(driverAdmin.MountsCallCount()).To(Equal(1))
+		})
+
+		It("only lets write access evacuate the driver", func() {
+			recorder := serve("/evacuate", "read-token")
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			Expect(recorder.Body.String()).To(ContainSubstring("write access required"))
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(0))
+
+			Expect(serve("/evacuate", "write-token").Code).To(Equal(http.StatusOK))
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,164 @@
+package driveradminhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"github.com/tedsuo/rata"
+)
+
+type remoteClient struct {
+	httpClient *http.Client
+	reqGen     *rata.RequestGenerator
+	token      string
+}
+
+// NewRemoteClient returns a client of the admin API served at url. The
+// requests are made with httpClient, which presents the client certificate
+// when the admin API is served with mutual TLS, and with token as their bearer
+// token unless it is empty. The context of the env of each call bounds its
+// request.
+func NewRemoteClient(url string, httpClient *http.Client, token string) driveradmin.DriverAdmin {
+	return &remoteClient{
+		httpClient: httpClient,
+		reqGen:     rata.NewRequestGenerator(url, driveradmin.Routes),
+		token:      token,
+	}
+}
+
+func (r *remoteClient) Evacuate(env dockerdriver.Env) driveradmin.ErrorResponse {
+	var response driveradmin.ErrorResponse
+	if err := r.get(env, driveradmin.EvacuateRoute, &response); err != nil {
+		return driveradmin.ErrorResponse{Err: err.Error()}
+	}
+	return response
+}
+
+func (r *remoteClient) Ping(env dockerdriver.Env) driveradmin.ErrorResponse {
+	var response driveradmin.ErrorResponse
+	if err := r.get(env, driveradmin.PingRoute, &response); err != nil {
+		return driveradmin.ErrorResponse{Err: err.Error()}
+	}
+	return response
+}
+
+func (r *remoteClient) Mounts(env dockerdriver.Env) driveradmin.MountsResponse {
+	var response driveradmin.MountsResponse
+	if err := r.get(env, driveradmin.MountsRoute, &response); err != nil {
+		return driveradmin.MountsResponse{Err: err.Error()}
+	}
+	return response
+}
+
+func (r *remoteClient) CircuitBreakers(env dockerdriver.Env) driveradmin.CircuitBreakersResponse {
+	var response driveradmin.CircuitBreakersResponse
+	if err := r.get(env, driveradmin.CircuitBreakersRoute, &response); err != nil {
+		return driveradmin.CircuitBreakersResponse{Err: err.Error()}
+	}
+	return response
+}
+
+func (r *remoteClient) Capacity(env dockerdriver.Env) driveradmin.CapacityResponse {
+	var response driveradmin.CapacityResponse
+	if err := r.get(env, driveradmin.CapacityRoute, &response); err != nil {
+		return driveradmin.CapacityResponse{Err: err.Error()}
+	}
+	return response
+}
+
+func (r *remoteClient) CifsStats(env dockerdriver.Env) driveradmin.CifsStatsResponse {
+	var response driveradmin.CifsStatsResponse
+	if err := r.get(env, driveradmin.CifsStatsRoute, &response); err != nil {
+		return driveradmin.CifsStatsResponse{Err: err.Error()}
+	}
+	return response
+}
+
+func (r *remoteClient) Faults(env dockerdriver.Env) driveradmin.FaultsResponse {
+	var response driveradmin.FaultsResponse
+	if err := r.get(env, driveradmin.FaultsRoute, &response); err != nil {
+		return driveradmin.FaultsResponse{Err: err.Error()}
+	}
+	return response
+}
+
+func (r *remoteClient) SetFaults(env dockerdriver.Env, faults []driveradmin.Fault) driveradmin.ErrorResponse {
+	if faults == nil {
+		faults = []driveradmin.Fault{}
+	}
+
+	var response driveradmin.ErrorResponse
+	if err := r.send(env, driveradmin.SetFaultsRoute, faults, &response); err != nil {
+		return driveradmin.ErrorResponse{Err: err.Error()}
+	}
+	return response
+}
+
+// get requests route and decodes its JSON body into response. The error of a
+// response that is not OK is returned with its status.
+func (r *remoteClient) get(env dockerdriver.Env, route string, response any) error {
+	return r.send(env, route, nil, response)
+}
+
+// send requests route like get, with request encoded as its JSON body unless
+// it is nil.
+func (r *remoteClient) send(env dockerdriver.Env, route string, request any, response any) error {
+	logger := env.Logger().Session("remoteclient-" + route)
+	logger.Debug("start")
+	defer logger.Debug("end")
+
+	var body io.Reader
+	if request != nil {
+		contents, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(contents)
+	}
+
+	req, err := r.reqGen.CreateRequest(route, nil, body)
+	if err != nil {
+		return err
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req = req.WithContext(env.Context())
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		logger.Error("failed-request", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("failed-reading-response", err)
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse driveradmin.ErrorResponse
+		if err := json.Unmarshal(contents, &errorResponse); err != nil || errorResponse.Err == "" {
+			errorResponse.Err = http.StatusText(resp.StatusCode)
+		}
+		logger.Info("failed-response", lager.Data{"status": resp.StatusCode, "error": errorResponse.Err})
+		return fmt.Errorf("%s: %d %s", route, resp.StatusCode, errorResponse.Err)
+	}
+
+	if err := json.Unmarshal(contents, response); err != nil {
+		logger.Error("failed-parsing-response", err)
+		return fmt.Errorf("%s: invalid response: %s", route, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package driveradminhttp_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/driveradmin/driveradminhttp"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RemoteClient", func() {
+	var (
+		logger      *lagertest.TestLogger
+		env         dockerdriver.Env
+		driverAdmin *smbdriverfakes.FakeDriverAdmin
+		server      *httptest.Server
+		token       string
+		client      driveradmin.DriverAdmin
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("remote-client")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		driverAdmin = &smbdriverfakes.FakeDriverAdmin{}
+		token = "write-token"
+
+		handler, err := driveradminhttp.NewAuthenticatedHandler(logger, driverAdmin, driveradminhttp.NewAuthenticator([]driveradminhttp.Token{
+			{Name: "monitoring", Token: "read-token", Access: "read"},
+			{Name: "drain", Token: "write-token", Access: "write"},
+		}, nil))
+		Expect(err).NotTo(HaveOccurred())
+		server = httptest.NewServer(handler)
+		DeferCleanup(server.Close)
+	})
+
+	JustBeforeEach(func() {
+		client = driveradminhttp.NewRemoteClient(server.URL, server.Client(), token)
+	})
+
+	It("pings and evacuates the driver", func() {
+		Expect(client.Ping(env).Err).To(BeEmpty())
+		Expect(driverAdmin.PingCallCount()).To(Equal(1))
+
+		Expect(client.Evacuate(env).Err).To(BeEmpty())
+		Expect(driverAdmin.EvacuateCallCount()).To(Equal(1))
+	})
+
+	It("reports on the driver", func() {
+		checkedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		mounts := driveradmin.MountsResponse{Mounts: []driveradmin.Mount{
+			{Target: "/var/vcap/data/volumes/smb/vol1", Source: "//server/share", Sources: []string{"//server/share"}, Personality: "smbdriver"},
+		}}
+		driverAdmin.MountsReturns(mounts)
+		driverAdmin.CircuitBreakersReturns(driveradmin.CircuitBreakersResponse{CircuitBreakers: []driveradmin.CircuitBreaker{
+			{Server: "server", State: "open", ConsecutiveFailures: 3, OpenUntil: checkedAt},
+		}})
+		driverAdmin.CapacityReturns(driveradmin.CapacityResponse{Volumes: []driveradmin.VolumeCapacity{
+			{Target: "/var/vcap/data/volumes/smb/vol1", TotalBytes: 100, UsedBytes: 40, FreeBytes: 60, CheckedAt: checkedAt},
+		}})
+		driverAdmin.CifsStatsReturns(driveradmin.CifsStatsResponse{SessionReconnects: 2, Volumes: []driveradmin.VolumeCifsStats{
+			{Target: "/var/vcap/data/volumes/smb/vol1", Share: `\\server\share`, CheckedAt: checkedAt},
+		}})
+
+		Expect(client.Mounts(env)).To(Equal(mounts))
+		Expect(client.CircuitBreakers(env).CircuitBreakers[0].OpenUntil).To(BeTemporally("==", checkedAt))
+		Expect(client.Capacity(env).Volumes[0].UsedBytes).To(Equal(uint64(40)))
+
+		cifsStats := client.CifsStats(env)
+		Expect(cifsStats.SessionReconnects).To(Equal(uint64(2)))
+		Expect(cifsStats.Volumes[0].Share).To(Equal(`\\server\share`))
+	})
+
+	It("lists and sets the faults of the driver", func() {
+		faults := []driveradmin.Fault{{Operation: "mount", Host: "server", Hang: "2m"}}
+		driverAdmin.FaultsReturns(driveradmin.FaultsResponse{Faults: faults})
+
+		Expect(client.Faults(env).Faults).To(Equal(faults))
+
+		Expect(client.SetFaults(env, faults).Err).To(BeEmpty())
+		Expect(driverAdmin.SetFaultsCallCount()).To(Equal(1))
+		_, setFaults := driverAdmin.SetFaultsArgsForCall(0)
+		Expect(setFaults).To(Equal(faults))
+
+		Expect(client.SetFaults(env, nil).Err).To(BeEmpty())
+		_, setFaults = driverAdmin.SetFaultsArgsForCall(1)
+		Expect(setFaults).To(BeEmpty())
+	})
+
+	It("returns the error of the driver", func() {
+		driverAdmin.EvacuateReturns(driveradmin.ErrorResponse{Err: "unexpected error: server process not found"})
+
+		Expect(client.Evacuate(env).Err).To(Equal("evacuate: 500 unexpected error: server process not found"))
+	})
+
+	Context("without enough access", func() {
+		BeforeEach(func() {
+			token = "read-token"
+		})
+
+		It("returns the error of the admin API", func() {
+			Expect(client.Ping(env).Err).To(BeEmpty())
+			Expect(client.Evacuate(env).Err).To(Equal("evacuate: 403 write access required"))
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(0))
+
+			Expect(client.SetFaults(env, nil).Err).To(Equal("set-faults: 403 write access required"))
+			Expect(driverAdmin.SetFaultsCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("without a token", func() {
+		BeforeEach(func() {
+			token = ""
+		})
+
+		It("is not authorized", func() {
+			Expect(client.Mounts(env).Err).To(Equal("mounts: 401 unauthorized"))
+		})
+	})
+
+	Context("when the request is cancelled", func() {
+		It("returns the error of the context", func() {
+			ctx, cancel := context.WithCancel(context.TODO())
+			cancel()
+
+			response := client.Ping(driverhttp.NewHttpDriverEnv(logger, ctx))
+			Expect(response.Err).To(ContainSubstring("context canceled"))
+		})
+	})
+
+	Context("when the admin API is not served", func() {
+		JustBeforeEach(func() {
+			server.Close()
+		})
+
+		It("returns the error of the connection", func() {
+			Expect(client.Ping(env).Err).To(ContainSubstring("connection refused"))
+		})
+	})
+})
@@ -17,14 +17,38 @@ func NewHandler(logger lager.Logger, client driveradmin.DriverAdmin) (http.Handl
 	logger.Info("start")
 	defer logger.Info("end")
 
-	var handlers = rata.Handlers{
-		driveradmin.EvacuateRoute: newEvacuateHandler(logger, client),
-		driveradmin.PingRoute:     newPingHandler(logger, client),
+	return rata.NewRouter(driveradmin.Routes, newHandlers(logger, client))
+}
+
+// NewAuthenticatedHandler serves only the requests whose client has the
+// access that their route requires in driveradmin.RouteAccess.
+func NewAuthenticatedHandler(logger lager.Logger, client driveradmin.DriverAdmin, authenticator Authenticator) (http.Handler, error) {
+	logger = logger.Session("server")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	handlers := newHandlers(logger, client)
+	for route, handler := range handlers {
+		handlers[route] = requireAccess(logger, authenticator, route, handler)
 	}
 
 	return rata.NewRouter(driveradmin.Routes, handlers)
 }
 
+func newHandlers(logger lager.Logger, client driveradmin.DriverAdmin) rata.Handlers {
+	return rata.Handlers{
+		driveradmin.EvacuateRoute:        newEvacuateHandler(logger, client),
+		driveradmin.PingRoute:            newPingHandler(logger, client),
+		driveradmin.MountsRoute:          newMountsHandler(logger, client),
+		driveradmin.CircuitBreakersRoute: newCircuitBreakersHandler(logger, client),
+		driveradmin.CapacityRoute:        newCapacityHandler(logger, client),
+		driveradmin.MetricsRoute:         newMetricsHandler(logger, client),
+		driveradmin.CifsStatsRoute:       newCifsStatsHandler(logger, client),
+		driveradmin.FaultsRoute:          newFaultsHandler(logger, client),
+		driveradmin.SetFaultsRoute:       newSetFaultsHandler(logger, client),
+	}
+}
+
 func newEvacuateHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		logger := logger.Session("handle-evacuate")
@@ -63,6 +87,157 @@ func newPingHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.Ha
 	}
 }
 
+func newMountsHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-mounts")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Mounts(env)
+		if response.Err != "" {
+			logger.Error("failed-listing-mounts", errors.New(response.Err))
+			WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newCircuitBreakersHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-circuit-breakers")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.CircuitBreakers(env)
+		if response.Err != "" {
+			logger.Error("failed-listing-circuit-breakers", errors.New(response.Err))
+			WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newCapacityHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-capacity")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Capacity(env)
+		if response.Err != "" {
+			logger.Error("failed-reporting-capacity", errors.New(response.Err))
+			WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newCifsStatsHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-cifs-stats")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.CifsStats(env)
+		if response.Err != "" {
+			logger.Error("failed-reporting-cifs-stats", errors.New(response.Err))
+			WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newFaultsHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-faults")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.Faults(env)
+		if response.Err != "" {
+			logger.Error("failed-listing-faults", errors.New(response.Err))
+			WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newSetFaultsHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-set-faults")
+		logger.Info("start")
+		defer logger.Info("end")
+
+		var faults []driveradmin.Fault
+		if err := json.NewDecoder(req.Body).Decode(&faults); err != nil {
+			logger.Error("failed-parsing-faults", err)
+			WriteJSONResponse(w, http.StatusBadRequest, driveradmin.ErrorResponse{Err: "invalid faults: " + err.Error()})
+			return
+		}
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		response := client.SetFaults(env, faults)
+		if response.Err != "" {
+			logger.Error("failed-setting-faults", errors.New(response.Err))
+			WriteJSONResponse(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		WriteJSONResponse(w, http.StatusOK, response)
+	}
+}
+
+func newMetricsHandler(logger lager.Logger, client driveradmin.DriverAdmin) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		logger := logger.Session("handle-metrics")
+		logger.Debug("start")
+		defer logger.Debug("end")
+
+		env := driverhttp.EnvWithMonitor(logger, req.Context(), w)
+
+		capacity := client.Capacity(env)
+		if capacity.Err != "" {
+			logger.Error("failed-reporting-capacity", errors.New(capacity.Err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		cifsStats := client.CifsStats(env)
+		if cifsStats.Err != "" {
+			logger.Error("failed-reporting-cifs-stats", errors.New(cifsStats.Err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(append(capacityMetrics(capacity.Volumes), cifsStatsMetrics(cifsStats)...)); err != nil {
+			logger.Error("failed-writing-metrics", err)
+		}
+	}
+}
+
 func WriteJSONResponse(w http.ResponseWriter, statusCode int, jsonObj any) {
 	jsonBytes, err := json.Marshal(jsonObj)
 	if err != nil {
@@ -6,6 +6,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/lager/v3/lagertest"
 	"code.cloudfoundry.org/smbdriver/driveradmin"
@@ -76,5 +78,253 @@ var _ = Describe("Volman Driver Handlers", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(response.Err).Should(BeEmpty())
 		})
+
+		It("should produce a handler with a mounts route", func() {
+			By("faking out the driver")
+			mounts := []driveradmin.Mount{{Target: "/mnt/vol", Source: "//b/share", Sources: []string{"//a/share", "//b/share"}}}
+			driverAdmin := &smbdriverfakes.FakeDriverAdmin{}
+			driverAdmin.MountsReturns(driveradmin.MountsResponse{Mounts: mounts})
+			handler, err := driveradminhttp.NewHandler(testLogger, driverAdmin)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("then fake serving the response using the handler")
+			route, found := driveradmin.Routes.FindRouteByName(driveradmin.MountsRoute)
+			Expect(found).To(BeTrue())
+
+			path := fmt.Sprintf("http://0.0.0.0%s", route.Path)
+			httpRequest, err := http.NewRequest("GET", path, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			httpResponseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(httpResponseRecorder, httpRequest)
+
+			By("then deserialing the HTTP response")
+			response := driveradmin.MountsResponse{}
+			body, err := io.ReadAll(httpResponseRecorder.Body)
+			Expect(err).NotTo(HaveOccurred())
+			err = json.Unmarshal(body, &response)
+
+			By("then expecting correct JSON conversion")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Err).Should(BeEmpty())
+			Expect(response.Mounts).To(Equal(mounts))
+		})
+
+		It("should produce a handler with a circuit breakers route", func() {
+			By("faking out the driver")
+			breakers := []driveradmin.CircuitBreaker{{Server: "nas", State: "open", ConsecutiveFailures: 5, OpenUntil: time.Date(2024, 3, 1, 12, 0, 30, 0, time.UTC)}}
+			driverAdmin := &smbdriverfakes.FakeDriverAdmin{}
+			driverAdmin.CircuitBreakersReturns(driveradmin.CircuitBreakersResponse{CircuitBreakers: breakers})
+			handler, err := driveradminhttp.NewHandler(testLogger, driverAdmin)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("then fake serving the response using the handler")
+			route, found := driveradmin.Routes.FindRouteByName(driveradmin.CircuitBreakersRoute)
+			Expect(found).To(BeTrue())
+
+			path := fmt.Sprintf("http://0.0.0.0%s", route.Path)
+			httpRequest, err := http.NewRequest("GET", path, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			httpResponseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(httpResponseRecorder, httpRequest)
+
+			By("then deserialing the HTTP response")
+			response := driveradmin.CircuitBreakersResponse{}
+			body, err := io.ReadAll(httpResponseRecorder.Body)
+			Expect(err).NotTo(HaveOccurred())
+			err = json.Unmarshal(body, &response)
+
+			By("then expecting correct JSON conversion")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Err).Should(BeEmpty())
+			Expect(response.CircuitBreakers).To(Equal(breakers))
+		})
+
+		It("should produce a handler with a capacity route", func() {
+			By("faking out the driver")
+			volumes := []driveradmin.VolumeCapacity{{Target: "/mnt/vol", Source: "//a/share", TotalBytes: 1000, FreeBytes: 600, UsedBytes: 400, CheckedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}}
+			driverAdmin := &smbdriverfakes.FakeDriverAdmin{}
+			driverAdmin.CapacityReturns(driveradmin.CapacityResponse{Volumes: volumes})
+			handler, err := driveradminhttp.NewHandler(testLogger, driverAdmin)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("then fake serving the response using the handler")
+			route, found := driveradmin.Routes.FindRouteByName(driveradmin.CapacityRoute)
+			Expect(found).To(BeTrue())
+
+			path := fmt.Sprintf("http://0.0.0.0%s", route.Path)
+			httpRequest, err := http.NewRequest("GET", path, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			httpResponseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(httpResponseRecorder, httpRequest)
+
+			By("then deserialing the HTTP response")
+			response := driveradmin.CapacityResponse{}
+			body, err := io.ReadAll(httpResponseRecorder.Body)
+			Expect(err).NotTo(HaveOccurred())
+			err = json.Unmarshal(body, &response)
+
+			By("then expecting correct JSON conversion")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Err).Should(BeEmpty())
+			Expect(response.Volumes).To(Equal(volumes))
+		})
+
+		It("should produce a handler with a cifs stats route", func() {
+			By("faking out the driver")
+			volumes := []driveradmin.VolumeCifsStats{{
+				Target:              "/mnt/vol",
+				Source:              "//a/share",
+				Share:               `\\a\share`,
+				SessionStatus:       "good",
+				SMBs:                120,
+				Operations:          map[string]driveradmin.CifsOperation{"Creates": {Sent: 40, Failed: 1}},
+				OperationsPerSecond: 2,
+				CheckedAt:           time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+			}}
+			driverAdmin := &smbdriverfakes.FakeDriverAdmin{}
+			driverAdmin.CifsStatsReturns(driveradmin.CifsStatsResponse{SessionReconnects: 1, ShareReconnects: 2, Volumes: volumes})
+			handler, err := driveradminhttp.NewHandler(testLogger, driverAdmin)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("then fake serving the response using the handler")
+			route, found := driveradmin.Routes.FindRouteByName(driveradmin.CifsStatsRoute)
+			Expect(found).To(BeTrue())
+
+			path := fmt.Sprintf("http://0.0.0.0%s", route.Path)
+			httpRequest, err := http.NewRequest("GET", path, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			httpResponseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(httpResponseRecorder, httpRequest)
+
+			By("then deserialing the HTTP response")
+			response := driveradmin.CifsStatsResponse{}
+			body, err := io.ReadAll(httpResponseRecorder.Body)
+			Expect(err).NotTo(HaveOccurred())
+			err = json.Unmarshal(body, &response)
+
+			By("then expecting correct JSON conversion")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Err).Should(BeEmpty())
+			Expect(response.SessionReconnects).To(Equal(uint64(1)))
+			Expect(response.ShareReconnects).To(Equal(uint64(2)))
+			Expect(response.Volumes).To(Equal(volumes))
+		})
+
+		It("should produce a handler with a metrics route", func() {
+			By("faking out the driver")
+			driverAdmin := &smbdriverfakes.FakeDriverAdmin{}
+			driverAdmin.CapacityReturns(driveradmin.CapacityResponse{Volumes: []driveradmin.VolumeCapacity{
+				{Target: "/mnt/vol", Source: `//a/"share"`, TotalBytes: 1000, FreeBytes: 600, UsedBytes: 400, TotalInodes: 100, FreeInodes: 90, UsedInodes: 10},
+				{Target: "/mnt/hung", Source: "//b/share", Err: "statfs timed out after 10s"},
+			}})
+			driverAdmin.CifsStatsReturns(driveradmin.CifsStatsResponse{SessionReconnects: 3, ShareReconnects: 4, Volumes: []driveradmin.VolumeCifsStats{
+				{Target: "/mnt/vol", Source: `//a/"share"`, Disconnected: true, SMBs: 120, Operations: map[string]driveradmin.CifsOperation{"Writes": {Sent: 40, Failed: 1}, "Creates": {Sent: 20}}},
+				{Target: "/mnt/dfs", Source: "//c/share", Err: "the share is not listed in /proc/fs/cifs/Stats"},
+			}})
+			handler, err := driveradminhttp.NewHandler(testLogger, driverAdmin)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("then fake serving the response using the handler")
+			route, found := driveradmin.Routes.FindRouteByName(driveradmin.MetricsRoute)
+			Expect(found).To(BeTrue())
+
+			path := fmt.Sprintf("http://0.0.0.0%s", route.Path)
+			httpRequest, err := http.NewRequest("GET", path, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			httpResponseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(httpResponseRecorder, httpRequest)
+
+			By("then expecting the Prometheus text format")
+			Expect(httpResponseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(httpResponseRecorder.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4"))
+
+			body := httpResponseRecorder.Body.String()
+			Expect(body).To(ContainSubstring("# TYPE smbdriver_volume_total_bytes gauge\n"))
+			Expect(body).To(ContainSubstring(`smbdriver_volume_total_bytes{target="/mnt/vol",source="//a/\"share\""} 1000` + "\n"))
+			Expect(body).To(ContainSubstring(`smbdriver_volume_free_bytes{target="/mnt/vol",source="//a/\"share\""} 600` + "\n"))
+			Expect(body).To(ContainSubstring(`smbdriver_volume_used_inodes{target="/mnt/vol",source="//a/\"share\""} 10` + "\n"))
+			Expect(body).NotTo(ContainSubstring("/mnt/hung"))
+
+			Expect(body).To(ContainSubstring("# TYPE smbdriver_cifs_session_reconnects_total counter\nsmbdriver_cifs_session_reconnects_total 3\n"))
+			Expect(body).To(ContainSubstring("smbdriver_cifs_share_reconnects_total 4\n"))
+			Expect(body).To(ContainSubstring(`smbdriver_volume_cifs_disconnected{target="/mnt/vol",source="//a/\"share\""} 1` + "\n"))
+			Expect(body).To(ContainSubstring(`smbdriver_volume_cifs_smbs_total{target="/mnt/vol",source="//a/\"share\""} 120` + "\n"))
+			Expect(body).To(ContainSubstring(
+				`smbdriver_volume_cifs_operations_total{target="/mnt/vol",source="//a/\"share\"",operation="Creates"} 20` + "\n" +
+					`smbdriver_volume_cifs_operations_total{target="/mnt/vol",source="//a/\"share\"",operation="Writes"} 40` + "\n"))
+			Expect(body).To(ContainSubstring(`smbdriver_volume_cifs_failed_operations_total{target="/mnt/vol",source="//a/\"share\"",operation="Writes"} 1` + "\n"))
+			Expect(body).NotTo(ContainSubstring("/mnt/dfs"))
+		})
+
+		It("should produce a handler with a faults route", func() {
+			By("faking out the driver")
+			faults := []driveradmin.Fault{{Operation: "mount", Host: "server", Errno: 13}}
+			driverAdmin := &smbdriverfakes.FakeDriverAdmin{}
+			driverAdmin.FaultsReturns(driveradmin.FaultsResponse{Faults: faults})
+			handler, err := driveradminhttp.NewHandler(testLogger, driverAdmin)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("then fake serving the response using the handler")
+			route, found := driveradmin.Routes.FindRouteByName(driveradmin.FaultsRoute)
+			Expect(found).To(BeTrue())
+
+			path := fmt.Sprintf("http://0.0.0.0%s", route.Path)
+			httpRequest, err := http.NewRequest("GET", path, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			httpResponseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(httpResponseRecorder, httpRequest)
+
+			By("then deserialing the HTTP response")
+			response := driveradmin.FaultsResponse{}
+			body, err := io.ReadAll(httpResponseRecorder.Body)
+			Expect(err).NotTo(HaveOccurred())
+			err = json.Unmarshal(body, &response)
+
+			By("then expecting correct JSON conversion")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Err).Should(BeEmpty())
+			Expect(response.Faults).To(Equal(faults))
+		})
+
+		It("should produce a handler with a set faults route", func() {
+			By("faking out the driver")
+			driverAdmin := &smbdriverfakes.FakeDriverAdmin{}
+			driverAdmin.SetFaultsReturns(driveradmin.ErrorResponse{})
+			handler, err := driveradminhttp.NewHandler(testLogger, driverAdmin)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("then fake serving the response using the handler")
+			route, found := driveradmin.Routes.FindRouteByName(driveradmin.SetFaultsRoute)
+			Expect(found).To(BeTrue())
+
+			path := fmt.Sprintf("http://0.0.0.0%s", route.Path)
+			httpRequest, err := http.NewRequest(route.Method, path, strings.NewReader(`[{"operation": "unmount", "volume": "vol1", "hang": "2m"}]`))
+			Expect(err).NotTo(HaveOccurred())
+
+			httpResponseRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(httpResponseRecorder, httpRequest)
+
+			By("then expecting the faults to be set")
+			Expect(httpResponseRecorder.Code).To(Equal(http.StatusOK))
+			Expect(driverAdmin.SetFaultsCallCount()).To(Equal(1))
+			_, faults := driverAdmin.SetFaultsArgsForCall(0)
+			Expect(faults).To(Equal([]driveradmin.Fault{{Operation: "unmount", Volume: "vol1", Hang: "2m"}}))
+
+			By("then rejecting faults that are not JSON")
+			httpRequest, err = http.NewRequest(route.Method, path, strings.NewReader(`unmount`))
+			Expect(err).NotTo(HaveOccurred())
+
+			httpResponseRecorder = httptest.NewRecorder()
+			handler.ServeHTTP(httpResponseRecorder, httpRequest)
+			Expect(httpResponseRecorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(httpResponseRecorder.Body.String()).To(ContainSubstring("invalid faults"))
+			Expect(driverAdmin.SetFaultsCallCount()).To(Equal(1))
+		})
 	})
 })
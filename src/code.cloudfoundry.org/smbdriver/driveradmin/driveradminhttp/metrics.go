@@ -0,0 +1,117 @@
+package driveradminhttp
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+type capacityMetric struct {
+	name  string
+	help  string
+	value func(driveradmin.VolumeCapacity) uint64
+}
+
+var capacityMetricDefinitions = []capacityMetric{
+	{"smbdriver_volume_total_bytes", "Size of the share mounted for a volume.", func(v driveradmin.VolumeCapacity) uint64 { return v.TotalBytes }},
+	{"smbdriver_volume_free_bytes", "Bytes available on the share mounted for a volume.", func(v driveradmin.VolumeCapacity) uint64 { return v.FreeBytes }},
+	{"smbdriver_volume_used_bytes", "Bytes used on the share mounted for a volume.", func(v driveradmin.VolumeCapacity) uint64 { return v.UsedBytes }},
+	{"smbdriver_volume_total_inodes", "Number of inodes of the share mounted for a volume.", func(v driveradmin.VolumeCapacity) uint64 { return v.TotalInodes }},
+	{"smbdriver_volume_free_inodes", "Free inodes on the share mounted for a volume.", func(v driveradmin.VolumeCapacity) uint64 { return v.FreeInodes }},
+	{"smbdriver_volume_used_inodes", "Used inodes on the share mounted for a volume.", func(v driveradmin.VolumeCapacity) uint64 { return v.UsedInodes }},
+}
+
+// capacityMetrics renders the capacity of the volumes in the Prometheus text
+// exposition format. Volumes that could not be checked are left out.
+func capacityMetrics(volumes []driveradmin.VolumeCapacity) []byte {
+	var b bytes.Buffer
+
+	for _, metric := range capacityMetricDefinitions {
+		writeHeader(&b, metric.name, "gauge", metric.help)
+
+		for _, volume := range volumes {
+			if volume.Err != "" {
+				continue
+			}
+			fmt.Fprintf(&b, "%s{%s} %d\n", metric.name, volumeLabels(volume.Target, volume.Source), metric.value(volume))
+		}
+	}
+
+	return b.Bytes()
+}
+
+// cifsStatsMetrics renders the kernel CIFS client statistics in the
+// Prometheus text exposition format. Volumes whose share was not found are
+// left out.
+func cifsStatsMetrics(stats driveradmin.CifsStatsResponse) []byte {
+	var b bytes.Buffer
+
+	writeHeader(&b, "smbdriver_cifs_session_reconnects_total", "counter", "SMB sessions reconnected by the kernel CIFS client.")
+	fmt.Fprintf(&b, "smbdriver_cifs_session_reconnects_total %d\n", stats.SessionReconnects)
+	writeHeader(&b, "smbdriver_cifs_share_reconnects_total", "counter", "Shares reconnected by the kernel CIFS client.")
+	fmt.Fprintf(&b, "smbdriver_cifs_share_reconnects_total %d\n", stats.ShareReconnects)
+
+	volumes := []driveradmin.VolumeCifsStats{}
+	for _, volume := range stats.Volumes {
+		if volume.Err == "" {
+			volumes = append(volumes, volume)
+		}
+	}
+
+	writeHeader(&b, "smbdriver_volume_cifs_disconnected", "gauge", "1 while the share mounted for a volume is disconnected.")
+	for _, volume := range volumes {
+		disconnected := 0
+		if volume.Disconnected {
+			disconnected = 1
+		}
+		fmt.Fprintf(&b, "smbdriver_volume_cifs_disconnected{%s} %d\n", volumeLabels(volume.Target, volume.Source), disconnected)
+	}
+
+	writeHeader(&b, "smbdriver_volume_cifs_smbs_total", "counter", "Requests sent for the share mounted for a volume.")
+	for _, volume := range volumes {
+		fmt.Fprintf(&b, "smbdriver_volume_cifs_smbs_total{%s} %d\n", volumeLabels(volume.Target, volume.Source), volume.SMBs)
+	}
+
+	writeHeader(&b, "smbdriver_volume_cifs_operations_total", "counter", "Requests of each kind sent for the share mounted for a volume.")
+	for _, volume := range volumes {
+		for _, name := range operationNames(volume) {
+			fmt.Fprintf(&b, "smbdriver_volume_cifs_operations_total{%s,operation=%s} %d\n", volumeLabels(volume.Target, volume.Source), labelValue(name), volume.Operations[name].Sent)
+		}
+	}
+
+	writeHeader(&b, "smbdriver_volume_cifs_failed_operations_total", "counter", "Failed requests of each kind for the share mounted for a volume.")
+	for _, volume := range volumes {
+		for _, name := range operationNames(volume) {
+			fmt.Fprintf(&b, "smbdriver_volume_cifs_failed_operations_total{%s,operation=%s} %d\n", volumeLabels(volume.Target, volume.Source), labelValue(name), volume.Operations[name].Failed)
+		}
+	}
+
+	return b.Bytes()
+}
+
+func writeHeader(b *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+func volumeLabels(target, source string) string {
+	return fmt.Sprintf("target=%s,source=%s", labelValue(target), labelValue(source))
+}
+
+func operationNames(volume driveradmin.VolumeCifsStats) []string {
+	names := []string{}
+	for name := range volume.Operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelValue(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
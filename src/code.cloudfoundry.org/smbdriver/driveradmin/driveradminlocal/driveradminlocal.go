@@ -4,13 +4,22 @@ import (
 	"os"
 
 	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
 	"code.cloudfoundry.org/smbdriver/driveradmin"
 	"github.com/tedsuo/ifrit"
 )
 
+const errFaultInjectionDisabled = "fault injection is disabled"
+
 type DriverAdminLocal struct {
 	serverProcess ifrit.Process
 	drainables    []driveradmin.Drainable
+	guards        []driveradmin.EvacuationGuard
+	mountListers  []driveradmin.MountLister
+	breakers      []driveradmin.CircuitBreakerLister
+	reporters     []driveradmin.CapacityReporter
+	cifsReporters []driveradmin.CifsStatsReporter
+	faultInjector driveradmin.FaultInjector
 }
 
 func NewDriverAdminLocal() *DriverAdminLocal {
@@ -27,6 +36,34 @@ func (d *DriverAdminLocal) RegisterDrainable(rhs driveradmin.Drainable) {
 	d.drainables = append(d.drainables, rhs)
 }
 
+// RegisterEvacuationGuard refuses evacuation for as long as the guard
+// returns an error.
+func (d *DriverAdminLocal) RegisterEvacuationGuard(rhs driveradmin.EvacuationGuard) {
+	d.guards = append(d.guards, rhs)
+}
+
+func (d *DriverAdminLocal) RegisterMountLister(rhs driveradmin.MountLister) {
+	d.mountListers = append(d.mountListers, rhs)
+}
+
+func (d *DriverAdminLocal) RegisterCircuitBreakerLister(rhs driveradmin.CircuitBreakerLister) {
+	d.breakers = append(d.breakers, rhs)
+}
+
+func (d *DriverAdminLocal) RegisterCapacityReporter(rhs driveradmin.CapacityReporter) {
+	d.reporters = append(d.reporters, rhs)
+}
+
+func (d *DriverAdminLocal) RegisterCifsStatsReporter(rhs driveradmin.CifsStatsReporter) {
+	d.cifsReporters = append(d.cifsReporters, rhs)
+}
+
+// RegisterFaultInjector serves the faults of the injector, which is only
+// registered when fault injection is enabled.
+func (d *DriverAdminLocal) RegisterFaultInjector(rhs driveradmin.FaultInjector) {
+	d.faultInjector = rhs
+}
+
 func (d *DriverAdminLocal) Evacuate(env dockerdriver.Env) driveradmin.ErrorResponse {
 	logger := env.Logger().Session("evacuate")
 	logger.Info("start")
@@ -36,6 +73,13 @@ func (d *DriverAdminLocal) Evacuate(env dockerdriver.Env) driveradmin.ErrorRespo
 		return driveradmin.ErrorResponse{Err: "unexpected error: server process not found"}
 	}
 
+	for _, guard := range d.guards {
+		if err := guard.CheckEvacuate(env); err != nil {
+			logger.Info("evacuation-refused", lager.Data{"error": err.Error()})
+			return driveradmin.ErrorResponse{Err: err.Error()}
+		}
+	}
+
 	for _, svr := range d.drainables {
 		if err := svr.Drain(env); err != nil {
 			logger.Error("failed-draining", err)
@@ -54,3 +98,85 @@ func (d *DriverAdminLocal) Ping(env dockerdriver.Env) driveradmin.ErrorResponse
 
 	return driveradmin.ErrorResponse{}
 }
+
+func (d *DriverAdminLocal) Mounts(env dockerdriver.Env) driveradmin.MountsResponse {
+	logger := env.Logger().Session("mounts")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	mounts := []driveradmin.Mount{}
+	for _, lister := range d.mountListers {
+		mounts = append(mounts, lister.Mounts(env)...)
+	}
+
+	return driveradmin.MountsResponse{Mounts: mounts}
+}
+
+func (d *DriverAdminLocal) CircuitBreakers(env dockerdriver.Env) driveradmin.CircuitBreakersResponse {
+	logger := env.Logger().Session("circuit-breakers")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	breakers := []driveradmin.CircuitBreaker{}
+	for _, lister := range d.breakers {
+		breakers = append(breakers, lister.CircuitBreakers(env)...)
+	}
+
+	return driveradmin.CircuitBreakersResponse{CircuitBreakers: breakers}
+}
+
+func (d *DriverAdminLocal) Capacity(env dockerdriver.Env) driveradmin.CapacityResponse {
+	logger := env.Logger().Session("capacity")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	volumes := []driveradmin.VolumeCapacity{}
+	for _, reporter := range d.reporters {
+		volumes = append(volumes, reporter.Capacity(env)...)
+	}
+
+	return driveradmin.CapacityResponse{Volumes: volumes}
+}
+
+func (d *DriverAdminLocal) CifsStats(env dockerdriver.Env) driveradmin.CifsStatsResponse {
+	logger := env.Logger().Session("cifs-stats")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	response := driveradmin.CifsStatsResponse{Volumes: []driveradmin.VolumeCifsStats{}}
+	for _, reporter := range d.cifsReporters {
+		stats := reporter.CifsStats(env)
+		response.SessionReconnects += stats.SessionReconnects
+		response.ShareReconnects += stats.ShareReconnects
+		response.Volumes = append(response.Volumes, stats.Volumes...)
+	}
+
+	return response
+}
+
+func (d *DriverAdminLocal) Faults(env dockerdriver.Env) driveradmin.FaultsResponse {
+	logger := env.Logger().Session("faults")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if d.faultInjector == nil {
+		return driveradmin.FaultsResponse{Err: errFaultInjectionDisabled}
+	}
+
+	return driveradmin.FaultsResponse{Faults: d.faultInjector.Faults(env)}
+}
+
+func (d *DriverAdminLocal) SetFaults(env dockerdriver.Env, faults []driveradmin.Fault) driveradmin.ErrorResponse {
+	logger := env.Logger().Session("set-faults")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	if d.faultInjector == nil {
+		return driveradmin.ErrorResponse{Err: errFaultInjectionDisabled}
+	}
+
+	if err := d.faultInjector.SetFaults(env, faults); err != nil {
+		return driveradmin.ErrorResponse{Err: err.Error()}
+	}
+	return driveradmin.ErrorResponse{}
+}
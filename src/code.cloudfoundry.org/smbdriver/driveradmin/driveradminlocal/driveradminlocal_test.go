@@ -2,6 +2,8 @@ package driveradminlocal_test
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
@@ -63,6 +65,33 @@ var _ = Describe("Driver Admin Local", func() {
 						Expect(fakeDrainable.DrainCallCount()).NotTo(Equal(0))
 					})
 				})
+				Context("when there is an evacuation guard registered", func() {
+					var (
+						fakeDrainable *smbdriverfakes.FakeDrainable
+						fakeGuard     *smbdriverfakes.FakeEvacuationGuard
+					)
+					BeforeEach(func() {
+						fakeDrainable = &smbdriverfakes.FakeDrainable{}
+						driverAdminLocal.RegisterDrainable(fakeDrainable)
+						fakeGuard = &smbdriverfakes.FakeEvacuationGuard{}
+						driverAdminLocal.RegisterEvacuationGuard(fakeGuard)
+					})
+					It("should evacuate when the guard allows it", func() {
+						Expect(err.Err).To(BeEmpty())
+						Expect(fakeGuard.CheckEvacuateCallCount()).To(Equal(1))
+						Expect(fakeProcess.SignalCallCount()).To(Equal(1))
+					})
+					Context("when the guard refuses", func() {
+						BeforeEach(func() {
+							fakeGuard.CheckEvacuateReturns(errors.New("1 FUSE mount is active"))
+						})
+						It("should neither drain nor signal the process", func() {
+							Expect(err.Err).To(Equal("1 FUSE mount is active"))
+							Expect(fakeDrainable.DrainCallCount()).To(Equal(0))
+							Expect(fakeProcess.SignalCallCount()).To(Equal(0))
+						})
+					})
+				})
 
 			})
 		})
@@ -78,5 +107,170 @@ var _ = Describe("Driver Admin Local", func() {
 				})
 			})
 		})
+
+		Describe("Mounts", func() {
+			var response driveradmin.MountsResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.Mounts(env)
+			})
+
+			Context("when nothing is registered", func() {
+				It("should list no mounts", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Mounts).To(BeEmpty())
+				})
+			})
+
+			Context("when there is a mount lister registered", func() {
+				var mount driveradmin.Mount
+
+				BeforeEach(func() {
+					mount = driveradmin.Mount{Target: "/mnt/vol", Source: "//b/share", Sources: []string{"//a/share", "//b/share"}}
+					fakeMountLister := &smbdriverfakes.FakeMountLister{}
+					fakeMountLister.MountsReturns([]driveradmin.Mount{mount})
+					driverAdminLocal.RegisterMountLister(fakeMountLister)
+				})
+
+				It("should list its mounts", func() {
+					Expect(response.Mounts).To(Equal([]driveradmin.Mount{mount}))
+				})
+			})
+		})
+
+		Describe("CircuitBreakers", func() {
+			var response driveradmin.CircuitBreakersResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.CircuitBreakers(env)
+			})
+
+			Context("when nothing is registered", func() {
+				It("should list no circuit breakers", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.CircuitBreakers).To(BeEmpty())
+				})
+			})
+
+			Context("when there is a circuit breaker lister registered", func() {
+				var breaker driveradmin.CircuitBreaker
+
+				BeforeEach(func() {
+					breaker = driveradmin.CircuitBreaker{Server: "nas", State: "open", ConsecutiveFailures: 5, OpenUntil: time.Now()}
+					fakeLister := &smbdriverfakes.FakeCircuitBreakerLister{}
+					fakeLister.CircuitBreakersReturns([]driveradmin.CircuitBreaker{breaker})
+					driverAdminLocal.RegisterCircuitBreakerLister(fakeLister)
+				})
+
+				It("should list its circuit breakers", func() {
+					Expect(response.CircuitBreakers).To(Equal([]driveradmin.CircuitBreaker{breaker}))
+				})
+			})
+		})
+
+		Describe("Capacity", func() {
+			var response driveradmin.CapacityResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.Capacity(env)
+			})
+
+			Context("when nothing is registered", func() {
+				It("should report no volumes", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Volumes).To(BeEmpty())
+				})
+			})
+
+			Context("when there is a capacity reporter registered", func() {
+				var volume driveradmin.VolumeCapacity
+
+				BeforeEach(func() {
+					volume = driveradmin.VolumeCapacity{Target: "/mnt/vol", Source: "//a/share", TotalBytes: 1000, FreeBytes: 600, UsedBytes: 400}
+					fakeReporter := &smbdriverfakes.FakeCapacityReporter{}
+					fakeReporter.CapacityReturns([]driveradmin.VolumeCapacity{volume})
+					driverAdminLocal.RegisterCapacityReporter(fakeReporter)
+				})
+
+				It("should report its volumes", func() {
+					Expect(response.Volumes).To(Equal([]driveradmin.VolumeCapacity{volume}))
+				})
+			})
+		})
+
+		Describe("CifsStats", func() {
+			var response driveradmin.CifsStatsResponse
+
+			JustBeforeEach(func() {
+				response = driverAdminLocal.CifsStats(env)
+			})
+
+			Context("when nothing is registered", func() {
+				It("should report no volumes", func() {
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Volumes).To(BeEmpty())
+				})
+			})
+
+			Context("when there is a cifs stats reporter registered", func() {
+				var volume driveradmin.VolumeCifsStats
+
+				BeforeEach(func() {
+					volume = driveradmin.VolumeCifsStats{Target: "/mnt/vol", Source: "//a/share", Share: `\\a\share`, SMBs: 120}
+					fakeReporter := &smbdriverfakes.FakeCifsStatsReporter{}
+					fakeReporter.CifsStatsReturns(driveradmin.CifsStats{SessionReconnects: 1, ShareReconnects: 2, Volumes: []driveradmin.VolumeCifsStats{volume}})
+					driverAdminLocal.RegisterCifsStatsReporter(fakeReporter)
+				})
+
+				It("should report its reconnects and volumes", func() {
+					Expect(response.SessionReconnects).To(Equal(uint64(1)))
+					Expect(response.ShareReconnects).To(Equal(uint64(2)))
+					Expect(response.Volumes).To(Equal([]driveradmin.VolumeCifsStats{volume}))
+				})
+			})
+		})
+
+		Describe("Faults", func() {
+			var faults []driveradmin.Fault
+
+			BeforeEach(func() {
+				faults = []driveradmin.Fault{{Operation: "mount", Host: "server", Errno: 13}}
+			})
+
+			Context("when fault injection is disabled", func() {
+				It("should fail", func() {
+					Expect(driverAdminLocal.Faults(env).Err).To(Equal("fault injection is disabled"))
+					Expect(driverAdminLocal.SetFaults(env, faults).Err).To(Equal("fault injection is disabled"))
+				})
+			})
+
+			Context("when there is a fault injector registered", func() {
+				var fakeInjector *smbdriverfakes.FakeFaultInjector
+
+				BeforeEach(func() {
+					fakeInjector = &smbdriverfakes.FakeFaultInjector{}
+					fakeInjector.FaultsReturns(faults)
+					driverAdminLocal.RegisterFaultInjector(fakeInjector)
+				})
+
+				It("should list its faults", func() {
+					response := driverAdminLocal.Faults(env)
+					Expect(response.Err).To(BeEmpty())
+					Expect(response.Faults).To(Equal(faults))
+				})
+
+				It("should set its faults", func() {
+					Expect(driverAdminLocal.SetFaults(env, faults).Err).To(BeEmpty())
+					Expect(fakeInjector.SetFaultsCallCount()).To(Equal(1))
+					_, setFaults := fakeInjector.SetFaultsArgsForCall(0)
+					Expect(setFaults).To(Equal(faults))
+				})
+
+				It("should return the error of invalid faults", func() {
+					fakeInjector.SetFaultsReturns(errors.New(`fault 0: invalid operation "format"`))
+					Expect(driverAdminLocal.SetFaults(env, faults).Err).To(Equal(`fault 0: invalid operation "format"`))
+				})
+			})
+		})
 	})
 })
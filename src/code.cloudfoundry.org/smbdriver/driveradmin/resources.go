@@ -1,18 +1,83 @@
 package driveradmin
 
 import (
+	"fmt"
+	"time"
+
 	"code.cloudfoundry.org/dockerdriver"
 	"github.com/tedsuo/rata"
 )
 
 const (
-	EvacuateRoute = "evacuate"
-	PingRoute     = "ping"
+	EvacuateRoute        = "evacuate"
+	PingRoute            = "ping"
+	MountsRoute          = "mounts"
+	CircuitBreakersRoute = "circuit-breakers"
+	CapacityRoute        = "capacity"
+	MetricsRoute         = "metrics"
+	CifsStatsRoute       = "cifs-stats"
+	FaultsRoute          = "faults"
+	SetFaultsRoute       = "set-faults"
 )
 
 var Routes = rata.Routes{
 	{Path: "/evacuate", Method: "GET", Name: EvacuateRoute},
 	{Path: "/ping", Method: "GET", Name: PingRoute},
+	{Path: "/mounts", Method: "GET", Name: MountsRoute},
+	{Path: "/circuit-breakers", Method: "GET", Name: CircuitBreakersRoute},
+	{Path: "/capacity", Method: "GET", Name: CapacityRoute},
+	{Path: "/metrics", Method: "GET", Name: MetricsRoute},
+	{Path: "/cifs-stats", Method: "GET", Name: CifsStatsRoute},
+	{Path: "/faults", Method: "GET", Name: FaultsRoute},
+	{Path: "/faults", Method: "PUT", Name: SetFaultsRoute},
+}
+
+// Access is what a client of the admin API is allowed to do. Read access
+// covers the routes that report on the driver, write access also covers the
+// routes that change it.
+type Access int
+
+const (
+	AccessNone Access = iota
+	AccessRead
+	AccessWrite
+)
+
+// RouteAccess is the access that each route requires when the admin API
+// authenticates its clients.
+var RouteAccess = map[string]Access{
+	EvacuateRoute:        AccessWrite,
+	PingRoute:            AccessRead,
+	MountsRoute:          AccessRead,
+	CircuitBreakersRoute: AccessRead,
+	CapacityRoute:        AccessRead,
+	MetricsRoute:         AccessRead,
+	CifsStatsRoute:       AccessRead,
+	FaultsRoute:          AccessRead,
+	SetFaultsRoute:       AccessWrite,
+}
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	default:
+		return "none"
+	}
+}
+
+// ParseAccess parses "read" or "write".
+func ParseAccess(s string) (Access, error) {
+	switch s {
+	case "read":
+		return AccessRead, nil
+	case "write":
+		return AccessWrite, nil
+	default:
+		return AccessNone, fmt.Errorf("invalid access %q: must be read or write", s)
+	}
 }
 
 //go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
@@ -20,13 +85,179 @@ var Routes = rata.Routes{
 type DriverAdmin interface {
 	Evacuate(env dockerdriver.Env) ErrorResponse
 	Ping(env dockerdriver.Env) ErrorResponse
+	Mounts(env dockerdriver.Env) MountsResponse
+	CircuitBreakers(env dockerdriver.Env) CircuitBreakersResponse
+	Capacity(env dockerdriver.Env) CapacityResponse
+	CifsStats(env dockerdriver.Env) CifsStatsResponse
+	Faults(env dockerdriver.Env) FaultsResponse
+	SetFaults(env dockerdriver.Env, faults []Fault) ErrorResponse
 }
 
 type ErrorResponse struct {
 	Err string
 }
 
+// Mount describes a volume mounted by the driver. Source is the share that is
+// currently mounted, one of Sources when the volume has alternate shares.
+// Share is the share that was actually mounted for Source: the DFS target
+// that Source resolved to, or Source itself. Personality is the name of the
+// driver that the volume was mounted through, and Mounter whether it was
+// mounted by the kernel or through FUSE. DryRun is the mount command that a
+// driver in dry-run mode did not run.
+type Mount struct {
+	Target      string
+	Source      string
+	Sources     []string
+	Share       string
+	Personality string
+	Mounter     string
+	DryRun      *MountCommand `json:",omitempty"`
+}
+
+// MountCommand is a mount command with its credentials redacted. EnvVars
+// only holds the names of the environment variables that it runs with.
+type MountCommand struct {
+	Args    []string
+	EnvVars []string
+}
+
+type MountsResponse struct {
+	Mounts []Mount
+	Err    string
+}
+
+// CircuitBreaker describes the state of the circuit breaker of an SMB
+// server: "closed" while mounts are attempted, "open" while they fail
+// immediately until OpenUntil, and "half-open" while a probe mount decides
+// whether to close it again.
+type CircuitBreaker struct {
+	Server              string
+	State               string
+	ConsecutiveFailures int
+	OpenUntil           time.Time
+}
+
+type CircuitBreakersResponse struct {
+	CircuitBreakers []CircuitBreaker
+	Err             string
+}
+
+// VolumeCapacity is the capacity and usage of a mounted volume as of its
+// last check. Err is set when the volume could not be checked.
+type VolumeCapacity struct {
+	Target      string
+	Source      string
+	TotalBytes  uint64
+	FreeBytes   uint64
+	UsedBytes   uint64
+	TotalInodes uint64
+	FreeInodes  uint64
+	UsedInodes  uint64
+	CheckedAt   time.Time
+	Err         string
+}
+
+type CapacityResponse struct {
+	Volumes []VolumeCapacity
+	Err     string
+}
+
+// CifsOperation counts the requests of one kind that the kernel CIFS client
+// sent for a share.
+type CifsOperation struct {
+	Sent   uint64
+	Failed uint64
+}
+
+// VolumeCifsStats are the kernel CIFS client statistics of the share mounted
+// for a volume as of the last check. Disconnected is set while the share or
+// its session waits to be reconnected. Err is set when the share could not
+// be found.
+type VolumeCifsStats struct {
+	Target              string
+	Source              string
+	Share               string
+	Disconnected        bool
+	SessionStatus       string
+	SMBs                uint64
+	BytesRead           uint64
+	BytesWritten        uint64
+	Operations          map[string]CifsOperation
+	OperationsPerSecond float64
+	CheckedAt           time.Time
+	Err                 string
+}
+
+// CifsStats are the reconnect counters of the kernel CIFS client, which
+// count over all shares since the cifs module was loaded, and the
+// statistics of each volume.
+type CifsStats struct {
+	SessionReconnects uint64
+	ShareReconnects   uint64
+	Volumes           []VolumeCifsStats
+}
+
+type CifsStatsResponse struct {
+	SessionReconnects uint64
+	ShareReconnects   uint64
+	Volumes           []VolumeCifsStats
+	Err               string
+}
+
+// Fault makes the invocations of mount.cifs, umount or mountpoint for an
+// Operation ("mount", "unmount" or "check") fail, hang or run slowly, to
+// rehearse outages of the SMB servers. Host and Volume limit the fault to the
+// volumes of one server and to one volume ID, and match all when empty.
+//
+// The invocations fail with Errno, after Delay when it is set. They hang for
+// Hang and then fail with Errno, or ETIMEDOUT. Otherwise they succeed after
+// Delay. Durations are in the form "30s".
+type Fault struct {
+	Operation string `json:"operation"`
+	Host      string `json:"host,omitempty"`
+	Volume    string `json:"volume,omitempty"`
+	Errno     int    `json:"errno,omitempty"`
+	Hang      string `json:"hang,omitempty"`
+	Delay     string `json:"delay,omitempty"`
+}
+
+type FaultsResponse struct {
+	Faults []Fault
+	Err    string
+}
+
 //counterfeiter:generate -o ../smbdriverfakes/fake_drainable.go . Drainable
 type Drainable interface {
 	Drain(env dockerdriver.Env) error
 }
+
+//counterfeiter:generate -o ../smbdriverfakes/fake_evacuation_guard.go . EvacuationGuard
+type EvacuationGuard interface {
+	CheckEvacuate(env dockerdriver.Env) error
+}
+
+//counterfeiter:generate -o ../smbdriverfakes/fake_mount_lister.go . MountLister
+type MountLister interface {
+	Mounts(env dockerdriver.Env) []Mount
+}
+
+//counterfeiter:generate -o ../smbdriverfakes/fake_circuit_breaker_lister.go . CircuitBreakerLister
+type CircuitBreakerLister interface {
+	CircuitBreakers(env dockerdriver.Env) []CircuitBreaker
+}
+
+//counterfeiter:generate -o ../smbdriverfakes/fake_capacity_reporter.go . CapacityReporter
+type CapacityReporter interface {
+	Capacity(env dockerdriver.Env) []VolumeCapacity
+}
+
+//counterfeiter:generate -o ../smbdriverfakes/fake_cifs_stats_reporter.go . CifsStatsReporter
+type CifsStatsReporter interface {
+	CifsStats(env dockerdriver.Env) CifsStats
+}
+
+//counterfeiter:generate -o ../smbdriverfakes/fake_fault_injector.go . FaultInjector
+type FaultInjector interface {
+	Faults(env dockerdriver.Env) []Fault
+	SetFaults(env dockerdriver.Env, faults []Fault) error
+}
@@ -0,0 +1,109 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	"code.cloudfoundry.org/volumedriver/mountchecker"
+)
+
+// WithDryRun validates and translates the options of each mount as usual,
+// but logs and records the mount command instead of running it, creates the
+// mountpoint as a plain directory and reports it as mounted. Unmounts do not
+// run umount either. It only applies to kernel mounts.
+func WithDryRun() MounterOption {
+	return func(m *smbMounter) {
+		m.dryRun = true
+	}
+}
+
+// dryRunMount creates the mountpoint and records the mount command that
+// would have mounted the share, with its credentials redacted.
+func (m *smbMounter) dryRunMount(logger lager.Logger, mountSource smbsource.Source, target string, mountArgs, mountEnvVars []string, mountOpts map[string]interface{}) error {
+	password := mountPassword(mountOpts)
+
+	command := driveradmin.MountCommand{Args: []string{"mount"}, EnvVars: []string{}}
+	for _, arg := range mountArgs {
+		command.Args = append(command.Args, redactMountOutput(arg, password))
+	}
+	for _, envVar := range mountEnvVars {
+		name, _, _ := strings.Cut(envVar, "=")
+		command.EnvVars = append(command.EnvVars, name)
+	}
+
+	if err := m.osutil.MkdirAll(target, os.ModePerm); err != nil {
+		logger.Error("dry-run-create-mountpoint-failed", err, lager.Data{"target": target})
+		return err
+	}
+
+	m.mountTargets.dryRun(target, command)
+	logger.Info("dry-run-mount", lager.Data{"share": mountSource.String(), "target": target, "args": command.Args, "env-vars": command.EnvVars})
+	return nil
+}
+
+// dryRunCheck reports a mountpoint as mounted while its directory exists.
+func (m *smbMounter) dryRunCheck(logger lager.Logger, name, mountPoint string) bool {
+	info, err := m.osutil.Stat(mountPoint)
+	if err != nil || !info.IsDir() {
+		logger.Info(fmt.Sprintf("unable to verify volume %s (dry run: %s is not a directory)", name, mountPoint))
+		return false
+	}
+	return true
+}
+
+// dryRunUnmount forgets the dry-run mount of target without running umount.
+func (m *smbMounter) dryRunUnmount(logger lager.Logger, target string) {
+	logger.Info("dry-run-unmount", lager.Data{"target": target})
+	m.mountTargets.unmounted(target)
+}
+
+// dryRunMountChecker reports the mountpoints of dry runs as mounted, since
+// they are plain directories that /proc/mounts does not list, and checks the
+// other mountpoints with checker.
+type dryRunMountChecker struct {
+	checker mountchecker.MountChecker
+	targets *MountTargets
+}
+
+// NewDryRunMountChecker returns the mount checker for the volume driver of a
+// mounter in dry-run mode, so that the volume driver unmounts dry runs
+// through the mounter instead of failing to find them.
+func NewDryRunMountChecker(checker mountchecker.MountChecker, targets *MountTargets) mountchecker.MountChecker {
+	return &dryRunMountChecker{checker: checker, targets: targets}
+}
+
+func (c *dryRunMountChecker) Exists(mountPath string) (bool, error) {
+	if c.targets.isDryRun(mountPath) {
+		return true, nil
+	}
+	return c.checker.Exists(mountPath)
+}
+
+func (c *dryRunMountChecker) List(pattern *regexp.Regexp) ([]string, error) {
+	mounts, err := c.checker.List(pattern)
+	if err != nil {
+		return mounts, err
+	}
+
+	for _, target := range c.targets.dryRunTargets() {
+		if pattern.MatchString(target) {
+			mounts = append(mounts, target)
+		}
+	}
+	return mounts, nil
+}
+
+func mountPassword(mountOpts map[string]interface{}) string {
+	if value, ok := mountOpts["password"]; ok && value != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return ""
+}
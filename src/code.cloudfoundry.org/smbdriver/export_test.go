@@ -0,0 +1,9 @@
+package smbdriver
+
+func (b *CircuitBreaker) Allow(host string) error {
+	return b.allow(host)
+}
+
+func (b *CircuitBreaker) Record(host string, err error, unreachable bool) bool {
+	return b.record(host, err, unreachable)
+}
@@ -0,0 +1,301 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"code.cloudfoundry.org/smbdriver/smbfuse"
+	"code.cloudfoundry.org/smbdriver/smbsnapshot"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	"code.cloudfoundry.org/smbdriver/smbtrace"
+	vmo "code.cloudfoundry.org/volume-mount-options"
+	"code.cloudfoundry.org/volumedriver"
+	"code.cloudfoundry.org/volumedriver/invoker"
+)
+
+// Mounters that the smbdriver can mount shares with.
+const (
+	KernelMounter = "kernel"
+	FuseMounter   = "fuse"
+	AutoMounter   = "auto"
+)
+
+// FilesystemsPath lists the filesystems that the kernel supports.
+const FilesystemsPath = "/proc/filesystems"
+
+const (
+	defaultSmbPort = 445
+
+	// defaultFuseMode is the default file_mode and dir_mode of kernel CIFS
+	// mounts.
+	defaultFuseMode = 0755
+)
+
+// FuseMountFunc serves a share at target in userspace, see smbfuse.Mount.
+type FuseMountFunc func(logger lager.Logger, source, target string, connect smbfuse.ConnectFunc, options smbfuse.Options) error
+
+// fuseUnsupportedFlags are the mount options that only kernel CIFS mounts
+// implement.
+var fuseUnsupportedFlags = []string{"seal", multiuserKey, posixKey, "cifsacl", "idsfromsid", "modefromsid"}
+
+// clientDialects are the dialects that the userspace SMB client offers for
+// each value of the "vers" option.
+var clientDialects = map[string][]uint16{
+	"2.0":   {smb2.Dialect202},
+	"2.1":   {smb2.Dialect210},
+	"3":     {smb2.Dialect300, smb2.Dialect302},
+	"3.0":   {smb2.Dialect300},
+	"3.02":  {smb2.Dialect302},
+	"3.0.2": {smb2.Dialect302},
+}
+
+// clientSecurityModes are the values of the "sec" option that the userspace
+// SMB client authenticates with. It always signs with NTLMv2 in NTLMSSP.
+var clientSecurityModes = []string{"ntlmssp", "ntlmsspi", "ntlmv2", "ntlmv2i"}
+
+// NewFuseMounter returns a mounter that serves shares through FUSE with a
+// userspace SMB client instead of mounting them with kernel CIFS, for cells
+// that cannot load the cifs module. It takes the same options as
+// NewSmbMounter, and refuses the mount options that it cannot honour.
+func NewFuseMounter(invoker invoker.Invoker, osutil osshim.Os, configMask vmo.MountOptsMask, forceNoserverino, forceNoDfs bool, mount FuseMountFunc, options ...MounterOption) volumedriver.Mounter {
+	m := NewSmbMounter(invoker, osutil, configMask, forceNoserverino, forceNoDfs, options...).(*smbMounter)
+	m.fuseMount = mount
+	return m
+}
+
+// ForgetFuseMounts forgets the FUSE mounts among the targets restored from
+// a previous run, and lazily unmounts them. FUSE mounts are served by the
+// smbdriver process, so they broke when it exited. Unmounting them lets the
+// volume driver mount their volumes again for new containers, and forgetting
+// them keeps them from blocking evacuation. Containers that used them keep
+// the broken mounts.
+func ForgetFuseMounts(env dockerdriver.Env, invoker invoker.Invoker, targets *MountTargets) {
+	logger := env.Logger().Session("forget-fuse-mounts")
+
+	for _, mount := range targets.Mounts(env) {
+		if mount.Mounter != FuseMounter {
+			continue
+		}
+
+		logger.Info("fuse-mount-lost", lager.Data{"target": mount.Target, "share": mount.Share})
+		if err := invoker.Invoke(env, "umount", []string{"-l", mount.Target}).Wait(); err != nil {
+			logger.Info("unmount-lost-fuse-mount-failed", lager.Data{"target": mount.Target, "error": err.Error()})
+		}
+		targets.unmounted(mount.Target)
+	}
+}
+
+// mounterName returns the mounter that the mounter mounts shares with.
+func (m *smbMounter) mounterName() string {
+	if m.fuseMount != nil {
+		return FuseMounter
+	}
+	return KernelMounter
+}
+
+// CheckEvacuate refuses evacuation while FUSE mounts are active. They are
+// served by the smbdriver process, so they would break once it exits.
+func (m *smbMounter) CheckEvacuate(env dockerdriver.Env) error {
+	if m.fuseMount == nil {
+		return nil
+	}
+
+	targets := []string{}
+	for _, mount := range m.mountTargets.Mounts(env) {
+		targets = append(targets, mount.Target)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d FUSE mounts are served by the smbdriver and would break if it exited: %s", len(targets), strings.Join(targets, ", "))
+}
+
+// KernelCifsAvailable reports whether the kernel supports CIFS mounts,
+// loading the cifs module if it is not loaded yet.
+func KernelCifsAvailable(env dockerdriver.Env, readFile ReadFileFunc, invoker invoker.Invoker) bool {
+	logger := env.Logger().Session("kernel-cifs-available")
+
+	if hasFilesystem(readFile, "cifs") {
+		return true
+	}
+
+	if err := invoker.Invoke(env, "modprobe", []string{"cifs"}).Wait(); err != nil {
+		logger.Info("modprobe-cifs-failed", lager.Data{"error": err.Error()})
+		return false
+	}
+	return hasFilesystem(readFile, "cifs")
+}
+
+func hasFilesystem(readFile ReadFileFunc, name string) bool {
+	contents, err := readFile(FilesystemsPath)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[len(fields)-1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFuseMountOptions refuses the mount options that FUSE mounts cannot
+// honour.
+func checkFuseMountOptions(mountOpts map[string]interface{}) error {
+	for _, key := range fuseUnsupportedFlags {
+		if isFlagSet(mountOpts, key) {
+			return fmt.Errorf("%s is not supported by the userspace SMB client", key)
+		}
+	}
+
+	if _, ok := mountOpts[smbsnapshot.Key]; ok {
+		return fmt.Errorf("%s is not supported by the userspace SMB client", smbsnapshot.Key)
+	}
+
+	if version, ok := mountOpts["vers"]; ok && version != "default" {
+		if _, ok := clientDialects[fmt.Sprintf("%v", version)]; !ok {
+			return fmt.Errorf("vers=%v is not supported by the userspace SMB client, expected one of 2.0, 2.1, 3, 3.0 or 3.02", version)
+		}
+	}
+
+	if sec, ok := mountOpts["sec"]; ok && !containsString(clientSecurityModes, fmt.Sprintf("%v", sec)) {
+		return fmt.Errorf("sec=%v is not supported by the userspace SMB client, expected ntlmssp", sec)
+	}
+
+	return nil
+}
+
+// fuseMountOptions converts the mount options of a share to the options of a
+// FUSE mount and of its SMB sessions.
+func fuseMountOptions(mountOpts map[string]interface{}) (smbfuse.Options, []smb2.DialOption, error) {
+	uid, _ := strconv.ParseUint(containerUid, 10, 32)
+
+	options := smbfuse.Options{
+		ReadOnly:    isFlagSet(mountOpts, "ro"),
+		Uid:         uint32(uid),
+		Gid:         uint32(uid),
+		FileMode:    defaultFuseMode,
+		DirMode:     defaultFuseMode,
+		AttrTimeout: smbfuse.DefaultAttrTimeout,
+	}
+
+	for key, mode := range map[string]*uint32{"file_mode": &options.FileMode, "dir_mode": &options.DirMode} {
+		if value, ok := mountOpts[key]; ok {
+			parsed, err := strconv.ParseUint(fmt.Sprintf("%v", value), 8, 32)
+			if err != nil || parsed > 07777 {
+				return smbfuse.Options{}, nil, fmt.Errorf("%s=%v is not an octal mode", key, value)
+			}
+			*mode = uint32(parsed)
+		}
+	}
+
+	if value, ok := mountOpts["actimeo"]; ok {
+		seconds, err := strconv.ParseUint(fmt.Sprintf("%v", value), 10, 32)
+		if err != nil {
+			return smbfuse.Options{}, nil, fmt.Errorf("actimeo=%v is not a number of seconds", value)
+		}
+		options.AttrTimeout = time.Duration(seconds) * time.Second
+	}
+
+	return options, clientDialOptions(mountOpts), nil
+}
+
+// clientDialOptions only offers the dialects of the "vers" option, if any,
+// in the sessions of the userspace SMB client.
+func clientDialOptions(mountOpts map[string]interface{}) []smb2.DialOption {
+	if dialects, ok := clientDialects[fmt.Sprintf("%v", mountOpts["vers"])]; ok {
+		return []smb2.DialOption{smb2.WithDialects(dialects...)}
+	}
+	return nil
+}
+
+// clientCredentials returns the credentials of a mount for the userspace SMB
+// client.
+func clientCredentials(mountOpts map[string]interface{}) smb2.Credentials {
+	credentials := smb2.Credentials{}
+	if username, ok := mountOpts["username"]; ok && username != nil {
+		credentials.Username = fmt.Sprintf("%v", username)
+	}
+	if password, ok := mountOpts["password"]; ok && password != nil {
+		credentials.Password = fmt.Sprintf("%v", password)
+	}
+	if domain, ok := mountOpts["domain"]; ok && domain != nil {
+		credentials.Domain = fmt.Sprintf("%v", domain)
+	}
+	return credentials
+}
+
+// smbAddress returns the address (host:port) of a share on the server
+// address.
+func smbAddress(mountSource smbsource.Source, address string) string {
+	port := mountSource.Port
+	if port == 0 {
+		port = defaultSmbPort
+	}
+	return net.JoinHostPort(address, strconv.Itoa(port))
+}
+
+// mountFuseAddresses serves a share through FUSE from each address of its
+// server in turn, and reports whether it failed because the server could not
+// be reached.
+func (m *smbMounter) mountFuseAddresses(env dockerdriver.Env, logger lager.Logger, mountSource smbsource.Source, addresses []string, target string, mountOpts map[string]interface{}) (bool, error) {
+	options, dialOptions, err := fuseMountOptions(mountOpts)
+	if err != nil {
+		return false, err
+	}
+
+	credentials := clientCredentials(mountOpts)
+
+	for _, address := range addresses {
+		connect := smbfuse.Dial(smbAddress(mountSource, address), mountSource.Host, mountSource.Share, mountSource.Path, credentials, dialOptions...)
+
+		span, _ := m.tracer.StartSpanFromContext(env.Context(), "mount.smbfuse")
+		span.Tag("share", mountSource.String())
+		span.Tag("address", address)
+		err = m.fuseMount(logger, mountSource.UNC(), target, connect, options)
+		smbtrace.FinishSpan(span, err)
+		if err == nil {
+			logger.Debug("mount-output", lager.Data{"share": mountSource.String(), "address": address, "mounter": FuseMounter})
+			return false, nil
+		}
+
+		logger.Info("mount-failed", lager.Data{"share": mountSource.String(), "address": address, "mounter": FuseMounter, "error": err.Error()})
+		if !isDialError(err) {
+			return false, err
+		}
+		logger.Info("server-address-unreachable", lager.Data{"host": mountSource.Host, "address": address, "error": err.Error()})
+	}
+
+	return true, err
+}
+
+// isDialError reports whether the userspace client failed to reach the
+// server rather than being refused by it.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) || errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,368 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbfuse"
+	"code.cloudfoundry.org/volumedriver"
+	"code.cloudfoundry.org/volumedriver/invokerfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+type fuseMount struct {
+	source  string
+	target  string
+	connect smbfuse.ConnectFunc
+	options smbfuse.Options
+}
+
+var _ = Describe("FuseMounter", func() {
+	var (
+		logger      *lagertest.TestLogger
+		env         dockerdriver.Env
+		err         error
+		fakeInvoker *invokerfakes.FakeInvoker
+
+		subject volumedriver.Mounter
+
+		lookupAddrs []net.IPAddr
+		mounts      []fuseMount
+		mountErrs   []error
+
+		source string
+		opts   map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("fuse-mounter")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		source = "//server/source"
+		opts = map[string]interface{}{"username": "foo", "password": "bar"}
+
+		fakeInvoker = &invokerfakes.FakeInvoker{}
+		fakeInvoker.InvokeReturns(&invokerfakes.FakeInvokeResult{})
+
+		lookupAddrs = []net.IPAddr{{IP: net.ParseIP("10.0.0.10")}}
+		mounts = nil
+		mountErrs = nil
+	})
+
+	JustBeforeEach(func() {
+		hostResolver := smbdriver.NewHostResolver(func(context.Context, string) ([]net.IPAddr, error) {
+			return lookupAddrs, nil
+		}, time.Second, time.Minute, fakeclock.NewFakeClock(time.Now()))
+
+		configMask, err := smbdriver.NewSmbVolumeMountMask()
+		Expect(err).NotTo(HaveOccurred())
+
+		mount := func(logger lager.Logger, source, target string, connect smbfuse.ConnectFunc, options smbfuse.Options) error {
+			mounts = append(mounts, fuseMount{source: source, target: target, connect: connect, options: options})
+			if len(mountErrs) >= len(mounts) {
+				return mountErrs[len(mounts)-1]
+			}
+			return nil
+		}
+
+		subject = smbdriver.NewFuseMounter(fakeInvoker, &os_fake.FakeOs{}, configMask, false, false, mount, smbdriver.WithHostResolver(hostResolver))
+	})
+
+	Context("#Mount", func() {
+		JustBeforeEach(func() {
+			err = subject.Mount(env, source, "target", opts)
+		})
+
+		It("serves the share through FUSE instead of mounting it with the kernel", func() {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+
+			Expect(mounts).To(HaveLen(1))
+			Expect(mounts[0].source).To(Equal("//server/source"))
+			Expect(mounts[0].target).To(Equal("target"))
+			Expect(mounts[0].options).To(Equal(smbfuse.Options{
+				Uid:         2000,
+				Gid:         2000,
+				FileMode:    0755,
+				DirMode:     0755,
+				AttrTimeout: time.Second,
+			}))
+		})
+
+		Context("when the binding sets the options of the mount", func() {
+			BeforeEach(func() {
+				opts["readonly"] = true
+				opts["file_mode"] = "0640"
+				opts["dir_mode"] = "0750"
+				opts["actimeo"] = "30"
+			})
+
+			It("honours them", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mounts[0].options).To(Equal(smbfuse.Options{
+					ReadOnly:    true,
+					Uid:         2000,
+					Gid:         2000,
+					FileMode:    0640,
+					DirMode:     0750,
+					AttrTimeout: 30 * time.Second,
+				}))
+			})
+		})
+
+		Context("when the share is on another port", func() {
+			var listener net.Listener
+
+			BeforeEach(func() {
+				listener, err = net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).NotTo(HaveOccurred())
+
+				lookupAddrs = []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}
+				source = fmt.Sprintf("smb://server:%d/source/folder", listener.Addr().(*net.TCPAddr).Port)
+			})
+
+			AfterEach(func() {
+				listener.Close()
+			})
+
+			It("connects to the port of the resolved address", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mounts[0].source).To(Equal("//server/source/folder"))
+
+				accepted := make(chan net.Conn, 1)
+				go func() {
+					conn, err := listener.Accept()
+					if err == nil {
+						accepted <- conn
+					}
+				}()
+
+				go func() {
+					defer GinkgoRecover()
+					_, _ = mounts[0].connect(context.TODO())
+				}()
+
+				var conn net.Conn
+				Eventually(accepted).Should(Receive(&conn))
+				conn.Close()
+			})
+		})
+
+		Context("when the server has several addresses", func() {
+			BeforeEach(func() {
+				lookupAddrs = []net.IPAddr{{IP: net.ParseIP("10.0.0.10")}, {IP: net.ParseIP("10.0.0.11")}}
+				mountErrs = []error{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+			})
+
+			It("falls back to the next address when the first one is unreachable", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mounts).To(HaveLen(2))
+			})
+
+			Context("and the first mount fails for another reason", func() {
+				BeforeEach(func() {
+					mountErrs = []error{errors.New("SMB SESSION_SETUP failed with status 0xc000006d")}
+				})
+
+				It("does not try the other addresses", func() {
+					Expect(err).To(MatchError("SMB SESSION_SETUP failed with status 0xc000006d"))
+					Expect(mounts).To(HaveLen(1))
+				})
+			})
+		})
+	})
+
+	Context("#Mount with options that only kernel mounts support", func() {
+		DescribeTable("when the binding sets an option that the userspace client cannot honour",
+			func(key string, value interface{}, message string) {
+				opts[key] = value
+				err = subject.Mount(env, source, "target", opts)
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				Expect(err).To(MatchError(message))
+				Expect(mounts).To(BeEmpty())
+			},
+			Entry("seal", "seal", true, "seal is not supported by the userspace SMB client"),
+			Entry("multiuser", "multiuser", true, "multiuser is not supported by the userspace SMB client"),
+			Entry("cifsacl", "cifsacl", true, "cifsacl is not supported by the userspace SMB client"),
+			Entry("snapshot", "snapshot", "@GMT-2024.01.02-03.04.05", "snapshot is not supported by the userspace SMB client"),
+			Entry("vers=3.1.1", "vers", "3.1.1", "vers=3.1.1 is not supported by the userspace SMB client, expected one of 2.0, 2.1, 3, 3.0 or 3.02"),
+			Entry("sec=krb5", "sec", "krb5", "sec=krb5 is not supported by the userspace SMB client, expected ntlmssp"),
+		)
+	})
+
+	Context("#Unmount", func() {
+		It("unmounts with umount", func() {
+			Expect(subject.Unmount(env, "target")).To(Succeed())
+			_, cmd, args, _ := fakeInvoker.InvokeArgsForCall(0)
+			Expect(cmd).To(Equal("umount"))
+			Expect(args).To(Equal([]string{"-l", "target"}))
+		})
+	})
+
+	Context("#CheckEvacuate", func() {
+		var guard driveradmin.EvacuationGuard
+
+		JustBeforeEach(func() {
+			guard = subject.(driveradmin.EvacuationGuard)
+		})
+
+		It("allows evacuation when nothing is mounted", func() {
+			Expect(guard.CheckEvacuate(env)).To(Succeed())
+		})
+
+		Context("when shares are mounted", func() {
+			JustBeforeEach(func() {
+				Expect(subject.Mount(env, source, "target", opts)).To(Succeed())
+				Expect(subject.Mount(env, "//server/other", "other-target", opts)).To(Succeed())
+			})
+
+			It("refuses evacuation, since the mounts would break", func() {
+				Expect(guard.CheckEvacuate(env)).To(MatchError("2 FUSE mounts are served by the smbdriver and would break if it exited: other-target, target"))
+			})
+
+			It("allows evacuation once they are unmounted", func() {
+				Expect(subject.Unmount(env, "target")).To(Succeed())
+				Expect(subject.Unmount(env, "other-target")).To(Succeed())
+				Expect(guard.CheckEvacuate(env)).To(Succeed())
+			})
+		})
+
+		Context("with the kernel mounter", func() {
+			JustBeforeEach(func() {
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+
+				subject = smbdriver.NewSmbMounter(fakeInvoker, &os_fake.FakeOs{}, configMask, false, false)
+				guard = subject.(driveradmin.EvacuationGuard)
+			})
+
+			It("always allows evacuation", func() {
+				Expect(guard.CheckEvacuate(env)).To(Succeed())
+			})
+		})
+	})
+})
+
+var _ = Describe("ForgetFuseMounts", func() {
+	var (
+		logger      *lagertest.TestLogger
+		env         dockerdriver.Env
+		fakeInvoker *invokerfakes.FakeInvoker
+		stateFile   string
+		targets     *smbdriver.MountTargets
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("forget-fuse-mounts")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+
+		fakeInvoker = &invokerfakes.FakeInvoker{}
+		fakeInvoker.InvokeReturns(&invokerfakes.FakeInvokeResult{})
+
+		stateFile = filepath.Join(GinkgoT().TempDir(), "mount-targets.json")
+		Expect(os.WriteFile(stateFile, []byte(`{"mounts": {
+			"/volumes/kernel": {"Target": "/volumes/kernel", "Source": "//server/kernel", "Mounter": "kernel"},
+			"/volumes/fuse": {"Target": "/volumes/fuse", "Source": "//server/fuse", "Mounter": "fuse"}
+		}}`), 0600)).To(Succeed())
+		targets = smbdriver.RestoreMountTargets(logger, stateFile)
+	})
+
+	JustBeforeEach(func() {
+		smbdriver.ForgetFuseMounts(env, fakeInvoker, targets)
+	})
+
+	It("unmounts and forgets the FUSE mounts of the previous run", func() {
+		Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+		_, cmd, args, _ := fakeInvoker.InvokeArgsForCall(0)
+		Expect(cmd).To(Equal("umount"))
+		Expect(args).To(Equal([]string{"-l", "/volumes/fuse"}))
+		Expect(logger.Buffer()).To(gbytes.Say(`fuse-mount-lost.*"target":"/volumes/fuse"`))
+
+		Expect(targets.Mounts(env)).To(ConsistOf(HaveField("Target", "/volumes/kernel")))
+		Expect(smbdriver.RestoreMountTargets(logger, stateFile).Mounts(env)).To(ConsistOf(HaveField("Target", "/volumes/kernel")))
+	})
+
+	Context("when a mount cannot be unmounted", func() {
+		BeforeEach(func() {
+			result := &invokerfakes.FakeInvokeResult{}
+			result.WaitReturns(errors.New("exit status 32"))
+			fakeInvoker.InvokeReturns(result)
+		})
+
+		It("still forgets it", func() {
+			Expect(logger.Buffer()).To(gbytes.Say("unmount-lost-fuse-mount-failed"))
+			Expect(targets.Mounts(env)).To(ConsistOf(HaveField("Target", "/volumes/kernel")))
+		})
+	})
+})
+
+var _ = Describe("KernelCifsAvailable", func() {
+	var (
+		env              dockerdriver.Env
+		fakeInvoker      *invokerfakes.FakeInvoker
+		fakeInvokeResult *invokerfakes.FakeInvokeResult
+		filesystems      []string
+		reads            int
+	)
+
+	BeforeEach(func() {
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("kernel-cifs"), context.TODO())
+		fakeInvoker = &invokerfakes.FakeInvoker{}
+		fakeInvokeResult = &invokerfakes.FakeInvokeResult{}
+		fakeInvoker.InvokeReturns(fakeInvokeResult)
+		filesystems = []string{"nodev\tproc\n\text4\nnodev\tcifs\n"}
+		reads = 0
+	})
+
+	readFile := func(path string) ([]byte, error) {
+		Expect(path).To(Equal(smbdriver.FilesystemsPath))
+		contents := filesystems[min(reads, len(filesystems)-1)]
+		reads++
+		return []byte(contents), nil
+	}
+
+	It("reports the kernel CIFS filesystem", func() {
+		Expect(smbdriver.KernelCifsAvailable(env, readFile, fakeInvoker)).To(BeTrue())
+		Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+	})
+
+	Context("when the cifs module is not loaded", func() {
+		BeforeEach(func() {
+			filesystems = []string{"nodev\tproc\n\text4\n", "nodev\tproc\n\text4\nnodev\tcifs\n"}
+		})
+
+		It("loads it", func() {
+			Expect(smbdriver.KernelCifsAvailable(env, readFile, fakeInvoker)).To(BeTrue())
+			_, cmd, args, _ := fakeInvoker.InvokeArgsForCall(0)
+			Expect(cmd).To(Equal("modprobe"))
+			Expect(args).To(Equal([]string{"cifs"}))
+		})
+
+		Context("and it cannot be loaded", func() {
+			BeforeEach(func() {
+				fakeInvokeResult.WaitReturns(errors.New("exit status 1"))
+			})
+
+			It("reports that kernel CIFS is unavailable", func() {
+				Expect(smbdriver.KernelCifsAvailable(env, readFile, fakeInvoker)).To(BeFalse())
+			})
+		})
+	})
+})
@@ -5,6 +5,7 @@ go 1.23
 toolchain go1.23.2
 
 require (
+	code.cloudfoundry.org/clock v1.16.0
 	code.cloudfoundry.org/debugserver v0.18.0
 	code.cloudfoundry.org/dockerdriver v0.19.0
 	code.cloudfoundry.org/goshims v0.45.0
@@ -12,27 +13,32 @@ require (
 	code.cloudfoundry.org/tlsconfig v0.7.0
 	code.cloudfoundry.org/volume-mount-options v0.100.0
 	code.cloudfoundry.org/volumedriver v0.101.0
+	github.com/container-storage-interface/spec v1.11.0
+	github.com/hanwen/go-fuse/v2 v2.9.0
 	github.com/maxbrunsfeld/counterfeiter/v6 v6.9.0
 	github.com/onsi/ginkgo/v2 v2.20.2
 	github.com/onsi/gomega v1.34.2
+	github.com/openzipkin/zipkin-go v0.4.3
 	github.com/tedsuo/ifrit v0.0.0-20230516164442-7862c310ad26
 	github.com/tedsuo/rata v1.0.0
+	golang.org/x/crypto v0.28.0
+	golang.org/x/sys v0.28.0
+	google.golang.org/grpc v1.63.2
 )
 
 require (
 	code.cloudfoundry.org/cfhttp/v2 v2.16.0 // indirect
-	code.cloudfoundry.org/clock v1.16.0 // indirect
 	github.com/bmizerany/pat v0.0.0-20210406213842-e4b6760bdd6f // indirect
 	github.com/go-logr/logr v1.4.2 // indirect
 	github.com/go-task/slim-sprig/v3 v3.0.0 // indirect
 	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/google/pprof v0.0.0-20241017200806-017d972448fc // indirect
-	github.com/openzipkin/zipkin-go v0.4.3 // indirect
 	golang.org/x/mod v0.21.0 // indirect
 	golang.org/x/net v0.30.0 // indirect
-	golang.org/x/sync v0.8.0 // indirect
-	golang.org/x/sys v0.26.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
 	golang.org/x/text v0.19.0 // indirect
 	golang.org/x/tools v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240415180920-8c6c420018be // indirect
+	google.golang.org/protobuf v1.35.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
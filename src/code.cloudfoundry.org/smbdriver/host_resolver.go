@@ -0,0 +1,94 @@
+package smbdriver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+const (
+	// DefaultResolveTimeout bounds how long a mount waits for DNS. mount.cifs
+	// applies no timeout of its own.
+	DefaultResolveTimeout = 5 * time.Second
+
+	// DefaultResolveTTL is how long resolved addresses are reused.
+	DefaultResolveTTL = 30 * time.Second
+)
+
+// LookupIPAddrFunc looks up the addresses of a host, like
+// net.Resolver.LookupIPAddr.
+type LookupIPAddrFunc func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+type resolvedHost struct {
+	addresses []string
+	expires   time.Time
+}
+
+// HostResolver resolves SMB servers before mounting so that mount.cifs can be
+// given an address with the "ip" option instead of resolving the host itself.
+type HostResolver struct {
+	lookup  LookupIPAddrFunc
+	timeout time.Duration
+	ttl     time.Duration
+	clock   clock.Clock
+
+	mutex sync.Mutex
+	cache map[string]resolvedHost
+}
+
+func NewHostResolver(lookup LookupIPAddrFunc, timeout, ttl time.Duration, clock clock.Clock) *HostResolver {
+	return &HostResolver{
+		lookup:  lookup,
+		timeout: timeout,
+		ttl:     ttl,
+		clock:   clock,
+		cache:   map[string]resolvedHost{},
+	}
+}
+
+// Resolve returns the A and AAAA addresses of host in the order given by the
+// resolver. Addresses are returned as they are, and failed lookups are not
+// cached.
+func (r *HostResolver) Resolve(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}, nil
+	}
+
+	r.mutex.Lock()
+	cached, ok := r.cache[host]
+	r.mutex.Unlock()
+
+	if ok && r.clock.Now().Before(cached.expires) {
+		return cached.addresses, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	ipAddrs, err := r.lookup(ctx, host)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("resolving %s timed out after %s", host, r.timeout)
+		}
+		return nil, fmt.Errorf("cannot resolve %s: %s", host, err.Error())
+	}
+
+	if len(ipAddrs) == 0 {
+		return nil, fmt.Errorf("cannot resolve %s: no addresses found", host)
+	}
+
+	addresses := []string{}
+	for _, ipAddr := range ipAddrs {
+		addresses = append(addresses, ipAddr.IP.String())
+	}
+
+	r.mutex.Lock()
+	r.cache[host] = resolvedHost{addresses: addresses, expires: r.clock.Now().Add(r.ttl)}
+	r.mutex.Unlock()
+
+	return addresses, nil
+}
@@ -0,0 +1,107 @@
+package smbdriver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/smbdriver"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HostResolver", func() {
+	var (
+		fakeClock *fakeclock.FakeClock
+		lookups   []string
+		lookup    smbdriver.LookupIPAddrFunc
+		subject   *smbdriver.HostResolver
+	)
+
+	BeforeEach(func() {
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		lookups = []string{}
+		lookup = func(_ context.Context, host string) ([]net.IPAddr, error) {
+			lookups = append(lookups, host)
+			return []net.IPAddr{{IP: net.ParseIP("10.0.0.10")}, {IP: net.ParseIP("fd00::10")}}, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		subject = smbdriver.NewHostResolver(func(ctx context.Context, host string) ([]net.IPAddr, error) {
+			return lookup(ctx, host)
+		}, 50*time.Millisecond, 30*time.Second, fakeClock)
+	})
+
+	It("returns the A and AAAA addresses of the host", func() {
+		Expect(subject.Resolve(context.TODO(), "server")).To(Equal([]string{"10.0.0.10", "fd00::10"}))
+	})
+
+	It("returns addresses without looking them up", func() {
+		Expect(subject.Resolve(context.TODO(), "10.0.0.1")).To(Equal([]string{"10.0.0.1"}))
+		Expect(subject.Resolve(context.TODO(), "fd00::1")).To(Equal([]string{"fd00::1"}))
+		Expect(lookups).To(BeEmpty())
+	})
+
+	It("caches the addresses for the TTL", func() {
+		_, err := subject.Resolve(context.TODO(), "server")
+		Expect(err).NotTo(HaveOccurred())
+
+		fakeClock.Increment(29 * time.Second)
+		_, err = subject.Resolve(context.TODO(), "server")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lookups).To(HaveLen(1))
+
+		fakeClock.Increment(time.Second)
+		_, err = subject.Resolve(context.TODO(), "server")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lookups).To(HaveLen(2))
+	})
+
+	Context("when the lookup fails", func() {
+		BeforeEach(func() {
+			lookup = func(_ context.Context, host string) ([]net.IPAddr, error) {
+				lookups = append(lookups, host)
+				return nil, errors.New("no such host")
+			}
+		})
+
+		It("does not cache the failure", func() {
+			_, err := subject.Resolve(context.TODO(), "server")
+			Expect(err).To(MatchError("cannot resolve server: no such host"))
+
+			_, err = subject.Resolve(context.TODO(), "server")
+			Expect(err).To(HaveOccurred())
+			Expect(lookups).To(HaveLen(2))
+		})
+	})
+
+	Context("when the lookup finds no addresses", func() {
+		BeforeEach(func() {
+			lookup = func(context.Context, string) ([]net.IPAddr, error) {
+				return []net.IPAddr{}, nil
+			}
+		})
+
+		It("returns an error", func() {
+			_, err := subject.Resolve(context.TODO(), "server")
+			Expect(err).To(MatchError("cannot resolve server: no addresses found"))
+		})
+	})
+
+	Context("when the lookup hangs", func() {
+		BeforeEach(func() {
+			lookup = func(ctx context.Context, _ string) ([]net.IPAddr, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+		})
+
+		It("gives up after the timeout", func() {
+			_, err := subject.Resolve(context.TODO(), "server")
+			Expect(err).To(MatchError("resolving server timed out after 50ms"))
+		})
+	})
+})
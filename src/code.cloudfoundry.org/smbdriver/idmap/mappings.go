@@ -0,0 +1,132 @@
+// Package idmap answers the kernel's cifs.idmap upcalls, which translate
+// between Windows SIDs and unix ids for cifsacl and idsfromsid mounts, from
+// an operator-configured mapping file.
+package idmap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Mappings maps SIDs to uids and gids.
+type Mappings struct {
+	users  map[string]uint32
+	groups map[string]uint32
+}
+
+type mappingFile struct {
+	Users  map[string]uint32 `json:"users"`
+	Groups map[string]uint32 `json:"groups"`
+}
+
+// LoadMappings reads and validates a mapping file such as
+// {"users": {"S-1-5-21-1-2-3-1001": 2000}, "groups": {"S-1-5-21-1-2-3-513": 2000}}.
+// An empty path yields no mappings.
+func LoadMappings(path string) (Mappings, error) {
+	if path == "" {
+		return Mappings{}, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return Mappings{}, err
+	}
+
+	var file mappingFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return Mappings{}, fmt.Errorf("cannot parse SID mappings %s: %s", path, err.Error())
+	}
+
+	var mappings Mappings
+	if mappings.users, err = canonicalize(file.Users); err != nil {
+		return Mappings{}, err
+	}
+
+	if mappings.groups, err = canonicalize(file.Groups); err != nil {
+		return Mappings{}, err
+	}
+
+	return mappings, nil
+}
+
+// Resolve returns the key payload for a cifs.idmap key description:
+// "os:<sid>" and "gs:<sid>" ask for a uid and gid, "oi:<uid>" and "gi:<gid>"
+// for the SID of an owner and group.
+func (m Mappings) Resolve(description string) ([]byte, error) {
+	kind, value, ok := strings.Cut(description, ":")
+	if !ok {
+		return nil, fmt.Errorf("%s is not a cifs.idmap key description", description)
+	}
+
+	switch kind {
+	case "os":
+		return resolveID(m.users, value)
+	case "gs":
+		return resolveID(m.groups, value)
+	case "oi":
+		return resolveSID(m.users, value)
+	case "gi":
+		return resolveSID(m.groups, value)
+	default:
+		return nil, fmt.Errorf("%s is not a cifs.idmap key description", description)
+	}
+}
+
+func canonicalize(mappings map[string]uint32) (map[string]uint32, error) {
+	canonical := map[string]uint32{}
+	for s, id := range mappings {
+		sid, err := ParseSID(s)
+		if err != nil {
+			return nil, err
+		}
+		canonical[sid.String()] = id
+	}
+	return canonical, nil
+}
+
+func resolveID(mappings map[string]uint32, value string) ([]byte, error) {
+	sid, err := ParseSID(value)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := mappings[sid.String()]
+	if !ok {
+		return nil, fmt.Errorf("no mapping for %s", sid)
+	}
+
+	// The kernel reads the id back as a native uid_t / gid_t.
+	payload := make([]byte, 4)
+	binary.NativeEndian.PutUint32(payload, id)
+	return payload, nil
+}
+
+func resolveSID(mappings map[string]uint32, value string) ([]byte, error) {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid id", value)
+	}
+
+	// Several SIDs may map to the same id, so pick the lowest SID string to
+	// answer consistently.
+	var match string
+	for sid, mapped := range mappings {
+		if mapped == uint32(id) && (match == "" || sid < match) {
+			match = sid
+		}
+	}
+
+	if match == "" {
+		return nil, fmt.Errorf("no mapping for id %d", id)
+	}
+
+	sid, err := ParseSID(match)
+	if err != nil {
+		return nil, err
+	}
+	return sid.Marshal(), nil
+}
@@ -0,0 +1,91 @@
+package idmap_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/smbdriver/idmap"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mappings", func() {
+	var (
+		path     string
+		contents string
+		mappings idmap.Mappings
+		err      error
+	)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "sid_mappings.json")
+		contents = `{
+			"users": {"S-1-5-21-1-2-3-1001": 2000, "s-1-5-21-1-2-3-1002": 2001},
+			"groups": {"S-1-5-21-1-2-3-513": 2000}
+		}`
+	})
+
+	JustBeforeEach(func() {
+		Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		mappings, err = idmap.LoadMappings(path)
+	})
+
+	uint32Payload := func(id uint32) []byte {
+		b := make([]byte, 4)
+		binary.NativeEndian.PutUint32(b, id)
+		return b
+	}
+
+	It("resolves SIDs to uids", func() {
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mappings.Resolve("os:S-1-5-21-1-2-3-1002")).To(Equal(uint32Payload(2001)))
+	})
+
+	It("resolves SIDs to gids", func() {
+		Expect(mappings.Resolve("gs:S-1-5-21-1-2-3-513")).To(Equal(uint32Payload(2000)))
+	})
+
+	It("resolves uids and gids to SIDs", func() {
+		sid, err := idmap.ParseSID("S-1-5-21-1-2-3-1001")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mappings.Resolve("oi:2000")).To(Equal(sid.Marshal()))
+
+		sid, err = idmap.ParseSID("S-1-5-21-1-2-3-513")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mappings.Resolve("gi:2000")).To(Equal(sid.Marshal()))
+	})
+
+	It("errors for unmapped SIDs and ids", func() {
+		_, err := mappings.Resolve("os:S-1-5-21-1-2-3-1003")
+		Expect(err).To(MatchError("no mapping for S-1-5-21-1-2-3-1003"))
+
+		_, err = mappings.Resolve("gi:3000")
+		Expect(err).To(MatchError("no mapping for id 3000"))
+	})
+
+	It("errors for unknown key descriptions", func() {
+		_, err := mappings.Resolve("xx:1")
+		Expect(err).To(MatchError("xx:1 is not a cifs.idmap key description"))
+	})
+
+	Context("when the file contains an invalid SID", func() {
+		BeforeEach(func() {
+			contents = `{"users": {"alice": 2000}}`
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError("alice is not a valid SID"))
+		})
+	})
+
+	Context("when the file is not JSON", func() {
+		BeforeEach(func() {
+			contents = `users:`
+		})
+
+		It("errors", func() {
+			Expect(err).To(MatchError(ContainSubstring("cannot parse SID mappings")))
+		})
+	})
+})
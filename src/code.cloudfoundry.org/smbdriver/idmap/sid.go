@@ -0,0 +1,82 @@
+package idmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxSubAuthorities is the number of sub-authorities held by the kernel's
+// struct cifs_sid.
+const maxSubAuthorities = 15
+
+// sidLength is the size of the kernel's struct cifs_sid.
+const sidLength = 1 + 1 + 6 + 4*maxSubAuthorities
+
+// SID is a Windows security identifier.
+type SID struct {
+	Revision       byte
+	Authority      uint64
+	SubAuthorities []uint32
+}
+
+// ParseSID parses the string form of a SID, e.g. S-1-5-21-1004336348-1177238915-682003330-512.
+func ParseSID(s string) (SID, error) {
+	parts := strings.Split(strings.ToUpper(strings.TrimSpace(s)), "-")
+	if len(parts) < 3 || parts[0] != "S" {
+		return SID{}, fmt.Errorf("%s is not a valid SID", s)
+	}
+
+	revision, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || revision != 1 {
+		return SID{}, fmt.Errorf("%s is not a valid SID: unsupported revision %s", s, parts[1])
+	}
+
+	authority, err := strconv.ParseUint(parts[2], 0, 48)
+	if err != nil {
+		return SID{}, fmt.Errorf("%s is not a valid SID: invalid authority %s", s, parts[2])
+	}
+
+	if len(parts)-3 > maxSubAuthorities {
+		return SID{}, fmt.Errorf("%s is not a valid SID: more than %d sub-authorities", s, maxSubAuthorities)
+	}
+
+	sid := SID{Revision: byte(revision), Authority: authority}
+	for _, part := range parts[3:] {
+		subAuthority, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return SID{}, fmt.Errorf("%s is not a valid SID: invalid sub-authority %s", s, part)
+		}
+		sid.SubAuthorities = append(sid.SubAuthorities, uint32(subAuthority))
+	}
+
+	return sid, nil
+}
+
+func (s SID) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "S-%d-%d", s.Revision, s.Authority)
+	for _, subAuthority := range s.SubAuthorities {
+		fmt.Fprintf(&b, "-%d", subAuthority)
+	}
+	return b.String()
+}
+
+// Marshal encodes the SID as the kernel's struct cifs_sid: the authority is
+// big endian and the sub-authorities are little endian.
+func (s SID) Marshal() []byte {
+	b := make([]byte, sidLength)
+	b[0] = s.Revision
+	b[1] = byte(len(s.SubAuthorities))
+
+	var authority [8]byte
+	binary.BigEndian.PutUint64(authority[:], s.Authority)
+	copy(b[2:8], authority[2:])
+
+	for i, subAuthority := range s.SubAuthorities {
+		binary.LittleEndian.PutUint32(b[8+4*i:], subAuthority)
+	}
+
+	return b
+}
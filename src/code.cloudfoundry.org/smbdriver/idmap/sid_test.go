@@ -0,0 +1,42 @@
+package idmap_test
+
+import (
+	"code.cloudfoundry.org/smbdriver/idmap"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SID", func() {
+	It("parses and formats SIDs", func() {
+		sid, err := idmap.ParseSID("s-1-5-21-1004336348-1177238915-682003330-512")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sid).To(Equal(idmap.SID{Revision: 1, Authority: 5, SubAuthorities: []uint32{21, 1004336348, 1177238915, 682003330, 512}}))
+		Expect(sid.String()).To(Equal("S-1-5-21-1004336348-1177238915-682003330-512"))
+	})
+
+	DescribeTable("rejects invalid SIDs",
+		func(s string) {
+			_, err := idmap.ParseSID(s)
+			Expect(err).To(MatchError(ContainSubstring(s + " is not a valid SID")))
+		},
+		Entry("without the S prefix", "1-5-21"),
+		Entry("with an unknown revision", "S-2-5-21"),
+		Entry("with a non numeric sub-authority", "S-1-5-21-abc"),
+		Entry("with too many sub-authorities", "S-1-5-1-2-3-4-5-6-7-8-9-10-11-12-13-14-15-16"),
+	)
+
+	It("marshals to the kernel's struct cifs_sid", func() {
+		sid, err := idmap.ParseSID("S-1-5-32-544")
+		Expect(err).NotTo(HaveOccurred())
+
+		b := sid.Marshal()
+		Expect(b).To(HaveLen(68))
+		Expect(b[:16]).To(Equal([]byte{
+			1, 2,
+			0, 0, 0, 0, 0, 5,
+			32, 0, 0, 0,
+			0x20, 0x02, 0, 0,
+		}))
+		Expect(b[16:]).To(Equal(make([]byte, 52)))
+	})
+})
@@ -5,15 +5,48 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+
+	"code.cloudfoundry.org/smbdriver/smbsnapshot"
 )
 
-func ToKernelMountOptionFlagsAndEnvVars(mountOpts map[string]interface{}) (string, []string) {
+// valuelessFlags are passed to mount.cifs without a value when they are set
+// to "true" and left out otherwise.
+var valuelessFlags = map[string]bool{
+	"mfsymlinks":   true,
+	"nodfs":        true,
+	"seal":         true,
+	"sign":         true,
+	"nobrl":        true,
+	"hard":         true,
+	"soft":         true,
+	"multichannel": true,
+	"multiuser":    true,
+	"cifsacl":      true,
+	"idsfromsid":   true,
+	"modefromsid":  true,
+	"posix":        true,
+}
+
+// ToKernelMountOptionFlagsAndEnvVars converts mount options to the flags and
+// environment variables of mount.cifs. It fails when an option cannot be
+// converted, rather than mounting without it.
+func ToKernelMountOptionFlagsAndEnvVars(mountOpts map[string]interface{}) (string, []string, error) {
 	mountFlags, mountEnvVars := separateFlagsAndEnvVars(mountOpts)
 
-	kernelMountOptions := convertToStringArr(sanitizeMountFlags(mountFlags))
-	kernelMountEnvVars := convertToStringArr(sanitizeMountFlags(mountEnvVars))
+	sanitizedFlags, valuelessFlags, err := sanitizeMountFlags(mountFlags)
+	if err != nil {
+		return "", nil, err
+	}
+
+	sanitizedEnvVars, valuelessEnvVars, err := sanitizeMountFlags(mountEnvVars)
+	if err != nil {
+		return "", nil, err
+	}
 
-	return strings.Join(kernelMountOptions, ","), kernelMountEnvVars
+	kernelMountOptions := convertToStringArr(sanitizedFlags, valuelessFlags)
+	kernelMountEnvVars := convertToStringArr(sanitizedEnvVars, valuelessEnvVars)
+
+	return strings.Join(kernelMountOptions, ","), kernelMountEnvVars, nil
 }
 
 func convertToStringArr(mountOpts map[string]interface{}, valueless []string) []string {
@@ -52,7 +85,7 @@ func separateFlagsAndEnvVars(mountOpts map[string]interface{}) (map[string]inter
 	return flagList, envVarList
 }
 
-func sanitizeMountFlags(mountOpts map[string]interface{}) (map[string]interface{}, []string) {
+func sanitizeMountFlags(mountOpts map[string]interface{}) (map[string]interface{}, []string, error) {
 	result := make(map[string]interface{})
 	valueless := []string{}
 
@@ -65,17 +98,28 @@ func sanitizeMountFlags(mountOpts map[string]interface{}) (map[string]interface{
 			if v != "" {
 				result["domain"] = v
 			}
-		} else if strings.ToLower(k) == "mfsymlinks" {
-			if v == "true" || v == "" {
-				valueless = append(valueless, "mfsymlinks")
+		} else if strings.ToLower(k) == smbsnapshot.Key {
+			// Mounting the live share instead of a snapshot that cannot be
+			// parsed would expose data the binding did not ask for.
+			t, err := smbsnapshot.Parse(fmt.Sprintf("%v", v))
+			if err != nil {
+				return nil, nil, err
 			}
-		} else if strings.ToLower(k) == "nodfs" {
+			result[smbsnapshot.Key] = strconv.FormatUint(smbsnapshot.NTTime(t), 10)
+		} else if valuelessFlags[strings.ToLower(k)] {
 			if v == "true" || v == "" {
-				valueless = append(valueless, "nodfs")
+				valueless = append(valueless, strings.ToLower(k))
 			}
 		} else {
 			result[k] = v
 		}
 	}
-	return result, valueless
+
+	// Snapshots are read-only, so their mounts are always forced read-only.
+	if _, ok := result[smbsnapshot.Key]; ok {
+		delete(result, "ro")
+		valueless = append(valueless, "ro")
+	}
+
+	return result, valueless, nil
 }
@@ -12,6 +12,7 @@ var _ = Describe("KernelMountOptions", func() {
 			mountOpts          map[string]interface{}
 			kernelMountOptions string
 			kernelMountEnvVars []string
+			err                error
 		)
 
 		BeforeEach(func() {
@@ -19,7 +20,7 @@ var _ = Describe("KernelMountOptions", func() {
 		})
 
 		JustBeforeEach(func() {
-			kernelMountOptions, kernelMountEnvVars = smbdriver.ToKernelMountOptionFlagsAndEnvVars(mountOpts)
+			kernelMountOptions, kernelMountEnvVars, err = smbdriver.ToKernelMountOptionFlagsAndEnvVars(mountOpts)
 		})
 
 		Context("given an empty mount opts", func() {
@@ -174,6 +175,122 @@ var _ = Describe("KernelMountOptions", func() {
 				})
 			})
 		})
+		Context("given ACL mount options", func() {
+			BeforeEach(func() {
+				mountOpts = map[string]interface{}{
+					"cifsacl":     "true",
+					"idsfromsid":  "",
+					"modefromsid": "false",
+					"posix":       "true",
+				}
+			})
+
+			It("passes the options that are set without a value", func() {
+				Expect(kernelMountOptions).To(Equal("cifsacl,idsfromsid,posix"))
+			})
+		})
+
+		Context("given a snapshot mount option", func() {
+			BeforeEach(func() {
+				mountOpts = map[string]interface{}{
+					"snapshot": "@GMT-2024.03.27-20.52.19",
+					"vers":     "3.0",
+				}
+			})
+
+			It("passes the snapshot in NT time and forces the mount read-only", func() {
+				Expect(kernelMountOptions).To(Equal("ro,snapshot=133560463390000000,vers=3.0"))
+			})
+
+			Context("when the binding also asks for ro", func() {
+				BeforeEach(func() {
+					mountOpts["ro"] = "true"
+				})
+
+				It("passes ro only once", func() {
+					Expect(kernelMountOptions).To(Equal("ro,snapshot=133560463390000000,vers=3.0"))
+				})
+			})
+
+			Context("when the snapshot cannot be parsed", func() {
+				BeforeEach(func() {
+					mountOpts["snapshot"] = "yesterday"
+				})
+
+				It("fails instead of mounting the live share", func() {
+					Expect(err).To(MatchError(ContainSubstring("yesterday is not a valid snapshot")))
+					Expect(kernelMountOptions).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("given tuning mount options", func() {
+			BeforeEach(func() {
+				mountOpts = map[string]interface{}{
+					"cache":        "strict",
+					"rsize":        "1048576",
+					"nobrl":        "true",
+					"hard":         "true",
+					"multichannel": "",
+					"soft":         "false",
+				}
+			})
+
+			It("passes values through and flags without a value", func() {
+				Expect(kernelMountOptions).To(Equal("cache=strict,hard,multichannel,nobrl,rsize=1048576"))
+			})
+		})
+
+		Context("given a seal mount option with a string boolean value", func() {
+			Context("true", func() {
+				BeforeEach(func() {
+					mountOpts = map[string]interface{}{
+						"seal": "true",
+					}
+				})
+
+				It("includes the mount option", func() {
+					Expect(kernelMountOptions).To(Equal("seal"))
+				})
+			})
+
+			Context("false", func() {
+				BeforeEach(func() {
+					mountOpts = map[string]interface{}{
+						"seal": "false",
+					}
+				})
+
+				It("does not include the mount option", func() {
+					Expect(kernelMountOptions).NotTo(ContainSubstring("seal"))
+				})
+			})
+		})
+		Context("given a sign mount option with a string boolean value", func() {
+			Context("true", func() {
+				BeforeEach(func() {
+					mountOpts = map[string]interface{}{
+						"sign": "true",
+					}
+				})
+
+				It("includes the mount option", func() {
+					Expect(kernelMountOptions).To(Equal("sign"))
+				})
+			})
+
+			Context("false", func() {
+				BeforeEach(func() {
+					mountOpts = map[string]interface{}{
+						"sign": "false",
+					}
+				})
+
+				It("does not include the mount option", func() {
+					Expect(kernelMountOptions).NotTo(ContainSubstring("sign"))
+				})
+			})
+		})
 		Context("given a mfsymlinks mount option with a string boolean value", func() {
 			Context("true", func() {
 				BeforeEach(func() {
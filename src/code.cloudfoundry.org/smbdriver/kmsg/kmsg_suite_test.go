@@ -0,0 +1,13 @@
+package kmsg_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestKmsg(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Kmsg Suite")
+}
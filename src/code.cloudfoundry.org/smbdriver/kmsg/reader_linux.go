@@ -0,0 +1,83 @@
+//go:build linux
+// +build linux
+
+package kmsg
+
+import (
+	"errors"
+	"io"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxRecordSize is larger than the longest record the kernel prints, which
+// is bounded by its 1024 byte message buffer after escaping.
+const maxRecordSize = 8192
+
+// Reader reads the records logged after it was opened.
+type Reader struct {
+	fd int
+}
+
+// Open opens the kernel log at path and skips the records already logged.
+func Open(path string) (*Reader, error) {
+	// The file is read with raw syscalls, as an os.File would block in the
+	// poller instead of reporting that no more records are available.
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := unix.Seek(fd, 0, io.SeekEnd); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &Reader{fd: fd}, nil
+}
+
+// Records returns the records logged since the reader was opened or last
+// read, without waiting for more.
+func (r *Reader) Records() ([]Record, error) {
+	records := []Record{}
+	buf := make([]byte, maxRecordSize)
+
+	for {
+		n, err := unix.Read(r.fd, buf)
+		switch {
+		case errors.Is(err, unix.EAGAIN):
+			return records, nil
+		case errors.Is(err, unix.EPIPE):
+			// Records were overwritten in the ring buffer before they were
+			// read; the next read continues with the oldest one left.
+			continue
+		case errors.Is(err, unix.EINTR):
+			continue
+		case err != nil:
+			return records, err
+		case n == 0:
+			return records, nil
+		}
+
+		record, err := ParseRecord(buf[:n])
+		if err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+}
+
+// Messages returns the messages of Records.
+func (r *Reader) Messages() ([]string, error) {
+	records, err := r.Records()
+
+	messages := []string{}
+	for _, record := range records {
+		messages = append(messages, record.Message)
+	}
+	return messages, err
+}
+
+func (r *Reader) Close() error {
+	return unix.Close(r.fd)
+}
@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package kmsg_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/smbdriver/kmsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reader", func() {
+	It("skips what was logged before it was opened", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "kmsg")
+		Expect(os.WriteFile(path, []byte("6,1,2,-;before\n"), 0600)).To(Succeed())
+
+		reader, err := kmsg.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		Expect(reader.Messages()).To(BeEmpty())
+	})
+
+	It("fails to open a missing kernel log", func() {
+		_, err := kmsg.Open("/does/not/exist")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reads the kernel log without blocking", func() {
+		reader, err := kmsg.Open(kmsg.Path)
+		if err != nil {
+			Skip("the kernel log cannot be read: " + err.Error())
+		}
+		defer reader.Close()
+
+		_, err = reader.Records()
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package kmsg
+
+import "errors"
+
+// Reader reads the records logged after it was opened.
+type Reader struct{}
+
+// Open fails, as /dev/kmsg only exists on Linux.
+func Open(path string) (*Reader, error) {
+	return nil, errors.New("the kernel log can only be read on linux")
+}
+
+func (r *Reader) Records() ([]Record, error) {
+	return nil, nil
+}
+
+func (r *Reader) Messages() ([]string, error) {
+	return nil, nil
+}
+
+func (r *Reader) Close() error {
+	return nil
+}
@@ -0,0 +1,66 @@
+// Package kmsg reads the kernel log from /dev/kmsg, so that the messages the
+// kernel CIFS client logs while a mount runs can be reported with a failed
+// mount.
+package kmsg
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Path = "/dev/kmsg"
+
+// Record is a message of the kernel log.
+type Record struct {
+	Priority  int           // syslog severity
+	Facility  int           // syslog facility
+	Sequence  uint64        // increases by one for each record
+	Timestamp time.Duration // since boot
+	Message   string
+}
+
+// ParseRecord parses a record as read from /dev/kmsg:
+//
+//	6,1234,5678901,-;CIFS: Attempting to mount \\server\share
+//	 SUBSYSTEM=...
+//
+// Continuation lines carry metadata and are ignored. Non printable bytes of
+// the message are escaped by the kernel as \xNN and are kept escaped.
+func ParseRecord(b []byte) (Record, error) {
+	line, _, _ := strings.Cut(string(b), "\n")
+
+	prefix, message, ok := strings.Cut(line, ";")
+	if !ok {
+		return Record{}, errors.New("kmsg record has no message")
+	}
+
+	fields := strings.Split(prefix, ",")
+	if len(fields) < 3 {
+		return Record{}, errors.New("kmsg record has too few fields")
+	}
+
+	value, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Record{}, errors.New("kmsg record has an invalid priority")
+	}
+
+	sequence, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return Record{}, errors.New("kmsg record has an invalid sequence number")
+	}
+
+	micros, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return Record{}, errors.New("kmsg record has an invalid timestamp")
+	}
+
+	return Record{
+		Priority:  value & 7,
+		Facility:  value >> 3,
+		Sequence:  sequence,
+		Timestamp: time.Duration(micros) * time.Microsecond,
+		Message:   message,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package kmsg_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/kmsg"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseRecord", func() {
+	It("parses the prefix and message of a record", func() {
+		record, err := kmsg.ParseRecord([]byte("3,1234,5678901,-;CIFS: VFS: \\\\fs1 Send error in SessSetup = -13\n SUBSYSTEM=cifs\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record).To(Equal(kmsg.Record{
+			Priority:  3,
+			Facility:  0,
+			Sequence:  1234,
+			Timestamp: 5678901 * time.Microsecond,
+			Message:   `CIFS: VFS: \\fs1 Send error in SessSetup = -13`,
+		}))
+	})
+
+	It("splits the facility from the priority", func() {
+		record, err := kmsg.ParseRecord([]byte("14,1,2,-,caller=T1;message with; a semicolon"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(record.Facility).To(Equal(1))
+		Expect(record.Priority).To(Equal(6))
+		Expect(record.Message).To(Equal("message with; a semicolon"))
+	})
+
+	It("rejects malformed records", func() {
+		for _, b := range []string{"no message", "6,1;too few fields", "x,1,2,-;bad priority", "6,x,2,-;bad sequence", "6,1,x,-;bad timestamp"} {
+			_, err := kmsg.ParseRecord([]byte(b))
+			Expect(err).To(HaveOccurred(), b)
+		}
+	})
+})
@@ -0,0 +1,86 @@
+package smbdriver
+
+import (
+	"regexp"
+	"strings"
+)
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
+
+// KernelLog returns the kernel messages logged since it was opened.
+//
+//counterfeiter:generate -o smbdriverfakes/fake_kernel_log.go . KernelLog
+type KernelLog interface {
+	Messages() ([]string, error)
+	Close() error
+}
+
+// OpenKernelLogFunc opens the kernel log, skipping what is already logged.
+type OpenKernelLogFunc func() (KernelLog, error)
+
+type mountErrorCause struct {
+	pattern *regexp.Regexp
+	cause   string
+}
+
+// mountErrorCatalog explains the common causes of failed mounts. Entries are
+// matched against the mount.cifs output and the kernel messages logged while
+// it ran, so the NT status codes the kernel reports come before the less
+// specific mount.cifs errors.
+var mountErrorCatalog = []mountErrorCause{
+	{regexp.MustCompile(`STATUS_LOGON_FAILURE|STATUS_NO_SUCH_USER|STATUS_WRONG_PASSWORD`), "the server rejected the username or password"},
+	{regexp.MustCompile(`STATUS_PASSWORD_EXPIRED|STATUS_PASSWORD_MUST_CHANGE`), "the password of the user has expired"},
+	{regexp.MustCompile(`STATUS_ACCOUNT_LOCKED_OUT`), "the account of the user is locked out"},
+	{regexp.MustCompile(`STATUS_ACCOUNT_DISABLED|STATUS_ACCOUNT_EXPIRED`), "the account of the user is disabled or has expired"},
+	{regexp.MustCompile(`STATUS_BAD_NETWORK_NAME`), "the share does not exist on the server"},
+	{regexp.MustCompile(`STATUS_ACCESS_DENIED|STATUS_NETWORK_ACCESS_DENIED`), "the user is not allowed to access the share"},
+	{regexp.MustCompile(`(?i)does not support (?:mounting with )?encryption|STATUS_NOT_SUPPORTED.*encrypt`), "the server does not support SMB encryption (seal)"},
+	{regexp.MustCompile(`(?i)negotiate protocol|no dialect|dialect.*not supported|STATUS_NOT_SUPPORTED`), "the server does not support the requested SMB version (vers) or security mode (sec)"},
+	{regexp.MustCompile(`(?i)Required key not available|mount error\(126\)`), "no Kerberos ticket is available for the user"},
+	{regexp.MustCompile(`mount error\(13\)`), "the server denied access: check the username, password and domain, and the permissions on the share"},
+	{regexp.MustCompile(`mount error\(2\)`), "the share or the folder within it does not exist"},
+	{regexp.MustCompile(`mount error\(95\)`), "the server does not support the requested SMB version (vers) or a mount option"},
+	{regexp.MustCompile(`mount error\(112\)`), "the server is down, or refused the requested SMB version (vers)"},
+	{regexp.MustCompile(`mount error\(110\)`), "the server did not answer in time: check that TCP port 445 is reachable"},
+	{regexp.MustCompile(`mount error\(111\)`), "the server refused the connection: check that it serves SMB on the port"},
+	{regexp.MustCompile(`mount error\((101|113)\)`), "the server is unreachable from this cell"},
+	{regexp.MustCompile(`mount error\(22\)`), "the kernel rejected a mount option"},
+	{regexp.MustCompile(`mount error\(16\)`), "the target is already mounted or busy"},
+}
+
+// lookupMountError returns the likely cause of a failed mount, or "" when
+// none of the lines match the catalog.
+func lookupMountError(lines ...string) string {
+	for _, entry := range mountErrorCatalog {
+		for _, line := range lines {
+			if entry.pattern.MatchString(line) {
+				return entry.cause
+			}
+		}
+	}
+	return ""
+}
+
+var credentialOptions = regexp.MustCompile(`(?i)\b(user|username|pass|password)=[^,\s]*`)
+
+// redactMountOutput removes the credentials that mount.cifs and the kernel
+// may print, including the password wherever it appears.
+func redactMountOutput(s, password string) string {
+	if password != "" {
+		s = strings.ReplaceAll(s, password, "*REDACTED*")
+	}
+	return credentialOptions.ReplaceAllString(s, "$1=*REDACTED*")
+}
+
+var cifsMessage = regexp.MustCompile(`(?i)cifs|smb`)
+
+// cifsMessages keeps the kernel messages of the CIFS client.
+func cifsMessages(messages []string, password string) []string {
+	filtered := []string{}
+	for _, message := range messages {
+		if cifsMessage.MatchString(message) {
+			filtered = append(filtered, redactMountOutput(message, password))
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,173 @@
+package smbdriver
+
+import (
+	"sort"
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+)
+
+// MountTargets records which share each volume has mounted, and which share
+// of a list of alternates last mounted, so that it is tried first next time.
+type MountTargets struct {
+	logger    lager.Logger
+	stateFile string
+
+	mutex    sync.Mutex
+	mounts   map[string]driveradmin.Mount
+	lastGood map[string]string
+	dryRuns  map[string]driveradmin.MountCommand
+}
+
+// mountTargetsState is how MountTargets are saved in their state file.
+type mountTargetsState struct {
+	Mounts   map[string]driveradmin.Mount `json:"mounts"`
+	LastGood map[string]string            `json:"last_good"`
+}
+
+func NewMountTargets() *MountTargets {
+	return &MountTargets{
+		mounts:   map[string]driveradmin.Mount{},
+		lastGood: map[string]string{},
+		dryRuns:  map[string]driveradmin.MountCommand{},
+	}
+}
+
+// RestoreMountTargets returns the targets saved at path by a previous run,
+// and saves them there whenever they change, so that the volumes that the
+// volume driver restores after a restart are still listed and monitored.
+func RestoreMountTargets(logger lager.Logger, path string) *MountTargets {
+	logger = logger.Session("mount-targets", lager.Data{"state-file": path})
+
+	t := NewMountTargets()
+	t.logger = logger
+	t.stateFile = path
+
+	state := mountTargetsState{}
+	if err := readStateFile(path, &state); err != nil {
+		logger.Error("restore-failed", err)
+		return t
+	}
+
+	for target, mount := range state.Mounts {
+		t.mounts[target] = mount
+	}
+	for sources, source := range state.LastGood {
+		t.lastGood[sources] = source
+	}
+	logger.Info("restored", lager.Data{"mounts": len(t.mounts)})
+	return t
+}
+
+// Mounts lists the mounted volumes, ordered by target.
+func (t *MountTargets) Mounts(env dockerdriver.Env) []driveradmin.Mount {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	mounts := []driveradmin.Mount{}
+	for _, mount := range t.mounts {
+		mounts = append(mounts, mount)
+	}
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Target < mounts[j].Target })
+
+	return mounts
+}
+
+// order returns the sources in the order they should be tried: the one that
+// last mounted first, then the others in the order they were given.
+func (t *MountTargets) order(sources []smbsource.Source) []smbsource.Source {
+	t.mutex.Lock()
+	lastGood, ok := t.lastGood[smbsource.JoinList(sources)]
+	t.mutex.Unlock()
+
+	if !ok {
+		return sources
+	}
+
+	ordered := []smbsource.Source{}
+	for _, source := range sources {
+		if source.String() == lastGood {
+			ordered = append([]smbsource.Source{source}, ordered...)
+		} else {
+			ordered = append(ordered, source)
+		}
+	}
+	return ordered
+}
+
+// mounted records that target mounted share for source, one of sources,
+// with mounter.
+func (t *MountTargets) mounted(target, personality, mounter string, sources []smbsource.Source, source, share smbsource.Source) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	mount := driveradmin.Mount{Target: target, Source: source.String(), Share: share.String(), Personality: personality, Mounter: mounter}
+	for _, s := range sources {
+		mount.Sources = append(mount.Sources, s.String())
+	}
+	if command, ok := t.dryRuns[target]; ok {
+		mount.DryRun = &command
+		delete(t.dryRuns, target)
+	}
+
+	t.mounts[target] = mount
+	t.lastGood[smbsource.JoinList(sources)] = source.String()
+	t.save()
+}
+
+func (t *MountTargets) unmounted(target string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.mounts, target)
+	delete(t.dryRuns, target)
+	t.save()
+}
+
+// dryRun records the mount command that a dry run did not run for target,
+// until the volume is recorded as mounted.
+func (t *MountTargets) dryRun(target string, command driveradmin.MountCommand) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.dryRuns[target] = command
+}
+
+// isDryRun reports whether target is mounted by a dry run.
+func (t *MountTargets) isDryRun(target string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	mount, ok := t.mounts[target]
+	return ok && mount.DryRun != nil
+}
+
+// dryRunTargets lists the targets mounted by dry runs, in order.
+func (t *MountTargets) dryRunTargets() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	targets := []string{}
+	for target, mount := range t.mounts {
+		if mount.DryRun != nil {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// save writes the targets to the state file, if they have one. Dry runs that
+// have not been recorded as mounted yet are not saved.
+func (t *MountTargets) save() {
+	if t.stateFile == "" {
+		return
+	}
+
+	if err := writeStateFile(t.stateFile, mountTargetsState{Mounts: t.mounts, LastGood: t.lastGood}); err != nil {
+		t.logger.Error("save-failed", err)
+	}
+}
@@ -0,0 +1,145 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+
+	vmo "code.cloudfoundry.org/volume-mount-options"
+)
+
+// DefaultPersonality is the name of the driver configured by the command
+// line flags of the smbdriver.
+const DefaultPersonality = "smbdriver"
+
+// Personality is a driver that the smbdriver registers in the drivers path
+// under its own name, so that brokers can choose it per plan. All
+// personalities share the volumes, mounts and monitors of the smbdriver, but
+// mount with their own options.
+type Personality struct {
+	Name             string
+	ListenPort       int
+	ConfigMask       vmo.MountOptsMask
+	ForceNoserverino bool
+	ForceNoDfs       bool
+}
+
+// PersonalityConfig is a personality in the personalities file, which maps
+// the names of the personalities to their configuration.
+type PersonalityConfig struct {
+	ListenPort       int               `json:"listen_port"`
+	ForceNoserverino bool              `json:"force_noserverino"`
+	ForceNoDfs       bool              `json:"force_nodfs"`
+	AllowedInMount   []string          `json:"allowed_in_mount"`
+	DefaultInMount   map[string]string `json:"default_in_mount"`
+}
+
+var personalityName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// LoadPersonalities reads the personalities file at path, ordered by name.
+// There are none when path is empty.
+func LoadPersonalities(path string) ([]Personality, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := map[string]PersonalityConfig{}
+	if err := json.Unmarshal(contents, &configs); err != nil {
+		return nil, fmt.Errorf("cannot parse personalities %s: %s", path, err.Error())
+	}
+
+	personalities := []Personality{}
+	for name, config := range configs {
+		personality, err := NewPersonality(name, config)
+		if err != nil {
+			return nil, err
+		}
+		personalities = append(personalities, personality)
+	}
+	sort.Slice(personalities, func(i, j int) bool { return personalities[i].Name < personalities[j].Name })
+
+	return personalities, nil
+}
+
+// NewPersonality builds the mount mask of a personality. Bindings may only
+// set the options in AllowedInMount, or every option the smbdriver supports
+// when it is empty. DefaultInMount sets options that bindings do not, which
+// fixes the options that they are not allowed to set.
+func NewPersonality(name string, config PersonalityConfig) (Personality, error) {
+	if !personalityName.MatchString(name) {
+		return Personality{}, fmt.Errorf("invalid personality name %q", name)
+	}
+	if name == DefaultPersonality {
+		return Personality{}, fmt.Errorf("personality %s is the default driver", name)
+	}
+
+	allowed := supportedMountOptions()
+	if len(config.AllowedInMount) > 0 {
+		allowed = []string{"username", "password"}
+		for _, option := range config.AllowedInMount {
+			if !slices.Contains(supportedMountOptions(), option) {
+				return Personality{}, fmt.Errorf("personality %s: option %s is not supported", name, option)
+			}
+			allowed = append(allowed, option)
+		}
+	}
+
+	defaults := map[string]interface{}{}
+	for option, value := range config.DefaultInMount {
+		if !slices.Contains(supportedMountOptions(), option) {
+			return Personality{}, fmt.Errorf("personality %s: option %s is not supported", name, option)
+		}
+		defaults[option] = value
+	}
+
+	configMask, err := newSmbVolumeMountMask(allowed, defaults)
+	if err != nil {
+		return Personality{}, fmt.Errorf("personality %s: %s", name, err.Error())
+	}
+
+	return Personality{
+		Name:             name,
+		ListenPort:       config.ListenPort,
+		ConfigMask:       configMask,
+		ForceNoserverino: config.ForceNoserverino,
+		ForceNoDfs:       config.ForceNoDfs,
+	}, nil
+}
+
+type personalityKey struct{}
+
+// ContextWithPersonality marks the requests in ctx as made to the named
+// personality.
+func ContextWithPersonality(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, personalityKey{}, name)
+}
+
+// PersonalityFromContext returns the personality that the requests in ctx
+// were made to, DefaultPersonality unless they were marked otherwise.
+func PersonalityFromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(personalityKey{}).(string); ok {
+		return name
+	}
+	return DefaultPersonality
+}
+
+// NewPersonalityHandler serves the driver API of the named personality with
+// handler, which mounts with the options of that personality.
+func NewPersonalityHandler(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(w, req.WithContext(ContextWithPersonality(req.Context(), name)))
+	})
+}
@@ -0,0 +1,91 @@
+package smbdriver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/smbdriver"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Personalities", func() {
+	Describe("LoadPersonalities", func() {
+		var path string
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "personalities")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.RemoveAll, dir)
+			path = filepath.Join(dir, "personalities.json")
+		})
+
+		It("loads no personalities without a file", func() {
+			personalities, err := smbdriver.LoadPersonalities("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(personalities).To(BeEmpty())
+		})
+
+		It("loads the personalities ordered by name", func() {
+			Expect(os.WriteFile(path, []byte(`{
+				"smbdriver-nodfs": {"listen_port": 8593, "force_nodfs": true},
+				"smbdriver-legacy": {
+					"listen_port": 8592,
+					"force_noserverino": true,
+					"allowed_in_mount": ["mfsymlinks"],
+					"default_in_mount": {"vers": "2.1"}
+				}
+			}`), 0600)).To(Succeed())
+
+			personalities, err := smbdriver.LoadPersonalities(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(personalities).To(HaveLen(2))
+
+			legacy := personalities[0]
+			Expect(legacy.Name).To(Equal("smbdriver-legacy"))
+			Expect(legacy.ListenPort).To(Equal(8592))
+			Expect(legacy.ForceNoserverino).To(BeTrue())
+			Expect(legacy.ForceNoDfs).To(BeFalse())
+			Expect(legacy.ConfigMask.Allowed).To(ConsistOf("username", "password", "mfsymlinks"))
+			Expect(legacy.ConfigMask.Defaults).To(Equal(map[string]interface{}{"vers": "2.1"}))
+
+			nodfs := personalities[1]
+			Expect(nodfs.Name).To(Equal("smbdriver-nodfs"))
+			Expect(nodfs.ForceNoDfs).To(BeTrue())
+			Expect(nodfs.ConfigMask.Allowed).To(ContainElements("vers", "nodfs", "seal"))
+		})
+
+		DescribeTable("rejects invalid personalities",
+			func(contents, message string) {
+				Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+
+				_, err := smbdriver.LoadPersonalities(path)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("not JSON", `smbdriver-legacy`, "cannot parse personalities"),
+			Entry("the default driver", `{"smbdriver": {}}`, "personality smbdriver is the default driver"),
+			Entry("a name that is not a file name", `{"../legacy": {}}`, `invalid personality name "../legacy"`),
+			Entry("an unsupported allowed option", `{"legacy": {"allowed_in_mount": ["cache=none"]}}`, "personality legacy: option cache=none is not supported"),
+			Entry("an unsupported default option", `{"legacy": {"default_in_mount": {"sloppy_mount": "true"}}}`, "personality legacy: option sloppy_mount is not supported"),
+		)
+	})
+
+	Describe("NewPersonalityHandler", func() {
+		It("marks the requests as made to the personality", func() {
+			var personality string
+			handler := smbdriver.NewPersonalityHandler("smbdriver-legacy", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				personality = smbdriver.PersonalityFromContext(req.Context())
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/VolumeDriver.Mount", nil))
+			Expect(personality).To(Equal("smbdriver-legacy"))
+		})
+
+		It("leaves other requests to the default driver", func() {
+			req := httptest.NewRequest("POST", "/VolumeDriver.Mount", nil)
+			Expect(smbdriver.PersonalityFromContext(req.Context())).To(Equal(smbdriver.DefaultPersonality))
+		})
+	})
+})
@@ -0,0 +1,106 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver
+
+import (
+	"errors"
+	"fmt"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"code.cloudfoundry.org/smbdriver/smbpreflight"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	"code.cloudfoundry.org/smbdriver/smbtrace"
+)
+
+// WithPreflight connects to each share with the credentials of the mount
+// using the given checker before the kernel mounts it, and fails the mount
+// with the stage that failed instead of running mount.cifs.
+func WithPreflight(checker *smbpreflight.Checker) MounterOption {
+	return func(m *smbMounter) {
+		m.preflightChecker = checker
+	}
+}
+
+// preflight checks that the share can be connected to at the address with
+// the credentials of the mount. Mounts that the userspace SMB client cannot
+// connect the way the kernel would are not checked, and a server that does
+// not negotiate a dialect with it is mounted as if it had not been checked.
+func (m *smbMounter) preflight(env dockerdriver.Env, logger lager.Logger, mountSource smbsource.Source, address string, mountOpts map[string]interface{}) error {
+	if m.preflightChecker == nil {
+		return nil
+	}
+
+	if reason := preflightSkipReason(mountOpts); reason != "" {
+		logger.Debug("preflight-skipped", lager.Data{"share": mountSource.String(), "reason": reason})
+		return nil
+	}
+
+	span, ctx := m.tracer.StartSpanFromContext(env.Context(), "preflight")
+	span.Tag("share", mountSource.String())
+	span.Tag("address", address)
+	dialect, err := m.preflightChecker.Check(ctx, smbAddress(mountSource, address), mountSource.Host, mountSource.Share, clientCredentials(mountOpts), clientDialOptions(mountOpts)...)
+	if dialect != 0 {
+		span.Tag("dialect", smb2.DialectName(dialect))
+	}
+	smbtrace.FinishSpan(span, err)
+
+	if err != nil {
+		data := lager.Data{"share": mountSource.String(), "address": address, "error": err.Error()}
+		var checkErr *smbpreflight.Error
+		if errors.As(err, &checkErr) {
+			data["stage"] = checkErr.Stage
+		}
+		if dialect != 0 {
+			data["dialect"] = smb2.DialectName(dialect)
+		}
+
+		// The kernel also negotiates SMB 3.1.1, which the userspace SMB
+		// client does not, so servers that require it are left to mount.cifs.
+		if checkErr != nil && checkErr.Stage == smbpreflight.StageNegotiate {
+			logger.Info("preflight-inconclusive", data)
+			return nil
+		}
+
+		logger.Info("preflight-failed", data)
+		return err
+	}
+
+	logger.Info("preflight-succeeded", lager.Data{"share": mountSource.String(), "address": address, "dialect": smb2.DialectName(dialect)})
+	return nil
+}
+
+// preflightSkipReason returns why a mount cannot be checked, or nothing when
+// it can.
+func preflightSkipReason(mountOpts map[string]interface{}) string {
+	if username, ok := mountOpts["username"]; !ok || username == nil {
+		return "no username"
+	}
+
+	// The userspace SMB client cannot encrypt, and servers that require
+	// encryption refuse unencrypted tree connects.
+	if isFlagSet(mountOpts, "seal") {
+		return "seal"
+	}
+
+	if version, ok := mountOpts["vers"]; ok && version != "default" {
+		if _, ok := clientDialects[fmt.Sprintf("%v", version)]; !ok {
+			return fmt.Sprintf("vers=%v", version)
+		}
+	}
+
+	if sec, ok := mountOpts["sec"]; ok && !containsString(clientSecurityModes, fmt.Sprintf("%v", sec)) {
+		return fmt.Sprintf("sec=%v", sec)
+	}
+
+	return ""
+}
+
+// isPreflightUnreachable reports whether a preflight check failed because
+// the server could not be reached.
+func isPreflightUnreachable(err error) bool {
+	var checkErr *smbpreflight.Error
+	return errors.As(err, &checkErr) && checkErr.Unreachable()
+}
@@ -0,0 +1,120 @@
+package smbdriver
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// dialectRanks orders the values accepted by the "vers" mount option.
+// "3" asks mount.cifs to negotiate any SMB3 dialect, so it ranks as 3.0.
+var dialectRanks = map[string]int{
+	"1.0":   100,
+	"2.0":   200,
+	"2.1":   210,
+	"3":     300,
+	"3.0":   300,
+	"3.02":  302,
+	"3.0.2": 302,
+	"3.1.1": 311,
+	"3.11":  311,
+}
+
+// SecurityPolicy lets the platform operator refuse SMB mounts that do not
+// meet their transport security requirements. The zero value allows every
+// mount.
+type SecurityPolicy struct {
+	RequireEncryption bool
+	MinimumVersion    string
+	Servers           []string
+}
+
+// NewSecurityPolicy builds a policy that applies to servers matching one of
+// the given host patterns (path.Match syntax), or to every server when no
+// pattern is given.
+func NewSecurityPolicy(requireEncryption bool, minimumVersion string, servers []string) (SecurityPolicy, error) {
+	if minimumVersion != "" {
+		rank, ok := dialectRanks[minimumVersion]
+		if !ok || rank < dialectRanks["3.0"] {
+			return SecurityPolicy{}, fmt.Errorf("%s is not a valid minimum SMB version, expected one of 3.0, 3.02 or 3.1.1", minimumVersion)
+		}
+	}
+
+	patterns := []string{}
+	for _, server := range servers {
+		pattern := strings.ToLower(strings.TrimSpace(server))
+		if pattern == "" {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return SecurityPolicy{}, fmt.Errorf("%s is not a valid server pattern: %s", server, err.Error())
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return SecurityPolicy{RequireEncryption: requireEncryption, MinimumVersion: minimumVersion, Servers: patterns}, nil
+}
+
+// Check returns an error describing why a mount of host with the given
+// (already masked) mount options violates the policy.
+func (p SecurityPolicy) Check(host string, mountOpts map[string]interface{}) error {
+	if !p.appliesTo(host) {
+		return nil
+	}
+
+	version, hasVersion := mountOpts["vers"]
+
+	if p.MinimumVersion != "" {
+		if !hasVersion {
+			return fmt.Errorf("mounts from %s must use SMB version %s or later, but the binding does not set a version", host, p.MinimumVersion)
+		}
+
+		if rank, ok := dialectRanks[fmt.Sprintf("%v", version)]; !ok || rank < dialectRanks[p.MinimumVersion] {
+			return fmt.Errorf("mounts from %s must use SMB version %s or later, but the binding asks for version %v", host, p.MinimumVersion, version)
+		}
+	}
+
+	if p.RequireEncryption {
+		if !isFlagSet(mountOpts, "seal") {
+			return fmt.Errorf("mounts from %s must be encrypted, but the binding does not set seal=true", host)
+		}
+
+		if hasVersion {
+			if rank, ok := dialectRanks[fmt.Sprintf("%v", version)]; !ok || rank < dialectRanks["3.0"] {
+				return fmt.Errorf("mounts from %s must be encrypted, which requires SMB version 3.0 or later, but the binding asks for version %v", host, version)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p SecurityPolicy) appliesTo(host string) bool {
+	if !p.RequireEncryption && p.MinimumVersion == "" {
+		return false
+	}
+
+	if len(p.Servers) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(host)
+	for _, pattern := range p.Servers {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isFlagSet(mountOpts map[string]interface{}, key string) bool {
+	value, ok := mountOpts[key]
+	if !ok {
+		return false
+	}
+
+	return value == "true" || value == ""
+}
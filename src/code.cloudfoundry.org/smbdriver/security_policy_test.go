@@ -0,0 +1,110 @@
+package smbdriver_test
+
+import (
+	"code.cloudfoundry.org/smbdriver"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SecurityPolicy", func() {
+	Describe("NewSecurityPolicy", func() {
+		It("accepts SMB3 minimum versions", func() {
+			for _, version := range []string{"", "3.0", "3.02", "3.1.1"} {
+				_, err := smbdriver.NewSecurityPolicy(true, version, nil)
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("rejects minimum versions below SMB3", func() {
+			_, err := smbdriver.NewSecurityPolicy(false, "2.1", nil)
+			Expect(err).To(MatchError("2.1 is not a valid minimum SMB version, expected one of 3.0, 3.02 or 3.1.1"))
+		})
+
+		It("rejects unknown minimum versions", func() {
+			_, err := smbdriver.NewSecurityPolicy(false, "4.0", nil)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects malformed server patterns", func() {
+			_, err := smbdriver.NewSecurityPolicy(true, "", []string{"[server"})
+			Expect(err).To(MatchError(ContainSubstring("[server is not a valid server pattern")))
+		})
+	})
+
+	Describe("#Check", func() {
+		var policy smbdriver.SecurityPolicy
+
+		Context("with the zero value", func() {
+			It("allows every mount", func() {
+				Expect(policy.Check("server", map[string]interface{}{"vers": "1.0"})).To(Succeed())
+			})
+		})
+
+		Context("when encryption is required", func() {
+			BeforeEach(func() {
+				var err error
+				policy, err = smbdriver.NewSecurityPolicy(true, "", nil)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			DescribeTable("checks the mount options",
+				func(mountOpts map[string]interface{}, expectedError string) {
+					err := policy.Check("server", mountOpts)
+					if expectedError == "" {
+						Expect(err).NotTo(HaveOccurred())
+					} else {
+						Expect(err).To(MatchError(expectedError))
+					}
+				},
+				Entry("seal without a version", map[string]interface{}{"seal": "true"}, ""),
+				Entry("seal with SMB 3.1.1", map[string]interface{}{"seal": "true", "vers": "3.1.1"}, ""),
+				Entry("seal as a valueless flag", map[string]interface{}{"seal": ""}, ""),
+				Entry("no seal", map[string]interface{}{"vers": "3.0"}, "mounts from server must be encrypted, but the binding does not set seal=true"),
+				Entry("seal=false", map[string]interface{}{"seal": "false"}, "mounts from server must be encrypted, but the binding does not set seal=true"),
+				Entry("seal with SMB 2.0", map[string]interface{}{"seal": "true", "vers": "2.0"}, "mounts from server must be encrypted, which requires SMB version 3.0 or later, but the binding asks for version 2.0"),
+			)
+		})
+
+		Context("when a minimum version is required", func() {
+			BeforeEach(func() {
+				var err error
+				policy, err = smbdriver.NewSecurityPolicy(false, "3.02", nil)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			DescribeTable("checks the version",
+				func(mountOpts map[string]interface{}, expectedError string) {
+					err := policy.Check("server", mountOpts)
+					if expectedError == "" {
+						Expect(err).NotTo(HaveOccurred())
+					} else {
+						Expect(err).To(MatchError(expectedError))
+					}
+				},
+				Entry("the minimum version", map[string]interface{}{"vers": "3.02"}, ""),
+				Entry("a later version", map[string]interface{}{"vers": "3.1.1"}, ""),
+				Entry("an earlier version", map[string]interface{}{"vers": "3.0"}, "mounts from server must use SMB version 3.02 or later, but the binding asks for version 3.0"),
+				Entry("an unknown version", map[string]interface{}{"vers": "default"}, "mounts from server must use SMB version 3.02 or later, but the binding asks for version default"),
+				Entry("no version", map[string]interface{}{}, "mounts from server must use SMB version 3.02 or later, but the binding does not set a version"),
+			)
+		})
+
+		Context("when the policy is limited to some servers", func() {
+			BeforeEach(func() {
+				var err error
+				policy, err = smbdriver.NewSecurityPolicy(true, "3.0", []string{"*.Secure.Example.com", " 10.0.0.* "})
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("checks mounts from matching servers", func() {
+				Expect(policy.Check("files.secure.example.com", map[string]interface{}{})).NotTo(Succeed())
+				Expect(policy.Check("10.0.0.12", map[string]interface{}{})).NotTo(Succeed())
+			})
+
+			It("allows mounts from other servers", func() {
+				Expect(policy.Check("files.example.com", map[string]interface{}{})).To(Succeed())
+				Expect(policy.Check("10.0.1.12", map[string]interface{}{})).To(Succeed())
+			})
+		})
+	})
+})
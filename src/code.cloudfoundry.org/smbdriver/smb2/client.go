@@ -0,0 +1,596 @@
+// Package smb2 is a minimal SMB 2 and 3 client, enough to authenticate to a
+// server, issue IOCTLs on its IPC$ share, e.g. to ask for DFS referrals, and
+// read and write the files of its shares. It negotiates dialects 2.0.2 to
+// 3.0.2, authenticates with NTLMv2 and signs every request once the session
+// is set up. It does not support encryption, and sends one request at a time.
+package smb2
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	commandNegotiate      = 0x0000
+	commandSessionSetup   = 0x0001
+	commandLogoff         = 0x0002
+	commandTreeConnect    = 0x0003
+	commandTreeDisconnect = 0x0004
+	commandCreate         = 0x0005
+	commandClose          = 0x0006
+	commandFlush          = 0x0007
+	commandRead           = 0x0008
+	commandWrite          = 0x0009
+	commandIoctl          = 0x000b
+	commandQueryDirectory = 0x000e
+	commandQueryInfo      = 0x0010
+	commandSetInfo        = 0x0011
+
+	flagsServerToRedir = 0x00000001
+	flagsAsyncCommand  = 0x00000002
+	flagsSigned        = 0x00000008
+
+	securityModeSigningEnabled  = 0x0001
+	securityModeSigningRequired = 0x0002
+
+	// The client signs every request once the session is set up, so it
+	// requires signing, and servers must sign the last SESSION_SETUP
+	// response.
+	securityMode = securityModeSigningEnabled | securityModeSigningRequired
+
+	sessionFlagIsGuest = 0x0001
+	sessionFlagIsNull  = 0x0002
+
+	headerLength = 64
+
+	// maxMessageLength bounds the messages accepted from servers.
+	maxMessageLength = 1 << 20
+
+	// maxIOLength bounds reads and writes to what a single credit pays for.
+	maxIOLength = 64 * 1024
+)
+
+// Dialects offered to servers.
+const (
+	Dialect202 = 0x0202
+	Dialect210 = 0x0210
+	Dialect300 = 0x0300
+	Dialect302 = 0x0302
+)
+
+var dialects = []uint16{Dialect202, Dialect210, Dialect300, Dialect302}
+
+// Status codes returned by servers.
+const (
+	StatusSuccess                = 0x00000000
+	StatusPending                = 0x00000103
+	StatusNoMoreFiles            = 0x80000006
+	StatusInvalidParameter       = 0xc000000d
+	StatusEndOfFile              = 0xc0000011
+	StatusMoreProcessingRequired = 0xc0000016
+	StatusAccessDenied           = 0xc0000022
+	StatusObjectNameNotFound     = 0xc0000034
+	StatusObjectNameCollision    = 0xc0000035
+	StatusObjectPathNotFound     = 0xc000003a
+	StatusSharingViolation       = 0xc0000043
+	StatusDeletePending          = 0xc0000056
+	StatusLogonFailure           = 0xc000006d
+	StatusAccountRestriction     = 0xc000006e
+	StatusPasswordExpired        = 0xc0000071
+	StatusAccountDisabled        = 0xc0000072
+	StatusDiskFull               = 0xc000007f
+	StatusMediaWriteProtected    = 0xc00000a2
+	StatusFileIsADirectory       = 0xc00000ba
+	StatusNotSupported           = 0xc00000bb
+	StatusBadNetworkName         = 0xc00000cc
+	StatusDirectoryNotEmpty      = 0xc0000101
+	StatusNotADirectory          = 0xc0000103
+	StatusFSDriverRequired       = 0xc000019c
+	StatusPasswordMustChange     = 0xc0000224
+	StatusNotFound               = 0xc0000225
+	StatusAccountLockedOut       = 0xc0000234
+)
+
+// Credentials authenticate a session.
+type Credentials struct {
+	Domain   string
+	Username string
+	Password string
+}
+
+// StatusError is returned when a server fails a request.
+type StatusError struct {
+	Command uint16
+	Status  uint32
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("SMB %s failed with status 0x%08x", commandNames[e.Command], e.Status)
+}
+
+var commandNames = map[uint16]string{
+	commandNegotiate:      "NEGOTIATE",
+	commandSessionSetup:   "SESSION_SETUP",
+	commandLogoff:         "LOGOFF",
+	commandTreeConnect:    "TREE_CONNECT",
+	commandTreeDisconnect: "TREE_DISCONNECT",
+	commandCreate:         "CREATE",
+	commandClose:          "CLOSE",
+	commandFlush:          "FLUSH",
+	commandRead:           "READ",
+	commandWrite:          "WRITE",
+	commandIoctl:          "IOCTL",
+	commandQueryDirectory: "QUERY_DIRECTORY",
+	commandQueryInfo:      "QUERY_INFO",
+	commandSetInfo:        "SET_INFO",
+}
+
+// Session is an authenticated connection to a server.
+type Session struct {
+	conn           net.Conn
+	server         string
+	dialects       []uint16
+	dialect        uint16
+	negotiated     func(dialect uint16)
+	sessionID      uint64
+	signingKey     []byte
+	maxReadLength  uint32
+	maxWriteLength uint32
+
+	// operation serializes the requests made with a context, which applies
+	// its deadline to the whole connection.
+	operation sync.Mutex
+
+	mutex     sync.Mutex
+	messageID uint64
+}
+
+// DialOption configures optional behaviour of the sessions returned by Dial.
+type DialOption func(*Session)
+
+// WithDialects only offers the given dialects to the server instead of all
+// the dialects that the client supports.
+func WithDialects(dialects ...uint16) DialOption {
+	return func(s *Session) {
+		s.dialects = dialects
+	}
+}
+
+// WithNegotiated calls f with the negotiated dialect before authenticating,
+// so that callers can tell a failed negotiation from a failed authentication.
+func WithNegotiated(f func(dialect uint16)) DialOption {
+	return func(s *Session) {
+		s.negotiated = f
+	}
+}
+
+// Dial connects to the server at address (host:port), whose name is server,
+// negotiates a dialect and authenticates with the credentials.
+func Dial(ctx context.Context, address, server string, credentials Credentials, options ...DialOption) (*Session, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{conn: conn, server: server, dialects: dialects}
+	for _, option := range options {
+		option(s)
+	}
+
+	err = s.withContext(ctx, func() error {
+		if err := s.negotiate(); err != nil {
+			return err
+		}
+		if s.negotiated != nil {
+			s.negotiated(s.dialect)
+		}
+		return s.sessionSetup(credentials)
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Dialect returns the negotiated dialect.
+func (s *Session) Dialect() uint16 {
+	return s.dialect
+}
+
+// DialectName returns the version of an SMB dialect, e.g. "3.0.2".
+func DialectName(dialect uint16) string {
+	switch dialect {
+	case Dialect202:
+		return "2.0.2"
+	case Dialect210:
+		return "2.1"
+	case Dialect300:
+		return "3.0"
+	case Dialect302:
+		return "3.0.2"
+	}
+	return fmt.Sprintf("0x%04x", dialect)
+}
+
+// Close logs off and closes the connection.
+func (s *Session) Close() error {
+	s.operation.Lock()
+	defer s.operation.Unlock()
+
+	_ = s.conn.SetDeadline(time.Now().Add(time.Second))
+	_, _ = s.call(commandLogoff, 0, []byte{4, 0, 0, 0})
+	return s.conn.Close()
+}
+
+// Tree is a share connected within a session.
+type Tree struct {
+	session *Session
+	treeID  uint32
+}
+
+// TreeConnect connects to share on the server, e.g. "IPC$".
+func (s *Session) TreeConnect(ctx context.Context, share string) (*Tree, error) {
+	path := encodeUTF16(`\\` + s.server + `\` + share)
+
+	body := binary.LittleEndian.AppendUint16(nil, 9)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint16(body, headerLength+8)
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(path)))
+	body = append(body, path...)
+
+	var tree *Tree
+	err := s.withContext(ctx, func() error {
+		response, err := s.call(commandTreeConnect, 0, body)
+		if err != nil {
+			return err
+		}
+		tree = &Tree{session: s, treeID: response.treeID}
+		return nil
+	})
+	return tree, err
+}
+
+// Disconnect disconnects the tree.
+func (t *Tree) Disconnect() error {
+	t.session.operation.Lock()
+	defer t.session.operation.Unlock()
+
+	_, err := t.session.call(commandTreeDisconnect, t.treeID, []byte{4, 0, 0, 0})
+	return err
+}
+
+// Ioctl issues an FSCTL that does not refer to an open file, and returns its
+// output.
+func (t *Tree) Ioctl(ctx context.Context, ctlCode uint32, input []byte, maxOutput uint32) ([]byte, error) {
+	const fixedLength = 56
+
+	body := binary.LittleEndian.AppendUint16(nil, 57)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, ctlCode)
+	body = append(body, bytes.Repeat([]byte{0xff}, 16)...)
+	body = binary.LittleEndian.AppendUint32(body, headerLength+fixedLength)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(input)))
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, maxOutput)
+	body = binary.LittleEndian.AppendUint32(body, 1) // SMB2_0_IOCTL_IS_FSCTL
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = append(body, input...)
+
+	var output []byte
+	err := t.session.withContext(ctx, func() error {
+		response, err := t.session.call(commandIoctl, t.treeID, body)
+		if err != nil {
+			return err
+		}
+
+		b := response.body
+		if len(b) < 48 {
+			return errors.New("invalid IOCTL response")
+		}
+		offset := int(binary.LittleEndian.Uint32(b[32:])) - headerLength
+		count := int(binary.LittleEndian.Uint32(b[36:]))
+		if count == 0 {
+			output = []byte{}
+			return nil
+		}
+		if offset < 0 || offset+count > len(b) {
+			return errors.New("invalid IOCTL response: output out of bounds")
+		}
+		output = b[offset : offset+count]
+		return nil
+	})
+	return output, err
+}
+
+func (s *Session) negotiate() error {
+	body := binary.LittleEndian.AppendUint16(nil, 36)
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(s.dialects)))
+	body = binary.LittleEndian.AppendUint16(body, securityMode)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	clientGUID := make([]byte, 16)
+	_, _ = rand.Read(clientGUID)
+	body = append(body, clientGUID...)
+	body = binary.LittleEndian.AppendUint64(body, 0)
+	for _, dialect := range s.dialects {
+		body = binary.LittleEndian.AppendUint16(body, dialect)
+	}
+
+	response, err := s.call(commandNegotiate, 0, body)
+	if err != nil {
+		return err
+	}
+
+	if len(response.body) < 64 {
+		return errors.New("invalid NEGOTIATE response")
+	}
+
+	s.dialect = binary.LittleEndian.Uint16(response.body[4:])
+	s.maxReadLength = ioLength(binary.LittleEndian.Uint32(response.body[32:]))
+	s.maxWriteLength = ioLength(binary.LittleEndian.Uint32(response.body[36:]))
+	for _, dialect := range s.dialects {
+		if s.dialect == dialect {
+			return nil
+		}
+	}
+	return fmt.Errorf("the server chose the unsupported SMB dialect 0x%04x", s.dialect)
+}
+
+// ioLength bounds the maximum read or write length of a server to
+// maxIOLength.
+func ioLength(serverMax uint32) uint32 {
+	if serverMax == 0 || serverMax > maxIOLength {
+		return maxIOLength
+	}
+	return serverMax
+}
+
+func (s *Session) sessionSetup(credentials Credentials) error {
+	token, err := spnegoInit(ntlmNegotiateMessage())
+	if err != nil {
+		return err
+	}
+
+	response, err := s.call(commandSessionSetup, 0, sessionSetupBody(token))
+	if err == nil {
+		return errors.New("the server accepted the session without authentication")
+	}
+	if statusErr, ok := err.(*StatusError); !ok || statusErr.Status != StatusMoreProcessingRequired {
+		return err
+	}
+	s.sessionID = response.sessionID
+
+	serverToken, err := sessionSetupToken(response.body)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := parseNTLMChallenge(serverToken)
+	if err != nil {
+		return err
+	}
+
+	authenticate, sessionKey := ntlmAuthenticate(challenge, credentials, newClientChallenge(), time.Now())
+	if token, err = spnegoResponse(authenticate); err != nil {
+		return err
+	}
+
+	// The server signs its response to the last leg with the new session key.
+	signingKey := sessionKey
+	if s.dialect >= Dialect300 {
+		signingKey = kdf(sessionKey, []byte("SMB2AESCMAC\x00"), []byte("SmbSign\x00"))
+	}
+
+	response, err = s.call(commandSessionSetup, 0, sessionSetupBody(token))
+	if err != nil {
+		return err
+	}
+
+	if len(response.body) < 4 {
+		return errors.New("invalid SESSION_SETUP response")
+	}
+	if flags := binary.LittleEndian.Uint16(response.body[2:]); flags&(sessionFlagIsGuest|sessionFlagIsNull) != 0 {
+		return errors.New("the server only allowed a guest session")
+	}
+
+	if !response.signed {
+		return errors.New("the server did not sign the SESSION_SETUP response")
+	}
+
+	s.signingKey = signingKey
+	if !s.verify(response.raw) {
+		s.signingKey = nil
+		return errors.New("the SESSION_SETUP response has an invalid signature")
+	}
+
+	return nil
+}
+
+func sessionSetupBody(token []byte) []byte {
+	body := binary.LittleEndian.AppendUint16(nil, 25)
+	body = append(body, 0, securityMode)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = binary.LittleEndian.AppendUint16(body, headerLength+24)
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(token)))
+	body = binary.LittleEndian.AppendUint64(body, 0)
+	return append(body, token...)
+}
+
+func sessionSetupToken(body []byte) ([]byte, error) {
+	if len(body) < 8 {
+		return nil, errors.New("invalid SESSION_SETUP response")
+	}
+	offset := int(binary.LittleEndian.Uint16(body[4:])) - headerLength
+	length := int(binary.LittleEndian.Uint16(body[6:]))
+	if offset < 0 || offset+length > len(body) {
+		return nil, errors.New("invalid SESSION_SETUP response: token out of bounds")
+	}
+	return spnegoToken(body[offset : offset+length])
+}
+
+type response struct {
+	status    uint32
+	sessionID uint64
+	treeID    uint32
+	signed    bool
+	body      []byte
+	raw       []byte
+}
+
+// call sends a request and waits for its response. Responses with a failure
+// status are returned together with a *StatusError.
+func (s *Session) call(command uint16, treeID uint32, body []byte) (response, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	messageID := s.messageID
+	s.messageID++
+
+	creditCharge := uint16(0)
+	if s.dialect >= Dialect210 {
+		creditCharge = 1
+	}
+
+	header := make([]byte, headerLength)
+	copy(header, []byte{0xfe, 'S', 'M', 'B'})
+	binary.LittleEndian.PutUint16(header[4:], headerLength)
+	binary.LittleEndian.PutUint16(header[6:], creditCharge)
+	binary.LittleEndian.PutUint16(header[12:], command)
+	binary.LittleEndian.PutUint16(header[14:], 32)
+	binary.LittleEndian.PutUint64(header[24:], messageID)
+	binary.LittleEndian.PutUint32(header[36:], treeID)
+	binary.LittleEndian.PutUint64(header[40:], s.sessionID)
+
+	message := append(header, body...)
+	if s.signingKey != nil {
+		binary.LittleEndian.PutUint32(message[16:], flagsSigned)
+		copy(message[48:64], s.sign(message))
+	}
+
+	// A request that fails half way leaves the connection out of step with
+	// the server, so it is closed and the session cannot be used anymore.
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(message)))
+	if _, err := s.conn.Write(append(frame, message...)); err != nil {
+		s.conn.Close()
+		return response{}, err
+	}
+
+	for {
+		r, err := s.receive()
+		if err != nil {
+			s.conn.Close()
+			return response{}, err
+		}
+
+		if binary.LittleEndian.Uint64(r.raw[24:]) != messageID {
+			return response{}, errors.New("unexpected SMB response")
+		}
+
+		flags := binary.LittleEndian.Uint32(r.raw[16:])
+		if r.status == StatusPending && flags&flagsAsyncCommand != 0 {
+			continue
+		}
+
+		// Servers may leave errors unsigned, e.g. when the session is gone.
+		if s.signingKey != nil && (r.signed || r.status == StatusSuccess) && (!r.signed || !s.verify(r.raw)) {
+			return response{}, fmt.Errorf("the SMB %s response has an invalid signature", commandNames[command])
+		}
+
+		if r.status != StatusSuccess {
+			return r, &StatusError{Command: command, Status: r.status}
+		}
+		return r, nil
+	}
+}
+
+func (s *Session) receive() (response, error) {
+	var frame [4]byte
+	if _, err := io.ReadFull(s.conn, frame[:]); err != nil {
+		return response{}, err
+	}
+
+	length := binary.BigEndian.Uint32(frame[:])
+	if length < headerLength || length > maxMessageLength {
+		return response{}, errors.New("invalid SMB message length")
+	}
+
+	raw := make([]byte, length)
+	if _, err := io.ReadFull(s.conn, raw); err != nil {
+		return response{}, err
+	}
+
+	if !bytes.Equal(raw[:4], []byte{0xfe, 'S', 'M', 'B'}) {
+		return response{}, errors.New("the server does not speak SMB 2")
+	}
+
+	flags := binary.LittleEndian.Uint32(raw[16:])
+	if flags&flagsServerToRedir == 0 {
+		return response{}, errors.New("invalid SMB response")
+	}
+
+	return response{
+		status:    binary.LittleEndian.Uint32(raw[8:]),
+		sessionID: binary.LittleEndian.Uint64(raw[40:]),
+		treeID:    binary.LittleEndian.Uint32(raw[36:]),
+		signed:    flags&flagsSigned != 0,
+		body:      raw[headerLength:],
+		raw:       raw,
+	}, nil
+}
+
+func (s *Session) sign(message []byte) []byte {
+	unsigned := append([]byte{}, message...)
+	copy(unsigned[48:64], make([]byte, 16))
+
+	if s.dialect >= Dialect300 {
+		return aesCMAC(s.signingKey, unsigned)
+	}
+
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write(unsigned)
+	return mac.Sum(nil)[:16]
+}
+
+func (s *Session) verify(message []byte) bool {
+	return hmac.Equal(message[48:64], s.sign(message))
+}
+
+// withContext runs f with the deadline of ctx applied to the connection, and
+// aborts it when ctx is cancelled.
+func (s *Session) withContext(ctx context.Context, f func() error) error {
+	s.operation.Lock()
+	defer s.operation.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetDeadline(deadline)
+	} else {
+		_ = s.conn.SetDeadline(time.Time{})
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = s.conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	err := f()
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
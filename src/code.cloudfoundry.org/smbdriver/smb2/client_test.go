@@ -0,0 +1,416 @@
+package smb2_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/smb2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const ctlCode = 0x00060194
+
+func ntlmChallenge(serverChallenge, targetInfo []byte) []byte {
+	b := []byte("NTLMSSP\x00")
+	b = binary.LittleEndian.AppendUint32(b, 2)
+	b = append(b, 0, 0, 0, 0, 56, 0, 0, 0)
+	b = binary.LittleEndian.AppendUint32(b, 0xe2888215)
+	b = append(b, serverChallenge...)
+	b = append(b, make([]byte, 8)...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(targetInfo)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(targetInfo)))
+	b = binary.LittleEndian.AppendUint32(b, 56)
+	b = append(b, make([]byte, 8)...)
+	return append(b, targetInfo...)
+}
+
+// fakeServer answers just enough of SMB 2 for a client to set up a session,
+// issue IOCTLs and use the files in fakeFiles, and checks the signatures of
+// its requests.
+type fakeServer struct {
+	listener net.Listener
+
+	dialect          uint16
+	credentials      smb2.Credentials
+	guest            bool
+	ioctlStatus      uint32
+	ioctlOutput      []byte
+	ioctlHangs       bool
+	corruptSignature bool
+	unsignedSession  bool
+	securityModes    []uint16
+	maxIOLength      uint32
+
+	mutex            sync.Mutex
+	files            fakeFiles
+	handles          map[uint64]*fakeHandle
+	nextHandle       uint64
+	paths            []string
+	ctlCodes         []uint32
+	unsignedRequests int
+}
+
+func newFakeServer(dialect uint16) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	return &fakeServer{
+		listener:    listener,
+		dialect:     dialect,
+		credentials: smb2.Credentials{Domain: "DOMAIN", Username: "user", Password: "secret"},
+		files:       fakeFiles{"": nil},
+		handles:     map[uint64]*fakeHandle{},
+	}
+}
+
+func (f *fakeServer) address() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeServer) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	serverChallenge := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	var signingKey []byte
+
+	for {
+		var frame [4]byte
+		if _, err := io.ReadFull(conn, frame[:]); err != nil {
+			return
+		}
+		request := make([]byte, binary.BigEndian.Uint32(frame[:]))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+
+		command := binary.LittleEndian.Uint16(request[12:])
+		body := request[64:]
+
+		if signingKey != nil {
+			if binary.LittleEndian.Uint32(request[16:])&0x8 == 0 ||
+				!bytes.Equal(request[48:64], smb2.Sign(f.dialect, signingKey, request)) {
+				f.mutex.Lock()
+				f.unsignedRequests++
+				f.mutex.Unlock()
+				f.respond(conn, request, smb2.StatusAccessDenied, nil, nil)
+				continue
+			}
+		}
+
+		switch command {
+		case 0x0000:
+			f.mutex.Lock()
+			f.securityModes = append(f.securityModes, binary.LittleEndian.Uint16(body[4:]))
+			f.mutex.Unlock()
+
+			response := make([]byte, 64)
+			binary.LittleEndian.PutUint16(response, 65)
+			binary.LittleEndian.PutUint16(response[4:], f.dialect)
+			binary.LittleEndian.PutUint32(response[32:], f.maxIOLength)
+			binary.LittleEndian.PutUint32(response[36:], f.maxIOLength)
+			f.respond(conn, request, smb2.StatusSuccess, response, nil)
+
+		case 0x0001:
+			offset := int(binary.LittleEndian.Uint16(body[12:])) - 64
+			length := int(binary.LittleEndian.Uint16(body[14:]))
+			token := body[offset : offset+length]
+			token = token[bytes.Index(token, []byte("NTLMSSP\x00")):]
+
+			switch binary.LittleEndian.Uint32(token[8:]) {
+			case 1:
+				challenge := ntlmChallenge(serverChallenge, []byte{0, 0, 0, 0})
+				f.respond(conn, request, smb2.StatusMoreProcessingRequired, sessionSetupResponse(0, challenge), nil)
+			case 3:
+				sessionKey, ok := smb2.VerifyAuthenticate(token, f.credentials, serverChallenge)
+				if !ok {
+					f.respond(conn, request, smb2.StatusLogonFailure, make([]byte, 9), nil)
+					continue
+				}
+
+				key := sessionKey
+				if f.dialect >= smb2.Dialect300 {
+					key = smb2.KDF(sessionKey, []byte("SMB2AESCMAC\x00"), []byte("SmbSign\x00"))
+				}
+
+				flags := uint16(0)
+				if f.guest {
+					flags = 1
+				}
+				responseKey := key
+				if f.unsignedSession {
+					responseKey = nil
+				}
+				f.respond(conn, request, smb2.StatusSuccess, sessionSetupResponse(flags, nil), responseKey)
+				signingKey = key
+			}
+
+		case 0x0003:
+			offset := int(binary.LittleEndian.Uint16(body[4:])) - 64
+			length := int(binary.LittleEndian.Uint16(body[6:]))
+			f.mutex.Lock()
+			f.paths = append(f.paths, utf16String(body[offset:offset+length]))
+			f.mutex.Unlock()
+
+			response := make([]byte, 16)
+			binary.LittleEndian.PutUint16(response, 16)
+			binary.LittleEndian.PutUint32(request[36:], 7)
+			f.respond(conn, request, smb2.StatusSuccess, response, signingKey)
+
+		case 0x000b:
+			f.mutex.Lock()
+			f.ctlCodes = append(f.ctlCodes, binary.LittleEndian.Uint32(body[4:]))
+			f.mutex.Unlock()
+
+			if f.ioctlHangs {
+				continue
+			}
+			if f.ioctlStatus != smb2.StatusSuccess {
+				f.respond(conn, request, f.ioctlStatus, make([]byte, 9), signingKey)
+				continue
+			}
+
+			response := make([]byte, 48)
+			binary.LittleEndian.PutUint16(response, 49)
+			binary.LittleEndian.PutUint32(response[32:], 64+48)
+			binary.LittleEndian.PutUint32(response[36:], uint32(len(f.ioctlOutput)))
+			f.respond(conn, request, smb2.StatusSuccess, append(response, f.ioctlOutput...), signingKey)
+
+		case 0x0005, 0x0006, 0x0007, 0x0008, 0x0009, 0x000e, 0x0010, 0x0011:
+			status, response := f.handleFile(command, body)
+			f.respond(conn, request, status, response, signingKey)
+
+		default:
+			f.respond(conn, request, smb2.StatusSuccess, []byte{4, 0, 0, 0}, signingKey)
+		}
+	}
+}
+
+func (f *fakeServer) respond(conn net.Conn, request []byte, status uint32, body []byte, signingKey []byte) {
+	header := make([]byte, 64)
+	copy(header, request[:64])
+	binary.LittleEndian.PutUint32(header[8:], status)
+	binary.LittleEndian.PutUint16(header[14:], 32)
+	binary.LittleEndian.PutUint32(header[16:], 0x1)
+	copy(header[48:], make([]byte, 16))
+	if binary.LittleEndian.Uint64(header[40:]) == 0 {
+		binary.LittleEndian.PutUint64(header[40:], 0x1234)
+	}
+
+	message := append(header, body...)
+	if signingKey != nil {
+		binary.LittleEndian.PutUint32(message[16:], 0x1|0x8)
+		copy(message[48:], smb2.Sign(f.dialect, signingKey, message))
+		if f.corruptSignature && binary.LittleEndian.Uint16(message[12:]) == 0x000b {
+			message[48] ^= 0xff
+		}
+	}
+
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(message)))
+	_, _ = conn.Write(append(frame, message...))
+}
+
+func sessionSetupResponse(flags uint16, token []byte) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, 9)
+	b = binary.LittleEndian.AppendUint16(b, flags)
+	b = binary.LittleEndian.AppendUint16(b, 64+8)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(token)))
+	return append(b, token...)
+}
+
+func utf16String(b []byte) string {
+	var s strings.Builder
+	for i := 0; i+1 < len(b); i += 2 {
+		s.WriteRune(rune(binary.LittleEndian.Uint16(b[i:])))
+	}
+	return s.String()
+}
+
+var _ = Describe("Client", func() {
+	var (
+		ctx         context.Context
+		server      *fakeServer
+		credentials smb2.Credentials
+		session     *smb2.Session
+		err         error
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		credentials = smb2.Credentials{Domain: "DOMAIN", Username: "user", Password: "secret"}
+	})
+
+	AfterEach(func() {
+		if session != nil {
+			session.Close()
+			session = nil
+		}
+		server.listener.Close()
+	})
+
+	for _, dialect := range []uint16{smb2.Dialect202, smb2.Dialect210, smb2.Dialect300, smb2.Dialect302} {
+		dialect := dialect
+
+		Context(fmt.Sprintf("when the server negotiates dialect 0x%04x", dialect), func() {
+			BeforeEach(func() {
+				server = newFakeServer(dialect)
+				server.ioctlOutput = []byte("referral")
+				go server.serve()
+
+				session, err = smb2.Dial(ctx, server.address(), "server", credentials)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("signs its requests and checks the responses", func() {
+				Expect(session.Dialect()).To(Equal(dialect))
+
+				tree, err := session.TreeConnect(ctx, "IPC$")
+				Expect(err).NotTo(HaveOccurred())
+
+				output, err := tree.Ioctl(ctx, ctlCode, []byte("request"), 4096)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(output).To(Equal([]byte("referral")))
+
+				Expect(tree.Disconnect()).To(Succeed())
+
+				server.mutex.Lock()
+				defer server.mutex.Unlock()
+				Expect(server.paths).To(Equal([]string{`\\server\IPC$`}))
+				Expect(server.ctlCodes).To(Equal([]uint32{ctlCode}))
+				Expect(server.unsignedRequests).To(BeZero())
+			})
+		})
+	}
+
+	Context("when connected", func() {
+		var tree *smb2.Tree
+
+		BeforeEach(func() {
+			server = newFakeServer(smb2.Dialect302)
+		})
+
+		JustBeforeEach(func() {
+			go server.serve()
+
+			session, err = smb2.Dial(ctx, server.address(), "server", credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			tree, err = session.TreeConnect(ctx, "IPC$")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when an IOCTL fails", func() {
+			BeforeEach(func() {
+				server.ioctlStatus = smb2.StatusNotFound
+			})
+
+			It("returns the status", func() {
+				_, err := tree.Ioctl(ctx, ctlCode, nil, 4096)
+
+				var statusErr *smb2.StatusError
+				Expect(errors.As(err, &statusErr)).To(BeTrue())
+				Expect(statusErr.Status).To(Equal(uint32(smb2.StatusNotFound)))
+				Expect(err).To(MatchError("SMB IOCTL failed with status 0xc0000225"))
+			})
+		})
+
+		Context("when a response has an invalid signature", func() {
+			BeforeEach(func() {
+				server.corruptSignature = true
+			})
+
+			It("rejects it", func() {
+				_, err := tree.Ioctl(ctx, ctlCode, nil, 4096)
+				Expect(err).To(MatchError("the SMB IOCTL response has an invalid signature"))
+			})
+		})
+
+		Context("when the server does not answer", func() {
+			BeforeEach(func() {
+				server.ioctlHangs = true
+			})
+
+			It("gives up when the context is done", func() {
+				ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+				defer cancel()
+
+				_, err := tree.Ioctl(ctx, ctlCode, nil, 4096)
+				Expect(err).To(Equal(context.DeadlineExceeded))
+			})
+		})
+	})
+
+	Context("when the credentials are wrong", func() {
+		BeforeEach(func() {
+			server = newFakeServer(smb2.Dialect302)
+			go server.serve()
+			credentials.Password = "wrong"
+		})
+
+		It("fails to authenticate", func() {
+			session, err = smb2.Dial(ctx, server.address(), "server", credentials)
+			Expect(err).To(MatchError("SMB SESSION_SETUP failed with status 0xc000006d"))
+		})
+
+		It("reports the dialect it negotiated before authenticating", func() {
+			var negotiated []uint16
+			session, err = smb2.Dial(ctx, server.address(), "server", credentials, smb2.WithNegotiated(func(dialect uint16) {
+				negotiated = append(negotiated, dialect)
+			}))
+			Expect(err).To(HaveOccurred())
+			Expect(negotiated).To(Equal([]uint16{smb2.Dialect302}))
+			Expect(smb2.DialectName(negotiated[0])).To(Equal("3.0.2"))
+		})
+	})
+
+	Context("when the server only allows a guest session", func() {
+		BeforeEach(func() {
+			server = newFakeServer(smb2.Dialect302)
+			server.guest = true
+			go server.serve()
+		})
+
+		It("refuses the session", func() {
+			session, err = smb2.Dial(ctx, server.address(), "server", credentials)
+			Expect(err).To(MatchError("the server only allowed a guest session"))
+		})
+	})
+
+	Context("when the server does not sign the last SESSION_SETUP response", func() {
+		BeforeEach(func() {
+			server = newFakeServer(smb2.Dialect302)
+			server.unsignedSession = true
+			go server.serve()
+		})
+
+		It("refuses the session", func() {
+			session, err = smb2.Dial(ctx, server.address(), "server", credentials)
+			Expect(err).To(MatchError("the server did not sign the SESSION_SETUP response"))
+		})
+
+		It("requires signing when negotiating", func() {
+			session, err = smb2.Dial(ctx, server.address(), "server", credentials)
+			server.mutex.Lock()
+			defer server.mutex.Unlock()
+			Expect(server.securityModes).To(Equal([]uint16{0x0003}))
+		})
+	})
+})
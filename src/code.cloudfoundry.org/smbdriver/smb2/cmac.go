@@ -0,0 +1,78 @@
+package smb2
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// aesCMAC implements RFC 4493, which SMB 3 uses to sign messages. Neither
+// the standard library nor golang.org/x/crypto provide it.
+func aesCMAC(key, message []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+
+	subkey := func(in []byte) []byte {
+		out := make([]byte, aes.BlockSize)
+		carry := byte(0)
+		for i := aes.BlockSize - 1; i >= 0; i-- {
+			out[i] = in[i]<<1 | carry
+			carry = in[i] >> 7
+		}
+		if carry != 0 {
+			out[aes.BlockSize-1] ^= 0x87
+		}
+		return out
+	}
+
+	l := make([]byte, aes.BlockSize)
+	block.Encrypt(l, l)
+	k1 := subkey(l)
+	k2 := subkey(k1)
+
+	n := (len(message) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(message)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, aes.BlockSize)
+	copy(last, message[(n-1)*aes.BlockSize:])
+	if complete {
+		xor(last, k1)
+	} else {
+		last[len(message)-(n-1)*aes.BlockSize] = 0x80
+		xor(last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		xor(x, message[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+	xor(x, last)
+	block.Encrypt(x, x)
+
+	return x
+}
+
+// kdf is the SP800-108 counter mode key derivation SMB 3 uses to derive the
+// signing key from the session key.
+func kdf(key, label, context []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte{0, 0, 0, 1})
+	mac.Write(label)
+	mac.Write([]byte{0})
+	mac.Write(context)
+	mac.Write(binary.BigEndian.AppendUint32(nil, 128))
+	return mac.Sum(nil)[:16]
+}
+
+func xor(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
@@ -0,0 +1,99 @@
+package smb2_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/smb2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	Expect(err).NotTo(HaveOccurred())
+	return b
+}
+
+func avPair(id uint16, value []byte) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, id)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	return append(b, value...)
+}
+
+var _ = Describe("Crypto", func() {
+	Context("NT hash", func() {
+		It("matches the MS-NLMP example", func() {
+			Expect(smb2.NTHash("Password")).To(Equal(unhex("a4f49c406510bdcab6824ee7c30fd852")))
+		})
+	})
+
+	Context("AES-CMAC", func() {
+		key := "2b7e151628aed2a6abf7158809cf4f3c"
+
+		It("matches the RFC 4493 examples", func() {
+			Expect(smb2.AESCMAC(unhex(key), []byte{})).To(Equal(unhex("bb1d6929e95937287fa37d129b756746")))
+			Expect(smb2.AESCMAC(unhex(key), unhex("6bc1bee22e409f96e93d7e117393172a"))).
+				To(Equal(unhex("070a16b46b4d4144f79bdd9dd04a287c")))
+			Expect(smb2.AESCMAC(unhex(key), unhex("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411"))).
+				To(Equal(unhex("dfa66747de9ae63030ca32611497c827")))
+			Expect(smb2.AESCMAC(unhex(key), unhex("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710"))).
+				To(Equal(unhex("51f0bebf7e3b9d92fc49741779363cfe")))
+		})
+	})
+
+	Context("NTLMv2", func() {
+		var (
+			credentials     smb2.Credentials
+			serverChallenge []byte
+			clientChallenge []byte
+			targetInfo      []byte
+		)
+
+		BeforeEach(func() {
+			credentials = smb2.Credentials{Domain: "Domain", Username: "User", Password: "Password"}
+			serverChallenge = unhex("0123456789abcdef")
+			clientChallenge = unhex("aaaaaaaaaaaaaaaa")
+			targetInfo = append(avPair(2, smb2.EncodeUTF16("Domain")), avPair(1, smb2.EncodeUTF16("Server"))...)
+			targetInfo = append(targetInfo, avPair(0, nil)...)
+		})
+
+		It("matches the MS-NLMP example", func() {
+			ntowfv2, ntProofStr, sessionKey := smb2.NTLMv2(credentials, serverChallenge, clientChallenge, 0, targetInfo)
+			Expect(ntowfv2).To(Equal(unhex("0c868a403bfd7a93a3001ef22ef02e3f")))
+			Expect(ntProofStr).To(Equal(unhex("68cd0ab851e51c96aabc927bebef6a1c")))
+			Expect(sessionKey).To(Equal(unhex("8de40ccadbc14a82f15cb0ad0de95ca3")))
+		})
+
+		Context("when answering a challenge", func() {
+			var challenge []byte
+
+			BeforeEach(func() {
+				challenge = ntlmChallenge(serverChallenge, targetInfo)
+			})
+
+			It("authenticates with the same session key as the server", func() {
+				authenticate, sessionKey, err := smb2.NTLMAuthenticate(challenge, credentials, clientChallenge, time.Now())
+				Expect(err).NotTo(HaveOccurred())
+
+				verifiedKey, ok := smb2.VerifyAuthenticate(authenticate, credentials, serverChallenge)
+				Expect(ok).To(BeTrue())
+				Expect(verifiedKey).To(Equal(sessionKey))
+			})
+
+			It("is rejected for the wrong password", func() {
+				authenticate, _, err := smb2.NTLMAuthenticate(challenge, smb2.Credentials{Domain: "Domain", Username: "User", Password: "wrong"}, clientChallenge, time.Now())
+				Expect(err).NotTo(HaveOccurred())
+
+				_, ok := smb2.VerifyAuthenticate(authenticate, credentials, serverChallenge)
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		It("rejects messages that are not challenges", func() {
+			_, _, err := smb2.NTLMAuthenticate([]byte("NTLMSSP\x00"), credentials, clientChallenge, time.Now())
+			Expect(err).To(MatchError("invalid NTLM challenge"))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package smb2
+
+import "time"
+
+var (
+	NTHash  = ntHash
+	AESCMAC = aesCMAC
+)
+
+func NTLMv2(credentials Credentials, serverChallenge, clientChallenge []byte, timestamp uint64, targetInfo []byte) ([]byte, []byte, []byte) {
+	ntProofStr, _ := ntlmv2Response(ntowfv2(credentials), serverChallenge, clientChallenge, timestamp, targetInfo)
+	return ntowfv2(credentials), ntProofStr, hmacMD5(ntowfv2(credentials), ntProofStr)
+}
+
+func NTLMAuthenticate(challenge []byte, credentials Credentials, clientChallenge []byte, now time.Time) ([]byte, []byte, error) {
+	parsed, err := parseNTLMChallenge(challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+	authenticate, sessionKey := ntlmAuthenticate(parsed, credentials, clientChallenge, now)
+	return authenticate, sessionKey, nil
+}
+
+var (
+	EncodeUTF16 = encodeUTF16
+	KDF         = kdf
+)
+
+// VerifyAuthenticate checks an NTLMv2 AUTHENTICATE_MESSAGE the way a server
+// does, and returns the session key it establishes.
+func VerifyAuthenticate(authenticate []byte, credentials Credentials, serverChallenge []byte) ([]byte, bool) {
+	ntResponse, err := securityBuffer(authenticate, 20)
+	if err != nil || len(ntResponse) < 16 {
+		return nil, false
+	}
+
+	mac := hmacMD5(ntowfv2(credentials), serverChallenge, ntResponse[16:])
+	if string(mac) != string(ntResponse[:16]) {
+		return nil, false
+	}
+	return hmacMD5(ntowfv2(credentials), ntResponse[:16]), true
+}
+
+// Sign computes the signature of an SMB 2 message.
+func Sign(dialect uint16, signingKey, message []byte) []byte {
+	s := &Session{dialect: dialect, signingKey: signingKey}
+	return s.sign(message)
+}
@@ -0,0 +1,522 @@
+package smb2
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Access rights requested when a file is created or opened.
+const (
+	AccessReadData        = 0x00000001
+	AccessWriteData       = 0x00000002
+	AccessAppendData      = 0x00000004
+	AccessReadAttributes  = 0x00000080
+	AccessWriteAttributes = 0x00000100
+	AccessDelete          = 0x00010000
+	AccessSynchronize     = 0x00100000
+)
+
+// Dispositions of a create, what to do when the file exists or not.
+const (
+	DispositionOpen        = 0x00000001 // open, fail if missing
+	DispositionCreate      = 0x00000002 // create, fail if present
+	DispositionOpenIf      = 0x00000003 // open or create
+	DispositionOverwriteIf = 0x00000005 // truncate or create
+)
+
+// Options of a create.
+const (
+	OptionDirectory    = 0x00000001
+	OptionNonDirectory = 0x00000040
+)
+
+// Attributes of a file.
+const (
+	AttributeReadOnly  = 0x00000001
+	AttributeDirectory = 0x00000010
+	AttributeNormal    = 0x00000080
+)
+
+const (
+	shareAccessAll = 0x00000007 // read, write and delete
+
+	infoTypeFile       = 0x01
+	infoTypeFilesystem = 0x02
+
+	fileDirectoryInformation   = 0x01
+	fileBasicInformation       = 0x04
+	fileRenameInformation      = 0x0a
+	fileDispositionInformation = 0x0d
+	fileEndOfFileInformation   = 0x14
+	fileFsFullSizeInformation  = 0x07
+
+	queryDirectoryRestartScans = 0x01
+
+	// maxDirectoryOutput bounds the entries returned by one QUERY_DIRECTORY.
+	maxDirectoryOutput = 64 * 1024
+)
+
+// CreateRequest is what Create asks the server for, e.g. the read access to
+// an existing file with DispositionOpen and OptionNonDirectory.
+type CreateRequest struct {
+	Access      uint32
+	Attributes  uint32
+	Disposition uint32
+	Options     uint32
+}
+
+// FileInfo describes a file or directory.
+type FileInfo struct {
+	Name           string
+	Size           int64
+	Attributes     uint32
+	CreationTime   time.Time
+	LastAccessTime time.Time
+	LastWriteTime  time.Time
+	ChangeTime     time.Time
+}
+
+func (i FileInfo) IsDir() bool {
+	return i.Attributes&AttributeDirectory != 0
+}
+
+// FilesystemInfo describes the capacity of the volume of a share.
+type FilesystemInfo struct {
+	BlockSize       uint64
+	TotalBlocks     uint64
+	AvailableBlocks uint64
+	FreeBlocks      uint64
+}
+
+// File is a file or directory opened on a tree.
+type File struct {
+	tree *Tree
+	id   []byte
+	info FileInfo
+}
+
+// Create opens or creates the file at path, a slash separated path relative
+// to the root of the share. The root itself is opened with an empty path.
+func (t *Tree) Create(ctx context.Context, path string, request CreateRequest) (*File, error) {
+	const fixedLength = 56
+
+	name := encodeUTF16(sharePath(path))
+
+	body := binary.LittleEndian.AppendUint16(nil, 57)
+	body = append(body, 0, 0)                        // security flags, no oplock
+	body = binary.LittleEndian.AppendUint32(body, 2) // impersonation
+	body = binary.LittleEndian.AppendUint64(body, 0) // create flags
+	body = binary.LittleEndian.AppendUint64(body, 0) // reserved
+	body = binary.LittleEndian.AppendUint32(body, request.Access)
+	body = binary.LittleEndian.AppendUint32(body, request.Attributes)
+	body = binary.LittleEndian.AppendUint32(body, shareAccessAll)
+	body = binary.LittleEndian.AppendUint32(body, request.Disposition)
+	body = binary.LittleEndian.AppendUint32(body, request.Options)
+	body = binary.LittleEndian.AppendUint16(body, headerLength+fixedLength)
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(name)))
+	body = binary.LittleEndian.AppendUint32(body, 0) // no create contexts
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = append(body, name...)
+	if len(name) == 0 {
+		body = append(body, 0)
+	}
+
+	var file *File
+	err := t.session.withContext(ctx, func() error {
+		response, err := t.session.call(commandCreate, t.treeID, body)
+		if err != nil {
+			return err
+		}
+
+		b := response.body
+		if len(b) < 88 {
+			return errors.New("invalid CREATE response")
+		}
+
+		file = &File{
+			tree: t,
+			id:   append([]byte{}, b[64:80]...),
+			info: FileInfo{
+				Name:           baseName(path),
+				CreationTime:   fromFiletime(binary.LittleEndian.Uint64(b[8:])),
+				LastAccessTime: fromFiletime(binary.LittleEndian.Uint64(b[16:])),
+				LastWriteTime:  fromFiletime(binary.LittleEndian.Uint64(b[24:])),
+				ChangeTime:     fromFiletime(binary.LittleEndian.Uint64(b[32:])),
+				Size:           int64(binary.LittleEndian.Uint64(b[48:])),
+				Attributes:     binary.LittleEndian.Uint32(b[56:]),
+			},
+		}
+		return nil
+	})
+	return file, err
+}
+
+// Stat returns the file as it was when it was opened.
+func (f *File) Stat() FileInfo {
+	return f.info
+}
+
+// Close closes the file.
+func (f *File) Close(ctx context.Context) error {
+	body := binary.LittleEndian.AppendUint16(nil, 24)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = append(body, f.id...)
+
+	return f.tree.session.withContext(ctx, func() error {
+		_, err := f.tree.session.call(commandClose, f.tree.treeID, body)
+		return err
+	})
+}
+
+// ReadAt reads up to len(p) bytes at offset, in as many requests as the
+// server needs. It returns io.EOF when it reads less than len(p) bytes
+// because the file ends.
+func (f *File) ReadAt(ctx context.Context, p []byte, offset int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		n, err := f.read(ctx, p[read:min(len(p), read+int(f.tree.session.maxReadLength))], offset+int64(read))
+		read += n
+		if err != nil {
+			return read, err
+		}
+		if n == 0 {
+			return read, io.EOF
+		}
+	}
+	return read, nil
+}
+
+func (f *File) read(ctx context.Context, p []byte, offset int64) (int, error) {
+	body := binary.LittleEndian.AppendUint16(nil, 49)
+	body = append(body, headerLength+16, 0) // data offset in the response, flags
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(p)))
+	body = binary.LittleEndian.AppendUint64(body, uint64(offset))
+	body = append(body, f.id...)
+	body = binary.LittleEndian.AppendUint32(body, 0) // minimum count
+	body = binary.LittleEndian.AppendUint32(body, 0) // channel
+	body = binary.LittleEndian.AppendUint32(body, 0) // remaining bytes
+	body = binary.LittleEndian.AppendUint16(body, 0) // no channel info
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = append(body, 0)
+
+	n := 0
+	err := f.tree.session.withContext(ctx, func() error {
+		response, err := f.tree.session.call(commandRead, f.tree.treeID, body)
+		if err != nil {
+			return err
+		}
+
+		b := response.body
+		if len(b) < 16 {
+			return errors.New("invalid READ response")
+		}
+		offset := int(b[2]) - headerLength
+		length := int(binary.LittleEndian.Uint32(b[4:]))
+		if length == 0 {
+			return nil
+		}
+		if offset < 0 || offset+length > len(b) || length > len(p) {
+			return errors.New("invalid READ response: data out of bounds")
+		}
+		n = copy(p, b[offset:offset+length])
+		return nil
+	})
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Status == StatusEndOfFile {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+// WriteAt writes p at offset, in as many requests as the server needs.
+func (f *File) WriteAt(ctx context.Context, p []byte, offset int64) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := f.write(ctx, p[written:min(len(p), written+int(f.tree.session.maxWriteLength))], offset+int64(written))
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+func (f *File) write(ctx context.Context, p []byte, offset int64) (int, error) {
+	const fixedLength = 48
+
+	body := binary.LittleEndian.AppendUint16(nil, 49)
+	body = binary.LittleEndian.AppendUint16(body, headerLength+fixedLength)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(p)))
+	body = binary.LittleEndian.AppendUint64(body, uint64(offset))
+	body = append(body, f.id...)
+	body = binary.LittleEndian.AppendUint32(body, 0) // channel
+	body = binary.LittleEndian.AppendUint32(body, 0) // remaining bytes
+	body = binary.LittleEndian.AppendUint16(body, 0) // no channel info
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0) // flags
+	body = append(body, p...)
+
+	n := 0
+	err := f.tree.session.withContext(ctx, func() error {
+		response, err := f.tree.session.call(commandWrite, f.tree.treeID, body)
+		if err != nil {
+			return err
+		}
+
+		if len(response.body) < 8 {
+			return errors.New("invalid WRITE response")
+		}
+		n = int(binary.LittleEndian.Uint32(response.body[4:]))
+		if n > len(p) {
+			return errors.New("invalid WRITE response: more written than sent")
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Flush makes the server write the data of the file to disk.
+func (f *File) Flush(ctx context.Context) error {
+	body := binary.LittleEndian.AppendUint16(nil, 24)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = append(body, f.id...)
+
+	return f.tree.session.withContext(ctx, func() error {
+		_, err := f.tree.session.call(commandFlush, f.tree.treeID, body)
+		return err
+	})
+}
+
+// ReadDir lists the entries of a directory, except for "." and "..".
+func (f *File) ReadDir(ctx context.Context) ([]FileInfo, error) {
+	const fixedLength = 32
+
+	pattern := encodeUTF16("*")
+
+	entries := []FileInfo{}
+	for flags := byte(queryDirectoryRestartScans); ; flags = 0 {
+		body := binary.LittleEndian.AppendUint16(nil, 33)
+		body = append(body, fileDirectoryInformation, flags)
+		body = binary.LittleEndian.AppendUint32(body, 0) // file index
+		body = append(body, f.id...)
+		body = binary.LittleEndian.AppendUint16(body, headerLength+fixedLength)
+		body = binary.LittleEndian.AppendUint16(body, uint16(len(pattern)))
+		body = binary.LittleEndian.AppendUint32(body, maxDirectoryOutput)
+		body = append(body, pattern...)
+
+		var output []byte
+		err := f.tree.session.withContext(ctx, func() error {
+			response, err := f.tree.session.call(commandQueryDirectory, f.tree.treeID, body)
+			if err != nil {
+				return err
+			}
+			output, err = outputBuffer(response.body, "QUERY_DIRECTORY")
+			return err
+		})
+
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Status == StatusNoMoreFiles {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		page, err := parseDirectoryInformation(output)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+	}
+}
+
+func parseDirectoryInformation(b []byte) ([]FileInfo, error) {
+	entries := []FileInfo{}
+	for len(b) > 0 {
+		if len(b) < 64 {
+			return nil, errors.New("invalid QUERY_DIRECTORY response: entry out of bounds")
+		}
+
+		next := int(binary.LittleEndian.Uint32(b[0:]))
+		nameLength := int(binary.LittleEndian.Uint32(b[60:]))
+		if 64+nameLength > len(b) || (next != 0 && (next < 64+nameLength || next > len(b))) {
+			return nil, errors.New("invalid QUERY_DIRECTORY response: entry out of bounds")
+		}
+
+		info := FileInfo{
+			Name:           decodeUTF16(b[64 : 64+nameLength]),
+			CreationTime:   fromFiletime(binary.LittleEndian.Uint64(b[8:])),
+			LastAccessTime: fromFiletime(binary.LittleEndian.Uint64(b[16:])),
+			LastWriteTime:  fromFiletime(binary.LittleEndian.Uint64(b[24:])),
+			ChangeTime:     fromFiletime(binary.LittleEndian.Uint64(b[32:])),
+			Size:           int64(binary.LittleEndian.Uint64(b[40:])),
+			Attributes:     binary.LittleEndian.Uint32(b[56:]),
+		}
+		if info.Name != "." && info.Name != ".." {
+			entries = append(entries, info)
+		}
+
+		if next == 0 {
+			break
+		}
+		b = b[next:]
+	}
+	return entries, nil
+}
+
+// Truncate changes the size of the file.
+func (f *File) Truncate(ctx context.Context, size int64) error {
+	return f.setInfo(ctx, fileEndOfFileInformation, binary.LittleEndian.AppendUint64(nil, uint64(size)))
+}
+
+// SetTimes changes the last access and last write times of the file. Zero
+// times are left unchanged.
+func (f *File) SetTimes(ctx context.Context, lastAccessTime, lastWriteTime time.Time) error {
+	info := binary.LittleEndian.AppendUint64(nil, 0) // creation time
+	info = binary.LittleEndian.AppendUint64(info, filetime(lastAccessTime))
+	info = binary.LittleEndian.AppendUint64(info, filetime(lastWriteTime))
+	info = binary.LittleEndian.AppendUint64(info, 0) // change time
+	info = binary.LittleEndian.AppendUint32(info, 0) // attributes
+	info = binary.LittleEndian.AppendUint32(info, 0)
+	return f.setInfo(ctx, fileBasicInformation, info)
+}
+
+// Rename moves the file to path, relative to the root of the share, and
+// replaces the file there if replace is set. The file must have been opened
+// with AccessDelete.
+func (f *File) Rename(ctx context.Context, path string, replace bool) error {
+	name := encodeUTF16(sharePath(path))
+
+	info := []byte{0, 0, 0, 0, 0, 0, 0, 0}
+	if replace {
+		info[0] = 1
+	}
+	info = binary.LittleEndian.AppendUint64(info, 0) // root directory
+	info = binary.LittleEndian.AppendUint32(info, uint32(len(name)))
+	info = append(info, name...)
+	return f.setInfo(ctx, fileRenameInformation, info)
+}
+
+// Delete deletes the file once it is closed. The file must have been opened
+// with AccessDelete, and a directory must be empty.
+func (f *File) Delete(ctx context.Context) error {
+	return f.setInfo(ctx, fileDispositionInformation, []byte{1})
+}
+
+func (f *File) setInfo(ctx context.Context, class byte, info []byte) error {
+	const fixedLength = 32
+
+	body := binary.LittleEndian.AppendUint16(nil, 33)
+	body = append(body, infoTypeFile, class)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(info)))
+	body = binary.LittleEndian.AppendUint16(body, headerLength+fixedLength)
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0) // additional information
+	body = append(body, f.id...)
+	body = append(body, info...)
+
+	return f.tree.session.withContext(ctx, func() error {
+		_, err := f.tree.session.call(commandSetInfo, f.tree.treeID, body)
+		return err
+	})
+}
+
+// StatFilesystem returns the capacity of the volume that the file is on.
+func (f *File) StatFilesystem(ctx context.Context) (FilesystemInfo, error) {
+	body := binary.LittleEndian.AppendUint16(nil, 41)
+	body = append(body, infoTypeFilesystem, fileFsFullSizeInformation)
+	body = binary.LittleEndian.AppendUint32(body, 32) // output buffer length
+	body = binary.LittleEndian.AppendUint16(body, 0)  // no input
+	body = binary.LittleEndian.AppendUint16(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = binary.LittleEndian.AppendUint32(body, 0) // additional information
+	body = binary.LittleEndian.AppendUint32(body, 0) // flags
+	body = append(body, f.id...)
+	body = append(body, 0)
+
+	var info FilesystemInfo
+	err := f.tree.session.withContext(ctx, func() error {
+		response, err := f.tree.session.call(commandQueryInfo, f.tree.treeID, body)
+		if err != nil {
+			return err
+		}
+
+		output, err := outputBuffer(response.body, "QUERY_INFO")
+		if err != nil {
+			return err
+		}
+		if len(output) < 32 {
+			return errors.New("invalid QUERY_INFO response: filesystem information too short")
+		}
+
+		sectorsPerUnit := uint64(binary.LittleEndian.Uint32(output[24:]))
+		bytesPerSector := uint64(binary.LittleEndian.Uint32(output[28:]))
+		info = FilesystemInfo{
+			BlockSize:       sectorsPerUnit * bytesPerSector,
+			TotalBlocks:     binary.LittleEndian.Uint64(output[0:]),
+			AvailableBlocks: binary.LittleEndian.Uint64(output[8:]),
+			FreeBlocks:      binary.LittleEndian.Uint64(output[16:]),
+		}
+		return nil
+	})
+	return info, err
+}
+
+// outputBuffer returns the output of a QUERY_DIRECTORY or QUERY_INFO
+// response.
+func outputBuffer(b []byte, command string) ([]byte, error) {
+	if len(b) < 8 {
+		return nil, errors.New("invalid " + command + " response")
+	}
+	offset := int(binary.LittleEndian.Uint16(b[2:])) - headerLength
+	length := int(binary.LittleEndian.Uint32(b[4:]))
+	if length == 0 {
+		return []byte{}, nil
+	}
+	if offset < 0 || offset+length > len(b) {
+		return nil, errors.New("invalid " + command + " response: output out of bounds")
+	}
+	return b[offset : offset+length], nil
+}
+
+// sharePath converts a slash separated path to a path within a share.
+func sharePath(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	return strings.ReplaceAll(p, "/", `\`)
+}
+
+func baseName(p string) string {
+	if p = sharePath(p); p == "" {
+		return ""
+	}
+	return path.Base(strings.ReplaceAll(p, `\`, "/"))
+}
+
+// filetimeEpoch is the start of the Windows FILETIME, in 100ns intervals
+// before the Unix epoch.
+const filetimeEpoch = 116444736000000000
+
+func fromFiletime(t uint64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, (int64(t)-filetimeEpoch)*100).UTC()
+}
+
+func filetime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100 + filetimeEpoch)
+}
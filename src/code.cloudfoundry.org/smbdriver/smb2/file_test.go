@@ -0,0 +1,420 @@
+package smb2_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/smb2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeFile is a file or directory of a fakeServer, whose files are keyed by
+// their path within the share, the root being "".
+type fakeFile struct {
+	data     []byte
+	dir      bool
+	modified time.Time
+}
+
+type fakeFiles map[string]*fakeFile
+
+type fakeHandle struct {
+	path          string
+	deleteOnClose bool
+}
+
+var fakeModified = time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+func (f *fakeServer) handleFile(command uint16, body []byte) (uint32, []byte) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.files[""] == nil {
+		f.files[""] = &fakeFile{dir: true, modified: fakeModified}
+	}
+
+	if command == 0x0005 {
+		return f.create(body)
+	}
+
+	offsets := map[uint16]int{0x0006: 8, 0x0007: 8, 0x0008: 16, 0x0009: 16, 0x000e: 8, 0x0010: 24, 0x0011: 16}
+	id := binary.LittleEndian.Uint64(body[offsets[command]:])
+	handle, ok := f.handles[id]
+	if !ok {
+		return smb2.StatusInvalidParameter, make([]byte, 9)
+	}
+	file := f.files[handle.path]
+
+	switch command {
+	case 0x0006:
+		delete(f.handles, id)
+		if handle.deleteOnClose {
+			delete(f.files, handle.path)
+		}
+		return smb2.StatusSuccess, make([]byte, 60)
+
+	case 0x0008:
+		length := int(binary.LittleEndian.Uint32(body[4:]))
+		offset := int(binary.LittleEndian.Uint64(body[8:]))
+		if offset >= len(file.data) {
+			return smb2.StatusEndOfFile, make([]byte, 9)
+		}
+		data := file.data[offset:min(len(file.data), offset+length)]
+
+		response := make([]byte, 16)
+		binary.LittleEndian.PutUint16(response, 17)
+		response[2] = 64 + 16
+		binary.LittleEndian.PutUint32(response[4:], uint32(len(data)))
+		return smb2.StatusSuccess, append(response, data...)
+
+	case 0x0009:
+		dataOffset := int(binary.LittleEndian.Uint16(body[2:])) - 64
+		length := int(binary.LittleEndian.Uint32(body[4:]))
+		offset := int(binary.LittleEndian.Uint64(body[8:]))
+		if end := offset + length; end > len(file.data) {
+			file.data = append(file.data, make([]byte, end-len(file.data))...)
+		}
+		copy(file.data[offset:], body[dataOffset:dataOffset+length])
+
+		response := make([]byte, 16)
+		binary.LittleEndian.PutUint16(response, 17)
+		binary.LittleEndian.PutUint32(response[4:], uint32(length))
+		return smb2.StatusSuccess, response
+
+	case 0x000e:
+		if body[3]&0x01 == 0 {
+			return smb2.StatusNoMoreFiles, make([]byte, 9)
+		}
+		return smb2.StatusSuccess, queryResponse(f.directoryInformation(handle.path))
+
+	case 0x0010:
+		info := binary.LittleEndian.AppendUint64(nil, 1000)
+		info = binary.LittleEndian.AppendUint64(info, 400)
+		info = binary.LittleEndian.AppendUint64(info, 500)
+		info = binary.LittleEndian.AppendUint32(info, 8)
+		info = binary.LittleEndian.AppendUint32(info, 512)
+		return smb2.StatusSuccess, queryResponse(info)
+
+	case 0x0011:
+		offset := int(binary.LittleEndian.Uint16(body[8:])) - 64
+		length := int(binary.LittleEndian.Uint32(body[4:]))
+		return f.setInfo(handle, body[3], body[offset:offset+length]), []byte{2, 0}
+	}
+
+	return smb2.StatusSuccess, []byte{4, 0, 0, 0}
+}
+
+func (f *fakeServer) create(body []byte) (uint32, []byte) {
+	disposition := binary.LittleEndian.Uint32(body[36:])
+	options := binary.LittleEndian.Uint32(body[40:])
+	offset := int(binary.LittleEndian.Uint16(body[44:])) - 64
+	length := int(binary.LittleEndian.Uint16(body[46:]))
+	path := utf16String(body[offset : offset+length])
+
+	file, exists := f.files[path]
+	switch {
+	case !exists && disposition == smb2.DispositionOpen:
+		return smb2.StatusObjectNameNotFound, make([]byte, 9)
+	case exists && disposition == smb2.DispositionCreate:
+		return smb2.StatusObjectNameCollision, make([]byte, 9)
+	case exists && file.dir && options&smb2.OptionNonDirectory != 0:
+		return smb2.StatusFileIsADirectory, make([]byte, 9)
+	case exists && !file.dir && options&smb2.OptionDirectory != 0:
+		return smb2.StatusNotADirectory, make([]byte, 9)
+	case !exists:
+		if parent := f.files[parentPath(path)]; parent == nil || !parent.dir {
+			return smb2.StatusObjectPathNotFound, make([]byte, 9)
+		}
+		file = &fakeFile{dir: options&smb2.OptionDirectory != 0, modified: fakeModified}
+		f.files[path] = file
+	case disposition == smb2.DispositionOverwriteIf:
+		file.data = nil
+	}
+
+	f.nextHandle++
+	f.handles[f.nextHandle] = &fakeHandle{path: path}
+
+	response := make([]byte, 88)
+	binary.LittleEndian.PutUint16(response, 89)
+	binary.LittleEndian.PutUint64(response[24:], filetime(file.modified))
+	binary.LittleEndian.PutUint64(response[48:], uint64(len(file.data)))
+	binary.LittleEndian.PutUint32(response[56:], attributes(file))
+	binary.LittleEndian.PutUint64(response[64:], f.nextHandle)
+	return smb2.StatusSuccess, response
+}
+
+func (f *fakeServer) setInfo(handle *fakeHandle, class byte, info []byte) uint32 {
+	file := f.files[handle.path]
+
+	switch class {
+	case 0x04:
+		if lastWrite := binary.LittleEndian.Uint64(info[16:]); lastWrite != 0 {
+			file.modified = time.Unix(0, (int64(lastWrite)-116444736000000000)*100).UTC()
+		}
+
+	case 0x0a:
+		target := utf16String(info[20 : 20+binary.LittleEndian.Uint32(info[16:])])
+		if _, exists := f.files[target]; exists && info[0] == 0 {
+			return smb2.StatusObjectNameCollision
+		}
+		delete(f.files, handle.path)
+		f.files[target] = file
+		handle.path = target
+
+	case 0x0d:
+		for path := range f.files {
+			if file.dir && parentPath(path) == handle.path && path != "" {
+				return smb2.StatusDirectoryNotEmpty
+			}
+		}
+		handle.deleteOnClose = info[0] != 0
+
+	case 0x14:
+		size := int(binary.LittleEndian.Uint64(info))
+		if size > len(file.data) {
+			file.data = append(file.data, make([]byte, size-len(file.data))...)
+		}
+		file.data = file.data[:size]
+	}
+	return smb2.StatusSuccess
+}
+
+// directoryInformation lists a directory as FileDirectoryInformation
+// entries, starting with "." and "..".
+func (f *fakeServer) directoryInformation(dir string) []byte {
+	names := []string{}
+	for path := range f.files {
+		if path != "" && parentPath(path) == dir {
+			names = append(names, path)
+		}
+	}
+	sort.Strings(names)
+
+	var b []byte
+	for i, path := range append([]string{".", ".."}, names...) {
+		file, ok := f.files[path]
+		if !ok {
+			file = f.files[dir]
+		}
+		name := smb2.EncodeUTF16(path[strings.LastIndex(path, `\`)+1:])
+
+		entry := make([]byte, 64)
+		binary.LittleEndian.PutUint64(entry[24:], filetime(file.modified))
+		binary.LittleEndian.PutUint64(entry[40:], uint64(len(file.data)))
+		binary.LittleEndian.PutUint32(entry[56:], attributes(file))
+		binary.LittleEndian.PutUint32(entry[60:], uint32(len(name)))
+		entry = append(entry, name...)
+		if i < len(names)+1 {
+			entry = append(entry, make([]byte, (8-len(entry)%8)%8)...)
+			binary.LittleEndian.PutUint32(entry, uint32(len(entry)))
+		}
+		b = append(b, entry...)
+	}
+	return b
+}
+
+func queryResponse(output []byte) []byte {
+	response := make([]byte, 8)
+	binary.LittleEndian.PutUint16(response, 9)
+	binary.LittleEndian.PutUint16(response[2:], 64+8)
+	binary.LittleEndian.PutUint32(response[4:], uint32(len(output)))
+	return append(response, output...)
+}
+
+func parentPath(path string) string {
+	if i := strings.LastIndex(path, `\`); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+func attributes(file *fakeFile) uint32 {
+	if file.dir {
+		return smb2.AttributeDirectory
+	}
+	return smb2.AttributeNormal
+}
+
+func filetime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100 + 116444736000000000)
+}
+
+var _ = Describe("Files", func() {
+	var (
+		ctx     context.Context
+		server  *fakeServer
+		session *smb2.Session
+		tree    *smb2.Tree
+	)
+
+	open := func(path string) *smb2.File {
+		file, err := tree.Create(ctx, path, smb2.CreateRequest{
+			Access:      smb2.AccessReadData | smb2.AccessWriteData | smb2.AccessDelete,
+			Disposition: smb2.DispositionOpen,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return file
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		server = newFakeServer(smb2.Dialect302)
+		server.maxIOLength = 1024
+		server.files = fakeFiles{
+			"":                {dir: true, modified: fakeModified},
+			"dir":             {dir: true, modified: fakeModified},
+			`dir\file`:        {data: []byte("contents"), modified: fakeModified},
+			`dir\subdir`:      {dir: true, modified: fakeModified},
+			`dir\subdir\file`: {data: []byte("nested"), modified: fakeModified},
+		}
+		go server.serve()
+
+		var err error
+		session, err = smb2.Dial(ctx, server.address(), "server", smb2.Credentials{Domain: "DOMAIN", Username: "user", Password: "secret"})
+		Expect(err).NotTo(HaveOccurred())
+
+		tree, err = session.TreeConnect(ctx, "share")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		session.Close()
+		server.listener.Close()
+	})
+
+	It("opens files by their slash separated path", func() {
+		file := open("/dir/file")
+		Expect(file.Stat().Name).To(Equal("file"))
+		Expect(file.Stat().Size).To(Equal(int64(8)))
+		Expect(file.Stat().IsDir()).To(BeFalse())
+		Expect(file.Stat().LastWriteTime).To(Equal(fakeModified))
+		Expect(file.Close(ctx)).To(Succeed())
+
+		root := open("")
+		Expect(root.Stat().IsDir()).To(BeTrue())
+		Expect(root.Close(ctx)).To(Succeed())
+
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		Expect(server.handles).To(BeEmpty())
+	})
+
+	It("returns the status of a failed create", func() {
+		_, err := tree.Create(ctx, "dir/missing", smb2.CreateRequest{Disposition: smb2.DispositionOpen})
+
+		var statusErr *smb2.StatusError
+		Expect(errors.As(err, &statusErr)).To(BeTrue())
+		Expect(statusErr.Status).To(Equal(uint32(smb2.StatusObjectNameNotFound)))
+	})
+
+	It("writes and reads files in as many requests as the server needs", func() {
+		file, err := tree.Create(ctx, "dir/new", smb2.CreateRequest{
+			Access:      smb2.AccessReadData | smb2.AccessWriteData,
+			Disposition: smb2.DispositionCreate,
+			Options:     smb2.OptionNonDirectory,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close(ctx)
+
+		data := []byte(strings.Repeat("0123456789", 300))
+		n, err := file.WriteAt(ctx, data, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(3000))
+		Expect(file.Flush(ctx)).To(Succeed())
+
+		read := make([]byte, 3000)
+		n, err = file.ReadAt(ctx, read, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(3000))
+		Expect(read).To(Equal(data))
+
+		n, err = file.ReadAt(ctx, read, 2500)
+		Expect(err).To(Equal(io.EOF))
+		Expect(n).To(Equal(500))
+		Expect(read[:500]).To(Equal(data[2500:]))
+	})
+
+	It("lists directories without . and ..", func() {
+		dir := open("dir")
+		defer dir.Close(ctx)
+
+		entries, err := dir.ReadDir(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Name).To(Equal("file"))
+		Expect(entries[0].Size).To(Equal(int64(8)))
+		Expect(entries[0].IsDir()).To(BeFalse())
+		Expect(entries[0].LastWriteTime).To(Equal(fakeModified))
+		Expect(entries[1].Name).To(Equal("subdir"))
+		Expect(entries[1].IsDir()).To(BeTrue())
+	})
+
+	It("truncates files and changes their times", func() {
+		file := open("dir/file")
+		Expect(file.Truncate(ctx, 3)).To(Succeed())
+
+		modified := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		Expect(file.SetTimes(ctx, time.Time{}, modified)).To(Succeed())
+		Expect(file.Close(ctx)).To(Succeed())
+
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		Expect(server.files[`dir\file`].data).To(Equal([]byte("con")))
+		Expect(server.files[`dir\file`].modified).To(Equal(modified))
+	})
+
+	It("renames files", func() {
+		file := open("dir/file")
+		defer file.Close(ctx)
+
+		err := file.Rename(ctx, "dir/subdir/file", false)
+		var statusErr *smb2.StatusError
+		Expect(errors.As(err, &statusErr)).To(BeTrue())
+		Expect(statusErr.Status).To(Equal(uint32(smb2.StatusObjectNameCollision)))
+
+		Expect(file.Rename(ctx, "dir/subdir/file", true)).To(Succeed())
+
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		Expect(server.files).NotTo(HaveKey(`dir\file`))
+		Expect(server.files[`dir\subdir\file`].data).To(Equal([]byte("contents")))
+	})
+
+	It("deletes files once they are closed", func() {
+		dir := open("dir/subdir")
+		err := dir.Delete(ctx)
+		var statusErr *smb2.StatusError
+		Expect(errors.As(err, &statusErr)).To(BeTrue())
+		Expect(statusErr.Status).To(Equal(uint32(smb2.StatusDirectoryNotEmpty)))
+		Expect(dir.Close(ctx)).To(Succeed())
+
+		file := open("dir/subdir/file")
+		Expect(file.Delete(ctx)).To(Succeed())
+		Expect(file.Close(ctx)).To(Succeed())
+
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		Expect(server.files).NotTo(HaveKey(`dir\subdir\file`))
+	})
+
+	It("returns the capacity of the filesystem", func() {
+		root := open("")
+		defer root.Close(ctx)
+
+		info, err := root.StatFilesystem(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info).To(Equal(smb2.FilesystemInfo{
+			BlockSize:       4096,
+			TotalBlocks:     1000,
+			AvailableBlocks: 400,
+			FreeBlocks:      500,
+		}))
+	})
+})
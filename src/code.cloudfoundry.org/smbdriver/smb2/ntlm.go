@@ -0,0 +1,201 @@
+package smb2
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+
+	avIDEOL       = 0x0000
+	avIDTimestamp = 0x0007
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmChallenge holds the parts of the server's CHALLENGE_MESSAGE that the
+// client needs to authenticate.
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func ntlmNegotiateMessage() []byte {
+	b := append([]byte{}, ntlmSignature...)
+	b = binary.LittleEndian.AppendUint32(b, 1)
+	b = binary.LittleEndian.AppendUint32(b, ntlmNegotiateFlags)
+	b = appendSecurityBuffer(b, 0, 32)
+	b = appendSecurityBuffer(b, 0, 32)
+	return b
+}
+
+func parseNTLMChallenge(b []byte) (ntlmChallenge, error) {
+	if len(b) < 48 || !bytes.Equal(b[:8], ntlmSignature) || binary.LittleEndian.Uint32(b[8:]) != 2 {
+		return ntlmChallenge{}, errors.New("invalid NTLM challenge")
+	}
+
+	targetInfo, err := securityBuffer(b, 40)
+	if err != nil {
+		return ntlmChallenge{}, err
+	}
+
+	return ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(b[20:]),
+		serverChallenge: b[24:32],
+		targetInfo:      targetInfo,
+	}, nil
+}
+
+// ntlmAuthenticate computes the NTLMv2 AUTHENTICATE_MESSAGE answering the
+// challenge, and the session key it establishes.
+func ntlmAuthenticate(challenge ntlmChallenge, credentials Credentials, clientChallenge []byte, now time.Time) ([]byte, []byte) {
+	timestamp, hasTimestamp := avTimestamp(challenge.targetInfo)
+	if !hasTimestamp {
+		timestamp = fileTime(now)
+	}
+
+	ntResponseKey := ntowfv2(credentials)
+	ntProofStr, ntResponse := ntlmv2Response(ntResponseKey, challenge.serverChallenge, clientChallenge, timestamp, challenge.targetInfo)
+
+	// With a timestamp from the server the LM response must be empty,
+	// otherwise it is LMv2.
+	lmResponse := make([]byte, 24)
+	if !hasTimestamp {
+		lmResponse = append(hmacMD5(ntResponseKey, challenge.serverChallenge, clientChallenge), clientChallenge...)
+	}
+
+	sessionKey := hmacMD5(ntResponseKey, ntProofStr)
+
+	domain := encodeUTF16(credentials.Domain)
+	user := encodeUTF16(credentials.Username)
+	workstation := []byte{}
+
+	const headerLength = 64
+	payload := []byte{}
+	fields := [][]byte{lmResponse, ntResponse, domain, user, workstation, {}}
+	offsets := []int{}
+	for _, field := range fields {
+		offsets = append(offsets, headerLength+len(payload))
+		payload = append(payload, field...)
+	}
+
+	b := append([]byte{}, ntlmSignature...)
+	b = binary.LittleEndian.AppendUint32(b, 3)
+	for i, field := range fields {
+		b = appendSecurityBuffer(b, len(field), offsets[i])
+	}
+	b = binary.LittleEndian.AppendUint32(b, challenge.flags&ntlmNegotiateFlags)
+	b = append(b, payload...)
+
+	return b, sessionKey
+}
+
+func ntowfv2(credentials Credentials) []byte {
+	return hmacMD5(ntHash(credentials.Password), encodeUTF16(strings.ToUpper(credentials.Username)+credentials.Domain))
+}
+
+// ntHash is the NT hash of a password, the MD4 digest of its UTF-16 form.
+func ntHash(password string) []byte {
+	h := md4.New()
+	h.Write(encodeUTF16(password))
+	return h.Sum(nil)
+}
+
+func ntlmv2Response(ntResponseKey, serverChallenge, clientChallenge []byte, timestamp uint64, targetInfo []byte) ([]byte, []byte) {
+	temp := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	temp = binary.LittleEndian.AppendUint64(temp, timestamp)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+
+	ntProofStr := hmacMD5(ntResponseKey, serverChallenge, temp)
+
+	return ntProofStr, append(append([]byte{}, ntProofStr...), temp...)
+}
+
+func avTimestamp(targetInfo []byte) (uint64, bool) {
+	for len(targetInfo) >= 4 {
+		id := binary.LittleEndian.Uint16(targetInfo)
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if id == avIDEOL || len(targetInfo) < 4+length {
+			break
+		}
+		if id == avIDTimestamp && length == 8 {
+			return binary.LittleEndian.Uint64(targetInfo[4:]), true
+		}
+		targetInfo = targetInfo[4+length:]
+	}
+	return 0, false
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func newClientChallenge() []byte {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// fileTime returns t in 100ns intervals since 1601-01-01.
+func fileTime(t time.Time) uint64 {
+	return uint64(t.UnixNano()/100) + 116444736000000000
+}
+
+func appendSecurityBuffer(b []byte, length, offset int) []byte {
+	b = binary.LittleEndian.AppendUint16(b, uint16(length))
+	b = binary.LittleEndian.AppendUint16(b, uint16(length))
+	return binary.LittleEndian.AppendUint32(b, uint32(offset))
+}
+
+func securityBuffer(b []byte, at int) ([]byte, error) {
+	length := int(binary.LittleEndian.Uint16(b[at:]))
+	offset := int(binary.LittleEndian.Uint32(b[at+4:]))
+	if offset+length > len(b) {
+		return nil, errors.New("invalid NTLM message: field out of bounds")
+	}
+	return b[offset : offset+length], nil
+}
+
+func encodeUTF16(s string) []byte {
+	b := []byte{}
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+	return b
+}
+
+func decodeUTF16(b []byte) string {
+	runes := make([]uint16, len(b)/2)
+	for i := range runes {
+		runes[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(runes))
+}
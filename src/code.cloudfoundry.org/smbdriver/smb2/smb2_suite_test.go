@@ -0,0 +1,13 @@
+package smb2_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmb2(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smb2 Suite")
+}
@@ -0,0 +1,81 @@
+package smb2
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+)
+
+var (
+	spnegoOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	ntlmOID   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+)
+
+type negTokenInit struct {
+	MechTypes []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	MechToken []byte                  `asn1:"explicit,optional,tag:2"`
+}
+
+type negTokenResp struct {
+	NegState      asn1.Enumerated       `asn1:"explicit,optional,tag:0"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
+	ResponseToken []byte                `asn1:"explicit,optional,tag:2"`
+	MechListMIC   []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// spnegoInit wraps the NTLM NEGOTIATE_MESSAGE in the GSS-API initial
+// context token offering NTLM only.
+func spnegoInit(mechToken []byte) ([]byte, error) {
+	oid, err := asn1.Marshal(spnegoOID)
+	if err != nil {
+		return nil, err
+	}
+
+	init, err := asn1.Marshal(negTokenInit{MechTypes: []asn1.ObjectIdentifier{ntlmOID}, MechToken: mechToken})
+	if err != nil {
+		return nil, err
+	}
+
+	choice, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: init})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: append(oid, choice...)})
+}
+
+// spnegoResponse wraps the NTLM AUTHENTICATE_MESSAGE.
+func spnegoResponse(responseToken []byte) ([]byte, error) {
+	resp, err := asn1.Marshal(negTokenResp{ResponseToken: responseToken})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: resp})
+}
+
+// spnegoToken returns the NTLM message in a server's response token. Servers
+// that answer with a bare NTLM message are accepted too.
+func spnegoToken(b []byte) ([]byte, error) {
+	if bytes.HasPrefix(b, ntlmSignature) {
+		return b, nil
+	}
+
+	var choice asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &choice); err != nil {
+		return nil, err
+	}
+	if choice.Class != asn1.ClassContextSpecific || choice.Tag != 1 {
+		return nil, errors.New("unexpected SPNEGO token")
+	}
+
+	var resp negTokenResp
+	if _, err := asn1.Unmarshal(choice.Bytes, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.SupportedMech) > 0 && !resp.SupportedMech.Equal(ntlmOID) {
+		return nil, errors.New("the server does not support NTLM authentication")
+	}
+
+	return resp.ResponseToken, nil
+}
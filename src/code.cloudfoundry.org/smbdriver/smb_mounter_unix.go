@@ -6,17 +6,35 @@ package smbdriver
 import (
 	"context"
 	"fmt"
+	"net"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
 	"code.cloudfoundry.org/goshims/osshim"
 	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"code.cloudfoundry.org/smbdriver/smbdfs"
+	"code.cloudfoundry.org/smbdriver/smbpreflight"
+	"code.cloudfoundry.org/smbdriver/smbsnapshot"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	"code.cloudfoundry.org/smbdriver/smbtrace"
+	"code.cloudfoundry.org/smbdriver/smbtuning"
 	vmo "code.cloudfoundry.org/volume-mount-options"
 	"code.cloudfoundry.org/volumedriver"
 	"code.cloudfoundry.org/volumedriver/invoker"
+	"github.com/openzipkin/zipkin-go"
+)
+
+const (
+	posixKey = "posix"
+
+	// posixVersion is the only SMB dialect with the POSIX extensions.
+	posixVersion = "3.1.1"
 )
 
 type smbMounter struct {
@@ -25,10 +43,127 @@ type smbMounter struct {
 	configMask       vmo.MountOptsMask
 	forceNoserverino bool
 	forceNoDfs       bool
+	securityPolicy   SecurityPolicy
+	tuningProfiles   smbtuning.Profiles
+	keyring          *credentialKeyring
+	hostResolver     *HostResolver
+	mountTargets     *MountTargets
+	dfsResolver      *smbdfs.Resolver
+	circuitBreaker   *CircuitBreaker
+	openKernelLog    OpenKernelLogFunc
+	personalities    map[string]Personality
+	tracer           *zipkin.Tracer
+	fuseMount        FuseMountFunc
+	preflightChecker *smbpreflight.Checker
+	dryRun           bool
+}
+
+// MounterOption configures optional behaviour of the mounter returned by
+// NewSmbMounter.
+type MounterOption func(*smbMounter)
+
+// WithSecurityPolicy rejects mounts that do not comply with the given policy.
+func WithSecurityPolicy(policy SecurityPolicy) MounterOption {
+	return func(m *smbMounter) {
+		m.securityPolicy = policy
+	}
+}
+
+// WithTuningProfiles lets bindings refer to the given tuning profiles with
+// the "profile" option.
+func WithTuningProfiles(profiles smbtuning.Profiles) MounterOption {
+	return func(m *smbMounter) {
+		m.tuningProfiles = profiles
+	}
+}
+
+// WithKeyringStateFile saves which keys the mounts loaded into the keyring at
+// path, so that mounts restored after a restart still remove their keys when
+// they are unmounted.
+func WithKeyringStateFile(path string) MounterOption {
+	return func(m *smbMounter) {
+		m.keyring.stateFile = path
+	}
+}
+
+// WithHostResolver resolves servers with the given resolver instead of one
+// using the system resolver with the default timeout and TTL.
+func WithHostResolver(resolver *HostResolver) MounterOption {
+	return func(m *smbMounter) {
+		m.hostResolver = resolver
+	}
+}
+
+// WithMountTargets records the mounted shares in the given targets, which
+// can then be listed by the admin API.
+func WithMountTargets(targets *MountTargets) MounterOption {
+	return func(m *smbMounter) {
+		m.mountTargets = targets
+	}
+}
+
+// WithDfsResolver resolves DFS shares to their targets with the given
+// resolver, and mounts the targets directly with "nodfs" instead of leaving
+// the referrals to the kernel.
+func WithDfsResolver(resolver *smbdfs.Resolver) MounterOption {
+	return func(m *smbMounter) {
+		m.dfsResolver = resolver
+	}
+}
+
+// WithCircuitBreaker fails the mounts from servers that cannot be reached
+// according to the given circuit breaker.
+func WithCircuitBreaker(breaker *CircuitBreaker) MounterOption {
+	return func(m *smbMounter) {
+		m.circuitBreaker = breaker
+	}
+}
+
+// WithKernelLog reports the kernel CIFS messages logged while a mount ran
+// when it fails.
+func WithKernelLog(open OpenKernelLogFunc) MounterOption {
+	return func(m *smbMounter) {
+		m.openKernelLog = open
+	}
+}
+
+// WithPersonalities mounts the volumes of requests made to one of the given
+// personalities with its mount mask and forced options, instead of those
+// that the mounter was created with.
+func WithPersonalities(personalities ...Personality) MounterOption {
+	return func(m *smbMounter) {
+		for _, personality := range personalities {
+			m.personalities[personality.Name] = personality
+		}
+	}
+}
+
+// WithTracer records spans for the steps of each mount, as children of the
+// span in the context of the request.
+func WithTracer(tracer *zipkin.Tracer) MounterOption {
+	return func(m *smbMounter) {
+		m.tracer = tracer
+	}
 }
 
-func NewSmbMounter(invoker invoker.Invoker, osutil osshim.Os, configMask vmo.MountOptsMask, forceNoserverino, forceNoDfs bool) volumedriver.Mounter {
-	return &smbMounter{invoker: invoker, osutil: osutil, configMask: configMask, forceNoserverino: forceNoserverino, forceNoDfs: forceNoDfs}
+func NewSmbMounter(invoker invoker.Invoker, osutil osshim.Os, configMask vmo.MountOptsMask, forceNoserverino, forceNoDfs bool, options ...MounterOption) volumedriver.Mounter {
+	m := &smbMounter{
+		invoker:          invoker,
+		osutil:           osutil,
+		configMask:       configMask,
+		forceNoserverino: forceNoserverino,
+		forceNoDfs:       forceNoDfs,
+		keyring:          newCredentialKeyring(invoker),
+		hostResolver:     NewHostResolver(net.DefaultResolver.LookupIPAddr, DefaultResolveTimeout, DefaultResolveTTL, clock.NewClock()),
+		mountTargets:     NewMountTargets(),
+		circuitBreaker:   NewCircuitBreaker(0, DefaultCircuitBreakerCoolDown, clock.NewClock()),
+		personalities:    map[string]Personality{},
+		tracer:           smbtrace.NewNoopTracer(),
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
 }
 
 func (m *smbMounter) Mount(env dockerdriver.Env, source string, target string, opts map[string]interface{}) error {
@@ -36,46 +171,387 @@ func (m *smbMounter) Mount(env dockerdriver.Env, source string, target string, o
 	logger.Info("start")
 	defer logger.Info("end")
 
-	mountOpts, err := vmo.NewMountOpts(opts, m.configMask)
+	personality := m.personality(env)
+
+	span, _ := m.tracer.StartSpanFromContext(env.Context(), "validate-options")
+	sources, mountOpts, err := m.mountOptions(logger, personality, source, target, opts)
+	smbtrace.FinishSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	if m.fuseMount != nil {
+		if err := checkFuseMountOptions(mountOpts); err != nil {
+			logger.Info("error-fuse-mount-options", lager.Data{"given_options": opts, "error": err.Error()})
+			return safeError(err)
+		}
+	}
+
+	mountFlags, mountEnvVars, err := ToKernelMountOptionFlagsAndEnvVars(mountOpts)
+	if err != nil {
+		logger.Info("error-mount-options", lager.Data{"given_options": opts, "error": err.Error()})
+		return safeError(err)
+	}
+
+	if !isFlagSet(mountOpts, posixKey) {
+		if _, ok := mountOpts[uidKey]; !ok {
+			mountFlags = fmt.Sprintf("%s,uid=%s", mountFlags, containerUid)
+		}
+		mountFlags = fmt.Sprintf("%s,gid=%s", mountFlags, containerUid)
+	}
+
+	if personality.ForceNoserverino {
+		mountFlags = fmt.Sprintf("%s,noserverino", mountFlags)
+	}
+
+	if personality.ForceNoDfs {
+		mountFlags = fmt.Sprintf("%s,nodfs", mountFlags)
+	}
+
+	// Fall back to the alternate shares, if any, while the share cannot be
+	// mounted.
+	for _, candidate := range m.mountTargets.order(sources) {
+		var share smbsource.Source
+		share, err = m.mountShare(env, logger, candidate, target, mountFlags, mountEnvVars, mountOpts)
+		if err == nil {
+			m.mountTargets.mounted(target, personality.Name, m.mounterName(), sources, candidate, share)
+			return nil
+		}
+
+		if len(sources) > 1 {
+			logger.Info("mount-share-failed", lager.Data{"share": candidate.String(), "error": err.Error()})
+		}
+	}
+
+	return safeError(err)
+}
+
+// mountOptions validates the options of a mount against the mount mask of
+// its personality, and returns them with the shares to mount.
+func (m *smbMounter) mountOptions(logger lager.Logger, personality Personality, source, target string, opts map[string]interface{}) ([]smbsource.Source, map[string]interface{}, error) {
+	mountOpts, err := vmo.NewMountOpts(opts, personality.ConfigMask)
 	if err != nil {
 		logger.Debug("error-parse-entries", lager.Data{
 			"given_source":  source,
 			"given_target":  target,
 			"given_options": opts,
 		})
-		return safeError(err)
+		return nil, nil, safeError(err)
+	}
+
+	mountSource, err := smbsource.Parse(source)
+	if err != nil {
+		logger.Debug("error-invalid-source", lager.Data{"given_source": source})
+		return nil, nil, safeError(err)
 	}
 
-	mountFlags, mountEnvVars := ToKernelMountOptionFlagsAndEnvVars(mountOpts)
+	sources := []smbsource.Source{mountSource}
+	if alternates, ok := mountOpts[smbsource.AlternatesKey]; ok {
+		delete(mountOpts, smbsource.AlternatesKey)
 
-	mountFlags = fmt.Sprintf("%s,uid=2000,gid=2000", mountFlags)
+		alternateSources, err := smbsource.ParseList(fmt.Sprintf("%v", alternates))
+		if err != nil {
+			logger.Debug("error-invalid-alternate-shares", lager.Data{"given_options": opts})
+			return nil, nil, safeError(err)
+		}
+		sources = append(sources, alternateSources...)
+	}
 
-	if m.forceNoserverino {
-		mountFlags = fmt.Sprintf("%s,noserverino", mountFlags)
+	sources, err = sourcesWithSubpath(sources, mountOpts)
+	if err != nil {
+		logger.Debug("error-invalid-subpath", lager.Data{"given_source": source, "given_options": opts})
+		return nil, nil, safeError(err)
 	}
 
-	if m.forceNoDfs {
+	if err := m.tuningProfiles.Apply(mountOpts); err != nil {
+		logger.Info("error-tuning-profile", lager.Data{"given_options": opts, "error": err.Error()})
+		return nil, nil, safeError(err)
+	}
+
+	if err := smbtuning.Normalize(mountOpts); err != nil {
+		logger.Info("error-tuning-options", lager.Data{"given_options": opts, "error": err.Error()})
+		return nil, nil, safeError(err)
+	}
+
+	posix := isFlagSet(mountOpts, posixKey)
+	if posix {
+		// mount.cifs also accepts 3.11 for SMB 3.1.1.
+		if version := fmt.Sprintf("%v", mountOpts["vers"]); dialectRanks[version] != dialectRanks[posixVersion] {
+			err := fmt.Errorf("posix requires vers=%s", posixVersion)
+			logger.Info("error-posix-version", lager.Data{"given_options": opts})
+			return nil, nil, safeError(err)
+		}
+
+		// With the POSIX extensions the server provides the owner and mode
+		// of each file, so they must not be overridden.
+		for _, key := range []string{"file_mode", "dir_mode"} {
+			delete(mountOpts, key)
+		}
+	}
+
+	multiuser := isFlagSet(mountOpts, multiuserKey)
+	if uid, ok := mountOpts[uidKey]; ok {
+		if err := checkMultiuserUid(multiuser, fmt.Sprintf("%v", uid)); err != nil {
+			logger.Info("error-multiuser-uid", lager.Data{"given_options": opts, "error": err.Error()})
+			return nil, nil, safeError(err)
+		}
+	}
+	if _, ok := mountOpts["sec"]; multiuser && !ok {
+		// Per-user sessions need the credentials from the keyring, which only
+		// ntlmssp authentication reads.
+		mountOpts["sec"] = "ntlmssp"
+	}
+
+	return sources, mountOpts, nil
+}
+
+// personality returns the personality that env was requested through, or
+// the options the mounter was created with for the default personality.
+func (m *smbMounter) personality(env dockerdriver.Env) Personality {
+	if personality, ok := m.personalities[PersonalityFromContext(env.Context())]; ok {
+		return personality
+	}
+
+	return Personality{
+		Name:             DefaultPersonality,
+		ConfigMask:       m.configMask,
+		ForceNoserverino: m.forceNoserverino,
+		ForceNoDfs:       m.forceNoDfs,
+	}
+}
+
+// mountShare mounts a share or, when it is a DFS path, the first of its DFS
+// targets that mounts, and returns the share that it mounted.
+func (m *smbMounter) mountShare(env dockerdriver.Env, logger lager.Logger, mountSource smbsource.Source, target, mountFlags string, mountEnvVars []string, mountOpts map[string]interface{}) (smbsource.Source, error) {
+	dfsTargets := m.resolveDfs(env, logger, mountSource, mountOpts)
+	if len(dfsTargets) == 0 {
+		return mountSource, m.mountSource(env, logger, mountSource, target, mountFlags, mountEnvVars, mountOpts)
+	}
+
+	if !m.personality(env).ForceNoDfs {
 		mountFlags = fmt.Sprintf("%s,nodfs", mountFlags)
 	}
 
-	mountArgs := []string{
-		"-t", "cifs",
-		source,
-		target,
-		"-o", mountFlags,
-		"--verbose",
+	var err error
+	for _, dfsTarget := range dfsTargets {
+		err = m.mountSource(env, logger, dfsTarget, target, mountFlags, mountEnvVars, mountOpts)
+		if err == nil {
+			return dfsTarget, nil
+		}
+		logger.Info("mount-dfs-target-failed", lager.Data{"share": mountSource.String(), "dfs-target": dfsTarget.String(), "error": err.Error()})
 	}
+	return mountSource, err
+}
+
+// resolveDfs returns the DFS targets of a share, or nothing when the share is
+// not a DFS path or cannot be resolved, in which case the kernel is left to
+// follow the referrals.
+func (m *smbMounter) resolveDfs(env dockerdriver.Env, logger lager.Logger, mountSource smbsource.Source, mountOpts map[string]interface{}) []smbsource.Source {
+	if m.dfsResolver == nil {
+		return nil
+	}
+
+	username, ok := mountOpts["username"]
+	if !ok {
+		return nil
+	}
+
+	// Credentials are only sent to servers the mount itself may use.
+	if err := m.securityPolicy.Check(mountSource.Host, mountOpts); err != nil {
+		return nil
+	}
+
+	credentials := smb2.Credentials{
+		Username: fmt.Sprintf("%v", username),
+		Password: fmt.Sprintf("%v", mountOpts["password"]),
+	}
+	if domain, ok := mountOpts["domain"]; ok && domain != nil {
+		credentials.Domain = fmt.Sprintf("%v", domain)
+	}
+
+	span, ctx := m.tracer.StartSpanFromContext(env.Context(), "resolve-dfs")
+	span.Tag("share", mountSource.String())
+	targets, err := m.dfsResolver.Resolve(ctx, mountSource, credentials)
+	if err != nil && err != smbdfs.ErrNotDFS {
+		zipkin.TagError.Set(span, err.Error())
+	}
+	span.Finish()
+	if err != nil {
+		if err != smbdfs.ErrNotDFS {
+			logger.Info("error-resolve-dfs", lager.Data{"share": mountSource.String(), "error": err.Error()})
+		}
+		return nil
+	}
+
+	logger.Info("resolved-dfs", lager.Data{"share": mountSource.String(), "dfs-targets": smbsource.JoinList(targets)})
+	return targets
+}
+
+// mountSource mounts a single share, trying each address of its server.
+func (m *smbMounter) mountSource(env dockerdriver.Env, logger lager.Logger, mountSource smbsource.Source, target, mountFlags string, mountEnvVars []string, mountOpts map[string]interface{}) error {
+	span, _ := m.tracer.StartSpanFromContext(env.Context(), "security-policy")
+	span.Tag("host", mountSource.Host)
+	err := m.securityPolicy.Check(mountSource.Host, mountOpts)
+	smbtrace.FinishSpan(span, err)
+	if err != nil {
+		logger.Info("error-security-policy", lager.Data{"share": mountSource.String(), "error": err.Error()})
+		return err
+	}
+
+	if err := m.circuitBreaker.allow(mountSource.Host); err != nil {
+		logger.Info("circuit-breaker-open", lager.Data{"host": mountSource.Host, "error": err.Error()})
+		return err
+	}
+
+	unreachable, err := m.mountAddresses(env, logger, mountSource, target, mountFlags, mountEnvVars, mountOpts)
+	if m.circuitBreaker.record(mountSource.Host, err, unreachable) {
+		logger.Info("circuit-breaker-opened", lager.Data{"host": mountSource.Host, "error": err.Error()})
+	}
+	return err
+}
+
+// mountAddresses mounts a share from each address of its server in turn, and
+// reports whether it failed because the server could not be reached.
+func (m *smbMounter) mountAddresses(env dockerdriver.Env, logger lager.Logger, mountSource smbsource.Source, target, mountFlags string, mountEnvVars []string, mountOpts map[string]interface{}) (bool, error) {
+	if mountSource.Port != 0 {
+		mountFlags = fmt.Sprintf("%s,port=%d", mountFlags, mountSource.Port)
+	}
+
+	multiuser := isFlagSet(mountOpts, multiuserKey)
+
+	span, ctx := m.tracer.StartSpanFromContext(env.Context(), "resolve-host")
+	span.Tag("host", mountSource.Host)
+	addresses, err := m.hostResolver.Resolve(ctx, mountSource.Host)
+	smbtrace.FinishSpan(span, err)
+	if err != nil {
+		logger.Info("error-resolve-host", lager.Data{"host": mountSource.Host, "error": err.Error()})
+		return true, err
+	}
+
+	if m.fuseMount != nil {
+		return m.mountFuseAddresses(env, logger, mountSource, addresses, target, mountOpts)
+	}
+
+	// Fall back to the next address of the server while the previous one is
+	// unreachable.
+	for _, address := range addresses {
+		mountArgs := []string{
+			"-t", "cifs",
+			mountSource.UNC(),
+			target,
+			"-o", fmt.Sprintf("%s,ip=%s", mountFlags, address),
+			"--verbose",
+		}
+
+		logger.Debug("parse-mount", lager.Data{
+			"share":     mountSource.String(),
+			"target":    target,
+			"mountArgs": mountArgs,
+		})
+
+		// A dry run does not connect to the server or load credentials into
+		// the keyring.
+		if m.dryRun {
+			return false, m.dryRunMount(logger, mountSource, target, mountArgs, mountEnvVars, mountOpts)
+		}
+
+		if err = m.preflight(env, logger, mountSource, address, mountOpts); err != nil {
+			if !isPreflightUnreachable(err) {
+				return false, err
+			}
+			logger.Info("server-address-unreachable", lager.Data{"host": mountSource.Host, "address": address, "error": err.Error()})
+			continue
+		}
+
+		if multiuser {
+			username := fmt.Sprintf("%v", mountOpts["username"])
+			password := fmt.Sprintf("%v", mountOpts["password"])
+			if err := m.keyring.Add(env, target, multiuserUid(mountOpts), address, username, password); err != nil {
+				return false, err
+			}
+		}
+
+		logger.Debug("mount", lager.Data{"params": strings.Join(mountArgs, ",")})
+		kernelLog := m.kernelLog(logger)
+		span, mountEnv := smbtrace.StartSpan(m.tracer, env, "mount.cifs")
+		span.Tag("share", mountSource.String())
+		span.Tag("address", address)
+		invokeResult := m.invoker.Invoke(mountEnv, "mount", mountArgs, mountEnvVars...)
+		err = invokeResult.Wait()
+		smbtrace.FinishSpan(span, err)
+		m.reportMount(logger, mountSource, address, err, invokeResult, kernelLog, mountOpts)
+		if err == nil {
+			return false, nil
+		}
+
+		if multiuser {
+			if removeErr := m.keyring.Remove(env, target); removeErr != nil {
+				logger.Error("remove-multiuser-credentials-failed", removeErr)
+			}
+		}
+
+		if !isUnreachable(err, invokeResult.StdError()) {
+			return false, err
+		}
+		logger.Info("server-address-unreachable", lager.Data{"host": mountSource.Host, "address": address, "error": err.Error()})
+	}
+
+	return true, err
+}
 
-	logger.Debug("parse-mount", lager.Data{
-		"given_source":  source,
-		"given_target":  target,
-		"given_options": opts,
-		"mountArgs":     mountArgs,
-	})
+// kernelLog opens the kernel log before a mount runs, or returns nil when it
+// cannot be read.
+func (m *smbMounter) kernelLog(logger lager.Logger) KernelLog {
+	if m.openKernelLog == nil {
+		return nil
+	}
 
-	logger.Debug("mount", lager.Data{"params": strings.Join(mountArgs, ",")})
-	invokeResult := m.invoker.Invoke(env, "mount", mountArgs, mountEnvVars...)
-	return safeError(invokeResult.Wait())
+	kernelLog, err := m.openKernelLog()
+	if err != nil {
+		logger.Debug("error-open-kernel-log", lager.Data{"error": err.Error()})
+		return nil
+	}
+	return kernelLog
+}
+
+// reportMount logs the output of mount.cifs and, when the mount failed, the
+// kernel CIFS messages logged while it ran and their likely cause.
+func (m *smbMounter) reportMount(logger lager.Logger, mountSource smbsource.Source, address string, err error, invokeResult invoker.InvokeResult, kernelLog KernelLog, mountOpts map[string]interface{}) {
+	password := mountPassword(mountOpts)
+
+	stdout := redactMountOutput(strings.TrimSpace(invokeResult.StdOutput()), password)
+	stderr := redactMountOutput(strings.TrimSpace(invokeResult.StdError()), password)
+
+	if err == nil {
+		if kernelLog != nil {
+			kernelLog.Close()
+		}
+		logger.Debug("mount-output", lager.Data{"share": mountSource.String(), "address": address, "stdout": stdout, "stderr": stderr})
+		return
+	}
+
+	messages := []string{}
+	if kernelLog != nil {
+		all, readErr := kernelLog.Messages()
+		if readErr != nil {
+			logger.Debug("error-read-kernel-log", lager.Data{"error": readErr.Error()})
+		}
+		messages = cifsMessages(all, password)
+		kernelLog.Close()
+	}
+
+	data := lager.Data{
+		"share":           mountSource.String(),
+		"address":         address,
+		"error":           redactMountOutput(err.Error(), password),
+		"stdout":          stdout,
+		"stderr":          stderr,
+		"kernel-messages": messages,
+	}
+	if cause := lookupMountError(append([]string{err.Error(), stderr, stdout}, messages...)...); cause != "" {
+		data["cause"] = cause
+	}
+	logger.Info("mount-failed", data)
 }
 
 func (m *smbMounter) Unmount(env dockerdriver.Env, target string) error {
@@ -83,11 +559,22 @@ func (m *smbMounter) Unmount(env dockerdriver.Env, target string) error {
 	logger.Info("start")
 	defer logger.Info("end")
 
+	if m.dryRun {
+		m.dryRunUnmount(logger, target)
+		return nil
+	}
+
 	invokeResult := m.invoker.Invoke(env, "umount", []string{"-l", target})
 	err := invokeResult.Wait()
 	if err != nil {
 		return safeError(err)
 	}
+
+	m.mountTargets.unmounted(target)
+
+	if err := m.keyring.Remove(env, target); err != nil {
+		logger.Error("remove-multiuser-credentials-failed", err)
+	}
 	return nil
 }
 
@@ -96,11 +583,18 @@ func (m *smbMounter) Check(env dockerdriver.Env, name, mountPoint string) bool {
 	logger.Info("start")
 	defer logger.Info("end")
 
-	ctx, cancel := context.WithDeadline(context.TODO(), time.Now().Add(time.Second*5))
+	if m.dryRun {
+		return m.dryRunCheck(logger, name, mountPoint)
+	}
+
+	span, _ := m.tracer.StartSpanFromContext(env.Context(), "check")
+	span.Tag("volume", name)
+	ctx, cancel := context.WithDeadline(zipkin.NewContext(context.TODO(), span), time.Now().Add(time.Second*5))
 	defer cancel()
 	env = driverhttp.EnvWithContext(ctx, env)
 	invokeResult := m.invoker.Invoke(env, "mountpoint", []string{"-q", mountPoint})
 	err := invokeResult.Wait()
+	smbtrace.FinishSpan(span, err)
 	if err != nil {
 		// Note: Created volumes (with no mounts) will be removed
 		//       since VolumeInfo.Mountpoint will be an empty string
@@ -125,13 +619,20 @@ func (m *smbMounter) Purge(env dockerdriver.Env, path string) {
 		if dirEntry.IsDir() {
 			mountDir := filepath.Join(path, dirEntry.Name())
 
-			err = m.invoker.Invoke(env, "umount", []string{"-l", "-f", mountDir}).Wait()
-			if err != nil {
+			if m.dryRun {
+				logger.Info("dry-run-unmount", lager.Data{"path": mountDir})
+			} else if err = m.invoker.Invoke(env, "umount", []string{"-l", "-f", mountDir}).Wait(); err != nil {
 				logger.Error("warning-umount-failed", err)
 			} else {
 				logger.Info("unmount-successful", lager.Data{"path": mountDir})
 			}
 
+			m.mountTargets.unmounted(mountDir)
+
+			if err := m.keyring.Remove(env, mountDir); err != nil {
+				logger.Error("purge-remove-multiuser-credentials-failed", err, lager.Data{"path": mountDir})
+			}
+
 			if err := m.osutil.Remove(mountDir); err != nil {
 				logger.Error("purge-cannot-remove-directory", err, lager.Data{"name": mountDir, "path": path})
 			}
@@ -142,20 +643,37 @@ func (m *smbMounter) Purge(env dockerdriver.Env, path string) {
 }
 
 func NewSmbVolumeMountMask() (vmo.MountOptsMask, error) {
-	allowed := []string{"mfsymlinks", "username", "password", "file_mode", "dir_mode", "ro", "domain", "vers", "sec", "version",
-		"noserverino", "forceuid", "noforceuid", "forcegid", "noforcegid", "nodfs"}
-	defaultMap := map[string]interface{}{}
+	return newSmbVolumeMountMask(supportedMountOptions(), map[string]interface{}{})
+}
 
+func supportedMountOptions() []string {
+	supported := []string{"mfsymlinks", "username", "password", "file_mode", "dir_mode", "ro", "domain", "vers", "sec", "version",
+		"noserverino", "forceuid", "noforceuid", "forcegid", "noforcegid", "nodfs", "subpath", "seal", "sign", smbtuning.ProfileKey, smbsnapshot.Key, multiuserKey, uidKey,
+		"cifsacl", "idsfromsid", "modefromsid", posixKey, smbsource.AlternatesKey}
+	return append(supported, smbtuning.Keys...)
+}
+
+func newSmbVolumeMountMask(allowed []string, defaultMap map[string]interface{}) (vmo.MountOptsMask, error) {
 	return vmo.NewMountOptsMask(
 		allowed,
 		defaultMap,
 		map[string]string{"readonly": "ro", "version": "vers"},
 		[]string{"source", "mount"},
 		[]string{"username", "password"},
+		vmo.UserOptsValidationFunc(smbtuning.Validate),
+		vmo.UserOptsValidationFunc(smbsnapshot.Validate),
 	)
 
 }
 
+// unreachableErrors match the mount.cifs errors for ENETUNREACH, ETIMEDOUT,
+// ECONNREFUSED, EHOSTDOWN and EHOSTUNREACH.
+var unreachableErrors = regexp.MustCompile(`mount error\((101|110|111|112|113)\)`)
+
+func isUnreachable(err error, stderr string) bool {
+	return unreachableErrors.MatchString(err.Error()) || unreachableErrors.MatchString(stderr)
+}
+
 func safeError(e error) error {
 	if e == nil {
 		return nil
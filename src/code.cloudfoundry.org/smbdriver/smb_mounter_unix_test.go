@@ -6,20 +6,41 @@ package smbdriver_test
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/dockerdriver"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/goshims/bufioshim"
+	"code.cloudfoundry.org/goshims/filepathshim"
+	"code.cloudfoundry.org/goshims/osshim"
 	"code.cloudfoundry.org/goshims/osshim/os_fake"
+	"code.cloudfoundry.org/goshims/timeshim"
 	"code.cloudfoundry.org/lager/v3/lagertest"
 	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"code.cloudfoundry.org/smbdriver/smbdfs"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	"code.cloudfoundry.org/smbdriver/smbpreflight"
+	"code.cloudfoundry.org/smbdriver/smbtrace"
+	"code.cloudfoundry.org/smbdriver/smbtuning"
 	vmo "code.cloudfoundry.org/volume-mount-options"
 	"code.cloudfoundry.org/volumedriver"
+	"code.cloudfoundry.org/volumedriver/invoker"
 	"code.cloudfoundry.org/volumedriver/invokerfakes"
+	"code.cloudfoundry.org/volumedriver/mountchecker"
+	"code.cloudfoundry.org/volumedriver/oshelper"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
 )
 
 var _ = Describe("SmbMounter", func() {
@@ -35,13 +56,19 @@ var _ = Describe("SmbMounter", func() {
 
 		subject volumedriver.Mounter
 
-		opts map[string]interface{}
+		lookupAddrs  []net.IPAddr
+		lookupErr    error
+		hostResolver *smbdriver.HostResolver
+
+		source string
+		opts   map[string]interface{}
 	)
 
 	BeforeEach(func() {
 		logger = lagertest.NewTestLogger("smb-mounter")
 		testContext = context.TODO()
 		env = driverhttp.NewHttpDriverEnv(logger, testContext)
+		source = "//server/source"
 		opts = map[string]interface{}{}
 		opts["mount"] = "/data"
 		opts["source"] = "source-from-opts"
@@ -58,15 +85,21 @@ var _ = Describe("SmbMounter", func() {
 		fakeInvokeResult.WaitForReturns(nil)
 		fakeOs = &os_fake.FakeOs{}
 
+		lookupAddrs = []net.IPAddr{{IP: net.ParseIP("10.0.0.10")}}
+		lookupErr = nil
+		hostResolver = smbdriver.NewHostResolver(func(context.Context, string) ([]net.IPAddr, error) {
+			return lookupAddrs, lookupErr
+		}, time.Second, time.Minute, fakeclock.NewFakeClock(time.Now()))
+
 		configMask, err := smbdriver.NewSmbVolumeMountMask()
 		Expect(err).NotTo(HaveOccurred())
 
-		subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false)
+		subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false, smbdriver.WithHostResolver(hostResolver))
 	})
 
 	Context("#Mount", func() {
 		JustBeforeEach(func() {
-			err = subject.Mount(env, "source", "target", opts)
+			err = subject.Mount(env, source, "target", opts)
 		})
 
 		Context("when mount succeeds", func() {
@@ -96,12 +129,12 @@ var _ = Describe("SmbMounter", func() {
 					configMask, err := smbdriver.NewSmbVolumeMountMask()
 					Expect(err).NotTo(HaveOccurred())
 
-					subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false)
+					subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false, smbdriver.WithHostResolver(hostResolver))
 				})
 
 				DescribeTable("when passed smb versions", func(version string, containsVers bool) {
 					opts["version"] = version
-					err = subject.Mount(env, "source", "target", opts)
+					err = subject.Mount(env, "//server/source", "target", opts)
 					Expect(err).NotTo(HaveOccurred())
 					_, cmd, args, _ := fakeInvoker.InvokeArgsForCall(0)
 					Expect(cmd).To(Equal("mount"))
@@ -156,100 +189,1178 @@ var _ = Describe("SmbMounter", func() {
 				})
 			})
 
-			Context("when mounting with mfsymlinks option", func() {
-				Context("and mfsymlinks is true", func() {
-					BeforeEach(func() {
-						opts["mfsymlinks"] = true
-					})
+			Context("when mounting with mfsymlinks option", func() {
+				Context("and mfsymlinks is true", func() {
+					BeforeEach(func() {
+						opts["mfsymlinks"] = true
+					})
+
+					It("should include the mfsymlinks flag", func() {
+						Expect(err).NotTo(HaveOccurred())
+						_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+						Expect(strings.Join(args, " ")).To(ContainSubstring("mfsymlinks"))
+						Expect(strings.Join(args, " ")).NotTo(ContainSubstring("mfsymlinks=true"))
+					})
+				})
+
+				Context("and mfsymlinks is false", func() {
+					BeforeEach(func() {
+						opts["mfsymlinks"] = false
+					})
+
+					It("should not include the mfsymlinks flag", func() {
+						Expect(err).NotTo(HaveOccurred())
+						_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+						Expect(strings.Join(args, " ")).NotTo(ContainSubstring("mfsymlinks"))
+					})
+				})
+
+			})
+
+			Context("when mounting with seal and sign options", func() {
+				BeforeEach(func() {
+					opts["seal"] = true
+					opts["sign"] = true
+				})
+
+				It("should include the seal and sign flags", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("seal"))
+					Expect(strings.Join(args, " ")).To(ContainSubstring("sign"))
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("seal="))
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("sign="))
+				})
+			})
+
+			Context("when mounting with tuning options", func() {
+				BeforeEach(func() {
+					opts["cache"] = "loose"
+					opts["rsize"] = float64(1048576)
+					opts["nobrl"] = true
+					opts["max_channels"] = 4
+				})
+
+				It("should pass them to mount", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("cache=loose"))
+					Expect(strings.Join(args, " ")).To(ContainSubstring("rsize=1048576"))
+					Expect(strings.Join(args, " ")).To(ContainSubstring("max_channels=4"))
+					Expect(strings.Join(args, " ")).To(ContainSubstring("nobrl"))
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("nobrl="))
+				})
+			})
+
+			Context("when mounting with Windows ACL options", func() {
+				BeforeEach(func() {
+					opts["cifsacl"] = true
+					opts["idsfromsid"] = true
+					opts["modefromsid"] = true
+				})
+
+				It("should pass them to mount", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Split(args[5], ",")).To(ContainElements("cifsacl", "idsfromsid", "modefromsid"))
+				})
+			})
+
+			Context("when mounting with the POSIX extensions", func() {
+				BeforeEach(func() {
+					opts["posix"] = true
+					opts["version"] = "3.1.1"
+					opts["file_mode"] = "0777"
+				})
+
+				It("should mount without forcing the owner and mode", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Split(args[5], ",")).To(ContainElements("posix", "vers=3.1.1"))
+					Expect(args[5]).NotTo(ContainSubstring("uid="))
+					Expect(args[5]).NotTo(ContainSubstring("gid="))
+					Expect(args[5]).NotTo(ContainSubstring("file_mode="))
+				})
+
+				Context("and the version is spelled 3.11", func() {
+					BeforeEach(func() {
+						opts["version"] = "3.11"
+					})
+
+					It("should mount, since it is the same dialect", func() {
+						Expect(err).NotTo(HaveOccurred())
+						_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+						Expect(strings.Split(args[5], ",")).To(ContainElements("posix", "vers=3.11"))
+					})
+				})
+
+				Context("and the version is not 3.1.1", func() {
+					BeforeEach(func() {
+						opts["version"] = "3.0"
+					})
+
+					It("should return a safe error without mounting", func() {
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+						Expect(err).To(MatchError("posix requires vers=3.1.1"))
+						Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+					})
+				})
+			})
+
+			Context("when mounting a snapshot", func() {
+				BeforeEach(func() {
+					opts["snapshot"] = "2024-03-27T20:52:19Z"
+				})
+
+				It("should mount the snapshot read-only", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("snapshot=133560463390000000"))
+					Expect(strings.Split(args[5], ",")).To(ContainElement("ro"))
+				})
+			})
+
+			Context("when the source is not in the //host/share form", func() {
+				DescribeTable("normalizes the source passed to mount",
+					func(source, expectedSource, expectedFlag string) {
+						Expect(subject.Mount(env, source, "target", opts)).To(Succeed())
+						_, _, args, _ := fakeInvoker.InvokeArgsForCall(fakeInvoker.InvokeCallCount() - 1)
+						Expect(args[2]).To(Equal(expectedSource))
+						if expectedFlag != "" {
+							Expect(args[5]).To(ContainSubstring(expectedFlag))
+						} else {
+							Expect(args[5]).NotTo(ContainSubstring("port="))
+						}
+					},
+					Entry("a UNC path", `\\server\share\dir\`, "//server/share/dir", ""),
+					Entry("an smb URL", "smb://server/share/dir", "//server/share/dir", ""),
+					Entry("an smb URL with a port", "smb://server:1445/share", "//server/share", "port=1445"),
+					Entry("an IPv6 smb URL with a port", "smb://[fe80::1]:1445/share", "//fe80::1/share", "port=1445"),
+				)
+			})
+
+			Context("when a subpath is given", func() {
+				BeforeEach(func() {
+					opts["subpath"] = `apps\app1/`
+				})
+
+				It("should mount the folder within the share", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(args[2]).To(Equal("//server/source/apps/app1"))
+					Expect(args[3]).To(Equal("target"))
+				})
+
+				It("should not pass the subpath as a mount flag", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("subpath"))
+				})
+			})
+
+			Context("when configured without forceNoDfs", func() {
+				It("should not pass the nodfs mount flag", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("nodfs"))
+				})
+			})
+
+			Context("when configured with forceNoDfs", func() {
+				// The forceNoDfs option was added on 2024-01-09.
+				//
+				// We had seen a large deployment in which upgrading beyond jammy v1.199
+				// stemcells caused all apps using SMB mounts to fail with:
+				// "CIFS: VFS: cifs_mount failed w/return code = -19"
+				// errors. This turned out to be because the kernel had a regression around
+				// CIFS DFS handling.
+				//
+				// The fix was to re-bind the SMB service with the mount parameter
+				// "nodfs". This option was intended to allow the platform operator to
+				// apply that fix across the whole foundation, rather than relying on
+				// application authors to re-bind their SMB services.
+				It("should pass the nodfs mount flag", func() {
+					fakeInvoker = &invokerfakes.FakeInvoker{}
+					fakeInvoker.InvokeReturns(fakeInvokeResult)
+					configMask, err := smbdriver.NewSmbVolumeMountMask()
+					Expect(err).NotTo(HaveOccurred())
+
+					subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, true, smbdriver.WithHostResolver(hostResolver))
+					Expect(subject.Mount(env, "//server/source", "target", opts)).To(Succeed())
+
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("nodfs"))
+				})
+			})
+
+			Context("when configured without forceNoserverino", func() {
+				It("should not pass the noserverino mount flag", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("noserverino"))
+				})
+			})
+
+			Context("when configured with forceNoserverino", func() {
+				// The forceNoserverino option was added on 2023-04-15.
+				//
+				// We had seen a large deployment in which upgrading from xenial to jammy
+				// stemcells caused all apps using SMB mounts to fail with "Stale file handle"
+				// errors. This turned out to be because the SMB server was suggesting inode
+				// numbers, instead of allowing the client to generate temporary inode numbers.
+				//
+				// The fix was to re-bind the SMB service with the mount parameter
+				// "noserverino". This option was intended to allow the platform operator to
+				// apply that fix across the whole foundation, rather than relying on
+				// application authors to re-bind their SMB services.
+				It("should pass the noserverino mount flag", func() {
+					fakeInvoker = &invokerfakes.FakeInvoker{}
+					fakeInvoker.InvokeReturns(fakeInvokeResult)
+					configMask, err := smbdriver.NewSmbVolumeMountMask()
+					Expect(err).NotTo(HaveOccurred())
+
+					subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, true, false, smbdriver.WithHostResolver(hostResolver))
+					Expect(subject.Mount(env, "//server/source", "target", opts)).To(Succeed())
+
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("noserverino"))
+				})
+			})
+		})
+
+		Context("when configured with a security policy", func() {
+			BeforeEach(func() {
+				policy, err := smbdriver.NewSecurityPolicy(true, "3.0", []string{"server"})
+				Expect(err).NotTo(HaveOccurred())
+
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false, smbdriver.WithSecurityPolicy(policy), smbdriver.WithHostResolver(hostResolver))
+			})
+
+			Context("and the mount does not comply", func() {
+				It("should return a safe error without mounting", func() {
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError("mounts from server must use SMB version 3.0 or later, but the binding asks for version 2.0"))
+					Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+				})
+			})
+
+			Context("and the mount complies", func() {
+				BeforeEach(func() {
+					opts["version"] = "3.1.1"
+					opts["seal"] = true
+				})
+
+				It("should mount", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("seal"))
+					Expect(strings.Join(args, " ")).To(ContainSubstring("vers=3.1.1"))
+				})
+			})
+
+			Context("and the server is not covered by the policy", func() {
+				BeforeEach(func() {
+					source = "//other-server/source"
+				})
+
+				It("should mount", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+				})
+			})
+		})
+
+		Context("when mounting with multiuser", func() {
+			var invocations []string
+
+			BeforeEach(func() {
+				source = "//10.0.0.1/share"
+				opts["multiuser"] = true
+				invocations = []string{}
+
+				fakeInvoker.InvokeStub = func(_ dockerdriver.Env, executable string, args []string, envVars ...string) invoker.InvokeResult {
+					invocations = append(invocations, executable)
+					return fakeInvokeResult
+				}
+			})
+
+			It("should load the credentials into the keyring of the container user before mounting", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(invocations).To(Equal([]string{"setpriv", "mount"}))
+
+				_, _, args, envVars := fakeInvoker.InvokeArgsForCall(0)
+				Expect(args).To(ContainElements("--reuid=2000", "--regid=2000"))
+				Expect(strings.Join(args, " ")).To(ContainSubstring("keyctl padd logon"))
+				Expect(strings.Join(args, " ")).NotTo(ContainSubstring("bar"))
+				Expect(envVars).To(ContainElements("CIFS_USERNAME=foo", "CIFS_PASSWORD=bar", "CIFS_KEY=cifs:a:10.0.0.1"))
+			})
+
+			It("should mount with the multiuser flag and ntlmssp", func() {
+				_, _, args, _ := fakeInvoker.InvokeArgsForCall(1)
+				Expect(strings.Split(args[5], ",")).To(ContainElements("multiuser", "sec=ntlmssp"))
+			})
+
+			Context("and the binding sets sec", func() {
+				BeforeEach(func() {
+					opts["sec"] = "ntlmv2"
+				})
+
+				It("should keep it", func() {
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(1)
+					Expect(strings.Split(args[5], ",")).To(ContainElement("sec=ntlmv2"))
+				})
+			})
+
+			Context("and the volume is unmounted", func() {
+				JustBeforeEach(func() {
+					Expect(subject.Unmount(env, "target")).To(Succeed())
+				})
+
+				It("should remove the credentials from the keyring", func() {
+					Expect(invocations).To(Equal([]string{"setpriv", "mount", "umount", "setpriv"}))
+
+					_, _, args, envVars := fakeInvoker.InvokeArgsForCall(3)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("keyctl unlink"))
+					Expect(envVars).To(ContainElement("CIFS_KEY=cifs:a:10.0.0.1"))
+				})
+			})
+
+			Context("and the smbdriver restarts before the volume is unmounted", func() {
+				var (
+					stateFile  string
+					configMask vmo.MountOptsMask
+				)
+
+				BeforeEach(func() {
+					stateFile = filepath.Join(GinkgoT().TempDir(), "multiuser-keys.json")
+
+					configMask, err = smbdriver.NewSmbVolumeMountMask()
+					Expect(err).NotTo(HaveOccurred())
+					subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+						smbdriver.WithHostResolver(hostResolver), smbdriver.WithKeyringStateFile(stateFile))
+				})
+
+				JustBeforeEach(func() {
+					Expect(subject.Mount(env, source, "other-target", opts)).To(Succeed())
+
+					subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+						smbdriver.WithHostResolver(hostResolver), smbdriver.WithKeyringStateFile(stateFile))
+				})
+
+				It("should still remove the credentials once the last volume is unmounted", func() {
+					Expect(subject.Unmount(env, "target")).To(Succeed())
+					Expect(invocations).To(Equal([]string{"setpriv", "mount", "setpriv", "mount", "umount"}))
+
+					Expect(subject.Unmount(env, "other-target")).To(Succeed())
+					Expect(invocations).To(Equal([]string{"setpriv", "mount", "setpriv", "mount", "umount", "umount", "setpriv"}))
+
+					_, _, args, envVars := fakeInvoker.InvokeArgsForCall(6)
+					Expect(args).To(ContainElements("--reuid=2000", "--regid=2000"))
+					Expect(strings.Join(args, " ")).To(ContainSubstring("keyctl unlink"))
+					Expect(envVars).To(ContainElement("CIFS_KEY=cifs:a:10.0.0.1"))
+				})
+
+				It("should still refuse the credentials of another user", func() {
+					otherOpts := map[string]interface{}{"username": "other", "password": "secret", "multiuser": true}
+					Expect(subject.Mount(env, source, "third-target", otherOpts)).To(MatchError(ContainSubstring("credentials of another user are already loaded")))
+				})
+			})
+
+			Context("and another volume uses the same credentials", func() {
+				JustBeforeEach(func() {
+					Expect(subject.Mount(env, source, "other-target", opts)).To(Succeed())
+					Expect(subject.Unmount(env, "target")).To(Succeed())
+				})
+
+				It("should keep the credentials until the last volume is unmounted", func() {
+					Expect(invocations).To(Equal([]string{"setpriv", "mount", "setpriv", "mount", "umount"}))
+
+					Expect(subject.Unmount(env, "other-target")).To(Succeed())
+					Expect(invocations).To(Equal([]string{"setpriv", "mount", "setpriv", "mount", "umount", "umount", "setpriv"}))
+				})
+			})
+
+			Context("and another volume uses other credentials for the same server", func() {
+				It("should refuse to replace the credentials", func() {
+					otherOpts := map[string]interface{}{"username": "other", "password": "secret", "multiuser": true}
+					err := subject.Mount(env, source, "other-target", otherOpts)
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError("credentials of another user are already loaded for 10.0.0.1 and uid 2000 by a multiuser mount"))
+					Expect(invocations).To(Equal([]string{"setpriv", "mount"}))
+				})
+
+				It("should load them for the uid that the other binding gives", func() {
+					otherOpts := map[string]interface{}{"username": "other", "password": "secret", "multiuser": true, "uid": "3000"}
+					Expect(subject.Mount(env, source, "other-target", otherOpts)).To(Succeed())
+					Expect(invocations).To(Equal([]string{"setpriv", "mount", "setpriv", "mount"}))
+
+					_, _, args, envVars := fakeInvoker.InvokeArgsForCall(2)
+					Expect(args).To(ContainElements("--reuid=3000", "--regid=3000"))
+					Expect(envVars).To(ContainElements("CIFS_USERNAME=other", "CIFS_KEY=cifs:a:10.0.0.1"))
+
+					_, _, args, _ = fakeInvoker.InvokeArgsForCall(3)
+					Expect(strings.Split(args[5], ",")).To(ContainElements("uid=3000", "gid=2000"))
+					Expect(strings.Split(args[5], ",")).NotTo(ContainElement("uid=2000"))
+				})
+			})
+
+			Context("and the same volume is mounted again", func() {
+				JustBeforeEach(func() {
+					Expect(subject.Mount(env, source, "target", opts)).To(Succeed())
+					Expect(subject.Unmount(env, "target")).To(Succeed())
+				})
+
+				It("should count the volume once", func() {
+					Expect(invocations).To(Equal([]string{"setpriv", "mount", "setpriv", "mount", "umount", "setpriv"}))
+
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(5)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("keyctl unlink"))
+				})
+			})
+
+			Context("and the binding gives a uid that is not valid", func() {
+				BeforeEach(func() {
+					opts["uid"] = "root"
+				})
+
+				It("should return a safe error without mounting", func() {
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError("uid root is not a valid user id"))
+					Expect(invocations).To(BeEmpty())
+				})
+			})
+
+			Context("and the credentials cannot be loaded", func() {
+				BeforeEach(func() {
+					fakeInvoker.InvokeStub = func(_ dockerdriver.Env, executable string, args []string, envVars ...string) invoker.InvokeResult {
+						invocations = append(invocations, executable)
+						result := &invokerfakes.FakeInvokeResult{}
+						if executable == "setpriv" {
+							result.WaitReturns(fmt.Errorf("keyctl: command not found"))
+						}
+						return result
+					}
+				})
+
+				It("should return a safe error without mounting", func() {
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError("cannot load multiuser credentials into the keyring: keyctl: command not found"))
+					Expect(invocations).To(Equal([]string{"setpriv"}))
+				})
+			})
+
+			Context("and the mount fails", func() {
+				BeforeEach(func() {
+					fakeInvoker.InvokeStub = func(_ dockerdriver.Env, executable string, args []string, envVars ...string) invoker.InvokeResult {
+						invocations = append(invocations, executable)
+						result := &invokerfakes.FakeInvokeResult{}
+						if executable == "mount" {
+							result.WaitReturns(fmt.Errorf("mount error(13): Permission denied"))
+						}
+						return result
+					}
+				})
+
+				It("should remove the credentials again", func() {
+					Expect(err).To(HaveOccurred())
+					Expect(invocations).To(Equal([]string{"setpriv", "mount", "setpriv"}))
+				})
+			})
+		})
+
+		Context("when a uid is given without multiuser", func() {
+			BeforeEach(func() {
+				opts["uid"] = "3000"
+			})
+
+			It("should return a safe error without mounting", func() {
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				Expect(err).To(MatchError("uid can only be given with multiuser"))
+				Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when the snapshot is invalid", func() {
+			BeforeEach(func() {
+				opts["snapshot"] = "yesterday"
+			})
+
+			It("should return a safe error without mounting", func() {
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				Expect(err).To(MatchError(ContainSubstring("yesterday is not a valid snapshot")))
+				Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when the tuning options are invalid", func() {
+			BeforeEach(func() {
+				opts["rsize"] = "5000"
+			})
+
+			It("should return a safe error without mounting", func() {
+				Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+				Expect(err).To(MatchError(ContainSubstring("5000 is not a valid value for rsize")))
+				Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when both hard and soft are given", func() {
+			BeforeEach(func() {
+				opts["hard"] = true
+				opts["soft"] = true
+			})
+
+			It("should return a safe error without mounting", func() {
+				Expect(err).To(MatchError("hard and soft cannot be used together"))
+				Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when configured with tuning profiles", func() {
+			BeforeEach(func() {
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+
+				profiles := smbtuning.Profiles{"bulk-read": {"cache": "loose", "rsize": "4194304"}}
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false, smbdriver.WithTuningProfiles(profiles), smbdriver.WithHostResolver(hostResolver))
+			})
+
+			Context("and the binding refers to a profile", func() {
+				BeforeEach(func() {
+					opts["profile"] = "bulk-read"
+					opts["rsize"] = "65536"
+				})
+
+				It("should mount with the profile's options", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("cache=loose"))
+					Expect(strings.Join(args, " ")).To(ContainSubstring("rsize=65536"))
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("profile"))
+				})
+			})
+
+			Context("and the binding refers to an unknown profile", func() {
+				BeforeEach(func() {
+					opts["profile"] = "media"
+				})
+
+				It("should return a safe error without mounting", func() {
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError("tuning profile media is not defined, available profiles are: bulk-read"))
+					Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+				})
+			})
+		})
+
+		Context("when configured with personalities", func() {
+			var mountTargets *smbdriver.MountTargets
+
+			BeforeEach(func() {
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+
+				legacy, err := smbdriver.NewPersonality("smbdriver-legacy", smbdriver.PersonalityConfig{
+					ForceNoDfs:     true,
+					AllowedInMount: []string{"mfsymlinks", "vers", "version"},
+					DefaultInMount: map[string]string{"vers": "2.1"},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				mountTargets = smbdriver.NewMountTargets()
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+					smbdriver.WithHostResolver(hostResolver), smbdriver.WithMountTargets(mountTargets), smbdriver.WithPersonalities(legacy))
+			})
+
+			Context("and the volume is mounted through the default driver", func() {
+				It("should mount with the options of the mounter", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("vers=2.0"))
+					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("nodfs"))
+					Expect(mountTargets.Mounts(env)[0].Personality).To(Equal("smbdriver"))
+				})
+			})
+
+			Context("and the volume is mounted through a personality", func() {
+				BeforeEach(func() {
+					env = driverhttp.EnvWithContext(smbdriver.ContextWithPersonality(context.TODO(), "smbdriver-legacy"), env)
+					delete(opts, "version")
+				})
+
+				It("should mount with the options of the personality", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(strings.Join(args, " ")).To(ContainSubstring("vers=2.1"))
+					Expect(strings.Join(args, " ")).To(ContainSubstring(",nodfs"))
+					Expect(mountTargets.Mounts(env)[0].Personality).To(Equal("smbdriver-legacy"))
+				})
+
+				Context("and the binding sets an option the personality does not allow", func() {
+					BeforeEach(func() {
+						opts["seal"] = true
+					})
+
+					It("should return a safe error without mounting", func() {
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+						Expect(err.Error()).To(ContainSubstring("Not allowed options: seal"))
+						Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+					})
+				})
+			})
+		})
+
+		Context("when the source is malformed", func() {
+			BeforeEach(func() {
+				source = "server/share"
+			})
+
+			It("should return a safe error without mounting", func() {
+				Expect(err).To(HaveOccurred())
+				_, ok := err.(dockerdriver.SafeError)
+				Expect(ok).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring(`"server/share" is not a valid share`))
+				Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when the subpath escapes the share", func() {
+			BeforeEach(func() {
+				opts["subpath"] = "apps/../../other-share"
+			})
+
+			It("should return a safe error without mounting", func() {
+				Expect(err).To(HaveOccurred())
+				_, ok := err.(dockerdriver.SafeError)
+				Expect(ok).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("path traversal is not allowed"))
+				Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when alternate shares are given", func() {
+			var (
+				mountTargets *smbdriver.MountTargets
+				failing      map[string]bool
+			)
+
+			BeforeEach(func() {
+				opts["alternate_shares"] = "//replica/source,smb://backup:1445/source"
+				opts["subpath"] = "apps"
+
+				failing = map[string]bool{}
+				fakeInvoker.InvokeStub = func(_ dockerdriver.Env, executable string, args []string, envVars ...string) invoker.InvokeResult {
+					result := &invokerfakes.FakeInvokeResult{}
+					if executable == "mount" && failing[args[2]] {
+						result.WaitReturns(fmt.Errorf("exit status 32"))
+						result.StdErrorReturns("mount error(2): No such file or directory")
+					}
+					return result
+				}
+
+				mountTargets = smbdriver.NewMountTargets()
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+					smbdriver.WithHostResolver(hostResolver), smbdriver.WithMountTargets(mountTargets))
+			})
+
+			mountedSources := func() []string {
+				sources := []string{}
+				for i := 0; i < fakeInvoker.InvokeCallCount(); i++ {
+					_, executable, args, _ := fakeInvoker.InvokeArgsForCall(i)
+					if executable == "mount" {
+						sources = append(sources, args[2])
+					}
+				}
+				return sources
+			}
+
+			It("should mount the share and record it", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(mountedSources()).To(Equal([]string{"//server/source/apps"}))
+				Expect(mountTargets.Mounts(env)).To(Equal([]driveradmin.Mount{{
+					Target:      "target",
+					Source:      "//server/source/apps",
+					Sources:     []string{"//server/source/apps", "//replica/source/apps", "//backup:1445/source/apps"},
+					Share:       "//server/source/apps",
+					Personality: "smbdriver",
+					Mounter:     "kernel",
+				}}))
+			})
+
+			Context("and the share cannot be mounted", func() {
+				BeforeEach(func() {
+					failing["//server/source/apps"] = true
+					failing["//replica/source/apps"] = true
+				})
+
+				It("should mount the alternates in order", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(mountedSources()).To(Equal([]string{"//server/source/apps", "//replica/source/apps", "//backup/source/apps"}))
+
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(2)
+					Expect(strings.Split(args[5], ",")).To(ContainElement("port=1445"))
+					Expect(mountTargets.Mounts(env)[0].Source).To(Equal("//backup:1445/source/apps"))
+				})
+
+				It("should try the alternate that mounted first the next time", func() {
+					Expect(subject.Unmount(env, "target")).To(Succeed())
+					Expect(mountTargets.Mounts(env)).To(BeEmpty())
+
+					Expect(subject.Mount(env, source, "target", opts)).To(Succeed())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(4)
+					Expect(args[2]).To(Equal("//backup/source/apps"))
+				})
+
+				Context("and the smbdriver restarts", func() {
+					var (
+						stateFile  string
+						configMask vmo.MountOptsMask
+					)
+
+					BeforeEach(func() {
+						stateFile = filepath.Join(GinkgoT().TempDir(), "mount-targets.json")
+						mountTargets = smbdriver.RestoreMountTargets(logger, stateFile)
+
+						configMask, err = smbdriver.NewSmbVolumeMountMask()
+						Expect(err).NotTo(HaveOccurred())
+						subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+							smbdriver.WithHostResolver(hostResolver), smbdriver.WithMountTargets(mountTargets))
+					})
+
+					It("should restore the mounted shares and the alternate that mounted", func() {
+						Expect(err).NotTo(HaveOccurred())
+
+						restored := smbdriver.RestoreMountTargets(logger, stateFile)
+						Expect(restored.Mounts(env)).To(Equal(mountTargets.Mounts(env)))
+						Expect(restored.Mounts(env)[0].Source).To(Equal("//backup:1445/source/apps"))
+
+						subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+							smbdriver.WithHostResolver(hostResolver), smbdriver.WithMountTargets(restored))
+						Expect(subject.Mount(env, source, "other-target", opts)).To(Succeed())
+						_, _, args, _ := fakeInvoker.InvokeArgsForCall(3)
+						Expect(args[2]).To(Equal("//backup/source/apps"))
+
+						Expect(subject.Unmount(env, "target")).To(Succeed())
+						Expect(smbdriver.RestoreMountTargets(logger, stateFile).Mounts(env)).To(ConsistOf(
+							HaveField("Target", "other-target"),
+						))
+					})
+				})
+
+				Context("and none of the alternates can be mounted", func() {
+					BeforeEach(func() {
+						failing["//backup/source/apps"] = true
+					})
+
+					It("should return a safe error", func() {
+						Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+						Expect(err).To(MatchError("exit status 32"))
+						Expect(mountTargets.Mounts(env)).To(BeEmpty())
+					})
+				})
+			})
+
+			Context("and an alternate share is invalid", func() {
+				BeforeEach(func() {
+					opts["alternate_shares"] = "replica/source"
+				})
+
+				It("should return a safe error without mounting", func() {
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError(ContainSubstring(`"replica/source" is not a valid share`)))
+					Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+				})
+			})
+		})
+
+		Context("when configured to resolve DFS referrals", func() {
+			var (
+				referral     smbdfs.Referral
+				referralErr  error
+				requests     []string
+				credentials  smb2.Credentials
+				failing      map[string]bool
+				mountTargets *smbdriver.MountTargets
+			)
+
+			BeforeEach(func() {
+				opts["domain"] = "CORP"
+
+				referral = smbdfs.Referral{
+					PathConsumed: 28,
+					Entries: []smbdfs.ReferralEntry{
+						{TTL: time.Minute, Path: `\server\source`, Target: `\fs1\data`},
+						{TTL: time.Minute, Path: `\server\source`, Target: `\fs2\data\copy`},
+					},
+				}
+				referralErr = nil
+				requests = nil
+
+				failing = map[string]bool{}
+				fakeInvoker.InvokeStub = func(_ dockerdriver.Env, executable string, args []string, envVars ...string) invoker.InvokeResult {
+					result := &invokerfakes.FakeInvokeResult{}
+					if executable == "mount" && failing[args[2]] {
+						result.WaitReturns(fmt.Errorf("exit status 32"))
+					}
+					return result
+				}
+
+				dfsResolver := smbdfs.NewResolver(func(_ context.Context, address, server string, c smb2.Credentials, path string) (smbdfs.Referral, error) {
+					requests = append(requests, address+" "+path)
+					credentials = c
+					return referral, referralErr
+				}, time.Second, fakeclock.NewFakeClock(time.Now()))
+
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+				mountTargets = smbdriver.NewMountTargets()
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+					smbdriver.WithHostResolver(hostResolver), smbdriver.WithDfsResolver(dfsResolver), smbdriver.WithMountTargets(mountTargets))
+			})
+
+			It("should mount the first DFS target with nodfs", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(requests).To(Equal([]string{`server:445 \server\source`}))
+				Expect(credentials).To(Equal(smb2.Credentials{Domain: "CORP", Username: "foo", Password: "bar"}))
+
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+				_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+				Expect(args[2]).To(Equal("//fs1/data"))
+				Expect(strings.Split(args[5], ",")).To(ContainElement("nodfs"))
+			})
+
+			It("should record the DFS target as the mounted share", func() {
+				mounts := mountTargets.Mounts(env)
+				Expect(mounts).To(HaveLen(1))
+				Expect(mounts[0].Source).To(Equal("//server/source"))
+				Expect(mounts[0].Share).To(Equal("//fs1/data"))
+			})
+
+			Context("and the first DFS target cannot be mounted", func() {
+				BeforeEach(func() {
+					failing["//fs1/data"] = true
+				})
+
+				It("should fall back to the next target", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(2))
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(1)
+					Expect(args[2]).To(Equal("//fs2/data/copy"))
+					Expect(logger.Buffer()).To(gbytes.Say("mount-dfs-target-failed"))
+				})
+			})
+
+			Context("and the share is not a DFS path", func() {
+				BeforeEach(func() {
+					referralErr = smbdfs.ErrNotDFS
+				})
+
+				It("should mount the share without nodfs", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(args[2]).To(Equal("//server/source"))
+					Expect(strings.Split(args[5], ",")).NotTo(ContainElement("nodfs"))
+				})
+			})
+
+			Context("and the referral cannot be obtained", func() {
+				BeforeEach(func() {
+					referralErr = fmt.Errorf("connection refused")
+				})
+
+				It("should leave the referrals to the kernel", func() {
+					Expect(err).NotTo(HaveOccurred())
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+					Expect(args[2]).To(Equal("//server/source"))
+					Expect(logger.Buffer()).To(gbytes.Say("error-resolve-dfs"))
+				})
+			})
+
+			Context("and the binding has no credentials", func() {
+				BeforeEach(func() {
+					delete(opts, "username")
+					delete(opts, "password")
+				})
+
+				It("should not ask for a referral", func() {
+					Expect(requests).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when the server is resolved", func() {
+			It("should mount the resolved address", func() {
+				Expect(err).NotTo(HaveOccurred())
+				_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
+				Expect(args[2]).To(Equal("//server/source"))
+				Expect(strings.Split(args[5], ",")).To(ContainElement("ip=10.0.0.10"))
+			})
+
+			Context("and the server cannot be resolved", func() {
+				BeforeEach(func() {
+					lookupErr = fmt.Errorf("no such host")
+				})
+
+				It("should return a safe error without mounting", func() {
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError("cannot resolve server: no such host"))
+					Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+				})
+			})
+
+			Context("and the server has several addresses", func() {
+				var unreachable *invokerfakes.FakeInvokeResult
+
+				BeforeEach(func() {
+					lookupAddrs = []net.IPAddr{{IP: net.ParseIP("10.0.0.10")}, {IP: net.ParseIP("fd00::10")}}
+
+					unreachable = &invokerfakes.FakeInvokeResult{}
+					unreachable.WaitReturns(fmt.Errorf("exit status 32"))
+					unreachable.StdErrorReturns("mount error(113): could not connect to 10.0.0.10")
+					fakeInvoker.InvokeReturnsOnCall(0, unreachable)
+				})
 
-					It("should include the mfsymlinks flag", func() {
-						Expect(err).NotTo(HaveOccurred())
-						_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
-						Expect(strings.Join(args, " ")).To(ContainSubstring("mfsymlinks"))
-						Expect(strings.Join(args, " ")).NotTo(ContainSubstring("mfsymlinks=true"))
-					})
+				It("should fall back to the next address when the first one is unreachable", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(2))
+					_, _, args, _ := fakeInvoker.InvokeArgsForCall(1)
+					Expect(strings.Split(args[5], ",")).To(ContainElement("ip=fd00::10"))
 				})
 
-				Context("and mfsymlinks is false", func() {
+				Context("and the first mount fails for another reason", func() {
 					BeforeEach(func() {
-						opts["mfsymlinks"] = false
+						unreachable.StdErrorReturns("mount error(13): Permission denied")
 					})
 
-					It("should not include the mfsymlinks flag", func() {
-						Expect(err).NotTo(HaveOccurred())
-						_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
-						Expect(strings.Join(args, " ")).NotTo(ContainSubstring("mfsymlinks"))
+					It("should not try the other addresses", func() {
+						Expect(err).To(MatchError("exit status 32"))
+						Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
 					})
 				})
+			})
+		})
+
+		Context("when configured with a preflight check", func() {
+			type probe struct {
+				address     string
+				server      string
+				share       string
+				credentials smb2.Credentials
+				options     int
+			}
+
+			var (
+				probes    []probe
+				probeErrs []error
+			)
 
+			BeforeEach(func() {
+				opts["domain"] = "CORP"
+				probes = nil
+				probeErrs = nil
+
+				checker := smbpreflight.NewChecker(func(_ context.Context, address, server, share string, credentials smb2.Credentials, options ...smb2.DialOption) (uint16, error) {
+					probes = append(probes, probe{address: address, server: server, share: share, credentials: credentials, options: len(options)})
+					if len(probeErrs) >= len(probes) && probeErrs[len(probes)-1] != nil {
+						return 0, probeErrs[len(probes)-1]
+					}
+					return smb2.Dialect202, nil
+				}, time.Second)
+
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+					smbdriver.WithHostResolver(hostResolver), smbdriver.WithPreflight(checker))
 			})
 
-			Context("when configured without forceNoDfs", func() {
-				It("should not pass the nodfs mount flag", func() {
-					Expect(err).NotTo(HaveOccurred())
-					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
-					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("nodfs"))
+			It("should connect to the share before mounting it", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(probes).To(Equal([]probe{{
+					address:     "10.0.0.10:445",
+					server:      "server",
+					share:       "source",
+					credentials: smb2.Credentials{Domain: "CORP", Username: "foo", Password: "bar"},
+					options:     1,
+				}}))
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+				Expect(logger.Buffer()).To(gbytes.Say(`preflight-succeeded.*"dialect":"2.0.2"`))
+			})
+
+			Context("and the credentials are rejected", func() {
+				BeforeEach(func() {
+					probeErrs = []error{&smbpreflight.Error{
+						Stage:  smbpreflight.StageSessionSetup,
+						Server: "server",
+						Err:    &smb2.StatusError{Command: 0x0001, Status: smb2.StatusLogonFailure},
+					}}
+				})
+
+				It("should fail with the stage that failed without mounting", func() {
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError("SMB server server rejected the credentials: the username or password is wrong (status 0xc000006d)"))
+					Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+					Expect(logger.Buffer()).To(gbytes.Say(`preflight-failed.*"stage":"session-setup"`))
 				})
 			})
 
-			Context("when configured with forceNoDfs", func() {
-				// The forceNoDfs option was added on 2024-01-09.
-				//
-				// We had seen a large deployment in which upgrading beyond jammy v1.199
-				// stemcells caused all apps using SMB mounts to fail with:
-				// "CIFS: VFS: cifs_mount failed w/return code = -19"
-				// errors. This turned out to be because the kernel had a regression around
-				// CIFS DFS handling.
-				//
-				// The fix was to re-bind the SMB service with the mount parameter
-				// "nodfs". This option was intended to allow the platform operator to
-				// apply that fix across the whole foundation, rather than relying on
-				// application authors to re-bind their SMB services.
-				It("should pass the nodfs mount flag", func() {
-					fakeInvoker = &invokerfakes.FakeInvoker{}
-					fakeInvoker.InvokeReturns(fakeInvokeResult)
-					configMask, err := smbdriver.NewSmbVolumeMountMask()
+			Context("and the server does not negotiate a dialect that the check supports", func() {
+				BeforeEach(func() {
+					probeErrs = []error{&smbpreflight.Error{
+						Stage:  smbpreflight.StageNegotiate,
+						Server: "server",
+						Err:    &smb2.StatusError{Command: 0x0000, Status: smb2.StatusNotSupported},
+					}}
+				})
+
+				It("should leave the server to mount.cifs, which may negotiate SMB 3.1.1", func() {
 					Expect(err).NotTo(HaveOccurred())
+					Expect(probes).To(HaveLen(1))
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+					Expect(logger.Buffer()).To(gbytes.Say(`preflight-inconclusive.*"stage":"negotiate"`))
+				})
+			})
 
-					subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, true)
-					Expect(subject.Mount(env, "source", "target", opts)).To(Succeed())
+			Context("and the server has several addresses", func() {
+				BeforeEach(func() {
+					lookupAddrs = []net.IPAddr{{IP: net.ParseIP("10.0.0.10")}, {IP: net.ParseIP("10.0.0.11")}}
+					probeErrs = []error{&smbpreflight.Error{
+						Stage:   smbpreflight.StageConnect,
+						Server:  "server",
+						Address: "10.0.0.10:445",
+						Err:     fmt.Errorf("connection refused"),
+					}}
+				})
 
+				It("should fall back to the next address when the first one is unreachable", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(probes).To(HaveLen(2))
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
 					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
-					Expect(strings.Join(args, " ")).To(ContainSubstring("nodfs"))
+					Expect(strings.Split(args[5], ",")).To(ContainElement("ip=10.0.0.11"))
 				})
 			})
 
-			Context("when configured without forceNoserverino", func() {
-				It("should not pass the noserverino mount flag", func() {
+			Context("and the binding uses an option that the check cannot honour", func() {
+				BeforeEach(func() {
+					opts["seal"] = true
+				})
+
+				It("should mount without checking", func() {
 					Expect(err).NotTo(HaveOccurred())
-					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
-					Expect(strings.Join(args, " ")).NotTo(ContainSubstring("noserverino"))
+					Expect(probes).To(BeEmpty())
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
 				})
 			})
+		})
 
-			Context("when configured with forceNoserverino", func() {
-				// The forceNoserverino option was added on 2023-04-15.
-				//
-				// We had seen a large deployment in which upgrading from xenial to jammy
-				// stemcells caused all apps using SMB mounts to fail with "Stale file handle"
-				// errors. This turned out to be because the SMB server was suggesting inode
-				// numbers, instead of allowing the client to generate temporary inode numbers.
-				//
-				// The fix was to re-bind the SMB service with the mount parameter
-				// "noserverino". This option was intended to allow the platform operator to
-				// apply that fix across the whole foundation, rather than relying on
-				// application authors to re-bind their SMB services.
-				It("should pass the noserverino mount flag", func() {
-					fakeInvoker = &invokerfakes.FakeInvoker{}
-					fakeInvoker.InvokeReturns(fakeInvokeResult)
-					configMask, err := smbdriver.NewSmbVolumeMountMask()
-					Expect(err).NotTo(HaveOccurred())
+		Context("when configured with a circuit breaker", func() {
+			var (
+				clock   *fakeclock.FakeClock
+				breaker *smbdriver.CircuitBreaker
+			)
+
+			BeforeEach(func() {
+				fakeInvokeResult.WaitReturns(fmt.Errorf("exit status 32"))
+				fakeInvokeResult.StdErrorReturns("mount error(113): could not connect to 10.0.0.10")
 
-					subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, true, false)
-					Expect(subject.Mount(env, "source", "target", opts)).To(Succeed())
+				clock = fakeclock.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+				breaker = smbdriver.NewCircuitBreaker(2, 30*time.Second, clock)
 
-					_, _, args, _ := fakeInvoker.InvokeArgsForCall(0)
-					Expect(strings.Join(args, " ")).To(ContainSubstring("noserverino"))
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+					smbdriver.WithHostResolver(hostResolver), smbdriver.WithCircuitBreaker(breaker))
+			})
+
+			It("should count the connection failures", func() {
+				Expect(err).To(MatchError("exit status 32"))
+				Expect(breaker.CircuitBreakers(env)).To(Equal([]driveradmin.CircuitBreaker{
+					{Server: "server", State: "closed", ConsecutiveFailures: 1},
+				}))
+			})
+
+			Context("and the server fails too often", func() {
+				JustBeforeEach(func() {
+					Expect(subject.Mount(env, source, "target", opts)).To(MatchError("exit status 32"))
+					Expect(logger.Buffer()).To(gbytes.Say("circuit-breaker-opened"))
+
+					err = subject.Mount(env, source, "target", opts)
+				})
+
+				It("should fail the mounts immediately with a safe error", func() {
+					Expect(err).To(BeAssignableToTypeOf(dockerdriver.SafeError{}))
+					Expect(err).To(MatchError("the SMB server server is unavailable after 2 consecutive connection failures, mounts will be retried after 2024-03-01T12:00:30Z"))
+					Expect(fakeInvoker.InvokeCallCount()).To(Equal(2))
+					Expect(breaker.CircuitBreakers(env)).To(Equal([]driveradmin.CircuitBreaker{
+						{Server: "server", State: "open", ConsecutiveFailures: 2, OpenUntil: clock.Now().Add(30 * time.Second)},
+					}))
+				})
+
+				Context("and the cool-down has passed", func() {
+					JustBeforeEach(func() {
+						clock.Increment(30 * time.Second)
+						Expect(breaker.CircuitBreakers(env)[0].State).To(Equal("half-open"))
+					})
+
+					It("should close the circuit when a probe mount succeeds", func() {
+						fakeInvokeResult.WaitReturns(nil)
+
+						Expect(subject.Mount(env, source, "target", opts)).To(Succeed())
+						Expect(fakeInvoker.InvokeCallCount()).To(Equal(3))
+						Expect(breaker.CircuitBreakers(env)).To(BeEmpty())
+					})
+
+					It("should open the circuit again when a probe mount fails", func() {
+						Expect(subject.Mount(env, source, "target", opts)).To(MatchError("exit status 32"))
+						Expect(fakeInvoker.InvokeCallCount()).To(Equal(3))
+
+						err = subject.Mount(env, source, "target", opts)
+						Expect(err).To(MatchError(ContainSubstring("after 3 consecutive connection failures")))
+						Expect(fakeInvoker.InvokeCallCount()).To(Equal(3))
+					})
+
+					It("should only let one probe mount through at a time", func() {
+						probing := make(chan struct{})
+						release := make(chan struct{})
+						fakeInvokeResult.WaitStub = func() error {
+							close(probing)
+							<-release
+							return nil
+						}
+
+						done := make(chan error)
+						go func() { done <- subject.Mount(env, source, "target", opts) }()
+						Eventually(probing).Should(BeClosed())
+
+						Expect(subject.Mount(env, source, "other-target", opts)).To(MatchError(ContainSubstring("a probe mount is in progress")))
+
+						close(release)
+						Eventually(done).Should(Receive(BeNil()))
+					})
+				})
+
+				Context("and another server is mounted", func() {
+					It("should not affect it", func() {
+						fakeInvokeResult.WaitReturns(nil)
+						Expect(subject.Mount(env, "//other/source", "target", opts)).To(Succeed())
+					})
+				})
+			})
+
+			Context("and the server answers with another error", func() {
+				BeforeEach(func() {
+					fakeInvokeResult.StdErrorReturns("mount error(13): Permission denied")
+				})
+
+				It("should not count it", func() {
+					Expect(err).To(MatchError("exit status 32"))
+					Expect(subject.Mount(env, source, "target", opts)).To(MatchError("exit status 32"))
+					Expect(breaker.CircuitBreakers(env)).To(BeEmpty())
 				})
 			})
 		})
@@ -267,6 +1378,85 @@ var _ = Describe("SmbMounter", func() {
 			})
 		})
 
+		Context("when mount.cifs fails", func() {
+			var (
+				kernelLog     *smbdriverfakes.FakeKernelLog
+				kernelLogErr  error
+				kernelLogOpen int
+			)
+
+			BeforeEach(func() {
+				fakeInvokeResult.WaitReturns(fmt.Errorf("exit status 32"))
+				fakeInvokeResult.StdOutputReturns("mount.cifs kernel mount options: ip=10.0.0.10,unc=\\\\server\\source,vers=2.0,user=foo,pass=********")
+				fakeInvokeResult.StdErrorReturns("mount error(13): Permission denied\nRefer to the mount.cifs(8) manual page (e.g. man mount.cifs)")
+
+				kernelLog = &smbdriverfakes.FakeKernelLog{}
+				kernelLog.MessagesReturns([]string{
+					"CIFS: Attempting to mount \\\\server\\source",
+					"eth0: link up",
+					"CIFS: Status code returned 0xc000006d STATUS_LOGON_FAILURE",
+					"CIFS: VFS: \\\\server Send error in SessSetup = -13 for password bar",
+				}, nil)
+				kernelLogErr = nil
+				kernelLogOpen = 0
+
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+					smbdriver.WithHostResolver(hostResolver),
+					smbdriver.WithKernelLog(func() (smbdriver.KernelLog, error) {
+						kernelLogOpen++
+						return kernelLog, kernelLogErr
+					}))
+			})
+
+			It("should log the redacted output, the kernel CIFS messages and the likely cause", func() {
+				Expect(err).To(MatchError("exit status 32"))
+				Expect(kernelLogOpen).To(Equal(1))
+				Expect(kernelLog.CloseCallCount()).To(Equal(1))
+
+				Expect(logger.Buffer()).To(gbytes.Say(`mount-failed`))
+				Expect(logger.Buffer()).To(gbytes.Say(`"cause":"the server rejected the username or password"`))
+				Expect(logger.Buffer()).To(gbytes.Say(`"kernel-messages":\["CIFS: Attempting to mount \\\\\\\\server\\\\source","CIFS: Status code returned 0xc000006d STATUS_LOGON_FAILURE","CIFS: VFS: \\\\\\\\server Send error in SessSetup = -13 for password \*REDACTED\*"\]`))
+				Expect(logger.Buffer()).To(gbytes.Say(`"stderr":"mount error\(13\): Permission denied`))
+				Expect(logger.Buffer()).To(gbytes.Say(`"stdout":"mount.cifs kernel mount options: .*,user=\*REDACTED\*,pass=\*REDACTED\*"`))
+			})
+
+			Context("and the kernel log has nothing to add", func() {
+				BeforeEach(func() {
+					kernelLog.MessagesReturns([]string{}, nil)
+				})
+
+				It("should look up the cause of the mount.cifs error", func() {
+					Expect(logger.Buffer()).To(gbytes.Say(`mount-failed.*"cause":"the server denied access: check the username, password and domain, and the permissions on the share"`))
+				})
+			})
+
+			Context("and the kernel log cannot be opened", func() {
+				BeforeEach(func() {
+					kernelLogErr = fmt.Errorf("permission denied")
+				})
+
+				It("should still log the output of mount.cifs", func() {
+					Expect(err).To(MatchError("exit status 32"))
+					Expect(logger.Buffer()).To(gbytes.Say(`mount-failed.*"kernel-messages":\[\]`))
+				})
+			})
+
+			Context("and the mount succeeds", func() {
+				BeforeEach(func() {
+					fakeInvokeResult.WaitReturns(nil)
+				})
+
+				It("should close the kernel log without reading it", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(kernelLog.MessagesCallCount()).To(Equal(0))
+					Expect(kernelLog.CloseCallCount()).To(Equal(1))
+					Expect(logger.Buffer()).NotTo(gbytes.Say(`mount-failed`))
+				})
+			})
+		})
+
 		Context("when error occurs", func() {
 			BeforeEach(func() {
 				opts = map[string]interface{}{}
@@ -286,7 +1476,7 @@ var _ = Describe("SmbMounter", func() {
 				)
 				Expect(err2).NotTo(HaveOccurred())
 
-				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false)
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false, smbdriver.WithHostResolver(hostResolver))
 			})
 
 			Context("when a required option is missing", func() {
@@ -327,6 +1517,83 @@ var _ = Describe("SmbMounter", func() {
 			})
 		})
 
+		Context("when configured with a tracer", func() {
+			var (
+				spanRecorder *recorder.ReporterRecorder
+				parent       zipkin.Span
+			)
+
+			spanNames := func(spans []model.SpanModel) []string {
+				names := []string{}
+				for _, span := range spans {
+					names = append(names, span.Name)
+				}
+				return names
+			}
+
+			BeforeEach(func() {
+				spanRecorder = recorder.NewReporter()
+				tracer, err := smbtrace.NewTracerWithReporter(spanRecorder, 1)
+				Expect(err).NotTo(HaveOccurred())
+
+				parent = tracer.StartSpan("VolumeDriver.Mount")
+				env = driverhttp.NewHttpDriverEnv(logger, zipkin.NewContext(testContext, parent))
+
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false,
+					smbdriver.WithHostResolver(hostResolver), smbdriver.WithTracer(tracer))
+			})
+
+			It("should record the steps of the mount in the trace of the request", func() {
+				Expect(err).NotTo(HaveOccurred())
+
+				spans := spanRecorder.Flush()
+				Expect(spanNames(spans)).To(Equal([]string{"validate-options", "security-policy", "resolve-host", "mount.cifs"}))
+				for _, span := range spans {
+					Expect(span.TraceID).To(Equal(parent.Context().TraceID))
+					Expect(*span.ParentID).To(Equal(parent.Context().ID))
+				}
+				Expect(spans[3].Tags).To(Equal(map[string]string{"share": "//server/source", "address": "10.0.0.10"}))
+			})
+
+			It("should pass the span of the mount to mount.cifs", func() {
+				invokeEnv, _, _, _ := fakeInvoker.InvokeArgsForCall(0)
+				span := zipkin.SpanFromContext(invokeEnv.Context())
+				Expect(span).NotTo(BeNil())
+				Expect(*span.Context().ParentID).To(Equal(parent.Context().ID))
+			})
+
+			Context("and the mount fails", func() {
+				BeforeEach(func() {
+					fakeInvokeResult.WaitReturns(fmt.Errorf("exit status 32"))
+				})
+
+				It("should tag the span of mount.cifs with the error", func() {
+					Expect(err).To(HaveOccurred())
+
+					spans := spanRecorder.Flush()
+					Expect(spans[len(spans)-1].Name).To(Equal("mount.cifs"))
+					Expect(spans[len(spans)-1].Tags).To(HaveKeyWithValue("error", "exit status 32"))
+				})
+			})
+
+			Context("and the options are invalid", func() {
+				BeforeEach(func() {
+					opts["hard"] = true
+					opts["soft"] = true
+				})
+
+				It("should only record the validation", func() {
+					Expect(err).To(HaveOccurred())
+
+					spans := spanRecorder.Flush()
+					Expect(spanNames(spans)).To(Equal([]string{"validate-options"}))
+					Expect(spans[0].Tags).To(HaveKey("error"))
+				})
+			})
+		})
+
 		Context("when mandatory password argument is not provided", func() {
 			BeforeEach(func() {
 				opts["username"] = ""
@@ -398,6 +1665,31 @@ var _ = Describe("SmbMounter", func() {
 			})
 		})
 
+		Context("when configured with a tracer", func() {
+			var spanRecorder *recorder.ReporterRecorder
+
+			BeforeEach(func() {
+				spanRecorder = recorder.NewReporter()
+				tracer, err := smbtrace.NewTracerWithReporter(spanRecorder, 1)
+				Expect(err).NotTo(HaveOccurred())
+
+				configMask, err := smbdriver.NewSmbVolumeMountMask()
+				Expect(err).NotTo(HaveOccurred())
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, configMask, false, false, smbdriver.WithTracer(tracer))
+
+				success = subject.Check(env, "target", "source")
+			})
+
+			It("records the check", func() {
+				Expect(success).To(BeTrue())
+
+				spans := spanRecorder.Flush()
+				Expect(spans).To(HaveLen(1))
+				Expect(spans[0].Name).To(Equal("check"))
+				Expect(spans[0].Tags).To(Equal(map[string]string{"volume": "target"}))
+			})
+		})
+
 		Context("when check cmd fails", func() {
 			BeforeEach(func() {
 				fakeInvokeResult.WaitReturns(fmt.Errorf("mountpoint cmd error"))
@@ -505,4 +1797,135 @@ var _ = Describe("SmbMounter", func() {
 			})
 		})
 	})
+
+	Context("when configured for a dry run", func() {
+		var (
+			mountTargets *smbdriver.MountTargets
+			mountDir     string
+		)
+
+		BeforeEach(func() {
+			mountTargets = smbdriver.NewMountTargets()
+			mountDir = GinkgoT().TempDir()
+
+			configMask, err := smbdriver.NewSmbVolumeMountMask()
+			Expect(err).NotTo(HaveOccurred())
+			subject = smbdriver.NewSmbMounter(fakeInvoker, &osshim.OsShim{}, configMask, false, true,
+				smbdriver.WithHostResolver(hostResolver), smbdriver.WithMountTargets(mountTargets), smbdriver.WithDryRun())
+		})
+
+		Context("#Mount", func() {
+			var target string
+
+			JustBeforeEach(func() {
+				target = filepath.Join(mountDir, "volume")
+				err = subject.Mount(env, source, target, opts)
+			})
+
+			It("should record the mount command instead of running it", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+				Expect(target).To(BeADirectory())
+
+				mounts := mountTargets.Mounts(env)
+				Expect(mounts).To(HaveLen(1))
+				Expect(mounts[0].Source).To(Equal("//server/source"))
+				Expect(mounts[0].DryRun).NotTo(BeNil())
+
+				args := mounts[0].DryRun.Args
+				Expect(args[:5]).To(Equal([]string{"mount", "-t", "cifs", "//server/source", target}))
+				Expect(strings.Split(args[6], ",")).To(ContainElements("nodfs", "uid=2000", "ip=10.0.0.10"))
+				Expect(mounts[0].DryRun.EnvVars).To(ConsistOf("USER", "PASSWD"))
+
+				Expect(logger.Buffer()).To(gbytes.Say(`dry-run-mount.*"env-vars":\[`))
+				Expect(string(logger.Buffer().Contents())).NotTo(ContainSubstring(`PASSWD=bar`))
+			})
+
+			Context("and preflight checks and multiuser mounts are configured", func() {
+				var probes int
+
+				BeforeEach(func() {
+					probes = 0
+					checker := smbpreflight.NewChecker(func(context.Context, string, string, string, smb2.Credentials, ...smb2.DialOption) (uint16, error) {
+						probes++
+						return smb2.Dialect202, nil
+					}, time.Second)
+
+					configMask, err := smbdriver.NewSmbVolumeMountMask()
+					Expect(err).NotTo(HaveOccurred())
+					subject = smbdriver.NewSmbMounter(fakeInvoker, &osshim.OsShim{}, configMask, false, true,
+						smbdriver.WithHostResolver(hostResolver), smbdriver.WithMountTargets(mountTargets), smbdriver.WithDryRun(),
+						smbdriver.WithPreflight(checker))
+
+					opts["multiuser"] = true
+				})
+
+				It("should neither connect to the server nor load the keyring", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(probes).To(BeZero())
+					Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+					Expect(mountTargets.Mounts(env)[0].DryRun.Args[6]).To(ContainSubstring("multiuser"))
+				})
+			})
+
+			Context("and the mount fails validation", func() {
+				BeforeEach(func() {
+					opts["posix"] = true
+				})
+
+				It("should fail as it would without a dry run", func() {
+					Expect(err).To(MatchError("posix requires vers=3.1.1"))
+					Expect(target).NotTo(BeADirectory())
+					Expect(mountTargets.Mounts(env)).To(BeEmpty())
+				})
+			})
+
+			Context("and the volume is checked and unmounted", func() {
+				It("should report it as mounted until it is unmounted", func() {
+					Expect(subject.Check(env, "volume", target)).To(BeTrue())
+
+					Expect(subject.Unmount(env, target)).To(Succeed())
+					Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+					Expect(mountTargets.Mounts(env)).To(BeEmpty())
+
+					Expect(os.Remove(target)).To(Succeed())
+					Expect(subject.Check(env, "volume", target)).To(BeFalse())
+				})
+			})
+
+			Context("and the mount directory is purged", func() {
+				It("should remove the mountpoint without running umount", func() {
+					subject.Purge(env, mountDir)
+					Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+					Expect(target).NotTo(BeADirectory())
+				})
+			})
+		})
+
+		Context("through the volume driver", func() {
+			var driver *volumedriver.VolumeDriver
+
+			BeforeEach(func() {
+				checker := smbdriver.NewDryRunMountChecker(mountchecker.NewChecker(&bufioshim.BufioShim{}, &osshim.OsShim{}), mountTargets)
+				driver = volumedriver.NewVolumeDriver(logger, &osshim.OsShim{}, &filepathshim.FilepathShim{}, &timeshim.TimeShim{}, checker, mountDir, subject, oshelper.NewOsHelper())
+
+				Expect(driver.Create(env, dockerdriver.CreateRequest{Name: "volume", Opts: map[string]interface{}{"source": source, "username": "foo", "password": "bar"}}).Err).To(BeEmpty())
+			})
+
+			It("should unmount the volume through the mounter", func() {
+				target := filepath.Join(mountDir, "volume")
+
+				mountResponse := driver.Mount(env, dockerdriver.MountRequest{Name: "volume"})
+				Expect(mountResponse.Err).To(BeEmpty())
+				Expect(mountResponse.Mountpoint).To(Equal(target))
+				Expect(mountTargets.Mounts(env)).To(HaveLen(1))
+
+				Expect(driver.Unmount(env, dockerdriver.UnmountRequest{Name: "volume"}).Err).To(BeEmpty())
+				Expect(logger.Buffer()).To(gbytes.Say("dry-run-unmount"))
+				Expect(fakeInvoker.InvokeCallCount()).To(BeZero())
+				Expect(mountTargets.Mounts(env)).To(BeEmpty())
+				Expect(target).NotTo(BeADirectory())
+			})
+		})
+	})
 })
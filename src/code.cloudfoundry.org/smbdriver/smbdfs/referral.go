@@ -0,0 +1,181 @@
+// Package smbdfs resolves DFS paths to the shares that hold them by asking
+// the servers for DFS referrals (MS-DFSC), so that the targets can be
+// mounted directly with "nodfs".
+package smbdfs
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf16"
+
+	"code.cloudfoundry.org/smbdriver/smb2"
+)
+
+const (
+	// getReferralsCtlCode is FSCTL_DFS_GET_REFERRALS.
+	getReferralsCtlCode = 0x00060194
+
+	// maxReferralLevel is the highest referral version requested.
+	maxReferralLevel = 4
+
+	// maxReferralLength bounds the referral responses accepted from servers.
+	maxReferralLength = 64 * 1024
+
+	serverTypeRoot       = 0x0001
+	entryFlagNameList    = 0x0002
+	headerFlagRootTarget = 0x0001
+)
+
+// ErrNotDFS is returned for paths that are not in a DFS namespace.
+var ErrNotDFS = errors.New("not a DFS path")
+
+// Referral is a server's answer to a DFS referral request.
+type Referral struct {
+	// PathConsumed is the number of bytes of the UTF-16 request path that
+	// the referral covers.
+	PathConsumed int
+	Entries      []ReferralEntry
+}
+
+// ReferralEntry is one target of a referral.
+type ReferralEntry struct {
+	// Root is set when the target is a namespace root, whose links need
+	// further referrals.
+	Root   bool
+	TTL    time.Duration
+	Path   string // the DFS path the entry refers to, e.g. \domain\namespace\link
+	Target string // the share it refers to, e.g. \server\share\folder
+}
+
+// GetReferralFunc asks the server at address (host:port), whose name is
+// server, for a referral for path, e.g. \server\namespace\link.
+type GetReferralFunc func(ctx context.Context, address, server string, credentials smb2.Credentials, path string) (Referral, error)
+
+// GetReferral asks for a referral on the IPC$ share of the server. It returns
+// ErrNotDFS when the server does not know the path as a DFS path.
+func GetReferral(ctx context.Context, address, server string, credentials smb2.Credentials, path string) (Referral, error) {
+	session, err := smb2.Dial(ctx, address, server, credentials)
+	if err != nil {
+		return Referral{}, err
+	}
+	defer session.Close()
+
+	tree, err := session.TreeConnect(ctx, "IPC$")
+	if err != nil {
+		return Referral{}, err
+	}
+	defer tree.Disconnect()
+
+	output, err := tree.Ioctl(ctx, getReferralsCtlCode, EncodeReferralRequest(path), maxReferralLength)
+	if err != nil {
+		var statusErr *smb2.StatusError
+		if errors.As(err, &statusErr) {
+			switch statusErr.Status {
+			case smb2.StatusNotFound, smb2.StatusFSDriverRequired, smb2.StatusObjectPathNotFound:
+				return Referral{}, ErrNotDFS
+			}
+		}
+		return Referral{}, err
+	}
+
+	return DecodeReferral(output)
+}
+
+// EncodeReferralRequest encodes a REQ_GET_DFS_REFERRAL for path.
+func EncodeReferralRequest(path string) []byte {
+	b := binary.LittleEndian.AppendUint16(nil, maxReferralLevel)
+	for _, r := range utf16.Encode([]rune(path)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+	return binary.LittleEndian.AppendUint16(b, 0)
+}
+
+// DecodeReferral decodes a RESP_GET_DFS_REFERRAL. Version 2 to 4 entries are
+// supported, and the name list entries of domain referrals are skipped.
+func DecodeReferral(b []byte) (Referral, error) {
+	if len(b) < 8 {
+		return Referral{}, errors.New("invalid DFS referral: too short")
+	}
+
+	referral := Referral{PathConsumed: int(binary.LittleEndian.Uint16(b))}
+	count := int(binary.LittleEndian.Uint16(b[2:]))
+	rootTargets := binary.LittleEndian.Uint32(b[4:])&headerFlagRootTarget != 0
+
+	offset := 8
+	for i := 0; i < count; i++ {
+		if offset+8 > len(b) {
+			return Referral{}, errors.New("invalid DFS referral: entry out of bounds")
+		}
+
+		entry := b[offset:]
+		version := binary.LittleEndian.Uint16(entry)
+		size := int(binary.LittleEndian.Uint16(entry[2:]))
+		serverType := binary.LittleEndian.Uint16(entry[4:])
+		flags := binary.LittleEndian.Uint16(entry[6:])
+		if size < 8 || offset+size > len(b) {
+			return Referral{}, errors.New("invalid DFS referral: entry out of bounds")
+		}
+
+		var ttl, pathOffset, targetOffset int
+		switch version {
+		case 2:
+			if size < 22 {
+				return Referral{}, errors.New("invalid DFS referral: entry too short")
+			}
+			ttl = int(binary.LittleEndian.Uint32(entry[12:]))
+			pathOffset = int(binary.LittleEndian.Uint16(entry[16:]))
+			targetOffset = int(binary.LittleEndian.Uint16(entry[20:]))
+		case 3, 4:
+			if flags&entryFlagNameList != 0 {
+				offset += size
+				continue
+			}
+			if size < 18 {
+				return Referral{}, errors.New("invalid DFS referral: entry too short")
+			}
+			ttl = int(binary.LittleEndian.Uint32(entry[8:]))
+			pathOffset = int(binary.LittleEndian.Uint16(entry[12:]))
+			targetOffset = int(binary.LittleEndian.Uint16(entry[16:]))
+		default:
+			return Referral{}, fmt.Errorf("invalid DFS referral: unsupported version %d", version)
+		}
+
+		path, err := utf16String(entry, pathOffset)
+		if err != nil {
+			return Referral{}, err
+		}
+
+		target, err := utf16String(entry, targetOffset)
+		if err != nil {
+			return Referral{}, err
+		}
+
+		referral.Entries = append(referral.Entries, ReferralEntry{
+			Root:   rootTargets || serverType == serverTypeRoot,
+			TTL:    time.Duration(ttl) * time.Second,
+			Path:   path,
+			Target: target,
+		})
+		offset += size
+	}
+
+	return referral, nil
+}
+
+// utf16String reads the null terminated UTF-16 string at offset.
+func utf16String(b []byte, offset int) (string, error) {
+	runes := []uint16{}
+	for i := offset; ; i += 2 {
+		if i+2 > len(b) {
+			return "", errors.New("invalid DFS referral: string out of bounds")
+		}
+		r := binary.LittleEndian.Uint16(b[i:])
+		if r == 0 {
+			return string(utf16.Decode(runes)), nil
+		}
+		runes = append(runes, r)
+	}
+}
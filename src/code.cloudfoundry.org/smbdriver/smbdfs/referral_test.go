@@ -0,0 +1,157 @@
+package smbdfs_test
+
+import (
+	"encoding/binary"
+	"time"
+	"unicode/utf16"
+
+	"code.cloudfoundry.org/smbdriver/smbdfs"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type entry struct {
+	version    uint16
+	serverType uint16
+	flags      uint16
+	ttl        uint32
+	path       string
+	target     string
+}
+
+func encodeUTF16(s string) []byte {
+	b := []byte{}
+	for _, r := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, r)
+	}
+	return binary.LittleEndian.AppendUint16(b, 0)
+}
+
+// encodeReferral lays out a RESP_GET_DFS_REFERRAL with the fixed part of the
+// entries first and their strings after them, like Windows servers do.
+func encodeReferral(pathConsumed uint16, headerFlags uint32, entries ...entry) []byte {
+	sizes := []int{}
+	fixedLength := 0
+	for _, e := range entries {
+		size := 34
+		if e.version == 2 {
+			size = 22
+		}
+		sizes = append(sizes, size)
+		fixedLength += size
+	}
+
+	b := binary.LittleEndian.AppendUint16(nil, pathConsumed)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(entries)))
+	b = binary.LittleEndian.AppendUint32(b, headerFlags)
+
+	strings := []byte{}
+	entryOffset := 8
+	for i, e := range entries {
+		stringsOffset := 8 + fixedLength + len(strings) - entryOffset
+		path := encodeUTF16(e.path)
+		target := encodeUTF16(e.target)
+		strings = append(strings, path...)
+		strings = append(strings, target...)
+
+		b = binary.LittleEndian.AppendUint16(b, e.version)
+		b = binary.LittleEndian.AppendUint16(b, uint16(sizes[i]))
+		b = binary.LittleEndian.AppendUint16(b, e.serverType)
+		b = binary.LittleEndian.AppendUint16(b, e.flags)
+		if e.version == 2 {
+			b = binary.LittleEndian.AppendUint32(b, 0)
+		}
+		b = binary.LittleEndian.AppendUint32(b, e.ttl)
+		b = binary.LittleEndian.AppendUint16(b, uint16(stringsOffset))
+		b = binary.LittleEndian.AppendUint16(b, uint16(stringsOffset))
+		b = binary.LittleEndian.AppendUint16(b, uint16(stringsOffset+len(path)))
+		if e.version != 2 {
+			b = append(b, make([]byte, 16)...)
+		}
+
+		entryOffset += sizes[i]
+	}
+
+	return append(b, strings...)
+}
+
+var _ = Describe("Referral", func() {
+	Context("EncodeReferralRequest", func() {
+		It("asks for up to version 4 referrals for the null terminated path", func() {
+			Expect(smbdfs.EncodeReferralRequest(`\a\b`)).To(Equal([]byte{
+				4, 0,
+				'\\', 0, 'a', 0, '\\', 0, 'b', 0,
+				0, 0,
+			}))
+		})
+	})
+
+	Context("DecodeReferral", func() {
+		It("decodes version 3 and 4 entries", func() {
+			referral, err := smbdfs.DecodeReferral(encodeReferral(36, 0,
+				entry{version: 4, ttl: 300, path: `\corp\ns\apps`, target: `\fs1\apps`},
+				entry{version: 3, ttl: 600, path: `\corp\ns\apps`, target: `\fs2\apps\current`},
+			))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(referral).To(Equal(smbdfs.Referral{
+				PathConsumed: 36,
+				Entries: []smbdfs.ReferralEntry{
+					{TTL: 300 * time.Second, Path: `\corp\ns\apps`, Target: `\fs1\apps`},
+					{TTL: 600 * time.Second, Path: `\corp\ns\apps`, Target: `\fs2\apps\current`},
+				},
+			}))
+		})
+
+		It("decodes version 2 entries", func() {
+			referral, err := smbdfs.DecodeReferral(encodeReferral(16, 0,
+				entry{version: 2, ttl: 60, path: `\corp\ns`, target: `\fs1\ns`},
+			))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(referral.Entries).To(Equal([]smbdfs.ReferralEntry{
+				{TTL: 60 * time.Second, Path: `\corp\ns`, Target: `\fs1\ns`},
+			}))
+		})
+
+		It("marks root targets", func() {
+			referral, err := smbdfs.DecodeReferral(encodeReferral(16, 0,
+				entry{version: 4, serverType: 1, ttl: 300, path: `\corp\ns`, target: `\dc1\ns`},
+			))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(referral.Entries[0].Root).To(BeTrue())
+
+			referral, err = smbdfs.DecodeReferral(encodeReferral(16, 1,
+				entry{version: 4, ttl: 300, path: `\corp\ns`, target: `\dc1\ns`},
+			))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(referral.Entries[0].Root).To(BeTrue())
+		})
+
+		It("skips the name list entries of domain referrals", func() {
+			referral, err := smbdfs.DecodeReferral(encodeReferral(16, 0,
+				entry{version: 3, flags: 2, path: `\corp`, target: `\dc1`},
+				entry{version: 3, ttl: 300, path: `\corp\ns`, target: `\fs1\ns`},
+			))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(referral.Entries).To(HaveLen(1))
+			Expect(referral.Entries[0].Target).To(Equal(`\fs1\ns`))
+		})
+
+		It("rejects truncated referrals", func() {
+			b := encodeReferral(16, 0, entry{version: 4, ttl: 300, path: `\corp\ns`, target: `\fs1\ns`})
+
+			_, err := smbdfs.DecodeReferral(b[:6])
+			Expect(err).To(MatchError("invalid DFS referral: too short"))
+
+			_, err = smbdfs.DecodeReferral(b[:20])
+			Expect(err).To(MatchError("invalid DFS referral: entry out of bounds"))
+
+			_, err = smbdfs.DecodeReferral(b[:len(b)-2])
+			Expect(err).To(MatchError("invalid DFS referral: string out of bounds"))
+		})
+
+		It("rejects unsupported versions", func() {
+			_, err := smbdfs.DecodeReferral(encodeReferral(16, 0, entry{version: 5, path: `\corp\ns`, target: `\fs1\ns`}))
+			Expect(err).To(MatchError("invalid DFS referral: unsupported version 5"))
+		})
+	})
+})
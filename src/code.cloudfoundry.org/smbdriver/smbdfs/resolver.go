@@ -0,0 +1,189 @@
+package smbdfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+)
+
+const (
+	// DefaultTimeout bounds how long resolving a share may take.
+	DefaultTimeout = 10 * time.Second
+
+	// notDFSTTL is how long a share that is not a DFS path is remembered, so
+	// that mounting it does not cost a referral request every time.
+	notDFSTTL = 5 * time.Minute
+
+	// maxHops bounds the referrals followed from namespace roots to links.
+	maxHops = 4
+
+	defaultPort = 445
+)
+
+type cachedReferral struct {
+	referral Referral
+	err      error
+	expires  time.Time
+}
+
+// Resolver resolves DFS shares to their targets and caches the referrals
+// for their TTL.
+type Resolver struct {
+	getReferral GetReferralFunc
+	timeout     time.Duration
+	clock       clock.Clock
+
+	mutex sync.Mutex
+	cache map[string]cachedReferral
+}
+
+func NewResolver(getReferral GetReferralFunc, timeout time.Duration, clock clock.Clock) *Resolver {
+	return &Resolver{
+		getReferral: getReferral,
+		timeout:     timeout,
+		clock:       clock,
+		cache:       map[string]cachedReferral{},
+	}
+}
+
+// Resolve returns the shares holding the DFS path source, in the order the
+// server gave them, with the rest of the path below each of them. It returns
+// ErrNotDFS when the source is not a DFS path.
+func (r *Resolver) Resolve(ctx context.Context, source smbsource.Source, credentials smb2.Credentials) ([]smbsource.Source, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	targets, err := r.resolve(ctx, source, credentials, maxHops)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("resolving DFS path %s timed out after %s", source, r.timeout)
+	}
+	return targets, err
+}
+
+func (r *Resolver) resolve(ctx context.Context, source smbsource.Source, credentials smb2.Credentials, hops int) ([]smbsource.Source, error) {
+	path := referralPath(source)
+
+	referral, err := r.referral(ctx, source, credentials, path)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := remainder(path, referral.PathConsumed)
+
+	targets := []smbsource.Source{}
+	var rootErr error
+	for _, entry := range referral.Entries {
+		target, err := smbsource.Parse(`\` + entry.Target + remaining)
+		if err != nil {
+			continue
+		}
+
+		// A namespace root may hold links further down the path, which only
+		// the root servers can refer to. Root servers that cannot be asked
+		// are skipped.
+		if entry.Root && target.Path != "" && hops > 0 && !strings.EqualFold(target.String(), source.String()) {
+			expanded, err := r.resolve(ctx, target, credentials, hops-1)
+			if err == nil {
+				targets = append(targets, expanded...)
+				continue
+			}
+			if !errors.Is(err, ErrNotDFS) {
+				rootErr = err
+				continue
+			}
+		}
+
+		targets = append(targets, target)
+	}
+
+	if len(targets) == 0 && rootErr != nil {
+		return nil, rootErr
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("the DFS referral for %s has no targets", source)
+	}
+	return targets, nil
+}
+
+func (r *Resolver) referral(ctx context.Context, source smbsource.Source, credentials smb2.Credentials, path string) (Referral, error) {
+	key := strings.ToLower(strconv.Itoa(source.Port) + path)
+
+	r.mutex.Lock()
+	cached, ok := r.cache[key]
+	r.mutex.Unlock()
+
+	if ok && r.clock.Now().Before(cached.expires) {
+		return cached.referral, cached.err
+	}
+
+	port := source.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	address := net.JoinHostPort(source.Host, strconv.Itoa(port))
+
+	referral, err := r.getReferral(ctx, address, source.Host, credentials, path)
+	switch {
+	case errors.Is(err, ErrNotDFS):
+		r.store(key, cachedReferral{err: ErrNotDFS, expires: r.clock.Now().Add(notDFSTTL)})
+		return Referral{}, ErrNotDFS
+	case err != nil:
+		return Referral{}, err
+	}
+
+	if ttl, ok := minimumTTL(referral); ok && ttl > 0 {
+		r.store(key, cachedReferral{referral: referral, expires: r.clock.Now().Add(ttl)})
+	}
+	return referral, nil
+}
+
+func (r *Resolver) store(key string, cached cachedReferral) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.cache[key] = cached
+}
+
+func minimumTTL(referral Referral) (time.Duration, bool) {
+	if len(referral.Entries) == 0 {
+		return 0, false
+	}
+
+	ttl := referral.Entries[0].TTL
+	for _, entry := range referral.Entries[1:] {
+		if entry.TTL < ttl {
+			ttl = entry.TTL
+		}
+	}
+	return ttl, true
+}
+
+// referralPath returns the path of source as a DFS path, e.g.
+// \server\namespace\link\folder.
+func referralPath(source smbsource.Source) string {
+	path := `\` + source.Host + `\` + source.Share
+	if source.Path != "" {
+		path += `\` + strings.ReplaceAll(source.Path, "/", `\`)
+	}
+	return path
+}
+
+// remainder returns the part of path after the first consumed bytes of its
+// UTF-16 encoding.
+func remainder(path string, consumed int) string {
+	encoded := utf16.Encode([]rune(path))
+	if consumed/2 >= len(encoded) {
+		return ""
+	}
+	return string(utf16.Decode(encoded[consumed/2:]))
+}
@@ -0,0 +1,215 @@
+package smbdfs_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"code.cloudfoundry.org/smbdriver/smbdfs"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type referralRequest struct {
+	address string
+	server  string
+	path    string
+}
+
+var _ = Describe("Resolver", func() {
+	var (
+		ctx         context.Context
+		clock       *fakeclock.FakeClock
+		credentials smb2.Credentials
+		referrals   map[string]smbdfs.Referral
+		failures    map[string]error
+		requests    []referralRequest
+		resolver    *smbdfs.Resolver
+	)
+
+	parse := func(s string) smbsource.Source {
+		source, err := smbsource.Parse(s)
+		Expect(err).NotTo(HaveOccurred())
+		return source
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		clock = fakeclock.NewFakeClock(time.Now())
+		credentials = smb2.Credentials{Domain: "CORP", Username: "user", Password: "secret"}
+		referrals = map[string]smbdfs.Referral{}
+		failures = map[string]error{}
+		requests = nil
+
+		getReferral := func(ctx context.Context, address, server string, c smb2.Credentials, path string) (smbdfs.Referral, error) {
+			Expect(c).To(Equal(credentials))
+			requests = append(requests, referralRequest{address: address, server: server, path: path})
+
+			if err, ok := failures[path]; ok {
+				return smbdfs.Referral{}, err
+			}
+			if referral, ok := referrals[path]; ok {
+				return referral, nil
+			}
+			return smbdfs.Referral{}, smbdfs.ErrNotDFS
+		}
+
+		resolver = smbdfs.NewResolver(getReferral, smbdfs.DefaultTimeout, clock)
+	})
+
+	Context("when the share is not a DFS path", func() {
+		It("returns ErrNotDFS", func() {
+			_, err := resolver.Resolve(ctx, parse("//server/share/folder"), credentials)
+			Expect(err).To(Equal(smbdfs.ErrNotDFS))
+			Expect(requests).To(Equal([]referralRequest{{address: "server:445", server: "server", path: `\server\share\folder`}}))
+		})
+
+		It("remembers it", func() {
+			_, err := resolver.Resolve(ctx, parse("//server/share"), credentials)
+			Expect(err).To(Equal(smbdfs.ErrNotDFS))
+
+			clock.Increment(time.Minute)
+			_, err = resolver.Resolve(ctx, parse("//server/share"), credentials)
+			Expect(err).To(Equal(smbdfs.ErrNotDFS))
+			Expect(requests).To(HaveLen(1))
+
+			clock.Increment(5 * time.Minute)
+			_, err = resolver.Resolve(ctx, parse("//server/share"), credentials)
+			Expect(err).To(Equal(smbdfs.ErrNotDFS))
+			Expect(requests).To(HaveLen(2))
+		})
+	})
+
+	Context("when the share is a DFS link", func() {
+		BeforeEach(func() {
+			// \ns\apps\link is 13 characters, i.e. 26 bytes of UTF-16.
+			referrals[`\ns\apps\link\logs`] = smbdfs.Referral{
+				PathConsumed: 26,
+				Entries: []smbdfs.ReferralEntry{
+					{TTL: 300 * time.Second, Path: `\ns\apps\link`, Target: `\fs1\data\link`},
+					{TTL: 600 * time.Second, Path: `\ns\apps\link`, Target: `\fs2\data`},
+				},
+			}
+		})
+
+		It("returns the targets with the rest of the path below them", func() {
+			targets, err := resolver.Resolve(ctx, parse("smb://ns:1445/apps/link/logs"), credentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targets).To(Equal([]smbsource.Source{
+				{Host: "fs1", Share: "data", Path: "link/logs"},
+				{Host: "fs2", Share: "data", Path: "logs"},
+			}))
+			Expect(requests).To(Equal([]referralRequest{{address: "ns:1445", server: "ns", path: `\ns\apps\link\logs`}}))
+		})
+
+		It("caches the referral for the shortest TTL of its targets", func() {
+			_, err := resolver.Resolve(ctx, parse("//ns/apps/link/logs"), credentials)
+			Expect(err).NotTo(HaveOccurred())
+
+			clock.Increment(299 * time.Second)
+			_, err = resolver.Resolve(ctx, parse("//NS/apps/LINK/logs"), credentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(HaveLen(1))
+
+			clock.Increment(time.Second)
+			_, err = resolver.Resolve(ctx, parse("//ns/apps/link/logs"), credentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(HaveLen(2))
+		})
+	})
+
+	Context("when the share is below a domain namespace root", func() {
+		BeforeEach(func() {
+			// \corp.example.com\ns is 20 characters, i.e. 40 bytes of UTF-16.
+			referrals[`\corp.example.com\ns\link`] = smbdfs.Referral{
+				PathConsumed: 40,
+				Entries: []smbdfs.ReferralEntry{
+					{Root: true, TTL: 300 * time.Second, Path: `\corp.example.com\ns`, Target: `\dc1\ns`},
+					{Root: true, TTL: 300 * time.Second, Path: `\corp.example.com\ns`, Target: `\dc2\ns`},
+				},
+			}
+			referrals[`\dc1\ns\link`] = smbdfs.Referral{
+				PathConsumed: 24,
+				Entries: []smbdfs.ReferralEntry{
+					{TTL: 300 * time.Second, Path: `\dc1\ns\link`, Target: `\fs1\data`},
+				},
+			}
+		})
+
+		It("follows the referrals of the root targets", func() {
+			targets, err := resolver.Resolve(ctx, parse("//corp.example.com/ns/link"), credentials)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(targets).To(Equal([]smbsource.Source{
+				{Host: "fs1", Share: "data"},
+				{Host: "dc2", Share: "ns", Path: "link"},
+			}))
+		})
+
+		Context("when a root target cannot be asked", func() {
+			BeforeEach(func() {
+				failures[`\dc1\ns\link`] = errors.New("connection refused")
+			})
+
+			It("skips it", func() {
+				targets, err := resolver.Resolve(ctx, parse("//corp.example.com/ns/link"), credentials)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(targets).To(Equal([]smbsource.Source{{Host: "dc2", Share: "ns", Path: "link"}}))
+			})
+		})
+
+		Context("when no root target can be asked", func() {
+			BeforeEach(func() {
+				failures[`\dc1\ns\link`] = errors.New("connection refused")
+				failures[`\dc2\ns\link`] = errors.New("connection reset")
+			})
+
+			It("fails", func() {
+				_, err := resolver.Resolve(ctx, parse("//corp.example.com/ns/link"), credentials)
+				Expect(err).To(MatchError("connection reset"))
+			})
+		})
+	})
+
+	Context("when the referral fails", func() {
+		BeforeEach(func() {
+			failures[`\ns\apps`] = errors.New("SMB SESSION_SETUP failed with status 0xc000006d")
+		})
+
+		It("returns the error and does not cache it", func() {
+			_, err := resolver.Resolve(ctx, parse("//ns/apps"), credentials)
+			Expect(err).To(MatchError("SMB SESSION_SETUP failed with status 0xc000006d"))
+
+			_, err = resolver.Resolve(ctx, parse("//ns/apps"), credentials)
+			Expect(err).To(HaveOccurred())
+			Expect(requests).To(HaveLen(2))
+		})
+	})
+
+	Context("when the referral has no targets", func() {
+		BeforeEach(func() {
+			referrals[`\ns\apps`] = smbdfs.Referral{PathConsumed: 16}
+		})
+
+		It("fails", func() {
+			_, err := resolver.Resolve(ctx, parse("//ns/apps"), credentials)
+			Expect(err).To(MatchError("the DFS referral for //ns/apps has no targets"))
+		})
+	})
+
+	Context("when the server does not answer in time", func() {
+		BeforeEach(func() {
+			resolver = smbdfs.NewResolver(func(ctx context.Context, address, server string, credentials smb2.Credentials, path string) (smbdfs.Referral, error) {
+				<-ctx.Done()
+				return smbdfs.Referral{}, ctx.Err()
+			}, 10*time.Millisecond, clock)
+		})
+
+		It("times out", func() {
+			_, err := resolver.Resolve(ctx, parse("//ns/apps"), credentials)
+			Expect(err).To(MatchError("resolving DFS path //ns/apps timed out after 10ms"))
+		})
+	})
+})
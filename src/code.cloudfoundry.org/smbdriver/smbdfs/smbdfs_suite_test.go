@@ -0,0 +1,13 @@
+package smbdfs_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbdfs(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbdfs Suite")
+}
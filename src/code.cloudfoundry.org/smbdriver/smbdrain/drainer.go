@@ -0,0 +1,200 @@
+// Package smbdrain drains the smbdriver of a cell that BOSH is about to stop
+// or update, once the rep has evacuated the apps that use its volumes.
+package smbdrain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+// Config is where the drainer finds the smbdriver, and how long it waits for
+// each step of the drain.
+type Config struct {
+	// PidFile holds the pid of the smbdriver.
+	PidFile string
+	// SpecFiles are the files through which volman discovers the drivers
+	// that the smbdriver serves. They are removed before the smbdriver is
+	// evacuated, so that no new volumes are mounted.
+	SpecFiles []string
+
+	RepTimeout       time.Duration
+	RepPollInterval  time.Duration
+	EvacuateTimeout  time.Duration
+	ExitTimeout      time.Duration
+	ExitPollInterval time.Duration
+}
+
+// DefaultConfig waits as long for each step as the BOSH drain script of the
+// smbdriver always has.
+func DefaultConfig() Config {
+	return Config{
+		RepTimeout:       15 * time.Minute,
+		RepPollInterval:  10 * time.Second,
+		EvacuateTimeout:  10 * time.Minute,
+		ExitTimeout:      5 * time.Minute,
+		ExitPollInterval: 5 * time.Second,
+	}
+}
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -generate
+
+// Processes finds and kills the processes on the cell.
+//
+//counterfeiter:generate -o ../smbdriverfakes/fake_processes.go . Processes
+type Processes interface {
+	// Running reports whether the process with pid exists.
+	Running(pid int) bool
+	// RunningNamed reports whether a process with exactly the given name,
+	// as pgrep -x matches it, exists.
+	RunningNamed(name string) (bool, error)
+	// Kill kills the process with pid.
+	Kill(pid int) error
+}
+
+// ErrRepRunning is returned when the rep is still evacuating the apps of the
+// cell after Config.RepTimeout.
+var ErrRepRunning = errors.New("the rep is still running")
+
+type Drainer struct {
+	logger    lager.Logger
+	client    driveradmin.DriverAdmin
+	processes Processes
+	clock     clock.Clock
+	config    Config
+}
+
+func NewDrainer(logger lager.Logger, client driveradmin.DriverAdmin, processes Processes, clock clock.Clock, config Config) *Drainer {
+	return &Drainer{
+		logger:    logger,
+		client:    client,
+		processes: processes,
+		clock:     clock,
+		config:    config,
+	}
+}
+
+// Drain waits for the rep to exit, evacuates the smbdriver through its admin
+// API and waits for it to exit. The smbdriver is killed when it does not
+// exit in time or the evacuation times out. A smbdriver that is not running
+// is left as it is, and so is one that fails or refuses to evacuate, for
+// example because it serves FUSE mounts, in which case the drain fails.
+func (d *Drainer) Drain() error {
+	logger := d.logger.Session("drain")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	pid, err := d.pid()
+	if os.IsNotExist(err) {
+		logger.Info("pid-file-does-not-exist", lager.Data{"pid-file": d.config.PidFile})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !d.processes.Running(pid) {
+		logger.Info("smbdriver-not-running", lager.Data{"pid": pid})
+		return nil
+	}
+
+	if err := d.waitForRep(logger); err != nil {
+		return err
+	}
+
+	logger.Info("evacuating-smbdriver")
+	for _, specFile := range d.config.SpecFiles {
+		if err := os.Remove(specFile); err != nil && !os.IsNotExist(err) {
+			logger.Error("failed-removing-spec-file", err, lager.Data{"spec-file": specFile})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.EvacuateTimeout)
+	response := d.client.Evacuate(driverhttp.NewHttpDriverEnv(logger, ctx))
+	timedOut := ctx.Err() == context.DeadlineExceeded
+	cancel()
+
+	switch {
+	case timedOut:
+		logger.Info("evacuate-timed-out", lager.Data{"timeout": d.config.EvacuateTimeout.String()})
+	case response.Err != "":
+		logger.Info("evacuate-failed", lager.Data{"error": response.Err})
+		return errors.New(response.Err)
+	default:
+		d.waitForExit(logger)
+	}
+
+	d.kill(logger, pid)
+	return nil
+}
+
+func (d *Drainer) pid() (int, error) {
+	contents, err := os.ReadFile(d.config.PidFile)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pid file %s: %s", d.config.PidFile, err.Error())
+	}
+	return pid, nil
+}
+
+func (d *Drainer) waitForRep(logger lager.Logger) error {
+	deadline := d.clock.Now().Add(d.config.RepTimeout)
+	for {
+		running, err := d.processes.RunningNamed("rep")
+		if err != nil {
+			return err
+		}
+		if !running {
+			return nil
+		}
+		if !d.clock.Now().Before(deadline) {
+			return ErrRepRunning
+		}
+
+		logger.Info("waiting-for-rep")
+		d.clock.Sleep(d.config.RepPollInterval)
+	}
+}
+
+// waitForExit waits until the admin API of the smbdriver stops answering.
+func (d *Drainer) waitForExit(logger lager.Logger) {
+	deadline := d.clock.Now().Add(d.config.ExitTimeout)
+	for d.clock.Now().Before(deadline) {
+		ctx, cancel := context.WithTimeout(context.Background(), d.config.ExitPollInterval)
+		response := d.client.Ping(driverhttp.NewHttpDriverEnv(logger, ctx))
+		cancel()
+		if response.Err != "" {
+			logger.Info("smbdriver-exited")
+			return
+		}
+
+		logger.Info("waiting-for-smbdriver")
+		d.clock.Sleep(d.config.ExitPollInterval)
+	}
+	logger.Info("smbdriver-did-not-exit", lager.Data{"timeout": d.config.ExitTimeout.String()})
+}
+
+func (d *Drainer) kill(logger lager.Logger, pid int) {
+	if d.processes.Running(pid) {
+		if err := d.processes.Kill(pid); err != nil {
+			logger.Error("failed-killing-smbdriver", err, lager.Data{"pid": pid})
+		}
+	}
+
+	if err := os.Remove(d.config.PidFile); err != nil && !os.IsNotExist(err) {
+		logger.Error("failed-removing-pid-file", err)
+	}
+}
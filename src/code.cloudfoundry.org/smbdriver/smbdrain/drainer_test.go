@@ -0,0 +1,216 @@
+package smbdrain_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbdrain"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Drainer", func() {
+	var (
+		logger      *lagertest.TestLogger
+		driverAdmin *smbdriverfakes.FakeDriverAdmin
+		processes   *smbdriverfakes.FakeProcesses
+		clock       *fakeclock.FakeClock
+		config      smbdrain.Config
+		dir         string
+
+		drained chan error
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("drainer")
+		driverAdmin = &smbdriverfakes.FakeDriverAdmin{}
+		driverAdmin.PingReturns(driveradmin.ErrorResponse{Err: "connection refused"})
+		processes = &smbdriverfakes.FakeProcesses{}
+		processes.RunningReturns(true)
+		clock = fakeclock.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+
+		var err error
+		dir, err = os.MkdirTemp("", "smbdrain")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+
+		config = smbdrain.DefaultConfig()
+		config.PidFile = filepath.Join(dir, "smbdriver.pid")
+		config.SpecFiles = []string{filepath.Join(dir, "smbdriver.json"), filepath.Join(dir, "smbdriver-legacy.json")}
+		Expect(os.WriteFile(config.PidFile, []byte("1234\n"), 0644)).To(Succeed())
+		for _, specFile := range config.SpecFiles {
+			Expect(os.WriteFile(specFile, []byte("{}"), 0644)).To(Succeed())
+		}
+	})
+
+	JustBeforeEach(func() {
+		drainer := smbdrain.NewDrainer(logger, driverAdmin, processes, clock, config)
+		drained = make(chan error, 1)
+		go func() { drained <- drainer.Drain() }()
+	})
+
+	It("evacuates the smbdriver and kills it once it has exited", func() {
+		Eventually(drained).Should(Receive(BeNil()))
+
+		Expect(processes.RunningNamedArgsForCall(0)).To(Equal("rep"))
+		Expect(driverAdmin.EvacuateCallCount()).To(Equal(1))
+		for _, specFile := range config.SpecFiles {
+			Expect(specFile).NotTo(BeAnExistingFile())
+		}
+
+		Expect(processes.KillCallCount()).To(Equal(1))
+		Expect(processes.KillArgsForCall(0)).To(Equal(1234))
+		Expect(config.PidFile).NotTo(BeAnExistingFile())
+	})
+
+	It("does not kill the smbdriver again once it has exited", func() {
+		processes.RunningReturnsOnCall(1, false)
+
+		Eventually(drained).Should(Receive(BeNil()))
+		Expect(processes.KillCallCount()).To(Equal(0))
+		Expect(config.PidFile).NotTo(BeAnExistingFile())
+	})
+
+	Context("when the rep is still running", func() {
+		BeforeEach(func() {
+			processes.RunningNamedReturnsOnCall(0, true, nil)
+			processes.RunningNamedReturnsOnCall(1, false, nil)
+		})
+
+		It("waits for the rep to exit before evacuating", func() {
+			clock.WaitForWatcherAndIncrement(config.RepPollInterval)
+
+			Eventually(drained).Should(Receive(BeNil()))
+			Expect(logger.Buffer()).To(gbytes.Say("waiting-for-rep"))
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(1))
+		})
+
+		Context("and it does not exit in time", func() {
+			BeforeEach(func() {
+				processes.RunningNamedReturnsOnCall(1, true, nil)
+				config.RepTimeout = config.RepPollInterval
+			})
+
+			It("fails without evacuating the smbdriver", func() {
+				clock.WaitForWatcherAndIncrement(config.RepPollInterval)
+
+				Eventually(drained).Should(Receive(MatchError(smbdrain.ErrRepRunning)))
+				Expect(driverAdmin.EvacuateCallCount()).To(Equal(0))
+				Expect(config.SpecFiles[0]).To(BeAnExistingFile())
+				Expect(processes.KillCallCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when the processes cannot be listed", func() {
+		BeforeEach(func() {
+			processes.RunningNamedReturns(false, errors.New("permission denied"))
+		})
+
+		It("fails", func() {
+			Eventually(drained).Should(Receive(MatchError("permission denied")))
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the smbdriver takes a while to exit", func() {
+		BeforeEach(func() {
+			driverAdmin.PingReturnsOnCall(0, driveradmin.ErrorResponse{})
+		})
+
+		It("waits for the admin API to stop answering", func() {
+			clock.WaitForWatcherAndIncrement(config.ExitPollInterval)
+
+			Eventually(drained).Should(Receive(BeNil()))
+			Expect(driverAdmin.PingCallCount()).To(Equal(2))
+			Expect(processes.KillCallCount()).To(Equal(1))
+		})
+
+		Context("and it does not exit in time", func() {
+			BeforeEach(func() {
+				driverAdmin.PingReturns(driveradmin.ErrorResponse{})
+				config.ExitTimeout = config.ExitPollInterval
+			})
+
+			It("kills it", func() {
+				clock.WaitForWatcherAndIncrement(config.ExitPollInterval)
+
+				Eventually(drained).Should(Receive(BeNil()))
+				Expect(logger.Buffer()).To(gbytes.Say("smbdriver-did-not-exit"))
+				Expect(processes.KillCallCount()).To(Equal(1))
+			})
+		})
+	})
+
+	Context("when the evacuation times out", func() {
+		BeforeEach(func() {
+			config.EvacuateTimeout = 10 * time.Millisecond
+			driverAdmin.EvacuateStub = func(env dockerdriver.Env) driveradmin.ErrorResponse {
+				<-env.Context().Done()
+				return driveradmin.ErrorResponse{Err: env.Context().Err().Error()}
+			}
+		})
+
+		It("kills the smbdriver without waiting for it to exit", func() {
+			Eventually(drained).Should(Receive(BeNil()))
+			Expect(logger.Buffer()).To(gbytes.Say("evacuate-timed-out"))
+			Expect(driverAdmin.PingCallCount()).To(Equal(0))
+			Expect(processes.KillCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("when the evacuation fails", func() {
+		BeforeEach(func() {
+			driverAdmin.EvacuateReturns(driveradmin.ErrorResponse{Err: "evacuate: 403 write access required"})
+		})
+
+		It("fails the drain and leaves the smbdriver running", func() {
+			Eventually(drained).Should(Receive(MatchError("evacuate: 403 write access required")))
+			Expect(logger.Buffer()).To(gbytes.Say("evacuate-failed.*write access required"))
+			Expect(processes.KillCallCount()).To(Equal(0))
+			Expect(config.PidFile).To(BeAnExistingFile())
+		})
+	})
+
+	Context("when the smbdriver is not running", func() {
+		BeforeEach(func() {
+			processes.RunningReturns(false)
+		})
+
+		It("does nothing", func() {
+			Eventually(drained).Should(Receive(BeNil()))
+			Expect(processes.RunningNamedCallCount()).To(Equal(0))
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when there is no pid file", func() {
+		BeforeEach(func() {
+			Expect(os.Remove(config.PidFile)).To(Succeed())
+		})
+
+		It("does nothing", func() {
+			Eventually(drained).Should(Receive(BeNil()))
+			Expect(processes.RunningCallCount()).To(Equal(0))
+			Expect(driverAdmin.EvacuateCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("when the pid file is invalid", func() {
+		BeforeEach(func() {
+			Expect(os.WriteFile(config.PidFile, []byte("smbdriver"), 0644)).To(Succeed())
+		})
+
+		It("fails", func() {
+			Eventually(drained).Should(Receive(MatchError(ContainSubstring("invalid pid file"))))
+		})
+	})
+})
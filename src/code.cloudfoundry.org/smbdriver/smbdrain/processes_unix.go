@@ -0,0 +1,54 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdrain
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+type procProcesses struct {
+	procDir string
+}
+
+// NewProcProcesses finds the processes in the proc file system mounted at
+// procDir, usually /proc.
+func NewProcProcesses(procDir string) Processes {
+	return &procProcesses{procDir: procDir}
+}
+
+func (p *procProcesses) Running(pid int) bool {
+	_, err := os.Stat(filepath.Join(p.procDir, strconv.Itoa(pid)))
+	return err == nil
+}
+
+func (p *procProcesses) RunningNamed(name string) (bool, error) {
+	entries, err := os.ReadDir(p.procDir)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+
+		// The process may have exited since the directory was read.
+		comm, err := os.ReadFile(filepath.Join(p.procDir, entry.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSuffix(string(comm), "\n") == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *procProcesses) Kill(pid int) error {
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
@@ -0,0 +1,45 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdrain_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/smbdriver/smbdrain"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProcProcesses", func() {
+	var (
+		procDir   string
+		processes smbdrain.Processes
+	)
+
+	BeforeEach(func() {
+		var err error
+		procDir, err = os.MkdirTemp("", "proc")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, procDir)
+
+		for pid, comm := range map[string]string{"1": "systemd\n", "1234": "smbdriver\n", "5678": "rep-helper\n"} {
+			Expect(os.Mkdir(filepath.Join(procDir, pid), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(procDir, pid, "comm"), []byte(comm), 0644)).To(Succeed())
+		}
+		Expect(os.Mkdir(filepath.Join(procDir, "self"), 0755)).To(Succeed())
+
+		processes = smbdrain.NewProcProcesses(procDir)
+	})
+
+	It("finds processes by pid", func() {
+		Expect(processes.Running(1234)).To(BeTrue())
+		Expect(processes.Running(4321)).To(BeFalse())
+	})
+
+	It("finds processes by their exact name", func() {
+		Expect(processes.RunningNamed("smbdriver")).To(BeTrue())
+		Expect(processes.RunningNamed("rep")).To(BeFalse())
+	})
+})
@@ -0,0 +1,13 @@
+package smbdrain_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbdrain(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbdrain Suite")
+}
@@ -0,0 +1,112 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package smbdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+type FakeCapacityReporter struct {
+	CapacityStub        func(dockerdriver.Env) []driveradmin.VolumeCapacity
+	capacityMutex       sync.RWMutex
+	capacityArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	capacityReturns struct {
+		result1 []driveradmin.VolumeCapacity
+	}
+	capacityReturnsOnCall map[int]struct {
+		result1 []driveradmin.VolumeCapacity
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeCapacityReporter) Capacity(arg1 dockerdriver.Env) []driveradmin.VolumeCapacity {
+	fake.capacityMutex.Lock()
+	ret, specificReturn := fake.capacityReturnsOnCall[len(fake.capacityArgsForCall)]
+	fake.capacityArgsForCall = append(fake.capacityArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.CapacityStub
+	fakeReturns := fake.capacityReturns
+	fake.recordInvocation("Capacity", []interface{}{arg1})
+	fake.capacityMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCapacityReporter) CapacityCallCount() int {
+	fake.capacityMutex.RLock()
+	defer fake.capacityMutex.RUnlock()
+	return len(fake.capacityArgsForCall)
+}
+
+func (fake *FakeCapacityReporter) CapacityCalls(stub func(dockerdriver.Env) []driveradmin.VolumeCapacity) {
+	fake.capacityMutex.Lock()
+	defer fake.capacityMutex.Unlock()
+	fake.CapacityStub = stub
+}
+
+func (fake *FakeCapacityReporter) CapacityArgsForCall(i int) dockerdriver.Env {
+	fake.capacityMutex.RLock()
+	defer fake.capacityMutex.RUnlock()
+	argsForCall := fake.capacityArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCapacityReporter) CapacityReturns(result1 []driveradmin.VolumeCapacity) {
+	fake.capacityMutex.Lock()
+	defer fake.capacityMutex.Unlock()
+	fake.CapacityStub = nil
+	fake.capacityReturns = struct {
+		result1 []driveradmin.VolumeCapacity
+	}{result1}
+}
+
+func (fake *FakeCapacityReporter) CapacityReturnsOnCall(i int, result1 []driveradmin.VolumeCapacity) {
+	fake.capacityMutex.Lock()
+	defer fake.capacityMutex.Unlock()
+	fake.CapacityStub = nil
+	if fake.capacityReturnsOnCall == nil {
+		fake.capacityReturnsOnCall = make(map[int]struct {
+			result1 []driveradmin.VolumeCapacity
+		})
+	}
+	fake.capacityReturnsOnCall[i] = struct {
+		result1 []driveradmin.VolumeCapacity
+	}{result1}
+}
+
+func (fake *FakeCapacityReporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.capacityMutex.RLock()
+	defer fake.capacityMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeCapacityReporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.CapacityReporter = new(FakeCapacityReporter)
@@ -0,0 +1,112 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package smbdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+type FakeCifsStatsReporter struct {
+	CifsStatsStub        func(dockerdriver.Env) driveradmin.CifsStats
+	cifsStatsMutex       sync.RWMutex
+	cifsStatsArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	cifsStatsReturns struct {
+		result1 driveradmin.CifsStats
+	}
+	cifsStatsReturnsOnCall map[int]struct {
+		result1 driveradmin.CifsStats
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeCifsStatsReporter) CifsStats(arg1 dockerdriver.Env) driveradmin.CifsStats {
+	fake.cifsStatsMutex.Lock()
+	ret, specificReturn := fake.cifsStatsReturnsOnCall[len(fake.cifsStatsArgsForCall)]
+	fake.cifsStatsArgsForCall = append(fake.cifsStatsArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.CifsStatsStub
+	fakeReturns := fake.cifsStatsReturns
+	fake.recordInvocation("CifsStats", []interface{}{arg1})
+	fake.cifsStatsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCifsStatsReporter) CifsStatsCallCount() int {
+	fake.cifsStatsMutex.RLock()
+	defer fake.cifsStatsMutex.RUnlock()
+	return len(fake.cifsStatsArgsForCall)
+}
+
+func (fake *FakeCifsStatsReporter) CifsStatsCalls(stub func(dockerdriver.Env) driveradmin.CifsStats) {
+	fake.cifsStatsMutex.Lock()
+	defer fake.cifsStatsMutex.Unlock()
+	fake.CifsStatsStub = stub
+}
+
+func (fake *FakeCifsStatsReporter) CifsStatsArgsForCall(i int) dockerdriver.Env {
+	fake.cifsStatsMutex.RLock()
+	defer fake.cifsStatsMutex.RUnlock()
+	argsForCall := fake.cifsStatsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCifsStatsReporter) CifsStatsReturns(result1 driveradmin.CifsStats) {
+	fake.cifsStatsMutex.Lock()
+	defer fake.cifsStatsMutex.Unlock()
+	fake.CifsStatsStub = nil
+	fake.cifsStatsReturns = struct {
+		result1 driveradmin.CifsStats
+	}{result1}
+}
+
+func (fake *FakeCifsStatsReporter) CifsStatsReturnsOnCall(i int, result1 driveradmin.CifsStats) {
+	fake.cifsStatsMutex.Lock()
+	defer fake.cifsStatsMutex.Unlock()
+	fake.CifsStatsStub = nil
+	if fake.cifsStatsReturnsOnCall == nil {
+		fake.cifsStatsReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.CifsStats
+		})
+	}
+	fake.cifsStatsReturnsOnCall[i] = struct {
+		result1 driveradmin.CifsStats
+	}{result1}
+}
+
+func (fake *FakeCifsStatsReporter) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.cifsStatsMutex.RLock()
+	defer fake.cifsStatsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeCifsStatsReporter) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.CifsStatsReporter = new(FakeCifsStatsReporter)
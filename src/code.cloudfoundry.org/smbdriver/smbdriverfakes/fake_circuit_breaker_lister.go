@@ -0,0 +1,112 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package smbdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+type FakeCircuitBreakerLister struct {
+	CircuitBreakersStub        func(dockerdriver.Env) []driveradmin.CircuitBreaker
+	circuitBreakersMutex       sync.RWMutex
+	circuitBreakersArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	circuitBreakersReturns struct {
+		result1 []driveradmin.CircuitBreaker
+	}
+	circuitBreakersReturnsOnCall map[int]struct {
+		result1 []driveradmin.CircuitBreaker
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeCircuitBreakerLister) CircuitBreakers(arg1 dockerdriver.Env) []driveradmin.CircuitBreaker {
+	fake.circuitBreakersMutex.Lock()
+	ret, specificReturn := fake.circuitBreakersReturnsOnCall[len(fake.circuitBreakersArgsForCall)]
+	fake.circuitBreakersArgsForCall = append(fake.circuitBreakersArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.CircuitBreakersStub
+	fakeReturns := fake.circuitBreakersReturns
+	fake.recordInvocation("CircuitBreakers", []interface{}{arg1})
+	fake.circuitBreakersMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeCircuitBreakerLister) CircuitBreakersCallCount() int {
+	fake.circuitBreakersMutex.RLock()
+	defer fake.circuitBreakersMutex.RUnlock()
+	return len(fake.circuitBreakersArgsForCall)
+}
+
+func (fake *FakeCircuitBreakerLister) CircuitBreakersCalls(stub func(dockerdriver.Env) []driveradmin.CircuitBreaker) {
+	fake.circuitBreakersMutex.Lock()
+	defer fake.circuitBreakersMutex.Unlock()
+	fake.CircuitBreakersStub = stub
+}
+
+func (fake *FakeCircuitBreakerLister) CircuitBreakersArgsForCall(i int) dockerdriver.Env {
+	fake.circuitBreakersMutex.RLock()
+	defer fake.circuitBreakersMutex.RUnlock()
+	argsForCall := fake.circuitBreakersArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeCircuitBreakerLister) CircuitBreakersReturns(result1 []driveradmin.CircuitBreaker) {
+	fake.circuitBreakersMutex.Lock()
+	defer fake.circuitBreakersMutex.Unlock()
+	fake.CircuitBreakersStub = nil
+	fake.circuitBreakersReturns = struct {
+		result1 []driveradmin.CircuitBreaker
+	}{result1}
+}
+
+func (fake *FakeCircuitBreakerLister) CircuitBreakersReturnsOnCall(i int, result1 []driveradmin.CircuitBreaker) {
+	fake.circuitBreakersMutex.Lock()
+	defer fake.circuitBreakersMutex.Unlock()
+	fake.CircuitBreakersStub = nil
+	if fake.circuitBreakersReturnsOnCall == nil {
+		fake.circuitBreakersReturnsOnCall = make(map[int]struct {
+			result1 []driveradmin.CircuitBreaker
+		})
+	}
+	fake.circuitBreakersReturnsOnCall[i] = struct {
+		result1 []driveradmin.CircuitBreaker
+	}{result1}
+}
+
+func (fake *FakeCircuitBreakerLister) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.circuitBreakersMutex.RLock()
+	defer fake.circuitBreakersMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeCircuitBreakerLister) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.CircuitBreakerLister = new(FakeCircuitBreakerLister)
@@ -9,6 +9,39 @@ import (
 )
 
 type FakeDriverAdmin struct {
+	CapacityStub        func(dockerdriver.Env) driveradmin.CapacityResponse
+	capacityMutex       sync.RWMutex
+	capacityArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	capacityReturns struct {
+		result1 driveradmin.CapacityResponse
+	}
+	capacityReturnsOnCall map[int]struct {
+		result1 driveradmin.CapacityResponse
+	}
+	CifsStatsStub        func(dockerdriver.Env) driveradmin.CifsStatsResponse
+	cifsStatsMutex       sync.RWMutex
+	cifsStatsArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	cifsStatsReturns struct {
+		result1 driveradmin.CifsStatsResponse
+	}
+	cifsStatsReturnsOnCall map[int]struct {
+		result1 driveradmin.CifsStatsResponse
+	}
+	CircuitBreakersStub        func(dockerdriver.Env) driveradmin.CircuitBreakersResponse
+	circuitBreakersMutex       sync.RWMutex
+	circuitBreakersArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	circuitBreakersReturns struct {
+		result1 driveradmin.CircuitBreakersResponse
+	}
+	circuitBreakersReturnsOnCall map[int]struct {
+		result1 driveradmin.CircuitBreakersResponse
+	}
 	EvacuateStub        func(dockerdriver.Env) driveradmin.ErrorResponse
 	evacuateMutex       sync.RWMutex
 	evacuateArgsForCall []struct {
@@ -20,6 +53,28 @@ type FakeDriverAdmin struct {
 	evacuateReturnsOnCall map[int]struct {
 		result1 driveradmin.ErrorResponse
 	}
+	FaultsStub        func(dockerdriver.Env) driveradmin.FaultsResponse
+	faultsMutex       sync.RWMutex
+	faultsArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	faultsReturns struct {
+		result1 driveradmin.FaultsResponse
+	}
+	faultsReturnsOnCall map[int]struct {
+		result1 driveradmin.FaultsResponse
+	}
+	MountsStub        func(dockerdriver.Env) driveradmin.MountsResponse
+	mountsMutex       sync.RWMutex
+	mountsArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	mountsReturns struct {
+		result1 driveradmin.MountsResponse
+	}
+	mountsReturnsOnCall map[int]struct {
+		result1 driveradmin.MountsResponse
+	}
 	PingStub        func(dockerdriver.Env) driveradmin.ErrorResponse
 	pingMutex       sync.RWMutex
 	pingArgsForCall []struct {
@@ -31,10 +86,205 @@ type FakeDriverAdmin struct {
 	pingReturnsOnCall map[int]struct {
 		result1 driveradmin.ErrorResponse
 	}
+	SetFaultsStub        func(dockerdriver.Env, []driveradmin.Fault) driveradmin.ErrorResponse
+	setFaultsMutex       sync.RWMutex
+	setFaultsArgsForCall []struct {
+		arg1 dockerdriver.Env
+		arg2 []driveradmin.Fault
+	}
+	setFaultsReturns struct {
+		result1 driveradmin.ErrorResponse
+	}
+	setFaultsReturnsOnCall map[int]struct {
+		result1 driveradmin.ErrorResponse
+	}
 	invocations      map[string][][]interface{}
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeDriverAdmin) Capacity(arg1 dockerdriver.Env) driveradmin.CapacityResponse {
+	fake.capacityMutex.Lock()
+	ret, specificReturn := fake.capacityReturnsOnCall[len(fake.capacityArgsForCall)]
+	fake.capacityArgsForCall = append(fake.capacityArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.CapacityStub
+	fakeReturns := fake.capacityReturns
+	fake.recordInvocation("Capacity", []interface{}{arg1})
+	fake.capacityMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) CapacityCallCount() int {
+	fake.capacityMutex.RLock()
+	defer fake.capacityMutex.RUnlock()
+	return len(fake.capacityArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) CapacityCalls(stub func(dockerdriver.Env) driveradmin.CapacityResponse) {
+	fake.capacityMutex.Lock()
+	defer fake.capacityMutex.Unlock()
+	fake.CapacityStub = stub
+}
+
+func (fake *FakeDriverAdmin) CapacityArgsForCall(i int) dockerdriver.Env {
+	fake.capacityMutex.RLock()
+	defer fake.capacityMutex.RUnlock()
+	argsForCall := fake.capacityArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) CapacityReturns(result1 driveradmin.CapacityResponse) {
+	fake.capacityMutex.Lock()
+	defer fake.capacityMutex.Unlock()
+	fake.CapacityStub = nil
+	fake.capacityReturns = struct {
+		result1 driveradmin.CapacityResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) CapacityReturnsOnCall(i int, result1 driveradmin.CapacityResponse) {
+	fake.capacityMutex.Lock()
+	defer fake.capacityMutex.Unlock()
+	fake.CapacityStub = nil
+	if fake.capacityReturnsOnCall == nil {
+		fake.capacityReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.CapacityResponse
+		})
+	}
+	fake.capacityReturnsOnCall[i] = struct {
+		result1 driveradmin.CapacityResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) CifsStats(arg1 dockerdriver.Env) driveradmin.CifsStatsResponse {
+	fake.cifsStatsMutex.Lock()
+	ret, specificReturn := fake.cifsStatsReturnsOnCall[len(fake.cifsStatsArgsForCall)]
+	fake.cifsStatsArgsForCall = append(fake.cifsStatsArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.CifsStatsStub
+	fakeReturns := fake.cifsStatsReturns
+	fake.recordInvocation("CifsStats", []interface{}{arg1})
+	fake.cifsStatsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) CifsStatsCallCount() int {
+	fake.cifsStatsMutex.RLock()
+	defer fake.cifsStatsMutex.RUnlock()
+	return len(fake.cifsStatsArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) CifsStatsCalls(stub func(dockerdriver.Env) driveradmin.CifsStatsResponse) {
+	fake.cifsStatsMutex.Lock()
+	defer fake.cifsStatsMutex.Unlock()
+	fake.CifsStatsStub = stub
+}
+
+func (fake *FakeDriverAdmin) CifsStatsArgsForCall(i int) dockerdriver.Env {
+	fake.cifsStatsMutex.RLock()
+	defer fake.cifsStatsMutex.RUnlock()
+	argsForCall := fake.cifsStatsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) CifsStatsReturns(result1 driveradmin.CifsStatsResponse) {
+	fake.cifsStatsMutex.Lock()
+	defer fake.cifsStatsMutex.Unlock()
+	fake.CifsStatsStub = nil
+	fake.cifsStatsReturns = struct {
+		result1 driveradmin.CifsStatsResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) CifsStatsReturnsOnCall(i int, result1 driveradmin.CifsStatsResponse) {
+	fake.cifsStatsMutex.Lock()
+	defer fake.cifsStatsMutex.Unlock()
+	fake.CifsStatsStub = nil
+	if fake.cifsStatsReturnsOnCall == nil {
+		fake.cifsStatsReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.CifsStatsResponse
+		})
+	}
+	fake.cifsStatsReturnsOnCall[i] = struct {
+		result1 driveradmin.CifsStatsResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) CircuitBreakers(arg1 dockerdriver.Env) driveradmin.CircuitBreakersResponse {
+	fake.circuitBreakersMutex.Lock()
+	ret, specificReturn := fake.circuitBreakersReturnsOnCall[len(fake.circuitBreakersArgsForCall)]
+	fake.circuitBreakersArgsForCall = append(fake.circuitBreakersArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.CircuitBreakersStub
+	fakeReturns := fake.circuitBreakersReturns
+	fake.recordInvocation("CircuitBreakers", []interface{}{arg1})
+	fake.circuitBreakersMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) CircuitBreakersCallCount() int {
+	fake.circuitBreakersMutex.RLock()
+	defer fake.circuitBreakersMutex.RUnlock()
+	return len(fake.circuitBreakersArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) CircuitBreakersCalls(stub func(dockerdriver.Env) driveradmin.CircuitBreakersResponse) {
+	fake.circuitBreakersMutex.Lock()
+	defer fake.circuitBreakersMutex.Unlock()
+	fake.CircuitBreakersStub = stub
+}
+
+func (fake *FakeDriverAdmin) CircuitBreakersArgsForCall(i int) dockerdriver.Env {
+	fake.circuitBreakersMutex.RLock()
+	defer fake.circuitBreakersMutex.RUnlock()
+	argsForCall := fake.circuitBreakersArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) CircuitBreakersReturns(result1 driveradmin.CircuitBreakersResponse) {
+	fake.circuitBreakersMutex.Lock()
+	defer fake.circuitBreakersMutex.Unlock()
+	fake.CircuitBreakersStub = nil
+	fake.circuitBreakersReturns = struct {
+		result1 driveradmin.CircuitBreakersResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) CircuitBreakersReturnsOnCall(i int, result1 driveradmin.CircuitBreakersResponse) {
+	fake.circuitBreakersMutex.Lock()
+	defer fake.circuitBreakersMutex.Unlock()
+	fake.CircuitBreakersStub = nil
+	if fake.circuitBreakersReturnsOnCall == nil {
+		fake.circuitBreakersReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.CircuitBreakersResponse
+		})
+	}
+	fake.circuitBreakersReturnsOnCall[i] = struct {
+		result1 driveradmin.CircuitBreakersResponse
+	}{result1}
+}
+
 func (fake *FakeDriverAdmin) Evacuate(arg1 dockerdriver.Env) driveradmin.ErrorResponse {
 	fake.evacuateMutex.Lock()
 	ret, specificReturn := fake.evacuateReturnsOnCall[len(fake.evacuateArgsForCall)]
@@ -96,6 +346,128 @@ func (fake *FakeDriverAdmin) EvacuateReturnsOnCall(i int, result1 driveradmin.Er
 	}{result1}
 }
 
+func (fake *FakeDriverAdmin) Faults(arg1 dockerdriver.Env) driveradmin.FaultsResponse {
+	fake.faultsMutex.Lock()
+	ret, specificReturn := fake.faultsReturnsOnCall[len(fake.faultsArgsForCall)]
+	fake.faultsArgsForCall = append(fake.faultsArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.FaultsStub
+	fakeReturns := fake.faultsReturns
+	fake.recordInvocation("Faults", []interface{}{arg1})
+	fake.faultsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) FaultsCallCount() int {
+	fake.faultsMutex.RLock()
+	defer fake.faultsMutex.RUnlock()
+	return len(fake.faultsArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) FaultsCalls(stub func(dockerdriver.Env) driveradmin.FaultsResponse) {
+	fake.faultsMutex.Lock()
+	defer fake.faultsMutex.Unlock()
+	fake.FaultsStub = stub
+}
+
+func (fake *FakeDriverAdmin) FaultsArgsForCall(i int) dockerdriver.Env {
+	fake.faultsMutex.RLock()
+	defer fake.faultsMutex.RUnlock()
+	argsForCall := fake.faultsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) FaultsReturns(result1 driveradmin.FaultsResponse) {
+	fake.faultsMutex.Lock()
+	defer fake.faultsMutex.Unlock()
+	fake.FaultsStub = nil
+	fake.faultsReturns = struct {
+		result1 driveradmin.FaultsResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) FaultsReturnsOnCall(i int, result1 driveradmin.FaultsResponse) {
+	fake.faultsMutex.Lock()
+	defer fake.faultsMutex.Unlock()
+	fake.FaultsStub = nil
+	if fake.faultsReturnsOnCall == nil {
+		fake.faultsReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.FaultsResponse
+		})
+	}
+	fake.faultsReturnsOnCall[i] = struct {
+		result1 driveradmin.FaultsResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) Mounts(arg1 dockerdriver.Env) driveradmin.MountsResponse {
+	fake.mountsMutex.Lock()
+	ret, specificReturn := fake.mountsReturnsOnCall[len(fake.mountsArgsForCall)]
+	fake.mountsArgsForCall = append(fake.mountsArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.MountsStub
+	fakeReturns := fake.mountsReturns
+	fake.recordInvocation("Mounts", []interface{}{arg1})
+	fake.mountsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) MountsCallCount() int {
+	fake.mountsMutex.RLock()
+	defer fake.mountsMutex.RUnlock()
+	return len(fake.mountsArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) MountsCalls(stub func(dockerdriver.Env) driveradmin.MountsResponse) {
+	fake.mountsMutex.Lock()
+	defer fake.mountsMutex.Unlock()
+	fake.MountsStub = stub
+}
+
+func (fake *FakeDriverAdmin) MountsArgsForCall(i int) dockerdriver.Env {
+	fake.mountsMutex.RLock()
+	defer fake.mountsMutex.RUnlock()
+	argsForCall := fake.mountsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeDriverAdmin) MountsReturns(result1 driveradmin.MountsResponse) {
+	fake.mountsMutex.Lock()
+	defer fake.mountsMutex.Unlock()
+	fake.MountsStub = nil
+	fake.mountsReturns = struct {
+		result1 driveradmin.MountsResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) MountsReturnsOnCall(i int, result1 driveradmin.MountsResponse) {
+	fake.mountsMutex.Lock()
+	defer fake.mountsMutex.Unlock()
+	fake.MountsStub = nil
+	if fake.mountsReturnsOnCall == nil {
+		fake.mountsReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.MountsResponse
+		})
+	}
+	fake.mountsReturnsOnCall[i] = struct {
+		result1 driveradmin.MountsResponse
+	}{result1}
+}
+
 func (fake *FakeDriverAdmin) Ping(arg1 dockerdriver.Env) driveradmin.ErrorResponse {
 	fake.pingMutex.Lock()
 	ret, specificReturn := fake.pingReturnsOnCall[len(fake.pingArgsForCall)]
@@ -157,13 +529,92 @@ func (fake *FakeDriverAdmin) PingReturnsOnCall(i int, result1 driveradmin.ErrorR
 	}{result1}
 }
 
+func (fake *FakeDriverAdmin) SetFaults(arg1 dockerdriver.Env, arg2 []driveradmin.Fault) driveradmin.ErrorResponse {
+	var arg2Copy []driveradmin.Fault
+	if arg2 != nil {
+		arg2Copy = make([]driveradmin.Fault, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.setFaultsMutex.Lock()
+	ret, specificReturn := fake.setFaultsReturnsOnCall[len(fake.setFaultsArgsForCall)]
+	fake.setFaultsArgsForCall = append(fake.setFaultsArgsForCall, struct {
+		arg1 dockerdriver.Env
+		arg2 []driveradmin.Fault
+	}{arg1, arg2Copy})
+	stub := fake.SetFaultsStub
+	fakeReturns := fake.setFaultsReturns
+	fake.recordInvocation("SetFaults", []interface{}{arg1, arg2Copy})
+	fake.setFaultsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeDriverAdmin) SetFaultsCallCount() int {
+	fake.setFaultsMutex.RLock()
+	defer fake.setFaultsMutex.RUnlock()
+	return len(fake.setFaultsArgsForCall)
+}
+
+func (fake *FakeDriverAdmin) SetFaultsCalls(stub func(dockerdriver.Env, []driveradmin.Fault) driveradmin.ErrorResponse) {
+	fake.setFaultsMutex.Lock()
+	defer fake.setFaultsMutex.Unlock()
+	fake.SetFaultsStub = stub
+}
+
+func (fake *FakeDriverAdmin) SetFaultsArgsForCall(i int) (dockerdriver.Env, []driveradmin.Fault) {
+	fake.setFaultsMutex.RLock()
+	defer fake.setFaultsMutex.RUnlock()
+	argsForCall := fake.setFaultsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeDriverAdmin) SetFaultsReturns(result1 driveradmin.ErrorResponse) {
+	fake.setFaultsMutex.Lock()
+	defer fake.setFaultsMutex.Unlock()
+	fake.SetFaultsStub = nil
+	fake.setFaultsReturns = struct {
+		result1 driveradmin.ErrorResponse
+	}{result1}
+}
+
+func (fake *FakeDriverAdmin) SetFaultsReturnsOnCall(i int, result1 driveradmin.ErrorResponse) {
+	fake.setFaultsMutex.Lock()
+	defer fake.setFaultsMutex.Unlock()
+	fake.SetFaultsStub = nil
+	if fake.setFaultsReturnsOnCall == nil {
+		fake.setFaultsReturnsOnCall = make(map[int]struct {
+			result1 driveradmin.ErrorResponse
+		})
+	}
+	fake.setFaultsReturnsOnCall[i] = struct {
+		result1 driveradmin.ErrorResponse
+	}{result1}
+}
+
 func (fake *FakeDriverAdmin) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.capacityMutex.RLock()
+	defer fake.capacityMutex.RUnlock()
+	fake.cifsStatsMutex.RLock()
+	defer fake.cifsStatsMutex.RUnlock()
+	fake.circuitBreakersMutex.RLock()
+	defer fake.circuitBreakersMutex.RUnlock()
 	fake.evacuateMutex.RLock()
 	defer fake.evacuateMutex.RUnlock()
+	fake.faultsMutex.RLock()
+	defer fake.faultsMutex.RUnlock()
+	fake.mountsMutex.RLock()
+	defer fake.mountsMutex.RUnlock()
 	fake.pingMutex.RLock()
 	defer fake.pingMutex.RUnlock()
+	fake.setFaultsMutex.RLock()
+	defer fake.setFaultsMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
 	for key, value := range fake.invocations {
 		copiedInvocations[key] = value
@@ -0,0 +1,112 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package smbdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+type FakeEvacuationGuard struct {
+	CheckEvacuateStub        func(dockerdriver.Env) error
+	checkEvacuateMutex       sync.RWMutex
+	checkEvacuateArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	checkEvacuateReturns struct {
+		result1 error
+	}
+	checkEvacuateReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeEvacuationGuard) CheckEvacuate(arg1 dockerdriver.Env) error {
+	fake.checkEvacuateMutex.Lock()
+	ret, specificReturn := fake.checkEvacuateReturnsOnCall[len(fake.checkEvacuateArgsForCall)]
+	fake.checkEvacuateArgsForCall = append(fake.checkEvacuateArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.CheckEvacuateStub
+	fakeReturns := fake.checkEvacuateReturns
+	fake.recordInvocation("CheckEvacuate", []interface{}{arg1})
+	fake.checkEvacuateMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeEvacuationGuard) CheckEvacuateCallCount() int {
+	fake.checkEvacuateMutex.RLock()
+	defer fake.checkEvacuateMutex.RUnlock()
+	return len(fake.checkEvacuateArgsForCall)
+}
+
+func (fake *FakeEvacuationGuard) CheckEvacuateCalls(stub func(dockerdriver.Env) error) {
+	fake.checkEvacuateMutex.Lock()
+	defer fake.checkEvacuateMutex.Unlock()
+	fake.CheckEvacuateStub = stub
+}
+
+func (fake *FakeEvacuationGuard) CheckEvacuateArgsForCall(i int) dockerdriver.Env {
+	fake.checkEvacuateMutex.RLock()
+	defer fake.checkEvacuateMutex.RUnlock()
+	argsForCall := fake.checkEvacuateArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeEvacuationGuard) CheckEvacuateReturns(result1 error) {
+	fake.checkEvacuateMutex.Lock()
+	defer fake.checkEvacuateMutex.Unlock()
+	fake.CheckEvacuateStub = nil
+	fake.checkEvacuateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEvacuationGuard) CheckEvacuateReturnsOnCall(i int, result1 error) {
+	fake.checkEvacuateMutex.Lock()
+	defer fake.checkEvacuateMutex.Unlock()
+	fake.CheckEvacuateStub = nil
+	if fake.checkEvacuateReturnsOnCall == nil {
+		fake.checkEvacuateReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.checkEvacuateReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEvacuationGuard) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.checkEvacuateMutex.RLock()
+	defer fake.checkEvacuateMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeEvacuationGuard) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.EvacuationGuard = new(FakeEvacuationGuard)
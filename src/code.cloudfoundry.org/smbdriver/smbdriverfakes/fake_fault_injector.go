@@ -0,0 +1,193 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package smbdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+type FakeFaultInjector struct {
+	FaultsStub        func(dockerdriver.Env) []driveradmin.Fault
+	faultsMutex       sync.RWMutex
+	faultsArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	faultsReturns struct {
+		result1 []driveradmin.Fault
+	}
+	faultsReturnsOnCall map[int]struct {
+		result1 []driveradmin.Fault
+	}
+	SetFaultsStub        func(dockerdriver.Env, []driveradmin.Fault) error
+	setFaultsMutex       sync.RWMutex
+	setFaultsArgsForCall []struct {
+		arg1 dockerdriver.Env
+		arg2 []driveradmin.Fault
+	}
+	setFaultsReturns struct {
+		result1 error
+	}
+	setFaultsReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeFaultInjector) Faults(arg1 dockerdriver.Env) []driveradmin.Fault {
+	fake.faultsMutex.Lock()
+	ret, specificReturn := fake.faultsReturnsOnCall[len(fake.faultsArgsForCall)]
+	fake.faultsArgsForCall = append(fake.faultsArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.FaultsStub
+	fakeReturns := fake.faultsReturns
+	fake.recordInvocation("Faults", []interface{}{arg1})
+	fake.faultsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeFaultInjector) FaultsCallCount() int {
+	fake.faultsMutex.RLock()
+	defer fake.faultsMutex.RUnlock()
+	return len(fake.faultsArgsForCall)
+}
+
+func (fake *FakeFaultInjector) FaultsCalls(stub func(dockerdriver.Env) []driveradmin.Fault) {
+	fake.faultsMutex.Lock()
+	defer fake.faultsMutex.Unlock()
+	fake.FaultsStub = stub
+}
+
+func (fake *FakeFaultInjector) FaultsArgsForCall(i int) dockerdriver.Env {
+	fake.faultsMutex.RLock()
+	defer fake.faultsMutex.RUnlock()
+	argsForCall := fake.faultsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeFaultInjector) FaultsReturns(result1 []driveradmin.Fault) {
+	fake.faultsMutex.Lock()
+	defer fake.faultsMutex.Unlock()
+	fake.FaultsStub = nil
+	fake.faultsReturns = struct {
+		result1 []driveradmin.Fault
+	}{result1}
+}
+
+func (fake *FakeFaultInjector) FaultsReturnsOnCall(i int, result1 []driveradmin.Fault) {
+	fake.faultsMutex.Lock()
+	defer fake.faultsMutex.Unlock()
+	fake.FaultsStub = nil
+	if fake.faultsReturnsOnCall == nil {
+		fake.faultsReturnsOnCall = make(map[int]struct {
+			result1 []driveradmin.Fault
+		})
+	}
+	fake.faultsReturnsOnCall[i] = struct {
+		result1 []driveradmin.Fault
+	}{result1}
+}
+
+func (fake *FakeFaultInjector) SetFaults(arg1 dockerdriver.Env, arg2 []driveradmin.Fault) error {
+	var arg2Copy []driveradmin.Fault
+	if arg2 != nil {
+		arg2Copy = make([]driveradmin.Fault, len(arg2))
+		copy(arg2Copy, arg2)
+	}
+	fake.setFaultsMutex.Lock()
+	ret, specificReturn := fake.setFaultsReturnsOnCall[len(fake.setFaultsArgsForCall)]
+	fake.setFaultsArgsForCall = append(fake.setFaultsArgsForCall, struct {
+		arg1 dockerdriver.Env
+		arg2 []driveradmin.Fault
+	}{arg1, arg2Copy})
+	stub := fake.SetFaultsStub
+	fakeReturns := fake.setFaultsReturns
+	fake.recordInvocation("SetFaults", []interface{}{arg1, arg2Copy})
+	fake.setFaultsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeFaultInjector) SetFaultsCallCount() int {
+	fake.setFaultsMutex.RLock()
+	defer fake.setFaultsMutex.RUnlock()
+	return len(fake.setFaultsArgsForCall)
+}
+
+func (fake *FakeFaultInjector) SetFaultsCalls(stub func(dockerdriver.Env, []driveradmin.Fault) error) {
+	fake.setFaultsMutex.Lock()
+	defer fake.setFaultsMutex.Unlock()
+	fake.SetFaultsStub = stub
+}
+
+func (fake *FakeFaultInjector) SetFaultsArgsForCall(i int) (dockerdriver.Env, []driveradmin.Fault) {
+	fake.setFaultsMutex.RLock()
+	defer fake.setFaultsMutex.RUnlock()
+	argsForCall := fake.setFaultsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeFaultInjector) SetFaultsReturns(result1 error) {
+	fake.setFaultsMutex.Lock()
+	defer fake.setFaultsMutex.Unlock()
+	fake.SetFaultsStub = nil
+	fake.setFaultsReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFaultInjector) SetFaultsReturnsOnCall(i int, result1 error) {
+	fake.setFaultsMutex.Lock()
+	defer fake.setFaultsMutex.Unlock()
+	fake.SetFaultsStub = nil
+	if fake.setFaultsReturnsOnCall == nil {
+		fake.setFaultsReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.setFaultsReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeFaultInjector) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.faultsMutex.RLock()
+	defer fake.faultsMutex.RUnlock()
+	fake.setFaultsMutex.RLock()
+	defer fake.setFaultsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeFaultInjector) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.FaultInjector = new(FakeFaultInjector)
@@ -0,0 +1,172 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package smbdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/smbdriver"
+)
+
+type FakeKernelLog struct {
+	CloseStub        func() error
+	closeMutex       sync.RWMutex
+	closeArgsForCall []struct {
+	}
+	closeReturns struct {
+		result1 error
+	}
+	closeReturnsOnCall map[int]struct {
+		result1 error
+	}
+	MessagesStub        func() ([]string, error)
+	messagesMutex       sync.RWMutex
+	messagesArgsForCall []struct {
+	}
+	messagesReturns struct {
+		result1 []string
+		result2 error
+	}
+	messagesReturnsOnCall map[int]struct {
+		result1 []string
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeKernelLog) Close() error {
+	fake.closeMutex.Lock()
+	ret, specificReturn := fake.closeReturnsOnCall[len(fake.closeArgsForCall)]
+	fake.closeArgsForCall = append(fake.closeArgsForCall, struct {
+	}{})
+	stub := fake.CloseStub
+	fakeReturns := fake.closeReturns
+	fake.recordInvocation("Close", []interface{}{})
+	fake.closeMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeKernelLog) CloseCallCount() int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return len(fake.closeArgsForCall)
+}
+
+func (fake *FakeKernelLog) CloseCalls(stub func() error) {
+	fake.closeMutex.Lock()
+	defer fake.closeMutex.Unlock()
+	fake.CloseStub = stub
+}
+
+func (fake *FakeKernelLog) CloseReturns(result1 error) {
+	fake.closeMutex.Lock()
+	defer fake.closeMutex.Unlock()
+	fake.CloseStub = nil
+	fake.closeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKernelLog) CloseReturnsOnCall(i int, result1 error) {
+	fake.closeMutex.Lock()
+	defer fake.closeMutex.Unlock()
+	fake.CloseStub = nil
+	if fake.closeReturnsOnCall == nil {
+		fake.closeReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.closeReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeKernelLog) Messages() ([]string, error) {
+	fake.messagesMutex.Lock()
+	ret, specificReturn := fake.messagesReturnsOnCall[len(fake.messagesArgsForCall)]
+	fake.messagesArgsForCall = append(fake.messagesArgsForCall, struct {
+	}{})
+	stub := fake.MessagesStub
+	fakeReturns := fake.messagesReturns
+	fake.recordInvocation("Messages", []interface{}{})
+	fake.messagesMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeKernelLog) MessagesCallCount() int {
+	fake.messagesMutex.RLock()
+	defer fake.messagesMutex.RUnlock()
+	return len(fake.messagesArgsForCall)
+}
+
+func (fake *FakeKernelLog) MessagesCalls(stub func() ([]string, error)) {
+	fake.messagesMutex.Lock()
+	defer fake.messagesMutex.Unlock()
+	fake.MessagesStub = stub
+}
+
+func (fake *FakeKernelLog) MessagesReturns(result1 []string, result2 error) {
+	fake.messagesMutex.Lock()
+	defer fake.messagesMutex.Unlock()
+	fake.MessagesStub = nil
+	fake.messagesReturns = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeKernelLog) MessagesReturnsOnCall(i int, result1 []string, result2 error) {
+	fake.messagesMutex.Lock()
+	defer fake.messagesMutex.Unlock()
+	fake.MessagesStub = nil
+	if fake.messagesReturnsOnCall == nil {
+		fake.messagesReturnsOnCall = make(map[int]struct {
+			result1 []string
+			result2 error
+		})
+	}
+	fake.messagesReturnsOnCall[i] = struct {
+		result1 []string
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeKernelLog) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	fake.messagesMutex.RLock()
+	defer fake.messagesMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeKernelLog) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ smbdriver.KernelLog = new(FakeKernelLog)
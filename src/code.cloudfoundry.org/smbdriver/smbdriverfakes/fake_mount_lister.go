@@ -0,0 +1,112 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package smbdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+type FakeMountLister struct {
+	MountsStub        func(dockerdriver.Env) []driveradmin.Mount
+	mountsMutex       sync.RWMutex
+	mountsArgsForCall []struct {
+		arg1 dockerdriver.Env
+	}
+	mountsReturns struct {
+		result1 []driveradmin.Mount
+	}
+	mountsReturnsOnCall map[int]struct {
+		result1 []driveradmin.Mount
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeMountLister) Mounts(arg1 dockerdriver.Env) []driveradmin.Mount {
+	fake.mountsMutex.Lock()
+	ret, specificReturn := fake.mountsReturnsOnCall[len(fake.mountsArgsForCall)]
+	fake.mountsArgsForCall = append(fake.mountsArgsForCall, struct {
+		arg1 dockerdriver.Env
+	}{arg1})
+	stub := fake.MountsStub
+	fakeReturns := fake.mountsReturns
+	fake.recordInvocation("Mounts", []interface{}{arg1})
+	fake.mountsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeMountLister) MountsCallCount() int {
+	fake.mountsMutex.RLock()
+	defer fake.mountsMutex.RUnlock()
+	return len(fake.mountsArgsForCall)
+}
+
+func (fake *FakeMountLister) MountsCalls(stub func(dockerdriver.Env) []driveradmin.Mount) {
+	fake.mountsMutex.Lock()
+	defer fake.mountsMutex.Unlock()
+	fake.MountsStub = stub
+}
+
+func (fake *FakeMountLister) MountsArgsForCall(i int) dockerdriver.Env {
+	fake.mountsMutex.RLock()
+	defer fake.mountsMutex.RUnlock()
+	argsForCall := fake.mountsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeMountLister) MountsReturns(result1 []driveradmin.Mount) {
+	fake.mountsMutex.Lock()
+	defer fake.mountsMutex.Unlock()
+	fake.MountsStub = nil
+	fake.mountsReturns = struct {
+		result1 []driveradmin.Mount
+	}{result1}
+}
+
+func (fake *FakeMountLister) MountsReturnsOnCall(i int, result1 []driveradmin.Mount) {
+	fake.mountsMutex.Lock()
+	defer fake.mountsMutex.Unlock()
+	fake.MountsStub = nil
+	if fake.mountsReturnsOnCall == nil {
+		fake.mountsReturnsOnCall = make(map[int]struct {
+			result1 []driveradmin.Mount
+		})
+	}
+	fake.mountsReturnsOnCall[i] = struct {
+		result1 []driveradmin.Mount
+	}{result1}
+}
+
+func (fake *FakeMountLister) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.mountsMutex.RLock()
+	defer fake.mountsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeMountLister) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ driveradmin.MountLister = new(FakeMountLister)
@@ -0,0 +1,264 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package smbdriverfakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/smbdriver/smbdrain"
+)
+
+type FakeProcesses struct {
+	KillStub        func(int) error
+	killMutex       sync.RWMutex
+	killArgsForCall []struct {
+		arg1 int
+	}
+	killReturns struct {
+		result1 error
+	}
+	killReturnsOnCall map[int]struct {
+		result1 error
+	}
+	RunningStub        func(int) bool
+	runningMutex       sync.RWMutex
+	runningArgsForCall []struct {
+		arg1 int
+	}
+	runningReturns struct {
+		result1 bool
+	}
+	runningReturnsOnCall map[int]struct {
+		result1 bool
+	}
+	RunningNamedStub        func(string) (bool, error)
+	runningNamedMutex       sync.RWMutex
+	runningNamedArgsForCall []struct {
+		arg1 string
+	}
+	runningNamedReturns struct {
+		result1 bool
+		result2 error
+	}
+	runningNamedReturnsOnCall map[int]struct {
+		result1 bool
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeProcesses) Kill(arg1 int) error {
+	fake.killMutex.Lock()
+	ret, specificReturn := fake.killReturnsOnCall[len(fake.killArgsForCall)]
+	fake.killArgsForCall = append(fake.killArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	stub := fake.KillStub
+	fakeReturns := fake.killReturns
+	fake.recordInvocation("Kill", []interface{}{arg1})
+	fake.killMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeProcesses) KillCallCount() int {
+	fake.killMutex.RLock()
+	defer fake.killMutex.RUnlock()
+	return len(fake.killArgsForCall)
+}
+
+func (fake *FakeProcesses) KillCalls(stub func(int) error) {
+	fake.killMutex.Lock()
+	defer fake.killMutex.Unlock()
+	fake.KillStub = stub
+}
+
+func (fake *FakeProcesses) KillArgsForCall(i int) int {
+	fake.killMutex.RLock()
+	defer fake.killMutex.RUnlock()
+	argsForCall := fake.killArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeProcesses) KillReturns(result1 error) {
+	fake.killMutex.Lock()
+	defer fake.killMutex.Unlock()
+	fake.KillStub = nil
+	fake.killReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeProcesses) KillReturnsOnCall(i int, result1 error) {
+	fake.killMutex.Lock()
+	defer fake.killMutex.Unlock()
+	fake.KillStub = nil
+	if fake.killReturnsOnCall == nil {
+		fake.killReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.killReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeProcesses) Running(arg1 int) bool {
+	fake.runningMutex.Lock()
+	ret, specificReturn := fake.runningReturnsOnCall[len(fake.runningArgsForCall)]
+	fake.runningArgsForCall = append(fake.runningArgsForCall, struct {
+		arg1 int
+	}{arg1})
+	stub := fake.RunningStub
+	fakeReturns := fake.runningReturns
+	fake.recordInvocation("Running", []interface{}{arg1})
+	fake.runningMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeProcesses) RunningCallCount() int {
+	fake.runningMutex.RLock()
+	defer fake.runningMutex.RUnlock()
+	return len(fake.runningArgsForCall)
+}
+
+func (fake *FakeProcesses) RunningCalls(stub func(int) bool) {
+	fake.runningMutex.Lock()
+	defer fake.runningMutex.Unlock()
+	fake.RunningStub = stub
+}
+
+func (fake *FakeProcesses) RunningArgsForCall(i int) int {
+	fake.runningMutex.RLock()
+	defer fake.runningMutex.RUnlock()
+	argsForCall := fake.runningArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeProcesses) RunningReturns(result1 bool) {
+	fake.runningMutex.Lock()
+	defer fake.runningMutex.Unlock()
+	fake.RunningStub = nil
+	fake.runningReturns = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeProcesses) RunningReturnsOnCall(i int, result1 bool) {
+	fake.runningMutex.Lock()
+	defer fake.runningMutex.Unlock()
+	fake.RunningStub = nil
+	if fake.runningReturnsOnCall == nil {
+		fake.runningReturnsOnCall = make(map[int]struct {
+			result1 bool
+		})
+	}
+	fake.runningReturnsOnCall[i] = struct {
+		result1 bool
+	}{result1}
+}
+
+func (fake *FakeProcesses) RunningNamed(arg1 string) (bool, error) {
+	fake.runningNamedMutex.Lock()
+	ret, specificReturn := fake.runningNamedReturnsOnCall[len(fake.runningNamedArgsForCall)]
+	fake.runningNamedArgsForCall = append(fake.runningNamedArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.RunningNamedStub
+	fakeReturns := fake.runningNamedReturns
+	fake.recordInvocation("RunningNamed", []interface{}{arg1})
+	fake.runningNamedMutex.Unlock()
+	if stub != nil {
+		return stub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeProcesses) RunningNamedCallCount() int {
+	fake.runningNamedMutex.RLock()
+	defer fake.runningNamedMutex.RUnlock()
+	return len(fake.runningNamedArgsForCall)
+}
+
+func (fake *FakeProcesses) RunningNamedCalls(stub func(string) (bool, error)) {
+	fake.runningNamedMutex.Lock()
+	defer fake.runningNamedMutex.Unlock()
+	fake.RunningNamedStub = stub
+}
+
+func (fake *FakeProcesses) RunningNamedArgsForCall(i int) string {
+	fake.runningNamedMutex.RLock()
+	defer fake.runningNamedMutex.RUnlock()
+	argsForCall := fake.runningNamedArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *FakeProcesses) RunningNamedReturns(result1 bool, result2 error) {
+	fake.runningNamedMutex.Lock()
+	defer fake.runningNamedMutex.Unlock()
+	fake.RunningNamedStub = nil
+	fake.runningNamedReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeProcesses) RunningNamedReturnsOnCall(i int, result1 bool, result2 error) {
+	fake.runningNamedMutex.Lock()
+	defer fake.runningNamedMutex.Unlock()
+	fake.RunningNamedStub = nil
+	if fake.runningNamedReturnsOnCall == nil {
+		fake.runningNamedReturnsOnCall = make(map[int]struct {
+			result1 bool
+			result2 error
+		})
+	}
+	fake.runningNamedReturnsOnCall[i] = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeProcesses) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.killMutex.RLock()
+	defer fake.killMutex.RUnlock()
+	fake.runningMutex.RLock()
+	defer fake.runningMutex.RUnlock()
+	fake.runningNamedMutex.RLock()
+	defer fake.runningNamedMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeProcesses) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ smbdrain.Processes = new(FakeProcesses)
@@ -0,0 +1,127 @@
+// Package smbfault injects faults into the mount.cifs, umount and mountpoint
+// invocations of the smbdriver, so that operators can rehearse how their
+// apps and the driver behave while an SMB server fails or hangs.
+package smbfault
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+)
+
+const (
+	OperationMount   = "mount"
+	OperationUnmount = "unmount"
+	OperationCheck   = "check"
+)
+
+// DefaultHangErrno is the errno of a hung invocation whose fault sets none.
+const DefaultHangErrno = int(syscall.ETIMEDOUT)
+
+var operations = []string{OperationMount, OperationUnmount, OperationCheck}
+
+// LoadFaults reads a JSON list of faults from path. There are none when path
+// is empty.
+func LoadFaults(path string) ([]driveradmin.Fault, error) {
+	if path == "" {
+		return []driveradmin.Fault{}, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	faults := []driveradmin.Fault{}
+	if err := json.Unmarshal(contents, &faults); err != nil {
+		return nil, fmt.Errorf("cannot parse faults %s: %s", path, err.Error())
+	}
+
+	if _, err := parseFaults(faults); err != nil {
+		return nil, err
+	}
+
+	return faults, nil
+}
+
+type fault struct {
+	driveradmin.Fault
+	hang  time.Duration
+	delay time.Duration
+}
+
+func parseFaults(faults []driveradmin.Fault) ([]fault, error) {
+	parsed := []fault{}
+	for i, f := range faults {
+		p, err := parseFault(f)
+		if err != nil {
+			return nil, fmt.Errorf("fault %d: %s", i, err.Error())
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+func parseFault(f driveradmin.Fault) (fault, error) {
+	p := fault{Fault: f}
+
+	if !slices.Contains(operations, f.Operation) {
+		return fault{}, fmt.Errorf("invalid operation %q: must be one of %s", f.Operation, strings.Join(operations, ", "))
+	}
+	if f.Errno < 0 {
+		return fault{}, fmt.Errorf("invalid errno %d", f.Errno)
+	}
+	if f.Hang != "" && f.Delay != "" {
+		return fault{}, fmt.Errorf("hang and delay cannot both be set")
+	}
+
+	var err error
+	if f.Hang != "" {
+		if p.hang, err = parseDuration(f.Hang); err != nil {
+			return fault{}, fmt.Errorf("invalid hang: %s", err.Error())
+		}
+	}
+	if f.Delay != "" {
+		if p.delay, err = parseDuration(f.Delay); err != nil {
+			return fault{}, fmt.Errorf("invalid delay: %s", err.Error())
+		}
+	}
+
+	if f.Errno == 0 && p.hang == 0 && p.delay == 0 {
+		return fault{}, fmt.Errorf("one of errno, hang or delay must be set")
+	}
+
+	return p, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("%s is not positive", value)
+	}
+	return duration, nil
+}
+
+// matches reports whether the fault applies to an invocation of operation
+// for the volume mounted from host.
+func (f fault) matches(operation, host, volume string) bool {
+	if f.Operation != operation {
+		return false
+	}
+	if f.Host != "" && !strings.EqualFold(f.Host, host) {
+		return false
+	}
+	if f.Volume != "" && f.Volume != volume {
+		return false
+	}
+	return true
+}
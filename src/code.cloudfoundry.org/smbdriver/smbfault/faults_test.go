@@ -0,0 +1,60 @@
+package smbfault_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbfault"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadFaults", func() {
+	var path string
+
+	BeforeEach(func() {
+		dir, err := os.MkdirTemp("", "faults")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		path = filepath.Join(dir, "faults.json")
+	})
+
+	It("loads no faults without a file", func() {
+		faults, err := smbfault.LoadFaults("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(faults).To(BeEmpty())
+	})
+
+	It("loads the faults", func() {
+		Expect(os.WriteFile(path, []byte(`[
+			{"operation": "mount", "host": "server", "errno": 13},
+			{"operation": "unmount", "volume": "vol1", "hang": "2m"},
+			{"operation": "check", "delay": "3s"}
+		]`), 0600)).To(Succeed())
+
+		faults, err := smbfault.LoadFaults(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(faults).To(Equal([]driveradmin.Fault{
+			{Operation: "mount", Host: "server", Errno: 13},
+			{Operation: "unmount", Volume: "vol1", Hang: "2m"},
+			{Operation: "check", Delay: "3s"},
+		}))
+	})
+
+	DescribeTable("rejects invalid faults",
+		func(contents, message string) {
+			Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+
+			_, err := smbfault.LoadFaults(path)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("not JSON", `mount`, "cannot parse faults"),
+		Entry("an unknown operation", `[{"operation": "remove", "errno": 5}]`, `fault 0: invalid operation "remove"`),
+		Entry("a negative errno", `[{"operation": "mount", "errno": -5}]`, "fault 0: invalid errno -5"),
+		Entry("an invalid hang", `[{"operation": "mount", "hang": "forever"}]`, "fault 0: invalid hang"),
+		Entry("a delay that is not positive", `[{"operation": "mount", "delay": "0s"}]`, "fault 0: invalid delay: 0s is not positive"),
+		Entry("both hang and delay", `[{"operation": "mount", "hang": "1m", "delay": "1s"}]`, "fault 0: hang and delay cannot both be set"),
+		Entry("no effect", `[{"operation": "mount", "errno": 13}, {"operation": "check", "host": "server"}]`, "fault 1: one of errno, hang or delay must be set"),
+	)
+})
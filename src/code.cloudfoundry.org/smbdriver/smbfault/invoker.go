@@ -0,0 +1,246 @@
+package smbfault
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	"code.cloudfoundry.org/volumedriver/invoker"
+)
+
+// Invoker injects the faults that match an invocation of mount, umount or
+// mountpoint instead of running it, and runs every other invocation with the
+// wrapped invoker. The volume of an invocation is the last element of its
+// mount target, and its host is the server of the share mounted there.
+type Invoker struct {
+	invoker invoker.Invoker
+	mounts  driveradmin.MountLister
+	clock   clock.Clock
+
+	mutex  sync.Mutex
+	faults []fault
+}
+
+// NewInvoker wraps invoker with the faults, which can be replaced later
+// through SetFaults. mounts finds the share mounted at the targets of
+// unmounts and checks.
+func NewInvoker(invoker invoker.Invoker, mounts driveradmin.MountLister, clock clock.Clock, faults []driveradmin.Fault) (*Invoker, error) {
+	parsed, err := parseFaults(faults)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Invoker{
+		invoker: invoker,
+		mounts:  mounts,
+		clock:   clock,
+		faults:  parsed,
+	}, nil
+}
+
+func (i *Invoker) Faults(env dockerdriver.Env) []driveradmin.Fault {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	faults := []driveradmin.Fault{}
+	for _, f := range i.faults {
+		faults = append(faults, f.Fault)
+	}
+	return faults
+}
+
+func (i *Invoker) SetFaults(env dockerdriver.Env, faults []driveradmin.Fault) error {
+	parsed, err := parseFaults(faults)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.faults = parsed
+	env.Logger().Info("faults-set", lager.Data{"faults": faults})
+	return nil
+}
+
+func (i *Invoker) Invoke(env dockerdriver.Env, executable string, args []string, envVars ...string) invoker.InvokeResult {
+	operation, target := invocation(executable, args)
+	if operation == "" {
+		return i.invoker.Invoke(env, executable, args, envVars...)
+	}
+
+	host := i.host(env, operation, args, target)
+	volume := filepath.Base(target)
+
+	f, found := i.match(operation, host, volume)
+	if !found {
+		return i.invoker.Invoke(env, executable, args, envVars...)
+	}
+
+	env.Logger().Info("fault-injected", lager.Data{
+		"operation": operation,
+		"host":      host,
+		"volume":    volume,
+		"fault":     f.Fault,
+	})
+
+	return &faultResult{
+		invoker:    i.invoker,
+		clock:      i.clock,
+		env:        env,
+		executable: executable,
+		args:       args,
+		envVars:    envVars,
+		operation:  operation,
+		fault:      f,
+	}
+}
+
+func (i *Invoker) match(operation, host, volume string) (fault, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, f := range i.faults {
+		if f.matches(operation, host, volume) {
+			return f, true
+		}
+	}
+	return fault{}, false
+}
+
+// invocation returns the operation of an invocation and its mount target, or
+// no operation when faults do not apply to it.
+func invocation(executable string, args []string) (string, string) {
+	switch executable {
+	case "mount":
+		// mount -t cifs <source> <target> -o <options> ...
+		if len(args) < 4 {
+			return "", ""
+		}
+		return OperationMount, args[3]
+	case "umount":
+		if len(args) == 0 {
+			return "", ""
+		}
+		return OperationUnmount, args[len(args)-1]
+	case "mountpoint":
+		if len(args) == 0 {
+			return "", ""
+		}
+		return OperationCheck, args[len(args)-1]
+	default:
+		return "", ""
+	}
+}
+
+func (i *Invoker) host(env dockerdriver.Env, operation string, args []string, target string) string {
+	source := ""
+	if operation == OperationMount {
+		source = args[2]
+	} else {
+		for _, mount := range i.mounts.Mounts(env) {
+			if mount.Target == target {
+				source = mount.Source
+				break
+			}
+		}
+	}
+
+	parsed, err := smbsource.Parse(source)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
+
+type faultResult struct {
+	invoker    invoker.Invoker
+	clock      clock.Clock
+	env        dockerdriver.Env
+	executable string
+	args       []string
+	envVars    []string
+	operation  string
+	fault      fault
+
+	stdout string
+	stderr string
+}
+
+func (r *faultResult) StdError() string {
+	return r.stderr
+}
+
+func (r *faultResult) StdOutput() string {
+	return r.stdout
+}
+
+// Wait waits out the delay or hang of the fault and then fails with its
+// errno, or runs the invocation when the fault only delays it.
+func (r *faultResult) Wait() error {
+	if r.fault.delay > 0 {
+		if err := r.sleep(r.fault.delay); err != nil {
+			return err
+		}
+	}
+
+	if r.fault.hang > 0 {
+		// A hung invocation fails once it is cancelled, as a hung mount.cifs
+		// is killed when its request times out.
+		_ = r.sleep(r.fault.hang)
+		errno := r.fault.Errno
+		if errno == 0 {
+			errno = DefaultHangErrno
+		}
+		return r.fail(errno)
+	}
+
+	if r.fault.Errno != 0 {
+		return r.fail(r.fault.Errno)
+	}
+
+	result := r.invoker.Invoke(r.env, r.executable, r.args, r.envVars...)
+	err := result.Wait()
+	r.stdout, r.stderr = result.StdOutput(), result.StdError()
+	return err
+}
+
+func (r *faultResult) WaitFor(_ string, _ time.Duration) error {
+	return r.Wait()
+}
+
+func (r *faultResult) sleep(duration time.Duration) error {
+	timer := r.clock.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-r.env.Context().Done():
+		return r.env.Context().Err()
+	}
+}
+
+// fail reports errno the way the real invocation reports its failures.
+func (r *faultResult) fail(errno int) error {
+	message := syscall.Errno(errno).Error()
+	switch r.operation {
+	case OperationMount:
+		r.stderr = fmt.Sprintf("mount error(%d): %s\nRefer to the mount.cifs(8) manual page (e.g. man mount.cifs) and kernel log messages (dmesg)\n", errno, message)
+		return errors.New("exit status 32")
+	case OperationUnmount:
+		r.stderr = fmt.Sprintf("umount: %s: %s\n", r.args[len(r.args)-1], message)
+		return errors.New("exit status 32")
+	default:
+		// mountpoint -q reports nothing.
+		return errors.New("exit status 1")
+	}
+}
@@ -0,0 +1,188 @@
+package smbfault_test
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/driveradmin"
+	"code.cloudfoundry.org/smbdriver/smbdriverfakes"
+	"code.cloudfoundry.org/smbdriver/smbfault"
+	"code.cloudfoundry.org/volumedriver/invokerfakes"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Invoker", func() {
+	var (
+		logger           *lagertest.TestLogger
+		env              dockerdriver.Env
+		fakeInvoker      *invokerfakes.FakeInvoker
+		fakeInvokeResult *invokerfakes.FakeInvokeResult
+		fakeMounts       *smbdriverfakes.FakeMountLister
+		fakeClock        *fakeclock.FakeClock
+		faults           []driveradmin.Fault
+		subject          *smbfault.Invoker
+
+		mountArgs []string
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("smbfault")
+		env = driverhttp.NewHttpDriverEnv(logger, context.TODO())
+		fakeInvoker = &invokerfakes.FakeInvoker{}
+		fakeInvokeResult = &invokerfakes.FakeInvokeResult{}
+		fakeInvokeResult.StdErrorReturns("real stderr")
+		fakeInvoker.InvokeReturns(fakeInvokeResult)
+		fakeMounts = &smbdriverfakes.FakeMountLister{}
+		fakeMounts.MountsReturns([]driveradmin.Mount{
+			{Target: "/var/vcap/data/volumes/smb/vol1", Source: "//Server/share"},
+		})
+		fakeClock = fakeclock.NewFakeClock(time.Now())
+		faults = nil
+
+		mountArgs = []string{"-t", "cifs", "//server/share", "/var/vcap/data/volumes/smb/vol1", "-o", "uid=2000,ip=10.0.0.1", "--verbose"}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		subject, err = smbfault.NewInvoker(fakeInvoker, fakeMounts, fakeClock, faults)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("runs the invocations without faults", func() {
+		result := subject.Invoke(env, "mount", mountArgs, "PASSWD=secret")
+		Expect(result.Wait()).To(Succeed())
+
+		Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+		_, executable, args, envVars := fakeInvoker.InvokeArgsForCall(0)
+		Expect(executable).To(Equal("mount"))
+		Expect(args).To(Equal(mountArgs))
+		Expect(envVars).To(Equal([]string{"PASSWD=secret"}))
+	})
+
+	Context("with a fault that fails the mounts of a host", func() {
+		BeforeEach(func() {
+			faults = []driveradmin.Fault{{Operation: "mount", Host: "SERVER", Errno: 113}}
+		})
+
+		It("fails the mounts from the host like mount.cifs", func() {
+			result := subject.Invoke(env, "mount", mountArgs)
+			Expect(result.Wait()).To(MatchError("exit status 32"))
+			Expect(result.StdError()).To(HavePrefix("mount error(113): no route to host\n"))
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+			Expect(logger).To(gbytes.Say("fault-injected"))
+		})
+
+		It("runs the mounts from other hosts and other invocations", func() {
+			mountArgs[2] = "//other-server/share"
+			Expect(subject.Invoke(env, "mount", mountArgs).Wait()).To(Succeed())
+			Expect(subject.Invoke(env, "umount", []string{"-l", "/var/vcap/data/volumes/smb/vol1"}).Wait()).To(Succeed())
+			Expect(subject.Invoke(env, "setpriv", []string{"keyctl"}).Wait()).To(Succeed())
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(3))
+		})
+	})
+
+	Context("with a fault that fails the unmounts of a volume", func() {
+		BeforeEach(func() {
+			faults = []driveradmin.Fault{{Operation: "unmount", Host: "server", Volume: "vol1", Errno: 16}}
+		})
+
+		It("finds the host of the volume in the mounts", func() {
+			result := subject.Invoke(env, "umount", []string{"-l", "/var/vcap/data/volumes/smb/vol1"})
+			Expect(result.Wait()).To(MatchError("exit status 32"))
+			Expect(result.StdError()).To(Equal("umount: /var/vcap/data/volumes/smb/vol1: device or resource busy\n"))
+
+			Expect(subject.Invoke(env, "umount", []string{"-l", "/var/vcap/data/volumes/smb/vol2"}).Wait()).To(Succeed())
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+		})
+	})
+
+	Context("with a fault that delays the checks", func() {
+		BeforeEach(func() {
+			faults = []driveradmin.Fault{{Operation: "check", Delay: "3s"}}
+		})
+
+		It("runs the checks after the delay", func() {
+			result := subject.Invoke(env, "mountpoint", []string{"-q", "/var/vcap/data/volumes/smb/vol1"})
+
+			errs := make(chan error)
+			go func() { errs <- result.Wait() }()
+
+			fakeClock.WaitForWatcherAndIncrement(2 * time.Second)
+			Consistently(errs).ShouldNot(Receive())
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+
+			fakeClock.Increment(time.Second)
+			Eventually(errs).Should(Receive(BeNil()))
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+			Expect(result.StdError()).To(Equal("real stderr"))
+		})
+
+		It("stops waiting when the request is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.TODO())
+			result := subject.Invoke(driverhttp.NewHttpDriverEnv(logger, ctx), "mountpoint", []string{"-q", "/var/vcap/data/volumes/smb/vol1"})
+			cancel()
+
+			Expect(result.Wait()).To(MatchError(context.Canceled))
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+		})
+	})
+
+	Context("with a fault that hangs the mounts", func() {
+		BeforeEach(func() {
+			faults = []driveradmin.Fault{{Operation: "mount", Hang: "1m"}}
+		})
+
+		It("fails the mounts once they stop hanging", func() {
+			result := subject.Invoke(env, "mount", mountArgs)
+
+			errs := make(chan error)
+			go func() { errs <- result.Wait() }()
+
+			fakeClock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(errs).Should(Receive(MatchError("exit status 32")))
+			Expect(result.StdError()).To(HavePrefix("mount error(110): connection timed out\n"))
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+		})
+
+		It("fails the mounts when the request is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.TODO())
+			result := subject.Invoke(driverhttp.NewHttpDriverEnv(logger, ctx), "mount", mountArgs)
+			cancel()
+
+			Expect(result.Wait()).To(MatchError("exit status 32"))
+		})
+	})
+
+	Describe("SetFaults", func() {
+		It("replaces the faults", func() {
+			newFaults := []driveradmin.Fault{{Operation: "check", Errno: 5}}
+			Expect(subject.SetFaults(env, newFaults)).To(Succeed())
+			Expect(subject.Faults(env)).To(Equal(newFaults))
+
+			Expect(subject.Invoke(env, "mountpoint", []string{"-q", "/var/vcap/data/volumes/smb/vol1"}).Wait()).To(MatchError("exit status 1"))
+			Expect(fakeInvoker.InvokeCallCount()).To(Equal(0))
+
+			Expect(subject.SetFaults(env, nil)).To(Succeed())
+			Expect(subject.Faults(env)).To(BeEmpty())
+		})
+
+		It("keeps the faults when the new faults are invalid", func() {
+			Expect(subject.SetFaults(env, []driveradmin.Fault{{Operation: "check", Errno: 5}})).To(Succeed())
+
+			err := subject.SetFaults(env, []driveradmin.Fault{{Operation: "mount"}})
+			Expect(err).To(MatchError(ContainSubstring("fault 0: one of errno, hang or delay must be set")))
+			Expect(subject.Faults(env)).To(Equal([]driveradmin.Fault{{Operation: "check", Errno: 5}}))
+		})
+	})
+
+	It("rejects invalid faults", func() {
+		_, err := smbfault.NewInvoker(fakeInvoker, fakeMounts, fakeClock, []driveradmin.Fault{{Operation: "remove", Errno: 5}})
+		Expect(err).To(MatchError(ContainSubstring(`fault 0: invalid operation "remove"`)))
+	})
+})
@@ -0,0 +1,13 @@
+package smbfault_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbfault(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbfault Suite")
+}
@@ -0,0 +1,612 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbfuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+const (
+	// DefaultAttrTimeout is how long the kernel caches attributes and names,
+	// the default of the "actimeo" option of kernel CIFS mounts.
+	DefaultAttrTimeout = time.Second
+
+	// DefaultTimeout bounds each request to the server, like the 60 seconds
+	// that kernel CIFS mounts wait for a response before reconnecting.
+	DefaultTimeout = 60 * time.Second
+
+	blockSize = 512
+)
+
+// Options are the options of a mount, the counterparts of the kernel CIFS
+// options of the same names.
+type Options struct {
+	ReadOnly    bool
+	Uid         uint32
+	Gid         uint32
+	FileMode    uint32
+	DirMode     uint32
+	AttrTimeout time.Duration
+	Timeout     time.Duration
+}
+
+// Mount connects to a share and serves it at target until it is unmounted,
+// with source as the name of the mounted filesystem. The connection is
+// reopened whenever it is lost.
+func Mount(logger lager.Logger, source, target string, connect ConnectFunc, options Options) error {
+	if options.Timeout == 0 {
+		options.Timeout = DefaultTimeout
+	}
+
+	fsys := &filesystem{logger: logger, connect: connect, options: options}
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
+	defer cancel()
+	if _, _, err := fsys.share(ctx); err != nil {
+		return err
+	}
+
+	mountOptions := []string{"default_permissions"}
+	if options.ReadOnly {
+		mountOptions = append(mountOptions, "ro")
+	}
+	attrTimeout := options.AttrTimeout
+
+	server, err := fs.Mount(target, &node{fsys: fsys}, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			AllowOther:    true,
+			Options:       mountOptions,
+			FsName:        source,
+			Name:          "smb",
+			DirectMount:   true,
+			DisableXAttrs: true,
+		},
+		EntryTimeout: &attrTimeout,
+		AttrTimeout:  &attrTimeout,
+		UID:          options.Uid,
+		GID:          options.Gid,
+	})
+	if err != nil {
+		fsys.close()
+		return err
+	}
+
+	go func() {
+		server.Wait()
+		fsys.close()
+		logger.Info("smb-fuse-unmounted", lager.Data{"source": source, "target": target})
+	}()
+	return nil
+}
+
+// filesystem holds the connection to the share of a mount.
+type filesystem struct {
+	logger  lager.Logger
+	connect ConnectFunc
+	options Options
+
+	mutex      sync.Mutex
+	connection Share
+	generation int
+}
+
+// share returns the connection to the share, connecting if there is none,
+// and its generation, which changes with every new connection.
+func (fsys *filesystem) share(ctx context.Context) (Share, int, error) {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+
+	if fsys.connection == nil {
+		share, err := fsys.connect(ctx)
+		if err != nil {
+			fsys.logger.Info("smb-fuse-connect-failed", lager.Data{"error": err.Error()})
+			return nil, 0, err
+		}
+		fsys.connection = share
+		fsys.generation++
+	}
+	return fsys.connection, fsys.generation, nil
+}
+
+// failed drops the connection of a generation when err shows that it is
+// lost, rather than the server failing a single request.
+func (fsys *filesystem) failed(generation int, err error) {
+	var statusErr *smb2.StatusError
+	if err == nil || err == io.EOF || errors.As(err, &statusErr) {
+		return
+	}
+
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+
+	if fsys.connection != nil && fsys.generation == generation {
+		fsys.logger.Info("smb-fuse-connection-lost", lager.Data{"error": err.Error()})
+		fsys.connection.Close()
+		fsys.connection = nil
+	}
+}
+
+func (fsys *filesystem) close() {
+	fsys.mutex.Lock()
+	defer fsys.mutex.Unlock()
+
+	if fsys.connection != nil {
+		fsys.connection.Close()
+		fsys.connection = nil
+	}
+}
+
+// withFile opens the file at path, runs f on it and closes it.
+func (fsys *filesystem) withFile(ctx context.Context, path string, request smb2.CreateRequest, f func(context.Context, File) error) syscall.Errno {
+	ctx, cancel := context.WithTimeout(ctx, fsys.options.Timeout)
+	defer cancel()
+
+	share, generation, err := fsys.share(ctx)
+	if err != nil {
+		return syscall.EIO
+	}
+
+	file, err := share.Create(ctx, path, request)
+	if err != nil {
+		fsys.failed(generation, err)
+		return toErrno(err)
+	}
+
+	err = f(ctx, file)
+	if closeErr := file.Close(ctx); err == nil {
+		err = closeErr
+	}
+	fsys.failed(generation, err)
+	return toErrno(err)
+}
+
+func (fsys *filesystem) stat(ctx context.Context, path string) (smb2.FileInfo, syscall.Errno) {
+	var info smb2.FileInfo
+	errno := fsys.withFile(ctx, path, smb2.CreateRequest{Access: smb2.AccessReadAttributes, Disposition: smb2.DispositionOpen}, func(_ context.Context, file File) error {
+		info = file.Stat()
+		return nil
+	})
+	return info, errno
+}
+
+// fillAttr describes a file the way a kernel CIFS mount without the unix
+// extensions does, with the owner and modes of the mount options.
+func (fsys *filesystem) fillAttr(info smb2.FileInfo, out *fuse.Attr) {
+	if info.IsDir() {
+		out.Mode = syscall.S_IFDIR | fsys.options.DirMode
+		out.Nlink = 2
+	} else {
+		out.Mode = syscall.S_IFREG | fsys.options.FileMode
+		if info.Attributes&smb2.AttributeReadOnly != 0 {
+			out.Mode &^= 0222
+		}
+		out.Nlink = 1
+	}
+
+	out.Size = uint64(info.Size)
+	out.Blocks = (out.Size + blockSize - 1) / blockSize
+	out.Blksize = blockSize
+	out.Owner = fuse.Owner{Uid: fsys.options.Uid, Gid: fsys.options.Gid}
+	out.SetTimes(&info.LastAccessTime, &info.LastWriteTime, &info.ChangeTime)
+}
+
+// node is a file or directory of the share, whose path is its path in the
+// tree of inodes.
+type node struct {
+	fs.Inode
+	fsys *filesystem
+}
+
+var (
+	_ fs.NodeLookuper  = (*node)(nil)
+	_ fs.NodeGetattrer = (*node)(nil)
+	_ fs.NodeSetattrer = (*node)(nil)
+	_ fs.NodeReaddirer = (*node)(nil)
+	_ fs.NodeOpener    = (*node)(nil)
+	_ fs.NodeCreater   = (*node)(nil)
+	_ fs.NodeReader    = (*node)(nil)
+	_ fs.NodeWriter    = (*node)(nil)
+	_ fs.NodeFsyncer   = (*node)(nil)
+	_ fs.NodeReleaser  = (*node)(nil)
+	_ fs.NodeMkdirer   = (*node)(nil)
+	_ fs.NodeUnlinker  = (*node)(nil)
+	_ fs.NodeRmdirer   = (*node)(nil)
+	_ fs.NodeRenamer   = (*node)(nil)
+	_ fs.NodeStatfser  = (*node)(nil)
+)
+
+func (n *node) path() string {
+	return n.Path(nil)
+}
+
+func (n *node) child(name string) string {
+	return path.Join(n.path(), name)
+}
+
+func (n *node) newChild(ctx context.Context, info smb2.FileInfo, out *fuse.EntryOut) *fs.Inode {
+	n.fsys.fillAttr(info, &out.Attr)
+
+	mode := uint32(syscall.S_IFREG)
+	if info.IsDir() {
+		mode = syscall.S_IFDIR
+	}
+	return n.NewInode(ctx, &node{fsys: n.fsys}, fs.StableAttr{Mode: mode})
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	info, errno := n.fsys.stat(ctx, n.child(name))
+	if errno != 0 {
+		return nil, errno
+	}
+	return n.newChild(ctx, info, out), 0
+}
+
+func (n *node) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, errno := n.fsys.stat(ctx, n.path())
+	if errno != 0 {
+		return errno
+	}
+	n.fsys.fillAttr(info, &out.Attr)
+	return 0
+}
+
+// Setattr changes the size and times of a file. Like on a kernel CIFS mount
+// without the unix extensions, changes of owner and mode are ignored.
+func (n *node) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	size, setSize := in.GetSize()
+	lastAccessTime, setAccessTime := in.GetATime()
+	lastWriteTime, setWriteTime := in.GetMTime()
+
+	if setSize || setAccessTime || setWriteTime {
+		if n.fsys.options.ReadOnly {
+			return syscall.EROFS
+		}
+
+		request := smb2.CreateRequest{Access: smb2.AccessWriteAttributes, Disposition: smb2.DispositionOpen}
+		if setSize {
+			request.Access |= smb2.AccessWriteData
+		}
+
+		errno := n.fsys.withFile(ctx, n.path(), request, func(ctx context.Context, file File) error {
+			if setSize {
+				if err := file.Truncate(ctx, int64(size)); err != nil {
+					return err
+				}
+			}
+			if setAccessTime || setWriteTime {
+				return file.SetTimes(ctx, lastAccessTime, lastWriteTime)
+			}
+			return nil
+		})
+		if errno != 0 {
+			return errno
+		}
+	}
+
+	return n.Getattr(ctx, f, out)
+}
+
+func (n *node) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	var entries []fuse.DirEntry
+	errno := n.fsys.withFile(ctx, n.path(), smb2.CreateRequest{Access: smb2.AccessReadData, Disposition: smb2.DispositionOpen, Options: smb2.OptionDirectory}, func(ctx context.Context, file File) error {
+		infos, err := file.ReadDir(ctx)
+		for _, info := range infos {
+			mode := uint32(syscall.S_IFREG)
+			if info.IsDir() {
+				mode = syscall.S_IFDIR
+			}
+			entries = append(entries, fuse.DirEntry{Name: info.Name, Mode: mode})
+		}
+		return err
+	})
+	if errno != 0 {
+		return nil, errno
+	}
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *node) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	writable := flags&syscall.O_ACCMODE != syscall.O_RDONLY
+	if writable && n.fsys.options.ReadOnly {
+		return nil, 0, syscall.EROFS
+	}
+
+	disposition := uint32(smb2.DispositionOpen)
+	if flags&syscall.O_TRUNC != 0 && writable {
+		disposition = smb2.DispositionOverwriteIf
+	}
+
+	h, errno := n.fsys.open(ctx, n.path(), accessFor(flags), disposition)
+	if errno != 0 {
+		return nil, 0, errno
+	}
+	return h, 0, 0
+}
+
+func (n *node) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if n.fsys.options.ReadOnly {
+		return nil, nil, 0, syscall.EROFS
+	}
+
+	disposition := uint32(smb2.DispositionOpenIf)
+	switch {
+	case flags&syscall.O_EXCL != 0:
+		disposition = smb2.DispositionCreate
+	case flags&syscall.O_TRUNC != 0:
+		disposition = smb2.DispositionOverwriteIf
+	}
+
+	h, errno := n.fsys.open(ctx, n.child(name), accessFor(flags)|smb2.AccessReadAttributes, disposition)
+	if errno != 0 {
+		return nil, nil, 0, errno
+	}
+	return n.newChild(ctx, h.info, out), h, 0, 0
+}
+
+func (n *node) Read(ctx context.Context, f fs.FileHandle, dest []byte, offset int64) (fuse.ReadResult, syscall.Errno) {
+	h, ok := f.(*handle)
+	if !ok {
+		return nil, syscall.EBADF
+	}
+
+	read, errno := h.do(ctx, func(ctx context.Context, file File) (int, error) {
+		n, err := file.ReadAt(ctx, dest, offset)
+		if err == io.EOF {
+			err = nil
+		}
+		return n, err
+	})
+	if errno != 0 {
+		return nil, errno
+	}
+	return fuse.ReadResultData(dest[:read]), 0
+}
+
+func (n *node) Write(ctx context.Context, f fs.FileHandle, data []byte, offset int64) (uint32, syscall.Errno) {
+	h, ok := f.(*handle)
+	if !ok {
+		return 0, syscall.EBADF
+	}
+
+	written, errno := h.do(ctx, func(ctx context.Context, file File) (int, error) {
+		return file.WriteAt(ctx, data, offset)
+	})
+	return uint32(written), errno
+}
+
+func (n *node) Fsync(ctx context.Context, f fs.FileHandle, flags uint32) syscall.Errno {
+	h, ok := f.(*handle)
+	if !ok {
+		return 0
+	}
+
+	_, errno := h.do(ctx, func(ctx context.Context, file File) (int, error) {
+		return 0, file.Flush(ctx)
+	})
+	return errno
+}
+
+func (n *node) Release(ctx context.Context, f fs.FileHandle) syscall.Errno {
+	if h, ok := f.(*handle); ok {
+		h.close()
+	}
+	return 0
+}
+
+func (n *node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if n.fsys.options.ReadOnly {
+		return nil, syscall.EROFS
+	}
+
+	var info smb2.FileInfo
+	errno := n.fsys.withFile(ctx, n.child(name), smb2.CreateRequest{
+		Access:      smb2.AccessReadAttributes,
+		Disposition: smb2.DispositionCreate,
+		Options:     smb2.OptionDirectory,
+	}, func(_ context.Context, file File) error {
+		info = file.Stat()
+		return nil
+	})
+	if errno != 0 {
+		return nil, errno
+	}
+	return n.newChild(ctx, info, out), 0
+}
+
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	return n.remove(ctx, name, smb2.OptionNonDirectory)
+}
+
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	return n.remove(ctx, name, smb2.OptionDirectory)
+}
+
+func (n *node) remove(ctx context.Context, name string, options uint32) syscall.Errno {
+	if n.fsys.options.ReadOnly {
+		return syscall.EROFS
+	}
+
+	return n.fsys.withFile(ctx, n.child(name), smb2.CreateRequest{
+		Access:      smb2.AccessDelete,
+		Disposition: smb2.DispositionOpen,
+		Options:     options,
+	}, func(ctx context.Context, file File) error {
+		return file.Delete(ctx)
+	})
+}
+
+func (n *node) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if n.fsys.options.ReadOnly {
+		return syscall.EROFS
+	}
+	if flags&fs.RENAME_EXCHANGE != 0 {
+		return syscall.EINVAL
+	}
+
+	target := path.Join(newParent.EmbeddedInode().Path(nil), newName)
+	replace := flags&renameNoReplace == 0
+
+	return n.fsys.withFile(ctx, n.child(name), smb2.CreateRequest{
+		Access:      smb2.AccessDelete,
+		Disposition: smb2.DispositionOpen,
+	}, func(ctx context.Context, file File) error {
+		return file.Rename(ctx, target, replace)
+	})
+}
+
+func (n *node) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	var info smb2.FilesystemInfo
+	errno := n.fsys.withFile(ctx, "", smb2.CreateRequest{Access: smb2.AccessReadAttributes, Disposition: smb2.DispositionOpen}, func(ctx context.Context, file File) error {
+		var err error
+		info, err = file.StatFilesystem(ctx)
+		return err
+	})
+	if errno != 0 {
+		return errno
+	}
+
+	out.Bsize = uint32(info.BlockSize)
+	out.Frsize = uint32(info.BlockSize)
+	out.Blocks = info.TotalBlocks
+	out.Bfree = info.FreeBlocks
+	out.Bavail = info.AvailableBlocks
+	out.NameLen = 255
+	return 0
+}
+
+// renameNoReplace is the RENAME_NOREPLACE flag of renameat2.
+const renameNoReplace = 0x1
+
+func accessFor(flags uint32) uint32 {
+	switch flags & syscall.O_ACCMODE {
+	case syscall.O_WRONLY:
+		return smb2.AccessWriteData
+	case syscall.O_RDWR:
+		return smb2.AccessReadData | smb2.AccessWriteData
+	default:
+		return smb2.AccessReadData
+	}
+}
+
+// handle is an open file. It is opened again after the connection it was
+// opened on is lost.
+type handle struct {
+	fsys   *filesystem
+	path   string
+	access uint32
+	info   smb2.FileInfo
+
+	mutex      sync.Mutex
+	file       File
+	generation int
+}
+
+func (fsys *filesystem) open(ctx context.Context, path string, access, disposition uint32) (*handle, syscall.Errno) {
+	ctx, cancel := context.WithTimeout(ctx, fsys.options.Timeout)
+	defer cancel()
+
+	share, generation, err := fsys.share(ctx)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+
+	file, err := share.Create(ctx, path, smb2.CreateRequest{Access: access, Disposition: disposition, Options: smb2.OptionNonDirectory})
+	if err != nil {
+		fsys.failed(generation, err)
+		return nil, toErrno(err)
+	}
+
+	return &handle{fsys: fsys, path: path, access: access, info: file.Stat(), file: file, generation: generation}, 0
+}
+
+// do runs f on the file, opening it again first if its connection was lost.
+func (h *handle) do(ctx context.Context, f func(context.Context, File) (int, error)) (int, syscall.Errno) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, h.fsys.options.Timeout)
+	defer cancel()
+
+	share, generation, err := h.fsys.share(ctx)
+	if err != nil {
+		return 0, syscall.EIO
+	}
+
+	if h.file == nil || h.generation != generation {
+		file, err := share.Create(ctx, h.path, smb2.CreateRequest{Access: h.access, Disposition: smb2.DispositionOpen, Options: smb2.OptionNonDirectory})
+		if err != nil {
+			h.fsys.failed(generation, err)
+			return 0, toErrno(err)
+		}
+		h.file = file
+		h.generation = generation
+	}
+
+	n, err := f(ctx, h.file)
+	h.fsys.failed(generation, err)
+	return n, toErrno(err)
+}
+
+func (h *handle) close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.file == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.fsys.options.Timeout)
+	defer cancel()
+
+	h.fsys.failed(h.generation, h.file.Close(ctx))
+	h.file = nil
+}
+
+// errnos are the errors of the NTSTATUS codes that a file operation can fail
+// with. Any other status is an EIO.
+var errnos = map[uint32]syscall.Errno{
+	smb2.StatusObjectNameNotFound:  syscall.ENOENT,
+	smb2.StatusObjectPathNotFound:  syscall.ENOENT,
+	smb2.StatusDeletePending:       syscall.ENOENT,
+	smb2.StatusObjectNameCollision: syscall.EEXIST,
+	smb2.StatusAccessDenied:        syscall.EACCES,
+	smb2.StatusSharingViolation:    syscall.EBUSY,
+	smb2.StatusDiskFull:            syscall.ENOSPC,
+	smb2.StatusMediaWriteProtected: syscall.EROFS,
+	smb2.StatusFileIsADirectory:    syscall.EISDIR,
+	smb2.StatusNotADirectory:       syscall.ENOTDIR,
+	smb2.StatusDirectoryNotEmpty:   syscall.ENOTEMPTY,
+	smb2.StatusNotSupported:        syscall.ENOTSUP,
+	smb2.StatusInvalidParameter:    syscall.EINVAL,
+}
+
+func toErrno(err error) syscall.Errno {
+	if err == nil {
+		return 0
+	}
+
+	var statusErr *smb2.StatusError
+	if errors.As(err, &statusErr) {
+		if errno, ok := errnos[statusErr.Status]; ok {
+			return errno
+		}
+		return syscall.EIO
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return syscall.ETIMEDOUT
+	}
+	return syscall.EIO
+}
@@ -0,0 +1,442 @@
+//go:build linux
+// +build linux
+
+package smbfuse_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"code.cloudfoundry.org/smbdriver/smbfuse"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var errConnectionLost = errors.New("connection reset by peer")
+
+// memShare is a share held in memory, keyed by slash separated path, whose
+// connection can be broken.
+type memShare struct {
+	mutex    sync.Mutex
+	files    map[string]*memFile
+	connects int
+	broken   bool
+}
+
+type memFile struct {
+	data     []byte
+	dir      bool
+	modified time.Time
+}
+
+func newMemShare() *memShare {
+	return &memShare{files: map[string]*memFile{"": {dir: true}}}
+}
+
+func (s *memShare) connect(ctx context.Context) (smbfuse.Share, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.connects++
+	s.broken = false
+	return &memConnection{share: s, generation: s.connects}, nil
+}
+
+type memConnection struct {
+	share      *memShare
+	generation int
+}
+
+// lost reports whether the connection was broken, or replaced by a newer
+// one.
+func (c *memConnection) lost() bool {
+	return c.share.broken || c.generation != c.share.connects
+}
+
+func (c *memConnection) Create(ctx context.Context, name string, request smb2.CreateRequest) (smbfuse.File, error) {
+	s := c.share
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if c.lost() {
+		return nil, errConnectionLost
+	}
+
+	file, exists := s.files[name]
+	switch {
+	case !exists && request.Disposition == smb2.DispositionOpen:
+		return nil, &smb2.StatusError{Status: smb2.StatusObjectNameNotFound}
+	case exists && request.Disposition == smb2.DispositionCreate:
+		return nil, &smb2.StatusError{Status: smb2.StatusObjectNameCollision}
+	case exists && file.dir && request.Options&smb2.OptionNonDirectory != 0:
+		return nil, &smb2.StatusError{Status: smb2.StatusFileIsADirectory}
+	case exists && !file.dir && request.Options&smb2.OptionDirectory != 0:
+		return nil, &smb2.StatusError{Status: smb2.StatusNotADirectory}
+	case !exists:
+		if parent, ok := s.files[parentOf(name)]; !ok || !parent.dir {
+			return nil, &smb2.StatusError{Status: smb2.StatusObjectPathNotFound}
+		}
+		file = &memFile{dir: request.Options&smb2.OptionDirectory != 0, modified: time.Now()}
+		s.files[name] = file
+	case request.Disposition == smb2.DispositionOverwriteIf:
+		file.data = nil
+	}
+
+	return &memHandle{connection: c, name: name}, nil
+}
+
+func (c *memConnection) Close() error {
+	return nil
+}
+
+type memHandle struct {
+	connection *memConnection
+	name       string
+	delete     bool
+}
+
+// file returns the file of the handle, locking the share until unlock is
+// called.
+func (h *memHandle) file() (*memFile, func(), error) {
+	s := h.connection.share
+	s.mutex.Lock()
+	if h.connection.lost() {
+		s.mutex.Unlock()
+		return nil, nil, errConnectionLost
+	}
+	return s.files[h.name], s.mutex.Unlock, nil
+}
+
+func (h *memHandle) Stat() smb2.FileInfo {
+	file, unlock, err := h.file()
+	if err != nil {
+		return smb2.FileInfo{}
+	}
+	defer unlock()
+	return fileInfo(path.Base(h.name), file)
+}
+
+func (h *memHandle) ReadAt(ctx context.Context, p []byte, offset int64) (int, error) {
+	file, unlock, err := h.file()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if offset >= int64(len(file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, file.data[offset:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (h *memHandle) WriteAt(ctx context.Context, p []byte, offset int64) (int, error) {
+	file, unlock, err := h.file()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if end := int(offset) + len(p); end > len(file.data) {
+		file.data = append(file.data, make([]byte, end-len(file.data))...)
+	}
+	file.modified = time.Now()
+	return copy(file.data[offset:], p), nil
+}
+
+func (h *memHandle) Flush(ctx context.Context) error {
+	_, unlock, err := h.file()
+	if err != nil {
+		return err
+	}
+	unlock()
+	return nil
+}
+
+func (h *memHandle) ReadDir(ctx context.Context) ([]smb2.FileInfo, error) {
+	_, unlock, err := h.file()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	infos := []smb2.FileInfo{}
+	for name, file := range h.connection.share.files {
+		if name != "" && parentOf(name) == h.name {
+			infos = append(infos, fileInfo(path.Base(name), file))
+		}
+	}
+	return infos, nil
+}
+
+func (h *memHandle) Truncate(ctx context.Context, size int64) error {
+	file, unlock, err := h.file()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if int(size) > len(file.data) {
+		file.data = append(file.data, make([]byte, int(size)-len(file.data))...)
+	}
+	file.data = file.data[:size]
+	return nil
+}
+
+func (h *memHandle) SetTimes(ctx context.Context, lastAccessTime, lastWriteTime time.Time) error {
+	file, unlock, err := h.file()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if !lastWriteTime.IsZero() {
+		file.modified = lastWriteTime
+	}
+	return nil
+}
+
+func (h *memHandle) Rename(ctx context.Context, name string, replace bool) error {
+	file, unlock, err := h.file()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	files := h.connection.share.files
+	if _, exists := files[name]; exists && !replace {
+		return &smb2.StatusError{Status: smb2.StatusObjectNameCollision}
+	}
+	delete(files, h.name)
+	files[name] = file
+	h.name = name
+	return nil
+}
+
+func (h *memHandle) Delete(ctx context.Context) error {
+	file, unlock, err := h.file()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for name := range h.connection.share.files {
+		if file.dir && name != "" && parentOf(name) == h.name {
+			return &smb2.StatusError{Status: smb2.StatusDirectoryNotEmpty}
+		}
+	}
+	h.delete = true
+	return nil
+}
+
+func (h *memHandle) StatFilesystem(ctx context.Context) (smb2.FilesystemInfo, error) {
+	_, unlock, err := h.file()
+	if err != nil {
+		return smb2.FilesystemInfo{}, err
+	}
+	defer unlock()
+
+	return smb2.FilesystemInfo{BlockSize: 4096, TotalBlocks: 1000, AvailableBlocks: 400, FreeBlocks: 500}, nil
+}
+
+func (h *memHandle) Close(ctx context.Context) error {
+	_, unlock, err := h.file()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if h.delete {
+		delete(h.connection.share.files, h.name)
+	}
+	return nil
+}
+
+func fileInfo(name string, file *memFile) smb2.FileInfo {
+	info := smb2.FileInfo{Name: name, Size: int64(len(file.data)), Attributes: smb2.AttributeNormal, LastWriteTime: file.modified}
+	if file.dir {
+		info.Attributes = smb2.AttributeDirectory
+	}
+	return info
+}
+
+func parentOf(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+var _ = Describe("Mount", func() {
+	var (
+		logger  *lagertest.TestLogger
+		share   *memShare
+		connect smbfuse.ConnectFunc
+		target  string
+		options smbfuse.Options
+		err     error
+	)
+
+	BeforeEach(func() {
+		if _, err := os.Stat("/dev/fuse"); err != nil || os.Geteuid() != 0 {
+			Skip("FUSE mounts need /dev/fuse and root")
+		}
+
+		logger = lagertest.NewTestLogger("smbfuse")
+		share = newMemShare()
+		share.files["dir"] = &memFile{dir: true}
+		share.files["dir/file"] = &memFile{data: []byte("contents")}
+		connect = share.connect
+
+		target, err = os.MkdirTemp("", "smbfuse")
+		Expect(err).NotTo(HaveOccurred())
+
+		options = smbfuse.Options{Uid: 2000, Gid: 2000, FileMode: 0644, DirMode: 0755}
+	})
+
+	JustBeforeEach(func() {
+		err = smbfuse.Mount(logger, "//server/share", target, connect, options)
+		if err != nil && strings.Contains(err.Error(), "permission denied") {
+			Skip("FUSE mounts are not permitted: " + err.Error())
+		}
+	})
+
+	AfterEach(func() {
+		if target != "" {
+			_ = syscall.Unmount(target, syscall.MNT_DETACH)
+			Expect(os.Remove(target)).To(Succeed())
+		}
+	})
+
+	It("serves the files of the share", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		contents, err := os.ReadFile(filepath.Join(target, "dir", "file"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("contents"))
+
+		info, err := os.Stat(filepath.Join(target, "dir", "file"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode()).To(Equal(os.FileMode(0644)))
+		Expect(info.Size()).To(Equal(int64(8)))
+		Expect(info.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(2000)))
+
+		info, err = os.Stat(filepath.Join(target, "dir"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode()).To(Equal(os.ModeDir | 0755))
+
+		entries, err := os.ReadDir(target)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal("dir"))
+		Expect(entries[0].IsDir()).To(BeTrue())
+
+		_, err = os.Stat(filepath.Join(target, "missing"))
+		Expect(errors.Is(err, syscall.ENOENT)).To(BeTrue())
+	})
+
+	It("writes, renames and removes files and directories", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.Mkdir(filepath.Join(target, "new"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(target, "new", "file"), []byte("written"), 0644)).To(Succeed())
+		Expect(os.Rename(filepath.Join(target, "new", "file"), filepath.Join(target, "dir", "renamed"))).To(Succeed())
+		Expect(os.Truncate(filepath.Join(target, "dir", "renamed"), 4)).To(Succeed())
+
+		share.mutex.Lock()
+		Expect(share.files).NotTo(HaveKey("new/file"))
+		Expect(string(share.files["dir/renamed"].data)).To(Equal("writ"))
+		share.mutex.Unlock()
+
+		err := os.Remove(filepath.Join(target, "dir"))
+		Expect(errors.Is(err, syscall.ENOTEMPTY)).To(BeTrue())
+
+		Expect(os.Remove(filepath.Join(target, "dir", "renamed"))).To(Succeed())
+		Expect(os.Remove(filepath.Join(target, "new"))).To(Succeed())
+
+		share.mutex.Lock()
+		defer share.mutex.Unlock()
+		Expect(share.files).NotTo(HaveKey("dir/renamed"))
+		Expect(share.files).NotTo(HaveKey("new"))
+	})
+
+	It("reports the capacity of the share", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		var stat syscall.Statfs_t
+		Expect(syscall.Statfs(target, &stat)).To(Succeed())
+		Expect(stat.Bsize).To(Equal(int64(4096)))
+		Expect(stat.Blocks).To(Equal(uint64(1000)))
+		Expect(stat.Bavail).To(Equal(uint64(400)))
+	})
+
+	It("connects again when the connection is lost", func() {
+		Expect(err).NotTo(HaveOccurred())
+
+		file, err := os.OpenFile(filepath.Join(target, "dir", "file"), os.O_RDWR, 0)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+
+		share.mutex.Lock()
+		share.broken = true
+		share.mutex.Unlock()
+
+		_, err = file.WriteAt([]byte("C"), 0)
+		Expect(errors.Is(err, syscall.EIO)).To(BeTrue())
+
+		_, err = file.WriteAt([]byte("C"), 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		share.mutex.Lock()
+		defer share.mutex.Unlock()
+		Expect(share.connects).To(Equal(2))
+		Expect(string(share.files["dir/file"].data)).To(Equal("Contents"))
+	})
+
+	Context("when the mount is read-only", func() {
+		BeforeEach(func() {
+			options.ReadOnly = true
+		})
+
+		It("refuses changes", func() {
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := os.ReadFile(filepath.Join(target, "dir", "file"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("contents"))
+
+			err = os.WriteFile(filepath.Join(target, "dir", "file"), []byte("changed"), 0644)
+			Expect(errors.Is(err, syscall.EROFS)).To(BeTrue())
+
+			err = os.Mkdir(filepath.Join(target, "new"), 0755)
+			Expect(errors.Is(err, syscall.EROFS)).To(BeTrue())
+		})
+	})
+
+	Context("when the share cannot be connected to", func() {
+		BeforeEach(func() {
+			connectErr := &smb2.StatusError{Command: 0x0001, Status: smb2.StatusLogonFailure}
+			options.Timeout = time.Second
+			connect = func(ctx context.Context) (smbfuse.Share, error) {
+				return nil, connectErr
+			}
+		})
+
+		It("fails without mounting", func() {
+			Expect(err).To(MatchError("SMB SESSION_SETUP failed with status 0xc000006d"))
+		})
+	})
+})
@@ -0,0 +1,91 @@
+// Package smbfuse serves SMB shares through FUSE with the userspace client of
+// package smb2, for cells that cannot load the kernel CIFS module.
+package smbfuse
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/smb2"
+)
+
+// Share is a connected SMB share. Its paths are slash separated and relative
+// to the directory that is mounted, the root being "".
+type Share interface {
+	Create(ctx context.Context, path string, request smb2.CreateRequest) (File, error)
+	Close() error
+}
+
+// File is a file or directory opened on a Share.
+type File interface {
+	Stat() smb2.FileInfo
+	ReadAt(ctx context.Context, p []byte, offset int64) (int, error)
+	WriteAt(ctx context.Context, p []byte, offset int64) (int, error)
+	Flush(ctx context.Context) error
+	ReadDir(ctx context.Context) ([]smb2.FileInfo, error)
+	Truncate(ctx context.Context, size int64) error
+	SetTimes(ctx context.Context, lastAccessTime, lastWriteTime time.Time) error
+	Rename(ctx context.Context, path string, replace bool) error
+	Delete(ctx context.Context) error
+	StatFilesystem(ctx context.Context) (smb2.FilesystemInfo, error)
+	Close(ctx context.Context) error
+}
+
+// ConnectFunc connects to the share to serve, again each time the previous
+// connection was lost.
+type ConnectFunc func(ctx context.Context) (Share, error)
+
+// Dial returns a ConnectFunc that connects to the server at address
+// (host:port), whose name is server, and serves the directory at subpath of
+// its share.
+func Dial(address, server, share, subpath string, credentials smb2.Credentials, options ...smb2.DialOption) ConnectFunc {
+	return func(ctx context.Context) (Share, error) {
+		session, err := smb2.Dial(ctx, address, server, credentials, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		tree, err := session.TreeConnect(ctx, share)
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+
+		return &treeShare{session: session, tree: tree, subpath: strings.Trim(subpath, "/")}, nil
+	}
+}
+
+type treeShare struct {
+	session *smb2.Session
+	tree    *smb2.Tree
+	subpath string
+}
+
+func (s *treeShare) Create(ctx context.Context, path string, request smb2.CreateRequest) (File, error) {
+	file, err := s.tree.Create(ctx, s.sharePath(path), request)
+	if err != nil {
+		return nil, err
+	}
+	return &treeFile{File: file, share: s}, nil
+}
+
+func (s *treeShare) Close() error {
+	_ = s.tree.Disconnect()
+	return s.session.Close()
+}
+
+// sharePath returns the path of a file relative to the root of the share.
+func (s *treeShare) sharePath(p string) string {
+	return path.Join(s.subpath, p)
+}
+
+type treeFile struct {
+	*smb2.File
+	share *treeShare
+}
+
+func (f *treeFile) Rename(ctx context.Context, path string, replace bool) error {
+	return f.File.Rename(ctx, f.share.sharePath(path), replace)
+}
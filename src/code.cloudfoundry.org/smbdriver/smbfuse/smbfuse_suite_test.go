@@ -0,0 +1,13 @@
+package smbfuse_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbfuse(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbfuse Suite")
+}
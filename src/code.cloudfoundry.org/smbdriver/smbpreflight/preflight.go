@@ -0,0 +1,151 @@
+// Package smbpreflight checks that a share can be connected to with the
+// credentials of a mount before the kernel mounts it, so that a wrong
+// password, an unreachable server and a missing share fail with errors that
+// tell them apart instead of the same mount error.
+package smbpreflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/smb2"
+)
+
+// DefaultTimeout bounds how long a check may take.
+const DefaultTimeout = 10 * time.Second
+
+// Stage is the step of connecting to a share that a check failed at.
+type Stage string
+
+const (
+	StageConnect      Stage = "connect"
+	StageNegotiate    Stage = "negotiate"
+	StageSessionSetup Stage = "session-setup"
+	StageTreeConnect  Stage = "tree-connect"
+)
+
+// Error is returned when a check fails.
+type Error struct {
+	Stage   Stage
+	Server  string
+	Address string
+	Share   string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	switch e.Stage {
+	case StageConnect:
+		return fmt.Sprintf("cannot connect to SMB server %s at %s: %v", e.Server, e.Address, e.Err)
+	case StageNegotiate:
+		return fmt.Sprintf("SMB server %s did not negotiate a dialect from 2.0.2 to 3.0.2: %v", e.Server, e.Err)
+	case StageSessionSetup:
+		return fmt.Sprintf("SMB server %s rejected the credentials: %s", e.Server, describe(e.Err))
+	case StageTreeConnect:
+		var statusErr *smb2.StatusError
+		if errors.As(e.Err, &statusErr) && statusErr.Status == smb2.StatusBadNetworkName {
+			return fmt.Sprintf("share %s does not exist on SMB server %s", e.Share, e.Server)
+		}
+		return fmt.Sprintf("cannot connect to share %s on SMB server %s: %s", e.Share, e.Server, describe(e.Err))
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Unreachable reports whether the check failed because the server could not
+// be reached, rather than because it refused the connection.
+func (e *Error) Unreachable() bool {
+	return e.Stage == StageConnect
+}
+
+// statusDescriptions explain the statuses that servers commonly fail a
+// session setup or tree connect with.
+var statusDescriptions = map[uint32]string{
+	smb2.StatusLogonFailure:       "the username or password is wrong",
+	smb2.StatusAccountRestriction: "account restrictions prevent the logon",
+	smb2.StatusPasswordExpired:    "the password has expired",
+	smb2.StatusPasswordMustChange: "the password has expired",
+	smb2.StatusAccountDisabled:    "the account is disabled",
+	smb2.StatusAccountLockedOut:   "the account is locked out",
+	smb2.StatusAccessDenied:       "access is denied",
+}
+
+func describe(err error) string {
+	var statusErr *smb2.StatusError
+	if errors.As(err, &statusErr) {
+		if description, ok := statusDescriptions[statusErr.Status]; ok {
+			return fmt.Sprintf("%s (status 0x%08x)", description, statusErr.Status)
+		}
+	}
+	return err.Error()
+}
+
+// ProbeFunc connects to share on the server at address (host:port), whose
+// name is server, and returns the negotiated dialect. It fails with an
+// *Error.
+type ProbeFunc func(ctx context.Context, address, server, share string, credentials smb2.Credentials, options ...smb2.DialOption) (uint16, error)
+
+// Probe negotiates a dialect with the server, authenticates and connects to
+// the share, and then disconnects again.
+func Probe(ctx context.Context, address, server, share string, credentials smb2.Credentials, options ...smb2.DialOption) (uint16, error) {
+	var dialect uint16
+	negotiated := false
+	options = append(options, smb2.WithNegotiated(func(d uint16) {
+		dialect = d
+		negotiated = true
+	}))
+
+	session, err := smb2.Dial(ctx, address, server, credentials, options...)
+	if err != nil {
+		stage := StageNegotiate
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			stage = StageConnect
+		} else if negotiated {
+			stage = StageSessionSetup
+		}
+		return dialect, &Error{Stage: stage, Server: server, Address: address, Share: share, Err: err}
+	}
+	defer session.Close()
+
+	tree, err := session.TreeConnect(ctx, share)
+	if err != nil {
+		return dialect, &Error{Stage: StageTreeConnect, Server: server, Address: address, Share: share, Err: err}
+	}
+	_ = tree.Disconnect()
+
+	return dialect, nil
+}
+
+// Checker checks shares with a probe within a timeout.
+type Checker struct {
+	probe   ProbeFunc
+	timeout time.Duration
+}
+
+func NewChecker(probe ProbeFunc, timeout time.Duration) *Checker {
+	return &Checker{
+		probe:   probe,
+		timeout: timeout,
+	}
+}
+
+// Check connects to share on the server at address, and returns the
+// negotiated dialect.
+func (c *Checker) Check(ctx context.Context, address, server, share string, credentials smb2.Credentials, options ...smb2.DialOption) (uint16, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	dialect, err := c.probe(ctx, address, server, share, credentials, options...)
+	var checkErr *Error
+	if errors.As(err, &checkErr) && ctx.Err() == context.DeadlineExceeded {
+		checkErr.Err = fmt.Errorf("timed out after %s", c.timeout)
+	}
+	return dialect, err
+}
@@ -0,0 +1,144 @@
+package smbpreflight_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/smb2"
+	"code.cloudfoundry.org/smbdriver/smbpreflight"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Probe", func() {
+	var credentials smb2.Credentials
+
+	BeforeEach(func() {
+		credentials = smb2.Credentials{Username: "user", Password: "secret"}
+	})
+
+	Context("when nothing listens at the address", func() {
+		var address string
+
+		BeforeEach(func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			address = listener.Addr().String()
+			listener.Close()
+		})
+
+		It("fails to connect", func() {
+			_, err := smbpreflight.Probe(context.TODO(), address, "server", "share", credentials)
+
+			var checkErr *smbpreflight.Error
+			Expect(errors.As(err, &checkErr)).To(BeTrue())
+			Expect(checkErr.Stage).To(Equal(smbpreflight.StageConnect))
+			Expect(checkErr.Unreachable()).To(BeTrue())
+			Expect(err.Error()).To(HavePrefix("cannot connect to SMB server server at " + address + ": "))
+		})
+	})
+
+	Context("when the server closes the connection", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					conn.Close()
+				}
+			}()
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("fails to negotiate", func() {
+			_, err := smbpreflight.Probe(context.TODO(), listener.Addr().String(), "server", "share", credentials)
+
+			var checkErr *smbpreflight.Error
+			Expect(errors.As(err, &checkErr)).To(BeTrue())
+			Expect(checkErr.Stage).To(Equal(smbpreflight.StageNegotiate))
+			Expect(checkErr.Unreachable()).To(BeFalse())
+			Expect(err.Error()).To(HavePrefix("SMB server server did not negotiate a dialect from 2.0.2 to 3.0.2: "))
+		})
+	})
+})
+
+var _ = Describe("Error", func() {
+	DescribeTable("describes the stage that failed",
+		func(stage smbpreflight.Stage, err error, message string) {
+			checkErr := &smbpreflight.Error{Stage: stage, Server: "fs1", Address: "10.0.0.1:445", Share: "data", Err: err}
+			Expect(checkErr).To(MatchError(message))
+			Expect(errors.Is(checkErr, err)).To(BeTrue())
+		},
+		Entry("connect", smbpreflight.StageConnect, errors.New("connection refused"),
+			"cannot connect to SMB server fs1 at 10.0.0.1:445: connection refused"),
+		Entry("negotiate", smbpreflight.StageNegotiate, errors.New("EOF"),
+			"SMB server fs1 did not negotiate a dialect from 2.0.2 to 3.0.2: EOF"),
+		Entry("wrong password", smbpreflight.StageSessionSetup, &smb2.StatusError{Command: 0x0001, Status: smb2.StatusLogonFailure},
+			"SMB server fs1 rejected the credentials: the username or password is wrong (status 0xc000006d)"),
+		Entry("locked out account", smbpreflight.StageSessionSetup, &smb2.StatusError{Command: 0x0001, Status: smb2.StatusAccountLockedOut},
+			"SMB server fs1 rejected the credentials: the account is locked out (status 0xc0000234)"),
+		Entry("other session setup failure", smbpreflight.StageSessionSetup, errors.New("the server only allowed a guest session"),
+			"SMB server fs1 rejected the credentials: the server only allowed a guest session"),
+		Entry("missing share", smbpreflight.StageTreeConnect, &smb2.StatusError{Command: 0x0003, Status: smb2.StatusBadNetworkName},
+			"share data does not exist on SMB server fs1"),
+		Entry("denied share", smbpreflight.StageTreeConnect, &smb2.StatusError{Command: 0x0003, Status: smb2.StatusAccessDenied},
+			"cannot connect to share data on SMB server fs1: access is denied (status 0xc0000022)"),
+	)
+})
+
+var _ = Describe("Checker", func() {
+	var (
+		probe   smbpreflight.ProbeFunc
+		checker *smbpreflight.Checker
+	)
+
+	JustBeforeEach(func() {
+		checker = smbpreflight.NewChecker(probe, 50*time.Millisecond)
+	})
+
+	Context("when the probe succeeds", func() {
+		BeforeEach(func() {
+			probe = func(ctx context.Context, address, server, share string, credentials smb2.Credentials, options ...smb2.DialOption) (uint16, error) {
+				Expect(address).To(Equal("10.0.0.1:445"))
+				Expect(server).To(Equal("fs1"))
+				Expect(share).To(Equal("data"))
+				Expect(credentials).To(Equal(smb2.Credentials{Username: "user"}))
+				Expect(options).To(HaveLen(1))
+				return smb2.Dialect302, nil
+			}
+		})
+
+		It("returns the negotiated dialect", func() {
+			dialect, err := checker.Check(context.TODO(), "10.0.0.1:445", "fs1", "data", smb2.Credentials{Username: "user"}, smb2.WithDialects(smb2.Dialect302))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dialect).To(Equal(uint16(smb2.Dialect302)))
+		})
+	})
+
+	Context("when the server does not answer", func() {
+		BeforeEach(func() {
+			probe = func(ctx context.Context, address, server, share string, credentials smb2.Credentials, options ...smb2.DialOption) (uint16, error) {
+				<-ctx.Done()
+				return 0, &smbpreflight.Error{Stage: smbpreflight.StageNegotiate, Server: server, Address: address, Share: share, Err: ctx.Err()}
+			}
+		})
+
+		It("gives up after the timeout", func() {
+			_, err := checker.Check(context.TODO(), "10.0.0.1:445", "fs1", "data", smb2.Credentials{})
+			Expect(err).To(MatchError("SMB server fs1 did not negotiate a dialect from 2.0.2 to 3.0.2: timed out after 50ms"))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package smbpreflight_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbpreflight(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbpreflight Suite")
+}
@@ -0,0 +1,13 @@
+package smbsnapshot_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbsnapshot(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbsnapshot Suite")
+}
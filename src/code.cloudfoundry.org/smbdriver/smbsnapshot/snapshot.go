@@ -0,0 +1,72 @@
+// Package smbsnapshot parses the "snapshot" bind parameter, which selects a
+// "Previous Versions" snapshot of the share to mount read-only.
+package smbsnapshot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const Key = "snapshot"
+
+const gmtTokenLayout = "@GMT-2006.01.02-15.04.05"
+
+// ntEpochOffset is the number of seconds between 1601-01-01, the start of
+// Windows NT time, and the Unix epoch.
+const ntEpochOffset = 11644473600
+
+var ntEpoch = time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Parse accepts an RFC 3339 timestamp, e.g. 2024-03-27T20:52:19Z, or the
+// @GMT- token shown by Windows, e.g. @GMT-2024.03.27-20.52.19. Snapshots are
+// identified to the second, so any fraction is dropped.
+func Parse(val string) (time.Time, error) {
+	var (
+		t   time.Time
+		err error
+	)
+
+	if strings.HasPrefix(strings.ToUpper(val), "@GMT-") {
+		t, err = time.Parse(gmtTokenLayout, "@GMT-"+val[len("@GMT-"):])
+	} else {
+		t, err = time.Parse(time.RFC3339, val)
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not a valid snapshot, expected a timestamp such as 2024-03-27T20:52:19Z or a token such as @GMT-2024.03.27-20.52.19", val)
+	}
+
+	t = t.UTC().Truncate(time.Second)
+	if t.Before(ntEpoch) {
+		return time.Time{}, fmt.Errorf("%s is not a valid snapshot, it is before 1601", val)
+	}
+
+	if t.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("%s is not a valid snapshot, it is in the future", val)
+	}
+
+	return t, nil
+}
+
+// NTTime returns t in the 100 nanosecond intervals since 1601 that the CIFS
+// "snapshot" mount option expects.
+func NTTime(t time.Time) uint64 {
+	return uint64(t.Unix()+ntEpochOffset) * 10000000
+}
+
+// Token returns t as the @GMT- token used by Windows.
+func Token(t time.Time) string {
+	return t.UTC().Format(gmtTokenLayout)
+}
+
+// Validate checks the snapshot option and ignores all other keys so that it
+// can be used as a mount options mask validator.
+func Validate(key string, val string) error {
+	if key != Key {
+		return nil
+	}
+
+	_, err := Parse(val)
+	return err
+}
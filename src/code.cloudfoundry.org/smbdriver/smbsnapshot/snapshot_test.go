@@ -0,0 +1,51 @@
+package smbsnapshot_test
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/smbdriver/smbsnapshot"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot", func() {
+	expected := time.Date(2024, time.March, 27, 20, 52, 19, 0, time.UTC)
+
+	DescribeTable("Parse accepts",
+		func(val string) {
+			t, err := smbsnapshot.Parse(val)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(t).To(Equal(expected))
+		},
+		Entry("an RFC 3339 timestamp", "2024-03-27T20:52:19Z"),
+		Entry("an RFC 3339 timestamp with an offset", "2024-03-27T21:52:19+01:00"),
+		Entry("an RFC 3339 timestamp with a fraction", "2024-03-27T20:52:19.75Z"),
+		Entry("a @GMT- token", "@GMT-2024.03.27-20.52.19"),
+		Entry("a lower case @gmt- token", "@gmt-2024.03.27-20.52.19"),
+	)
+
+	DescribeTable("Parse rejects",
+		func(val, expectedError string) {
+			_, err := smbsnapshot.Parse(val)
+			Expect(err).To(MatchError(ContainSubstring(expectedError)))
+		},
+		Entry("a date without a time", "2024-03-27", "2024-03-27 is not a valid snapshot, expected a timestamp"),
+		Entry("a malformed token", "@GMT-2024-03-27", "@GMT-2024-03-27 is not a valid snapshot"),
+		Entry("a time in the future", time.Now().Add(time.Hour).UTC().Format(time.RFC3339), "it is in the future"),
+		Entry("a time before NT time", "1600-12-31T23:59:59Z", "it is before 1601"),
+	)
+
+	It("converts to NT time", func() {
+		Expect(smbsnapshot.NTTime(expected)).To(Equal(uint64(133560463390000000)))
+		Expect(smbsnapshot.NTTime(time.Unix(0, 0))).To(Equal(uint64(116444736000000000)))
+	})
+
+	It("formats @GMT- tokens", func() {
+		Expect(smbsnapshot.Token(expected)).To(Equal("@GMT-2024.03.27-20.52.19"))
+	})
+
+	It("only validates the snapshot option", func() {
+		Expect(smbsnapshot.Validate("snapshot", "yesterday")).To(HaveOccurred())
+		Expect(smbsnapshot.Validate("vers", "yesterday")).To(Succeed())
+	})
+})
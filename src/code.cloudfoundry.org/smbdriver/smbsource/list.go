@@ -0,0 +1,48 @@
+package smbsource
+
+import (
+	"strings"
+)
+
+// AlternatesKey is the parameter listing other shares that hold the same
+// data as the share of a service, to fail over to when it cannot be mounted.
+const AlternatesKey = "alternate_shares"
+
+// ParseList parses a comma separated list of sources. Commas within the
+// folder of a source are kept, as long as the text after them does not
+// itself look like a source.
+func ParseList(raw string) ([]Source, error) {
+	items := []string{}
+	for _, item := range strings.Split(raw, ",") {
+		if len(items) > 0 && !looksLikeSource(item) {
+			items[len(items)-1] += "," + item
+			continue
+		}
+		items = append(items, item)
+	}
+
+	sources := []Source{}
+	for _, item := range items {
+		source, err := Parse(item)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// JoinList returns the canonical form of a list of sources.
+func JoinList(sources []Source) string {
+	items := []string{}
+	for _, source := range sources {
+		items = append(items, source.String())
+	}
+	return strings.Join(items, ",")
+}
+
+func looksLikeSource(item string) bool {
+	value := strings.TrimSpace(item)
+	return hasSchemePrefix(value) || hasUNCPrefix(value)
+}
@@ -0,0 +1,32 @@
+package smbsource_test
+
+import (
+	"code.cloudfoundry.org/smbdriver/smbsource"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("List", func() {
+	Describe("#ParseList", func() {
+		DescribeTable("accepted lists",
+			func(raw string, canonical string) {
+				sources, err := smbsource.ParseList(raw)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(smbsource.JoinList(sources)).To(Equal(canonical))
+			},
+			Entry("a single share", "//server/share", "//server/share"),
+			Entry("shares in different forms", `//a/share, \\b\share,smb://c:1445/share`, "//a/share,//b/share,//c:1445/share"),
+			Entry("a comma within a folder", "//a/share/x,y,//b/share", "//a/share/x,y,//b/share"),
+		)
+
+		It("rejects a list with an invalid share", func() {
+			_, err := smbsource.ParseList("//a/share,b/share")
+			Expect(err).To(MatchError(ContainSubstring("//a/share,b/share")))
+		})
+
+		It("rejects an empty item", func() {
+			_, err := smbsource.ParseList("//a/share,,//b/share")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package smbsource_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbsource(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbsource Suite")
+}
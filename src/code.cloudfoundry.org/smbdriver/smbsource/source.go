@@ -0,0 +1,266 @@
+// Package smbsource parses the share locations accepted by the SMB broker and
+// driver and turns them into the canonical //host/share form.
+package smbsource
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const invalidShareNameChars = `"/\[]:|<>+=;,*?`
+
+type Source struct {
+	Host  string // hostname, IPv4 or IPv6 literal (never bracketed)
+	Port  int    // 0 when the default SMB port should be used
+	Share string
+	Path  string // slash separated folder within the share, may be empty
+}
+
+// Parse accepts //host/share, \\host\share and smb://host[:port]/share
+// sources, each optionally followed by a folder within the share.
+func Parse(raw string) (Source, error) {
+	value := strings.TrimSpace(raw)
+
+	switch {
+	case value == "":
+		return Source{}, errors.New("share must not be empty")
+	case hasSchemePrefix(value):
+		return parseURL(raw, value)
+	case hasUNCPrefix(value):
+		return parseUNC(raw, strings.ReplaceAll(value, `\`, "/")[2:])
+	default:
+		return Source{}, fmt.Errorf("%q is not a valid share: expected //host/share, \\\\host\\share or smb://host/share", raw)
+	}
+}
+
+// String returns the canonical form stored by the broker. IPv6 literals are
+// bracketed when a port is present so that the value parses back unchanged.
+func (s Source) String() string {
+	host := s.Host
+	if s.Port != 0 {
+		if isIPv6(host) {
+			host = "[" + host + "]"
+		}
+		host = host + ":" + strconv.Itoa(s.Port)
+	}
+
+	return "//" + host + s.suffix()
+}
+
+// UNC returns the device string passed to mount.cifs. The port is not part
+// of a UNC path and has to be passed as the "port" mount option instead.
+func (s Source) UNC() string {
+	return "//" + s.Host + s.suffix()
+}
+
+// WithSubpath returns a copy of the source pointing at a folder below its
+// current path.
+func (s Source) WithSubpath(subpath string) (Source, error) {
+	cleaned, err := CleanPath(subpath)
+	if err != nil {
+		return Source{}, fmt.Errorf("%s is not a valid subpath: %s", subpath, err.Error())
+	}
+
+	if cleaned != "" {
+		if s.Path == "" {
+			s.Path = cleaned
+		} else {
+			s.Path = s.Path + "/" + cleaned
+		}
+	}
+
+	return s, nil
+}
+
+func (s Source) suffix() string {
+	if s.Path == "" {
+		return "/" + s.Share
+	}
+
+	return "/" + s.Share + "/" + s.Path
+}
+
+// CleanPath normalizes a folder within a share into a slash separated
+// relative path. Either slash style is accepted but ".." components, which
+// would escape the share, are rejected.
+func CleanPath(path string) (string, error) {
+	var segments []string
+
+	for _, segment := range strings.Split(strings.ReplaceAll(path, `\`, "/"), "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", errors.New("path traversal is not allowed")
+		}
+
+		if strings.IndexFunc(segment, unicode.IsControl) >= 0 {
+			return "", errors.New("control characters are not allowed")
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+func hasSchemePrefix(value string) bool {
+	lower := strings.ToLower(value)
+	return strings.HasPrefix(lower, "smb://") || strings.HasPrefix(lower, "cifs://")
+}
+
+func hasUNCPrefix(value string) bool {
+	return strings.HasPrefix(value, `\\`) || strings.HasPrefix(value, "//") ||
+		strings.HasPrefix(value, `/\`) || strings.HasPrefix(value, `\/`)
+}
+
+func parseURL(raw, value string) (Source, error) {
+	u, err := url.Parse(strings.ReplaceAll(value, `\`, "/"))
+	if err != nil {
+		return Source{}, fmt.Errorf("%q is not a valid share: %s", raw, errors.Unwrap(err))
+	}
+
+	if u.User != nil {
+		return Source{}, fmt.Errorf("%q is not a valid share: credentials must be given as username and password parameters", raw)
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return Source{}, fmt.Errorf("%q is not a valid share: query strings and fragments are not supported", raw)
+	}
+
+	source := Source{}
+	if source.Host, err = parseHost(u.Hostname()); err != nil {
+		return Source{}, fmt.Errorf("%q is not a valid share: %s", raw, err.Error())
+	}
+
+	if u.Port() != "" {
+		if source.Port, err = parsePort(u.Port()); err != nil {
+			return Source{}, fmt.Errorf("%q is not a valid share: %s", raw, err.Error())
+		}
+	}
+
+	if err := source.setShareAndPath(u.Path); err != nil {
+		return Source{}, fmt.Errorf("%q is not a valid share: %s", raw, err.Error())
+	}
+
+	return source, nil
+}
+
+func parseUNC(raw, value string) (Source, error) {
+	authority, rest, _ := strings.Cut(value, "/")
+
+	source := Source{}
+	host := authority
+
+	if strings.HasPrefix(authority, "[") {
+		end := strings.Index(authority, "]")
+		if end < 0 {
+			return Source{}, fmt.Errorf("%q is not a valid share: missing ']' in host", raw)
+		}
+
+		host = authority[1:end]
+		if port, found := strings.CutPrefix(authority[end+1:], ":"); found {
+			var err error
+			if source.Port, err = parsePort(port); err != nil {
+				return Source{}, fmt.Errorf("%q is not a valid share: %s", raw, err.Error())
+			}
+		} else if authority[end+1:] != "" {
+			return Source{}, fmt.Errorf("%q is not a valid share: unexpected %q after host", raw, authority[end+1:])
+		}
+	} else if strings.Count(authority, ":") == 1 {
+		var port string
+		host, port, _ = strings.Cut(authority, ":")
+
+		var err error
+		if source.Port, err = parsePort(port); err != nil {
+			return Source{}, fmt.Errorf("%q is not a valid share: %s", raw, err.Error())
+		}
+	}
+
+	var err error
+	if source.Host, err = parseHost(host); err != nil {
+		return Source{}, fmt.Errorf("%q is not a valid share: %s", raw, err.Error())
+	}
+
+	if err := source.setShareAndPath(rest); err != nil {
+		return Source{}, fmt.Errorf("%q is not a valid share: %s", raw, err.Error())
+	}
+
+	return source, nil
+}
+
+func (s *Source) setShareAndPath(value string) error {
+	share, path, _ := strings.Cut(strings.TrimLeft(value, "/"), "/")
+
+	if share == "" {
+		return errors.New("missing share name")
+	}
+
+	if strings.ContainsAny(share, invalidShareNameChars) || strings.IndexFunc(share, unicode.IsControl) >= 0 {
+		return fmt.Errorf("share name %q contains characters that are not allowed", share)
+	}
+
+	cleaned, err := CleanPath(path)
+	if err != nil {
+		return err
+	}
+
+	s.Share = share
+	s.Path = cleaned
+	return nil
+}
+
+func parseHost(host string) (string, error) {
+	if host == "" {
+		return "", errors.New("missing host")
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.String(), nil
+	}
+
+	if strings.Contains(host, ":") {
+		return "", fmt.Errorf("host %q is not a valid IPv6 address", host)
+	}
+
+	if len(host) > 253 {
+		return "", fmt.Errorf("host %q is too long", host)
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("host %q is not a valid hostname", host)
+		}
+
+		for _, r := range label {
+			if !isHostnameChar(r) {
+				return "", fmt.Errorf("host %q contains the character %q which is not allowed", host, r)
+			}
+		}
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, ".")), nil
+}
+
+func isHostnameChar(r rune) bool {
+	return r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func parsePort(port string) (int, error) {
+	value, err := strconv.Atoi(port)
+	if err != nil || value < 1 || value > 65535 {
+		return 0, fmt.Errorf("port %q is not a valid port number", port)
+	}
+
+	return value, nil
+}
+
+func isIPv6(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.Is6()
+}
@@ -0,0 +1,87 @@
+package smbtrace
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/openzipkin/zipkin-go"
+)
+
+// persistStateSession is the lager session in which the volume driver writes
+// its state file.
+const persistStateSession = "persist-state"
+
+type tracingDriver struct {
+	dockerdriver.Driver
+	tracer *zipkin.Tracer
+}
+
+// NewDriver records a "persist-state" span each time driver writes its
+// state while it creates, mounts, unmounts or removes a volume. The volume
+// driver does not pass a context to the state file, so the span is started
+// and finished by the lager session in which it logs the write.
+func NewDriver(tracer *zipkin.Tracer, driver dockerdriver.Driver) dockerdriver.Driver {
+	return &tracingDriver{Driver: driver, tracer: tracer}
+}
+
+func (d *tracingDriver) Create(env dockerdriver.Env, createRequest dockerdriver.CreateRequest) dockerdriver.ErrorResponse {
+	return d.Driver.Create(d.env(env), createRequest)
+}
+
+func (d *tracingDriver) Mount(env dockerdriver.Env, mountRequest dockerdriver.MountRequest) dockerdriver.MountResponse {
+	return d.Driver.Mount(d.env(env), mountRequest)
+}
+
+func (d *tracingDriver) Unmount(env dockerdriver.Env, unmountRequest dockerdriver.UnmountRequest) dockerdriver.ErrorResponse {
+	return d.Driver.Unmount(d.env(env), unmountRequest)
+}
+
+func (d *tracingDriver) Remove(env dockerdriver.Env, removeRequest dockerdriver.RemoveRequest) dockerdriver.ErrorResponse {
+	return d.Driver.Remove(d.env(env), removeRequest)
+}
+
+func (d *tracingDriver) env(env dockerdriver.Env) dockerdriver.Env {
+	logger := &tracingLogger{Logger: env.Logger(), tracer: d.tracer, ctx: env.Context()}
+	return driverhttp.EnvWithLogger(logger, env)
+}
+
+type tracingLogger struct {
+	lager.Logger
+	tracer *zipkin.Tracer
+	ctx    context.Context
+	task   string
+	span   zipkin.Span
+}
+
+func (l *tracingLogger) Session(task string, data ...lager.Data) lager.Logger {
+	return &tracingLogger{Logger: l.Logger.Session(task, data...), tracer: l.tracer, ctx: l.ctx, task: task}
+}
+
+func (l *tracingLogger) WithData(data lager.Data) lager.Logger {
+	return &tracingLogger{Logger: l.Logger.WithData(data), tracer: l.tracer, ctx: l.ctx, task: l.task}
+}
+
+func (l *tracingLogger) Info(action string, data ...lager.Data) {
+	l.Logger.Info(action, data...)
+
+	if l.task != persistStateSession {
+		return
+	}
+	switch {
+	case action == "start" && l.span == nil:
+		l.span, _ = l.tracer.StartSpanFromContext(l.ctx, persistStateSession)
+	case action == "end" && l.span != nil:
+		l.span.Finish()
+		l.span = nil
+	}
+}
+
+func (l *tracingLogger) Error(action string, err error, data ...lager.Data) {
+	l.Logger.Error(action, err, data...)
+
+	if l.task == persistStateSession && l.span != nil && err != nil {
+		zipkin.TagError.Set(l.span, err.Error())
+	}
+}
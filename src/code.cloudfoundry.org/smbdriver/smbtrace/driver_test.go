@@ -0,0 +1,96 @@
+package smbtrace_test
+
+import (
+	"context"
+	"errors"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/dockerdriverfakes"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver/smbtrace"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
+)
+
+var _ = Describe("Driver", func() {
+	var (
+		spanRecorder *recorder.ReporterRecorder
+		tracer       *zipkin.Tracer
+		fakeDriver   *dockerdriverfakes.FakeDriver
+		driver       dockerdriver.Driver
+		parent       zipkin.Span
+		env          dockerdriver.Env
+	)
+
+	BeforeEach(func() {
+		spanRecorder = recorder.NewReporter()
+		var err error
+		tracer, err = smbtrace.NewTracerWithReporter(spanRecorder, 1)
+		Expect(err).NotTo(HaveOccurred())
+
+		parent = tracer.StartSpan("VolumeDriver.Mount")
+		env = driverhttp.NewHttpDriverEnv(lagertest.NewTestLogger("tracing-driver"), zipkin.NewContext(context.TODO(), parent))
+
+		fakeDriver = &dockerdriverfakes.FakeDriver{}
+		driver = smbtrace.NewDriver(tracer, fakeDriver)
+	})
+
+	persistState := func(env dockerdriver.Env, err error) {
+		logger := env.Logger().Session("mount").Session("persist-state")
+		logger.Info("start")
+		defer logger.Info("end")
+		if err != nil {
+			logger.Error("failed-to-write-state-file", err)
+		}
+	}
+
+	It("records the state persisted during a mount in the trace of the request", func() {
+		fakeDriver.MountStub = func(env dockerdriver.Env, _ dockerdriver.MountRequest) dockerdriver.MountResponse {
+			persistState(env, nil)
+			return dockerdriver.MountResponse{}
+		}
+
+		driver.Mount(env, dockerdriver.MountRequest{Name: "volume"})
+
+		spans := spanRecorder.Flush()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name).To(Equal("persist-state"))
+		Expect(spans[0].TraceID).To(Equal(parent.Context().TraceID))
+		Expect(*spans[0].ParentID).To(Equal(parent.Context().ID))
+	})
+
+	It("tags the span with the error when the state cannot be persisted", func() {
+		fakeDriver.UnmountStub = func(env dockerdriver.Env, _ dockerdriver.UnmountRequest) dockerdriver.ErrorResponse {
+			persistState(env, errors.New("disk full"))
+			return dockerdriver.ErrorResponse{Err: "disk full"}
+		}
+
+		driver.Unmount(env, dockerdriver.UnmountRequest{Name: "volume"})
+
+		spans := spanRecorder.Flush()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Tags).To(HaveKeyWithValue("error", "disk full"))
+	})
+
+	It("records nothing for other sessions", func() {
+		fakeDriver.CreateStub = func(env dockerdriver.Env, _ dockerdriver.CreateRequest) dockerdriver.ErrorResponse {
+			logger := env.Logger().Session("create")
+			logger.Info("start")
+			logger.Info("end")
+			return dockerdriver.ErrorResponse{}
+		}
+
+		driver.Create(env, dockerdriver.CreateRequest{Name: "volume"})
+		Expect(spanRecorder.Flush()).To(BeEmpty())
+	})
+
+	It("passes the other requests through", func() {
+		fakeDriver.ListReturns(dockerdriver.ListResponse{Volumes: []dockerdriver.VolumeInfo{{Name: "volume"}}})
+
+		Expect(driver.List(env).Volumes).To(HaveLen(1))
+		Expect(fakeDriver.ListCallCount()).To(Equal(1))
+	})
+})
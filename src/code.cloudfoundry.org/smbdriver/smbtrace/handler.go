@@ -0,0 +1,22 @@
+package smbtrace
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/middleware/http"
+)
+
+// NewHandler records a server span for each request to handler, as a child
+// of the B3 trace context in the request headers when volman sends one. The
+// span is named after the endpoint, such as VolumeDriver.Mount.
+func NewHandler(tracer *zipkin.Tracer, handler http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if span := zipkin.SpanFromContext(req.Context()); span != nil {
+			span.SetName(strings.TrimPrefix(req.URL.Path, "/"))
+		}
+		handler.ServeHTTP(w, req)
+	})
+	return zipkinhttp.NewServerMiddleware(tracer)(named)
+}
@@ -0,0 +1,13 @@
+package smbtrace_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbtrace(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbtrace Suite")
+}
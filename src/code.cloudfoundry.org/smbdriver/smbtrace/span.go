@@ -0,0 +1,23 @@
+package smbtrace
+
+import (
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"github.com/openzipkin/zipkin-go"
+)
+
+// StartSpan starts a span that is a child of the span in the context of env,
+// and returns it with an env whose context carries it. The span is the root
+// of a new trace when env carries none.
+func StartSpan(tracer *zipkin.Tracer, env dockerdriver.Env, name string) (zipkin.Span, dockerdriver.Env) {
+	span, ctx := tracer.StartSpanFromContext(env.Context(), name)
+	return span, driverhttp.EnvWithContext(ctx, env)
+}
+
+// FinishSpan tags span with err, if any, and finishes it.
+func FinishSpan(span zipkin.Span, err error) {
+	if err != nil {
+		zipkin.TagError.Set(span, err.Error())
+	}
+	span.Finish()
+}
@@ -0,0 +1,124 @@
+// Package smbtrace records zipkin spans for the requests that the smbdriver
+// serves, from the trace context that volman sends with them down to the
+// mount.cifs invocations.
+package smbtrace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/reporter"
+	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+)
+
+const (
+	// ExporterNone records no spans.
+	ExporterNone = ""
+	// ExporterZipkin sends spans to the zipkin collector at the endpoint.
+	ExporterZipkin = "zipkin"
+	// ExporterLog writes each span to stderr as a line of JSON.
+	ExporterLog = "log"
+
+	// DefaultEndpoint is the span endpoint of a local zipkin collector.
+	DefaultEndpoint = "http://127.0.0.1:9411/api/v2/spans"
+
+	// ServiceName is the name of the smbdriver in the spans it records.
+	ServiceName = "smbdriver"
+)
+
+// Config configures the exporter of the spans and which traces are sampled.
+// SampleRate only applies to the traces that the smbdriver starts, requests
+// made with a trace context keep the sampling decision of the caller.
+type Config struct {
+	Exporter   string
+	Endpoint   string
+	SampleRate float64
+}
+
+// NewTracer returns a tracer that exports its spans as configured, and the
+// reporter to close when the smbdriver exits.
+func NewTracer(config Config) (*zipkin.Tracer, reporter.Reporter, error) {
+	var rep reporter.Reporter
+	switch config.Exporter {
+	case ExporterNone:
+		return NewNoopTracer(), reporter.NewNoopReporter(), nil
+	case ExporterZipkin:
+		endpoint := config.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultEndpoint
+		}
+		rep = zipkinhttp.NewReporter(endpoint)
+	case ExporterLog:
+		rep = NewLogReporter(os.Stderr)
+	default:
+		return nil, nil, fmt.Errorf("invalid trace exporter %q: must be %s or %s", config.Exporter, ExporterZipkin, ExporterLog)
+	}
+
+	tracer, err := NewTracerWithReporter(rep, config.SampleRate)
+	if err != nil {
+		rep.Close()
+		return nil, nil, err
+	}
+	return tracer, rep, nil
+}
+
+// NewTracerWithReporter returns a tracer that sends its spans to rep, such as
+// an in-memory recorder in tests.
+func NewTracerWithReporter(rep reporter.Reporter, sampleRate float64) (*zipkin.Tracer, error) {
+	sampler, err := zipkin.NewCountingSampler(sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trace sample rate: %s", err)
+	}
+
+	endpoint, err := zipkin.NewEndpoint(ServiceName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return zipkin.NewTracer(
+		rep,
+		zipkin.WithLocalEndpoint(endpoint),
+		zipkin.WithSampler(sampler),
+		zipkin.WithSharedSpans(false),
+	)
+}
+
+// NewNoopTracer returns a tracer that records nothing.
+func NewNoopTracer() *zipkin.Tracer {
+	tracer, err := zipkin.NewTracer(reporter.NewNoopReporter(), zipkin.WithNoopTracer(true))
+	if err != nil {
+		panic(err)
+	}
+	return tracer
+}
+
+type logReporter struct {
+	mutex sync.Mutex
+	out   io.Writer
+}
+
+// NewLogReporter writes each span to out as a line of JSON in the zipkin v2
+// format.
+func NewLogReporter(out io.Writer) reporter.Reporter {
+	return &logReporter{out: out}
+}
+
+func (r *logReporter) Send(span model.SpanModel) {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	fmt.Fprintf(r.out, "%s\n", line)
+}
+
+func (r *logReporter) Close() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+package smbtrace_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/smbdriver/smbtrace"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/reporter/recorder"
+)
+
+var _ = Describe("Tracer", func() {
+	Describe("NewTracer", func() {
+		It("records nothing without an exporter", func() {
+			tracer, rep, err := smbtrace.NewTracer(smbtrace.Config{})
+			Expect(err).NotTo(HaveOccurred())
+			defer rep.Close()
+
+			span := tracer.StartSpan("VolumeDriver.Mount")
+			Expect(zipkin.IsNoop(span)).To(BeTrue())
+		})
+
+		It("exports to zipkin", func() {
+			tracer, rep, err := smbtrace.NewTracer(smbtrace.Config{Exporter: smbtrace.ExporterZipkin, SampleRate: 1})
+			Expect(err).NotTo(HaveOccurred())
+			defer rep.Close()
+
+			Expect(zipkin.IsNoop(tracer.StartSpan("VolumeDriver.Mount"))).To(BeFalse())
+		})
+
+		It("rejects an unknown exporter", func() {
+			_, _, err := smbtrace.NewTracer(smbtrace.Config{Exporter: "jaeger"})
+			Expect(err).To(MatchError(`invalid trace exporter "jaeger": must be zipkin or log`))
+		})
+
+		It("rejects a sample rate that is not between 0 and 1", func() {
+			_, _, err := smbtrace.NewTracer(smbtrace.Config{Exporter: smbtrace.ExporterLog, SampleRate: 2})
+			Expect(err).To(MatchError(ContainSubstring("invalid trace sample rate")))
+		})
+	})
+
+	Describe("NewLogReporter", func() {
+		It("writes each span as a line of JSON", func() {
+			out := gbytes.NewBuffer()
+			tracer, err := smbtrace.NewTracerWithReporter(smbtrace.NewLogReporter(out), 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			tracer.StartSpan("VolumeDriver.Mount").Finish()
+			tracer.StartSpan("VolumeDriver.Unmount").Finish()
+
+			Expect(out).To(gbytes.Say(`{"timestamp":\d+,"duration":\d+,"traceId":"[0-9a-f]+","id":"[0-9a-f]+","name":"volumedriver.mount","localEndpoint":{"serviceName":"smbdriver"}}\n`))
+			Expect(out).To(gbytes.Say(`"name":"volumedriver.unmount"`))
+		})
+	})
+
+	Describe("NewHandler", func() {
+		var (
+			spanRecorder *recorder.ReporterRecorder
+			handler      http.Handler
+			served       zipkin.Span
+		)
+
+		BeforeEach(func() {
+			spanRecorder = recorder.NewReporter()
+			tracer, err := smbtrace.NewTracerWithReporter(spanRecorder, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			served = nil
+			handler = smbtrace.NewHandler(tracer, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				served = zipkin.SpanFromContext(req.Context())
+			}))
+		})
+
+		It("continues the trace of the caller", func() {
+			req := httptest.NewRequest("POST", "/VolumeDriver.Mount", nil)
+			req.Header.Set("X-B3-TraceId", "463ac35c9f6413ad48485a3953bb6124")
+			req.Header.Set("X-B3-SpanId", "a2fb4a1d1a96d312")
+			req.Header.Set("X-B3-Sampled", "1")
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			Expect(served).NotTo(BeNil())
+
+			spans := spanRecorder.Flush()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name).To(Equal("VolumeDriver.Mount"))
+			Expect(spans[0].TraceID.String()).To(Equal("463ac35c9f6413ad48485a3953bb6124"))
+			Expect(spans[0].ParentID.String()).To(Equal("a2fb4a1d1a96d312"))
+			Expect(spans[0].ID).To(Equal(served.Context().ID))
+		})
+
+		It("keeps the sampling decision of the caller", func() {
+			req := httptest.NewRequest("POST", "/VolumeDriver.Mount", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			Expect(served).NotTo(BeNil())
+			Expect(spanRecorder.Flush()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package smbtuning
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Profiles maps a profile name to the tuning options it stands for.
+type Profiles map[string]map[string]string
+
+// LoadProfiles reads a JSON object of named profiles, e.g.
+// {"bulk-read": {"cache": "loose", "rsize": "4194304"}}. An empty path
+// yields no profiles.
+func LoadProfiles(path string) (Profiles, error) {
+	if path == "" {
+		return Profiles{}, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := Profiles{}
+	if err := json.Unmarshal(contents, &profiles); err != nil {
+		return nil, fmt.Errorf("cannot parse tuning profiles %s: %s", path, err.Error())
+	}
+
+	if err := profiles.validate(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// Apply replaces the "profile" option with the options of the named profile.
+// Options set explicitly by the binding take precedence over the profile.
+func (p Profiles) Apply(mountOpts map[string]interface{}) error {
+	val, ok := mountOpts[ProfileKey]
+	if !ok {
+		return nil
+	}
+	delete(mountOpts, ProfileKey)
+
+	name := fmt.Sprintf("%v", val)
+	profile, ok := p[name]
+	if !ok {
+		return fmt.Errorf("tuning profile %s is not defined, available profiles are: %s", name, p.names())
+	}
+
+	for key, val := range profile {
+		if _, ok := mountOpts[key]; !ok {
+			mountOpts[key] = val
+		}
+	}
+
+	return nil
+}
+
+func (p Profiles) validate() error {
+	for name, options := range p {
+		if err := Validate(ProfileKey, name); err != nil {
+			return err
+		}
+
+		for key, val := range options {
+			if !isTuningKey(key) {
+				return fmt.Errorf("tuning profile %s sets %s, which is not a tuning option", name, key)
+			}
+
+			if err := Validate(key, val); err != nil {
+				return fmt.Errorf("tuning profile %s: %s", name, err.Error())
+			}
+		}
+
+		if options["hard"] == "true" && options["soft"] == "true" {
+			return fmt.Errorf("tuning profile %s: hard and soft cannot be used together", name)
+		}
+	}
+
+	return nil
+}
+
+func (p Profiles) names() string {
+	if len(p) == 0 {
+		return "none"
+	}
+
+	names := []string{}
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+func isTuningKey(key string) bool {
+	for _, k := range Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package smbtuning_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/smbdriver/smbtuning"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profiles", func() {
+	Describe("LoadProfiles", func() {
+		var (
+			path     string
+			contents string
+			profiles smbtuning.Profiles
+			err      error
+		)
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "tuning_profiles.json")
+		})
+
+		JustBeforeEach(func() {
+			Expect(os.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+			profiles, err = smbtuning.LoadProfiles(path)
+		})
+
+		Context("with valid profiles", func() {
+			BeforeEach(func() {
+				contents = `{"bulk-read": {"cache": "loose", "rsize": "4194304"}, "build-cache": {"actimeo": "60", "nobrl": "true"}}`
+			})
+
+			It("returns them", func() {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(profiles).To(Equal(smbtuning.Profiles{
+					"bulk-read":   {"cache": "loose", "rsize": "4194304"},
+					"build-cache": {"actimeo": "60", "nobrl": "true"},
+				}))
+			})
+		})
+
+		Context("when a profile sets an option that is not a tuning option", func() {
+			BeforeEach(func() {
+				contents = `{"bulk-read": {"username": "admin"}}`
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError("tuning profile bulk-read sets username, which is not a tuning option"))
+			})
+		})
+
+		Context("when a profile sets an invalid value", func() {
+			BeforeEach(func() {
+				contents = `{"bulk-read": {"cache": "fast"}}`
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("tuning profile bulk-read: fast is not a valid value for cache")))
+			})
+		})
+
+		Context("when a profile sets both hard and soft", func() {
+			BeforeEach(func() {
+				contents = `{"resilient": {"hard": "true", "soft": "true"}}`
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError("tuning profile resilient: hard and soft cannot be used together"))
+			})
+		})
+
+		Context("when the file is not JSON", func() {
+			BeforeEach(func() {
+				contents = `bulk-read: {}`
+			})
+
+			It("errors", func() {
+				Expect(err).To(MatchError(ContainSubstring("cannot parse tuning profiles")))
+			})
+		})
+
+		Context("when no path is given", func() {
+			It("returns no profiles", func() {
+				profiles, err := smbtuning.LoadProfiles("")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(profiles).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("#Apply", func() {
+		var profiles smbtuning.Profiles
+
+		BeforeEach(func() {
+			profiles = smbtuning.Profiles{"bulk-read": {"cache": "loose", "rsize": "4194304"}}
+		})
+
+		It("replaces the profile option with the profile's options", func() {
+			mountOpts := map[string]interface{}{"profile": "bulk-read", "vers": "3.0"}
+			Expect(profiles.Apply(mountOpts)).To(Succeed())
+			Expect(mountOpts).To(Equal(map[string]interface{}{"cache": "loose", "rsize": "4194304", "vers": "3.0"}))
+		})
+
+		It("keeps options set by the binding", func() {
+			mountOpts := map[string]interface{}{"profile": "bulk-read", "rsize": "65536"}
+			Expect(profiles.Apply(mountOpts)).To(Succeed())
+			Expect(mountOpts).To(HaveKeyWithValue("rsize", "65536"))
+			Expect(mountOpts).To(HaveKeyWithValue("cache", "loose"))
+		})
+
+		It("does nothing without a profile option", func() {
+			mountOpts := map[string]interface{}{"vers": "3.0"}
+			Expect(profiles.Apply(mountOpts)).To(Succeed())
+			Expect(mountOpts).To(Equal(map[string]interface{}{"vers": "3.0"}))
+		})
+
+		It("errors on an unknown profile", func() {
+			Expect(profiles.Apply(map[string]interface{}{"profile": "media"})).To(MatchError("tuning profile media is not defined, available profiles are: bulk-read"))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package smbtuning_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSmbtuning(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Smbtuning Suite")
+}
@@ -0,0 +1,127 @@
+// Package smbtuning validates the CIFS performance tuning options accepted by
+// the SMB broker and driver, and holds the operator defined tuning profiles
+// that bindings can refer to by name.
+package smbtuning
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const ProfileKey = "profile"
+
+// Keys lists the tuning mount options, in the order they are documented.
+var Keys = []string{"cache", "actimeo", "rsize", "wsize", "nobrl", "hard", "soft", "echo_interval", "multichannel", "max_channels"}
+
+var cacheModes = []string{"strict", "none", "loose", "ro", "singleclient"}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type integerRange struct {
+	min, max, multipleOf int64
+	unit                 string
+}
+
+var integerOptions = map[string]integerRange{
+	"actimeo":       {min: 0, max: 86400, unit: "seconds"},
+	"rsize":         {min: 4096, max: 8388608, multipleOf: 4096, unit: "bytes"},
+	"wsize":         {min: 4096, max: 8388608, multipleOf: 4096, unit: "bytes"},
+	"echo_interval": {min: 1, max: 600, unit: "seconds"},
+	"max_channels":  {min: 1, max: 16},
+}
+
+var flagOptions = []string{"nobrl", "hard", "soft", "multichannel"}
+
+// Validate checks a single tuning option or profile name. Keys that are not
+// tuning options are ignored so that it can be used as a mount options mask
+// validator.
+func Validate(key string, val string) error {
+	if key == "cache" {
+		for _, mode := range cacheModes {
+			if val == mode {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s is not a valid value for cache, expected one of %s", val, strings.Join(cacheModes, ", "))
+	}
+
+	if key == ProfileKey {
+		if !profileNamePattern.MatchString(val) {
+			return fmt.Errorf("%s is not a valid profile name", val)
+		}
+		return nil
+	}
+
+	if r, ok := integerOptions[key]; ok {
+		_, err := r.parse(key, val)
+		return err
+	}
+
+	for _, flag := range flagOptions {
+		if key == flag {
+			if val == "true" {
+				return nil
+			}
+			return fmt.Errorf("%s is not a valid value for %s", val, key)
+		}
+	}
+
+	return nil
+}
+
+// Normalize rewrites the integer tuning options in place into the plain
+// decimal form expected by mount.cifs. Numbers given as JSON parameters reach
+// the driver in Go's float formatting, e.g. "1.048576e+06".
+func Normalize(mountOpts map[string]interface{}) error {
+	for key, r := range integerOptions {
+		val, ok := mountOpts[key]
+		if !ok {
+			continue
+		}
+
+		n, err := r.parse(key, fmt.Sprintf("%v", val))
+		if err != nil {
+			return err
+		}
+		mountOpts[key] = strconv.FormatInt(n, 10)
+	}
+
+	if isSet(mountOpts, "hard") && isSet(mountOpts, "soft") {
+		return fmt.Errorf("hard and soft cannot be used together")
+	}
+
+	return nil
+}
+
+func (r integerRange) parse(key, val string) (int64, error) {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%s is not a valid value for %s, expected an integer", val, key)
+	}
+
+	n := int64(f)
+	if n < r.min || n > r.max {
+		return 0, fmt.Errorf("%s is not a valid value for %s, expected %d to %d%s", val, key, r.min, r.max, r.unitSuffix())
+	}
+
+	if r.multipleOf != 0 && n%r.multipleOf != 0 {
+		return 0, fmt.Errorf("%s is not a valid value for %s, expected a multiple of %d", val, key, r.multipleOf)
+	}
+
+	return n, nil
+}
+
+func (r integerRange) unitSuffix() string {
+	if r.unit == "" {
+		return ""
+	}
+	return " " + r.unit
+}
+
+func isSet(mountOpts map[string]interface{}, key string) bool {
+	val, ok := mountOpts[key]
+	return ok && (val == "true" || val == "")
+}
@@ -0,0 +1,58 @@
+package smbtuning_test
+
+import (
+	"code.cloudfoundry.org/smbdriver/smbtuning"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tuning options", func() {
+	DescribeTable("Validate accepts",
+		func(key, val string) {
+			Expect(smbtuning.Validate(key, val)).To(Succeed())
+		},
+		Entry("a cache mode", "cache", "loose"),
+		Entry("actimeo of zero", "actimeo", "0"),
+		Entry("an rsize in bytes", "rsize", "4194304"),
+		Entry("a wsize given as a JSON number", "wsize", "1.048576e+06"),
+		Entry("nobrl", "nobrl", "true"),
+		Entry("hard", "hard", "true"),
+		Entry("soft", "soft", "true"),
+		Entry("an echo interval", "echo_interval", "60"),
+		Entry("multichannel", "multichannel", "true"),
+		Entry("max_channels", "max_channels", "4"),
+		Entry("a profile name", "profile", "bulk-read"),
+		Entry("options that are not tuning options", "vers", "anything"),
+	)
+
+	DescribeTable("Validate rejects",
+		func(key, val, expectedError string) {
+			Expect(smbtuning.Validate(key, val)).To(MatchError(expectedError))
+		},
+		Entry("an unknown cache mode", "cache", "fast", "fast is not a valid value for cache, expected one of strict, none, loose, ro, singleclient"),
+		Entry("a negative actimeo", "actimeo", "-1", "-1 is not a valid value for actimeo, expected 0 to 86400 seconds"),
+		Entry("a fractional rsize", "rsize", "4096.5", "4096.5 is not a valid value for rsize, expected an integer"),
+		Entry("a huge wsize", "wsize", "16777216", "16777216 is not a valid value for wsize, expected 4096 to 8388608 bytes"),
+		Entry("an unaligned rsize", "rsize", "5000", "5000 is not a valid value for rsize, expected a multiple of 4096"),
+		Entry("a zero echo interval", "echo_interval", "0", "0 is not a valid value for echo_interval, expected 1 to 600 seconds"),
+		Entry("too many channels", "max_channels", "17", "17 is not a valid value for max_channels, expected 1 to 16"),
+		Entry("nobrl=false", "nobrl", "false", "false is not a valid value for nobrl"),
+		Entry("a profile name with a slash", "profile", "../bulk", "../bulk is not a valid profile name"),
+	)
+
+	Describe("Normalize", func() {
+		It("writes integer options in decimal form", func() {
+			mountOpts := map[string]interface{}{"rsize": "1.048576e+06", "actimeo": "30", "cache": "loose"}
+			Expect(smbtuning.Normalize(mountOpts)).To(Succeed())
+			Expect(mountOpts).To(Equal(map[string]interface{}{"rsize": "1048576", "actimeo": "30", "cache": "loose"}))
+		})
+
+		It("rejects hard and soft together", func() {
+			Expect(smbtuning.Normalize(map[string]interface{}{"hard": "true", "soft": "true"})).To(MatchError("hard and soft cannot be used together"))
+		})
+
+		It("rejects out of range values", func() {
+			Expect(smbtuning.Normalize(map[string]interface{}{"max_channels": "0"})).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,34 @@
+package smbdriver
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// readStateFile decodes the state saved at path into state. A missing file
+// leaves state as it is.
+func readStateFile(path string, state interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, state)
+}
+
+// writeStateFile saves state at path. The new state replaces the previous
+// one in a single rename, so that a crash leaves one or the other.
+func writeStateFile(path string, state interface{}) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver
+
+import "golang.org/x/sys/unix"
+
+// Statfs returns the disk usage of the file system mounted at path. Free
+// bytes are those available to unprivileged users.
+func Statfs(path string) (DiskUsage, error) {
+	var buf unix.Statfs_t
+	if err := unix.Statfs(path, &buf); err != nil {
+		return DiskUsage{}, err
+	}
+
+	blockSize := uint64(buf.Bsize)
+	return DiskUsage{
+		TotalBytes:  buf.Blocks * blockSize,
+		FreeBytes:   buf.Bavail * blockSize,
+		UsedBytes:   (buf.Blocks - buf.Bfree) * blockSize,
+		TotalInodes: buf.Files,
+		FreeInodes:  buf.Ffree,
+	}, nil
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver_test
+
+import (
+	"os"
+
+	"code.cloudfoundry.org/smbdriver"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Statfs", func() {
+	It("returns the usage of a file system", func() {
+		usage, err := smbdriver.Statfs(os.TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(usage.TotalBytes).To(BeNumerically(">", 0))
+		Expect(usage.TotalBytes).To(BeNumerically(">=", usage.UsedBytes))
+	})
+
+	It("fails for a missing path", func() {
+		_, err := smbdriver.Statfs("/does/not/exist")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,28 @@
+package smbdriver
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/smbdriver/smbsource"
+)
+
+const subpathKey = "subpath"
+
+func sourcesWithSubpath(sources []smbsource.Source, opts map[string]interface{}) ([]smbsource.Source, error) {
+	value, ok := opts[subpathKey]
+	if !ok {
+		return sources, nil
+	}
+	delete(opts, subpathKey)
+
+	withSubpath := []smbsource.Source{}
+	for _, source := range sources {
+		s, err := source.WithSubpath(fmt.Sprintf("%v", value))
+		if err != nil {
+			return nil, err
+		}
+		withSubpath = append(withSubpath, s)
+	}
+
+	return withSubpath, nil
+}
@@ -0,0 +1,195 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/tedsuo/ifrit"
+)
+
+// DefaultUnixSocketMode lets the owner and group of the socket use the
+// driver API.
+const DefaultUnixSocketMode os.FileMode = 0660
+
+// UnixSocket configures the unix socket that the driver API is served on.
+type UnixSocket struct {
+	Path  string
+	Owner string // user name or uid, the user of the driver when empty
+	Group string // group name or gid, the group of the driver when empty
+	Mode  os.FileMode
+
+	// DiscoveryPath is where volman looks for the socket, for example
+	// <driversPath>/smbdriver.sock. It is linked to Path when they differ.
+	DiscoveryPath string
+}
+
+type unixSocketServer struct {
+	logger  lager.Logger
+	socket  UnixSocket
+	handler http.Handler
+}
+
+// NewUnixSocketServer serves handler on a unix socket until signalled. A
+// socket left behind by an earlier run is removed, but not one that another
+// process still serves on.
+func NewUnixSocketServer(logger lager.Logger, socket UnixSocket, handler http.Handler) ifrit.Runner {
+	return &unixSocketServer{
+		logger:  logger.Session("unix-socket-server", lager.Data{"socket": socket.Path}),
+		socket:  socket,
+		handler: handler,
+	}
+}
+
+func (s *unixSocketServer) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	uid, err := lookupUid(s.socket.Owner)
+	if err != nil {
+		return err
+	}
+
+	gid, err := lookupGid(s.socket.Group)
+	if err != nil {
+		return err
+	}
+
+	if err := removeStaleSocket(s.socket.Path); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.socket.Path), 0755); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("unix", s.socket.Path)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	if err := os.Chmod(s.socket.Path, s.socket.Mode); err != nil {
+		return err
+	}
+
+	if err := os.Chown(s.socket.Path, uid, gid); err != nil {
+		return err
+	}
+
+	linked, err := s.link()
+	if err != nil {
+		return err
+	}
+	if linked {
+		defer os.Remove(s.socket.DiscoveryPath)
+	}
+
+	server := http.Server{Handler: s.handler}
+
+	serverErrChan := make(chan error, 1)
+	go func() {
+		serverErrChan <- server.Serve(listener)
+	}()
+
+	s.logger.Info("started", lager.Data{"discovery-path": s.socket.DiscoveryPath})
+	close(ready)
+
+	select {
+	case err := <-serverErrChan:
+		return err
+	case <-signals:
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		server.Shutdown(ctx)
+		return nil
+	}
+}
+
+// link points the discovery path at the socket, replacing an earlier link
+// or socket, and reports whether it created a link.
+func (s *unixSocketServer) link() (bool, error) {
+	discoveryPath := s.socket.DiscoveryPath
+	if discoveryPath == "" || filepath.Clean(discoveryPath) == filepath.Clean(s.socket.Path) {
+		return false, nil
+	}
+
+	if info, err := os.Lstat(discoveryPath); err == nil {
+		if info.Mode()&(os.ModeSymlink|os.ModeSocket) == 0 {
+			return false, fmt.Errorf("%s exists and is not a socket", discoveryPath)
+		}
+		if err := os.Remove(discoveryPath); err != nil {
+			return false, err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(discoveryPath), 0755); err != nil {
+		return false, err
+	}
+
+	if err := os.Symlink(s.socket.Path, discoveryPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another process is serving on %s", path)
+	}
+
+	return os.Remove(path)
+}
+
+// lookupUid and lookupGid return -1, which leaves the owner or group
+// unchanged, for an empty name.
+func lookupUid(name string) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	if uid, err := strconv.Atoi(name); err == nil {
+		return uid, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+func lookupGid(name string) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	if gid, err := strconv.Atoi(name); err == nil {
+		return gid, nil
+	}
+
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
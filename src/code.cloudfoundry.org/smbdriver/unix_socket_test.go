@@ -0,0 +1,162 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package smbdriver_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"code.cloudfoundry.org/lager/v3/lagertest"
+	"code.cloudfoundry.org/smbdriver"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("UnixSocketServer", func() {
+	var (
+		dir     string
+		socket  smbdriver.UnixSocket
+		process ifrit.Process
+	)
+
+	get := func(path string) (string, error) {
+		client := http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+		resp, err := client.Get("http://unix/ping")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	BeforeEach(func() {
+		// Unix socket paths are limited to about 100 bytes, which the
+		// Ginkgo temporary directories can exceed.
+		var err error
+		dir, err = os.MkdirTemp("", "socket")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+
+		socket = smbdriver.UnixSocket{
+			Path:  filepath.Join(dir, "run", "smbdriver.sock"),
+			Owner: strconv.Itoa(os.Getuid()),
+			Group: strconv.Itoa(os.Getgid()),
+			Mode:  0640,
+		}
+	})
+
+	start := func() {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("pong"))
+		})
+		process = ifrit.Background(smbdriver.NewUnixSocketServer(lagertest.NewTestLogger("socket"), socket, handler))
+	}
+
+	stop := func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	}
+
+	It("serves on the socket with the given mode and removes it when stopped", func() {
+		start()
+		Eventually(process.Ready()).Should(BeClosed())
+
+		Expect(get(socket.Path)).To(Equal("pong"))
+
+		info, err := os.Stat(socket.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode() & os.ModeSocket).NotTo(BeZero())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+
+		stop()
+		_, err = os.Lstat(socket.Path)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("removes a stale socket", func() {
+		Expect(os.MkdirAll(filepath.Dir(socket.Path), 0755)).To(Succeed())
+		listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket.Path, Net: "unix"})
+		Expect(err).NotTo(HaveOccurred())
+		listener.SetUnlinkOnClose(false)
+		listener.Close()
+
+		start()
+		Eventually(process.Ready()).Should(BeClosed())
+		Expect(get(socket.Path)).To(Equal("pong"))
+		stop()
+	})
+
+	It("does not take over a socket that is still served", func() {
+		Expect(os.MkdirAll(filepath.Dir(socket.Path), 0755)).To(Succeed())
+		listener, err := net.Listen("unix", socket.Path)
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+
+		start()
+		Eventually(process.Wait()).Should(Receive(MatchError("another process is serving on " + socket.Path)))
+	})
+
+	It("does not remove a file that is not a socket", func() {
+		Expect(os.MkdirAll(filepath.Dir(socket.Path), 0755)).To(Succeed())
+		Expect(os.WriteFile(socket.Path, []byte("data"), 0600)).To(Succeed())
+
+		start()
+		Eventually(process.Wait()).Should(Receive(MatchError(socket.Path + " exists and is not a socket")))
+	})
+
+	It("fails for an unknown group", func() {
+		socket.Group = "no-such-group-for-smbdriver"
+
+		start()
+		Eventually(process.Wait()).Should(Receive(HaveOccurred()))
+	})
+
+	Context("with a discovery path", func() {
+		BeforeEach(func() {
+			socket.DiscoveryPath = filepath.Join(dir, "voldrivers", "smbdriver.sock")
+		})
+
+		It("links the discovery path to the socket until stopped", func() {
+			Expect(os.MkdirAll(filepath.Dir(socket.DiscoveryPath), 0755)).To(Succeed())
+			Expect(os.Symlink("/stale/smbdriver.sock", socket.DiscoveryPath)).To(Succeed())
+
+			start()
+			Eventually(process.Ready()).Should(BeClosed())
+
+			Expect(os.Readlink(socket.DiscoveryPath)).To(Equal(socket.Path))
+			Expect(get(socket.DiscoveryPath)).To(Equal("pong"))
+
+			stop()
+			_, err := os.Lstat(socket.DiscoveryPath)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		Context("that is the socket itself", func() {
+			BeforeEach(func() {
+				socket.Path = socket.DiscoveryPath
+			})
+
+			It("serves on it without a link", func() {
+				start()
+				Eventually(process.Ready()).Should(BeClosed())
+
+				info, err := os.Lstat(socket.DiscoveryPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode() & os.ModeSocket).NotTo(BeZero())
+				stop()
+			})
+		})
+	})
+})